@@ -0,0 +1,62 @@
+// main.go
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"os/signal"
+	"syscall"
+
+	"github.com/seo-crawler-app/internal/config"
+	"github.com/seo-crawler-app/pkg/agent"
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// The agent crawls sites the server cannot reach, such as intranets. It runs
+// inside the client's network, pulls the jobs of the URLs assigned to it from
+// the server and uploads the results. It needs no database access.
+func main() {
+	cfg := config.LoadAgent()
+
+	if cfg.ServerURL == "" || cfg.Token == "" {
+		log.Fatal("AGENT_SERVER_URL and AGENT_TOKEN are required")
+	}
+	serverURL, err := url.Parse(cfg.ServerURL)
+	if err != nil || serverURL.Host == "" {
+		log.Fatalf("Invalid AGENT_SERVER_URL %q", cfg.ServerURL)
+	}
+	if serverURL.Scheme != "https" && !cfg.Insecure {
+		log.Fatal("AGENT_SERVER_URL must use https, set AGENT_INSECURE=true to allow plain http")
+	}
+
+	client := agent.NewClient(cfg.ServerURL, cfg.Token)
+	crawlAgent := agent.New(client, agent.Options{
+		Concurrency:       cfg.Concurrency,
+		PollInterval:      cfg.PollInterval,
+		HeartbeatInterval: cfg.HeartbeatInterval,
+		Crawler: crawler.Options{
+			HostRequestsPerSecond: cfg.Crawler.HostRequestsPerSecond,
+			HostConcurrency:       cfg.Crawler.HostConcurrency,
+		},
+	})
+	crawlAgent.Start()
+	log.Printf("Agent polling %s", serverURL.Host)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	// Give running crawls the drain period to finish. Crawls still running
+	// after it are uploaded as interrupted and queued again by the server.
+	log.Printf("Shutting down, draining running crawls for up to %s", cfg.DrainPeriod)
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainPeriod)
+	defer cancel()
+
+	if err := crawlAgent.Shutdown(drainCtx); err != nil {
+		log.Printf("Interrupted unfinished crawls: %v", err)
+	}
+
+	log.Printf("Agent stopped")
+}
@@ -0,0 +1,99 @@
+// main.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/seo-crawler-app/internal/config"
+	"github.com/seo-crawler-app/internal/database"
+)
+
+const usage = `Usage: migrate [flags] up|down|status|redo
+
+  up      apply every pending migration
+  down    roll back the last -steps migrations
+  status  list every migration and whether it was applied
+  redo    roll back the last -steps migrations and apply them again
+
+Flags:
+`
+
+// migrate manages the database schema outside the API server, which applies
+// pending migrations on start. It connects with the same DB_* settings.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the statements instead of running them")
+	steps := flag.Int("steps", 1, "number of migrations rolled back by down and redo")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *steps < 1 {
+		log.Fatal("-steps must be at least 1")
+	}
+
+	cfg := config.Load()
+
+	dbConn, err := database.NewConnection(cfg.Database.Driver, cfg.GetDSN())
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer dbConn.Close()
+
+	migrationManager := database.NewMigrationManager(dbConn)
+	if *dryRun {
+		migrationManager.DryRun = os.Stdout
+	}
+	if err := migrationManager.Prepare(); err != nil {
+		log.Fatal("Failed to prepare migrations:", err)
+	}
+
+	var migrations []database.Migration
+	switch command := flag.Arg(0); command {
+	case "up":
+		migrations, err = migrationManager.Up()
+	case "down":
+		migrations, err = migrationManager.Down(*steps)
+	case "redo":
+		migrations, err = migrationManager.Redo(*steps)
+	case "status":
+		err = printStatus(migrationManager)
+	default:
+		log.Printf("Unknown command %q", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if flag.Arg(0) != "status" && !*dryRun {
+		log.Printf("%d migration(s) done", len(migrations))
+	}
+}
+
+// printStatus writes the status of every migration as a table
+func printStatus(migrationManager *database.MigrationManager) error {
+	status, err := migrationManager.GetMigrationStatus()
+	if err != nil {
+		return fmt.Errorf("failed to get migration status: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATUS\tAPPLIED AT\tREVERSIBLE")
+	for _, migration := range status {
+		appliedAt := "-"
+		if migration.AppliedAt != nil {
+			appliedAt = migration.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", migration.Name, migration.Status, appliedAt, migration.Reversible)
+	}
+	return w.Flush()
+}
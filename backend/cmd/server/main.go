@@ -2,19 +2,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
 
 	"github.com/seo-crawler-app/internal/api"
 	"github.com/seo-crawler-app/internal/config"
 	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/events"
+	"github.com/seo-crawler-app/internal/models"
 	"github.com/seo-crawler-app/internal/services"
+	"github.com/seo-crawler-app/pkg/blob"
 	"github.com/seo-crawler-app/pkg/crawler"
 )
 
 func main() {
 	cfg := config.Load()
 
-	dbConn, err := database.NewConnection(cfg.GetDSN())
+	dbConn, err := database.NewConnection(cfg.Database.Driver, cfg.GetDSN())
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -25,22 +33,142 @@ func main() {
 		log.Fatal("Failed to initialize database migrations:", err)
 	}
 
-	crawlRepo := database.NewCrawlRepository(dbConn)
-	userRepo := database.NewUserRepository(dbConn.DB)
+	var snapshots blob.Store
+	if cfg.Crawler.SnapshotDir != "" {
+		snapshots = blob.NewFSStore(cfg.Crawler.SnapshotDir)
+	}
+	crawlRepo := database.NewCrawlRepository(dbConn, snapshots)
+	userRepo := database.NewUserRepository(dbConn)
+
+	// Events of crawls run by separate workers reach the streams served here
+	// through the database
+	eventBus := events.NewBus()
+	eventRelay := services.NewEventRelay(database.NewEventRepository(dbConn), eventBus, services.EventRelayOptions{
+		Forward:      true,
+		PollInterval: cfg.Events.PollInterval,
+		Retention:    cfg.Events.Retention,
+	})
+	eventRelay.Start()
+
+	crawlerService := crawler.NewCrawler(crawler.Options{
+		WARCDir:               cfg.Crawler.WARCDir,
+		HostRequestsPerSecond: cfg.Crawler.HostRequestsPerSecond,
+		HostConcurrency:       cfg.Crawler.HostConcurrency,
+		Events:                eventBus,
+	})
 
-	crawlerService := crawler.NewCrawler()
+	usageRepo := database.NewUsageRepository(dbConn)
+	quotaService := services.NewQuotaService(usageRepo, models.QuotaLimits{
+		ConcurrentCrawls:   cfg.Quotas.ConcurrentCrawls,
+		CrawlsPerDay:       cfg.Quotas.CrawlsPerDay,
+		PagesPerMonth:      cfg.Quotas.PagesPerMonth,
+		LinkChecksPerCrawl: cfg.Quotas.LinkChecksPerCrawl,
+	})
+
+	// Crawls run in this process unless CRAWL_WORKERS is 0, in which case the
+	// API only enqueues jobs for separate worker processes
+	jobRepo := database.NewJobRepository(dbConn)
+	var worker services.Worker
+	var wakeWorker func()
+	if cfg.Queue.Workers > 0 {
+		worker = services.NewWorker(jobRepo, crawlRepo, crawlerService, quotaService, eventBus, services.WorkerOptions{
+			ID:                cfg.Queue.WorkerID,
+			Concurrency:       cfg.Queue.Workers,
+			PollInterval:      cfg.Queue.PollInterval,
+			LeaseDuration:     cfg.Queue.LeaseDuration,
+			HeartbeatInterval: cfg.Queue.HeartbeatInterval,
+			ReclaimInterval:   cfg.Queue.ReclaimInterval,
+			Retry: services.RetryPolicy{
+				MaxAttempts: cfg.Queue.MaxAttempts,
+				Backoff:     cfg.Queue.RetryBackoff,
+			},
+		})
+		worker.Start()
+		wakeWorker = worker.Wake
+	}
+	jobQueue := services.NewJobQueue(jobRepo, crawlRepo, eventBus, wakeWorker)
 
-	crawlService := services.NewCrawlService(crawlRepo, crawlerService)
+	scheduleRepo := database.NewScheduleRepository(dbConn)
+	scheduler := services.NewScheduler(scheduleRepo, crawlRepo, jobQueue, quotaService, cfg.Scheduler.Interval)
+	scheduler.Start()
+
+	webhookRepo := database.NewWebhookRepository(dbConn)
+	webhookDispatcher := services.NewWebhookDispatcher(webhookRepo, crawlRepo, services.RetryPolicy{
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     cfg.Webhooks.RetryBackoff,
+	}, cfg.Webhooks.PollInterval)
+	eventBus.Listen(webhookDispatcher.HandleEvent)
+	webhookDispatcher.Start()
+
+	agentRepo := database.NewAgentRepository(dbConn)
+	agentService := services.NewAgentService(agentRepo, jobRepo, crawlRepo, quotaService, eventBus, cfg.Queue.LeaseDuration, services.RetryPolicy{
+		MaxAttempts: cfg.Queue.MaxAttempts,
+		Backoff:     cfg.Queue.RetryBackoff,
+	})
+
+	retentionPolicy := models.RetentionPolicy{
+		KeepRuns:   cfg.Retention.KeepRuns,
+		MaxAgeDays: cfg.Retention.MaxAgeDays,
+	}
+	retentionRepo := database.NewRetentionRepository(dbConn)
+	janitor := services.NewJanitor(retentionRepo, crawlRepo, snapshots, services.JanitorOptions{
+		Interval:   cfg.Retention.Interval,
+		BatchSize:  cfg.Retention.BatchSize,
+		ArchiveDir: cfg.Retention.ArchiveDir,
+		WARCDir:    cfg.Crawler.WARCDir,
+		Default:    retentionPolicy,
+	})
+	janitor.Start()
+
+	crawlService := services.NewCrawlService(crawlRepo, agentRepo, crawlerService, jobQueue, quotaService, eventBus)
+	scheduleService := services.NewScheduleService(scheduleRepo, crawlRepo)
+	webhookService := services.NewWebhookService(webhookRepo, webhookDispatcher)
+	retentionService := services.NewRetentionService(retentionRepo, retentionPolicy)
 	authService := services.NewAuthService(userRepo, cfg.JWT.Secret)
 
 	authHandler := api.NewAuthHandler(authService)
-	handler := api.NewHandler(crawlService, authHandler, migrationManager)
+	handler := api.NewHandler(crawlService, scheduleService, webhookService, quotaService, agentService, retentionService, eventBus, authHandler, migrationManager)
 
-	router := api.NewRouter(handler, cfg, authService, migrationManager)
+	router := api.NewRouter(handler, cfg, authService, agentService, migrationManager)
 	app := router.SetupRoutes()
 
-	log.Printf("Server starting on :%s", cfg.Server.Port)
-	if err := app.Run(":" + cfg.Server.Port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	srv := &http.Server{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: app,
+	}
+
+	go func() {
+		log.Printf("Server starting on :%s", cfg.Server.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	// Stop taking new work, then give running crawls the drain period to
+	// finish. Crawls still running after it are recorded as interrupted and
+	// resumed on the next start.
+	log.Printf("Shutting down, draining running crawls for up to %s", cfg.Server.DrainPeriod)
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.DrainPeriod)
+	defer cancel()
+
+	scheduler.Stop()
+	janitor.Stop()
+	eventBus.Close()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		log.Printf("Failed to shut down HTTP server cleanly: %v", err)
 	}
+	jobQueue.Stop()
+	if worker != nil {
+		if err := worker.Shutdown(drainCtx); err != nil {
+			log.Printf("Interrupted unfinished crawls: %v", err)
+		}
+	}
+	eventRelay.Stop()
+
+	log.Printf("Server stopped")
 }
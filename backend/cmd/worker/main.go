@@ -0,0 +1,103 @@
+// main.go
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/seo-crawler-app/internal/config"
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/events"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/internal/services"
+	"github.com/seo-crawler-app/pkg/blob"
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// The worker runs crawls leased from the database, so crawling scales
+// independently of the API. Any number of workers can share one database.
+// Migrations are applied by the API server.
+func main() {
+	cfg := config.Load()
+
+	dbConn, err := database.NewConnection(cfg.Database.Driver, cfg.GetDSN())
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer dbConn.Close()
+
+	var snapshots blob.Store
+	if cfg.Crawler.SnapshotDir != "" {
+		snapshots = blob.NewFSStore(cfg.Crawler.SnapshotDir)
+	}
+	crawlRepo := database.NewCrawlRepository(dbConn, snapshots)
+
+	// Events feed webhooks here and reach the API streams through the database
+	eventBus := events.NewBus()
+	eventRelay := services.NewEventRelay(database.NewEventRepository(dbConn), eventBus, services.EventRelayOptions{
+		Retention: cfg.Events.Retention,
+	})
+	eventRelay.Start()
+
+	crawlerService := crawler.NewCrawler(crawler.Options{
+		WARCDir:               cfg.Crawler.WARCDir,
+		HostRequestsPerSecond: cfg.Crawler.HostRequestsPerSecond,
+		HostConcurrency:       cfg.Crawler.HostConcurrency,
+		Events:                eventBus,
+	})
+
+	usageRepo := database.NewUsageRepository(dbConn)
+	quotaService := services.NewQuotaService(usageRepo, models.QuotaLimits{
+		ConcurrentCrawls:   cfg.Quotas.ConcurrentCrawls,
+		CrawlsPerDay:       cfg.Quotas.CrawlsPerDay,
+		PagesPerMonth:      cfg.Quotas.PagesPerMonth,
+		LinkChecksPerCrawl: cfg.Quotas.LinkChecksPerCrawl,
+	})
+
+	// Webhook deliveries are logged here and sent by the API server
+	webhookRepo := database.NewWebhookRepository(dbConn)
+	webhookDispatcher := services.NewWebhookDispatcher(webhookRepo, crawlRepo, services.RetryPolicy{
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     cfg.Webhooks.RetryBackoff,
+	}, cfg.Webhooks.PollInterval)
+	eventBus.Listen(webhookDispatcher.HandleEvent)
+
+	workers := cfg.Queue.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	jobRepo := database.NewJobRepository(dbConn)
+	worker := services.NewWorker(jobRepo, crawlRepo, crawlerService, quotaService, eventBus, services.WorkerOptions{
+		ID:                cfg.Queue.WorkerID,
+		Concurrency:       workers,
+		PollInterval:      cfg.Queue.PollInterval,
+		LeaseDuration:     cfg.Queue.LeaseDuration,
+		HeartbeatInterval: cfg.Queue.HeartbeatInterval,
+		ReclaimInterval:   cfg.Queue.ReclaimInterval,
+		Retry: services.RetryPolicy{
+			MaxAttempts: cfg.Queue.MaxAttempts,
+			Backoff:     cfg.Queue.RetryBackoff,
+		},
+	})
+	worker.Start()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	// Give running crawls the drain period to finish. Crawls still running
+	// after it are recorded as interrupted and picked up by another worker.
+	log.Printf("Shutting down, draining running crawls for up to %s", cfg.Server.DrainPeriod)
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.DrainPeriod)
+	defer cancel()
+
+	if err := worker.Shutdown(drainCtx); err != nil {
+		log.Printf("Interrupted unfinished crawls: %v", err)
+	}
+	eventRelay.Stop()
+
+	log.Printf("Worker stopped")
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/internal/services"
+	"github.com/seo-crawler-app/pkg/agent"
+)
+
+// maxCompletionSize caps the result an agent uploads, which holds the page
+// snapshot base64-encoded along with its text and links
+const maxCompletionSize = 32 << 20
+
+// GetAgents lists the remote crawl agents of the current user
+func (h *handler) GetAgents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	agents, err := h.agentService.GetAgents(userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch agents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"agents": agents})
+}
+
+// CreateAgent registers a remote crawl agent and returns its token once
+func (h *handler) CreateAgent(c *gin.Context) {
+	var req models.AgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	registration, err := h.agentService.CreateAgent(userID.(int), &req)
+	if err != nil {
+		agentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, registration)
+}
+
+// DeleteAgent removes a remote crawl agent and revokes its token
+func (h *handler) DeleteAgent(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.agentService.DeleteAgent(userID.(int), c.Param("id")); err != nil {
+		agentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Agent deleted"})
+}
+
+// ClaimAgentJob hands the next job assigned to the calling agent, or
+// responds 204 when there is none
+func (h *handler) ClaimAgentJob(c *gin.Context) {
+	a := c.MustGet("agent").(*models.Agent)
+
+	job, err := h.agentService.ClaimJob(a)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if job == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// AgentHeartbeat renews the lease of a job run by the calling agent
+func (h *handler) AgentHeartbeat(c *gin.Context) {
+	a := c.MustGet("agent").(*models.Agent)
+
+	jobID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	heartbeat, err := h.agentService.Heartbeat(a, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, heartbeat)
+}
+
+// CompleteAgentJob ingests the result of a job run by the calling agent
+func (h *handler) CompleteAgentJob(c *gin.Context) {
+	a := c.MustGet("agent").(*models.Agent)
+
+	jobID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCompletionSize)
+	var completion agent.Completion
+	if err := c.ShouldBindJSON(&completion); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Result too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.agentService.CompleteJob(a, jobID, &completion); err != nil {
+		agentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Result stored"})
+}
+
+// agentError maps agent service errors to HTTP responses
+func agentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidAgent), errors.Is(err, services.ErrInvalidCompletion):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAgentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+	case errors.Is(err, services.ErrJobNotLeased):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// eventKeepAlive is how often a comment is sent on an idle event stream so
+// proxies do not close it
+const eventKeepAlive = 15 * time.Second
+
+// StreamEvents streams the progress events of every crawl of the current user
+func (h *handler) StreamEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	h.streamEvents(c, userID.(int), nil, 0)
+}
+
+// StreamResultEvents streams the progress events of a single crawl result,
+// starting with its current status
+func (h *handler) StreamResultEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result, err := h.crawlService.GetCrawlResultByID(userID.(int), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		return
+	}
+
+	current := &models.CrawlEvent{
+		Type:          models.EventStatus,
+		CrawlResultID: result.ID,
+		URL:           result.URL,
+		Status:        result.CrawlData.Status,
+		Time:          time.Now(),
+	}
+	h.streamEvents(c, userID.(int), current, result.ID)
+}
+
+// streamEvents writes the events of a user's crawls as Server-Sent Events until
+// the client disconnects. A non-zero crawlResultID limits the stream to one crawl.
+func (h *handler) streamEvents(c *gin.Context, userID int, first *models.CrawlEvent, crawlResultID int) {
+	events, unsubscribe := h.events.Subscribe(userID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	if first != nil {
+		c.SSEvent(first.Type, first)
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			if crawlResultID != 0 && event.CrawlResultID != crawlResultID {
+				return true
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		case <-h.events.Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/seo-crawler-app/internal/events"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// readEvent reads the next Server-Sent Event of a stream, skipping comments
+func readEvent(t *testing.T, r *bufio.Reader) (string, models.CrawlEvent) {
+	t.Helper()
+	var eventType string
+	var event models.CrawlEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && eventType != "":
+			return eventType, event
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event); err != nil {
+				t.Fatalf("decoding event %q: %v", line, err)
+			}
+		}
+	}
+}
+
+// openStream requests an event stream and returns its body
+func openStream(t *testing.T, server *httptest.Server, path string) *bufio.Reader {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("GET %s = %d %s, want an event stream", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestStreamResultEvents(t *testing.T) {
+	bus := events.NewBus()
+	server := httptest.NewServer(newTestRouter(t, models.QuotaLimits{}, bus))
+	defer server.Close()
+	defer bus.Close()
+
+	for _, url := range []string{"https://example.com/a", "https://example.com/b"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/crawls", strings.NewReader(`{"url": "`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		server.Config.Handler.ServeHTTP(w, req)
+		if w.Code >= 300 {
+			t.Fatalf("submit %s = %d %s", url, w.Code, w.Body)
+		}
+	}
+
+	// The stream of a result opens with its current status
+	stream := openStream(t, server, "/api/results/1/events")
+	eventType, event := readEvent(t, stream)
+	if eventType != models.EventStatus || event.CrawlResultID != 1 || event.Status != "pending" {
+		t.Fatalf("first event = %s %+v, want the pending status of result 1", eventType, event)
+	}
+
+	// Events of other results and of other users are left out, the test user
+	// being the first one
+	bus.Publish(models.CrawlEvent{Type: models.EventPageFetched, CrawlResultID: 2, UserID: 1, PagesFetched: 1})
+	bus.Publish(models.CrawlEvent{Type: models.EventPageFetched, CrawlResultID: 1, UserID: 2, PagesFetched: 2})
+	bus.Publish(models.CrawlEvent{Type: models.EventLinkChecked, CrawlResultID: 1, UserID: 1, LinksFound: 3, LinksChecked: 2, LinksFailed: 1})
+	eventType, event = readEvent(t, stream)
+	if eventType != models.EventLinkChecked || event.CrawlResultID != 1 || event.LinksChecked != 2 || event.LinksFailed != 1 {
+		t.Errorf("next event = %s %+v, want the link check of result 1", eventType, event)
+	}
+
+	// Closing the bus ends the stream
+	bus.Close()
+	if _, err := io.ReadAll(stream); err != nil {
+		t.Errorf("reading the end of the stream: %v", err)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	bus := events.NewBus()
+	server := httptest.NewServer(newTestRouter(t, models.QuotaLimits{}, bus))
+	defer server.Close()
+	defer bus.Close()
+
+	// Only events of the test user, the first one, are streamed
+	stream := openStream(t, server, "/api/events")
+	bus.Publish(models.CrawlEvent{Type: models.EventStatus, CrawlResultID: 7, UserID: 2, Status: "running"})
+	bus.Publish(models.CrawlEvent{Type: models.EventStatus, CrawlResultID: 5, UserID: 1, Status: "running"})
+	bus.Publish(models.CrawlEvent{Type: models.EventStatus, CrawlResultID: 6, UserID: 1, Status: "done"})
+
+	for _, want := range []int{5, 6} {
+		eventType, event := readEvent(t, stream)
+		if eventType != models.EventStatus || event.CrawlResultID != want {
+			t.Errorf("event = %s %+v, want the status of result %d", eventType, event, want)
+		}
+	}
+}
+
+func TestStreamResultEventsNotFound(t *testing.T) {
+	router := newTestRouter(t, models.QuotaLimits{}, events.NewBus())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/results/1/events", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("stream of an unknown result = %d, want 404", w.Code)
+	}
+}
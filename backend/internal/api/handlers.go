@@ -1,25 +1,64 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"path/filepath"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/events"
 	"github.com/seo-crawler-app/internal/models"
 	"github.com/seo-crawler-app/internal/services"
-	"github.com/seo-crawler-app/internal/database"
 )
 
 // Handler defines the interface for API handlers
 type Handler interface {
 	SubmitCrawl(c *gin.Context)
 	GetResults(c *gin.Context)
+	Search(c *gin.Context)
 	GetResultByID(c *gin.Context)
 	GetLinksByID(c *gin.Context)
 	GetHeadingsByID(c *gin.Context)
+	GetFormsByID(c *gin.Context)
+	GetSecurityByID(c *gin.Context)
+	GetIssuesByID(c *gin.Context)
+	GetResourcesByID(c *gin.Context)
+	GetRunsByID(c *gin.Context)
+	GetRunByID(c *gin.Context)
+	DiffRuns(c *gin.Context)
 	BulkRerun(c *gin.Context)
 	BulkDelete(c *gin.Context)
 	StopCrawl(c *gin.Context)
+	DownloadArchive(c *gin.Context)
+	ReplayCrawl(c *gin.Context)
+	ReanalyzeCrawl(c *gin.Context)
+	BulkReanalyze(c *gin.Context)
+	GetSnapshot(c *gin.Context)
+	GetSchedules(c *gin.Context)
+	CreateSchedule(c *gin.Context)
+	GetSchedule(c *gin.Context)
+	UpdateSchedule(c *gin.Context)
+	DeleteSchedule(c *gin.Context)
+	GetWebhooks(c *gin.Context)
+	CreateWebhook(c *gin.Context)
+	GetWebhook(c *gin.Context)
+	UpdateWebhook(c *gin.Context)
+	DeleteWebhook(c *gin.Context)
+	GetWebhookDeliveries(c *gin.Context)
+	RedeliverWebhook(c *gin.Context)
+	GetUsage(c *gin.Context)
+	GetRetention(c *gin.Context)
+	UpdateRetention(c *gin.Context)
+	GetAgents(c *gin.Context)
+	CreateAgent(c *gin.Context)
+	DeleteAgent(c *gin.Context)
+	ClaimAgentJob(c *gin.Context)
+	AgentHeartbeat(c *gin.Context)
+	CompleteAgentJob(c *gin.Context)
+	StreamEvents(c *gin.Context)
+	StreamResultEvents(c *gin.Context)
 	HealthCheck(c *gin.Context)
 	Register(c *gin.Context)
 	Login(c *gin.Context)
@@ -29,16 +68,28 @@ type Handler interface {
 
 // handler implements the Handler interface
 type handler struct {
-	crawlService services.CrawlService
-	authHandler  *AuthHandler
+	crawlService    services.CrawlService
+	scheduleService services.ScheduleService
+	webhookService  services.WebhookService
+	quotaService    services.QuotaService
+	agentService    services.AgentService
+	retentionService services.RetentionService
+	events          *events.Bus
+	authHandler     *AuthHandler
 	migrationManager *database.MigrationManager
 }
 
 // NewHandler creates a new API handler
-func NewHandler(crawlService services.CrawlService, authHandler *AuthHandler, migrationManager *database.MigrationManager) Handler {
+func NewHandler(crawlService services.CrawlService, scheduleService services.ScheduleService, webhookService services.WebhookService, quotaService services.QuotaService, agentService services.AgentService, retentionService services.RetentionService, events *events.Bus, authHandler *AuthHandler, migrationManager *database.MigrationManager) Handler {
 	return &handler{
-		crawlService: crawlService,
-		authHandler:  authHandler,
+		crawlService:    crawlService,
+		scheduleService: scheduleService,
+		webhookService:  webhookService,
+		quotaService:    quotaService,
+		agentService:    agentService,
+		retentionService: retentionService,
+		events:          events,
+		authHandler:     authHandler,
 		migrationManager: migrationManager,
 	}
 }
@@ -60,6 +111,17 @@ func (h *handler) SubmitCrawl(c *gin.Context) {
 
 
 	if err := h.crawlService.SubmitCrawl(userID.(int), &req); err != nil {
+		if quotaExceeded(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrAgentNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrJobActive) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -92,6 +154,30 @@ func (h *handler) GetResults(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// Search handles full-text search across the crawled pages of the user
+func (h *handler) Search(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	response, err := h.crawlService.Search(userID.(int), c.Query("q"), page, pageSize)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptySearch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // GetResultByID handles single result retrieval by ID
 func (h *handler) GetResultByID(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
@@ -138,6 +224,153 @@ func (h *handler) GetHeadingsByID(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"headings": headings})
 }
 
+// GetFormsByID handles forms retrieval for a specific crawl result
+func (h *handler) GetFormsByID(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+
+	forms, err := h.crawlService.GetFormsByCrawlID(userID.(int), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"forms": forms})
+}
+
+// GetSecurityByID handles HTTPS and TLS check retrieval for a specific crawl result
+func (h *handler) GetSecurityByID(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+
+	security, err := h.crawlService.GetSecurityByCrawlID(userID.(int), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Security check not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"security": security})
+}
+
+// GetIssuesByID handles issues retrieval for a specific crawl result
+func (h *handler) GetIssuesByID(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+
+	issues, err := h.crawlService.GetIssuesByCrawlID(userID.(int), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"issues": issues})
+}
+
+// GetResourcesByID handles page-weight report retrieval for a specific crawl result
+func (h *handler) GetResourcesByID(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+
+	report, err := h.crawlService.GetResourceReport(userID.(int), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetRunsByID handles run history retrieval for a specific crawl result
+func (h *handler) GetRunsByID(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+
+	runs, err := h.crawlService.GetCrawlRuns(userID.(int), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// GetRunByID handles retrieval of a single run of a crawl result
+func (h *handler) GetRunByID(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	run, err := h.crawlService.GetCrawlRun(userID.(int), c.Param("id"), c.Param("runId"))
+	if err != nil {
+		if errors.Is(err, services.ErrRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// DiffRuns handles the comparison of two runs of a crawl result
+func (h *handler) DiffRuns(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	diff, err := h.crawlService.DiffCrawlRuns(userID.(int), c.Param("id"), c.Query("from"), c.Query("to"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRunNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		case errors.Is(err, services.ErrNoRunToCompare):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
 // BulkRerun handles bulk re-crawl requests
 func (h *handler) BulkRerun(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
@@ -154,6 +387,9 @@ func (h *handler) BulkRerun(c *gin.Context) {
 	}
 
 	if err := h.crawlService.BulkRerun(userID.(int), req.URLs); err != nil {
+		if quotaExceeded(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -203,6 +439,339 @@ func (h *handler) StopCrawl(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Crawling stopped"})
 }
 
+// DownloadArchive handles WARC archive downloads for a specific crawl result
+func (h *handler) DownloadArchive(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+
+	archivePath, err := h.crawlService.GetArchivePath(userID.(int), id, c.Query("run"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrResultNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		case errors.Is(err, services.ErrRunNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		case errors.Is(err, services.ErrArchiveNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Archive not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch archive"})
+		}
+		return
+	}
+
+	c.Header("Content-Type", "application/warc")
+	c.FileAttachment(archivePath, filepath.Base(archivePath))
+}
+
+// GetSnapshot handles retrieval of the raw HTML and headers audited by a crawl
+// run. With raw=true only the HTML is returned, as plain text so that the
+// crawled page is never rendered on our origin.
+func (h *handler) GetSnapshot(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	snapshot, err := h.crawlService.GetSnapshot(userID.(int), c.Param("id"), c.Query("run"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrResultNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		case errors.Is(err, services.ErrRunNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		case errors.Is(err, services.ErrSnapshotNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch snapshot"})
+		}
+		return
+	}
+
+	if c.Query("raw") == "true" {
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", snapshot.Body)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"snapshot": snapshot, "html": string(snapshot.Body)})
+}
+
+// ReplayCrawl handles requests to re-analyze a crawl from its WARC archive
+func (h *handler) ReplayCrawl(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+
+	if err := h.crawlService.ReplayCrawl(userID.(int), id, c.Query("run")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrResultNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		case errors.Is(err, services.ErrRunNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		case errors.Is(err, services.ErrArchiveNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Archive not found"})
+		case errors.Is(err, services.ErrJobActive):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay crawl"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Replaying crawl from archive"})
+}
+
+// ReanalyzeCrawl handles requests to re-analyze a crawl from its stored snapshot
+func (h *handler) ReanalyzeCrawl(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.crawlService.ReanalyzeCrawl(userID.(int), c.Param("id"), c.Query("run")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrResultNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		case errors.Is(err, services.ErrRunNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		case errors.Is(err, services.ErrSnapshotNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+		case errors.Is(err, services.ErrJobActive):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to re-analyze crawl"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Re-analyzing crawl from snapshot"})
+}
+
+// BulkReanalyze handles bulk re-analysis requests
+func (h *handler) BulkReanalyze(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.BulkActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.crawlService.BulkReanalyze(userID.(int), req.URLs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "URLs queued for re-analysis"})
+}
+
+// GetSchedules lists the schedules of the current user
+func (h *handler) GetSchedules(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	schedules, err := h.scheduleService.GetSchedules(userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+// CreateSchedule creates a recurring crawl
+func (h *handler) CreateSchedule(c *gin.Context) {
+	var req models.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	schedule, err := h.scheduleService.CreateSchedule(userID.(int), &req)
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// GetSchedule returns a single schedule
+func (h *handler) GetSchedule(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	schedule, err := h.scheduleService.GetSchedule(userID.(int), c.Param("id"))
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule replaces the settings of a schedule
+func (h *handler) UpdateSchedule(c *gin.Context) {
+	var req models.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	schedule, err := h.scheduleService.UpdateSchedule(userID.(int), c.Param("id"), &req)
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule removes a schedule
+func (h *handler) DeleteSchedule(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.scheduleService.DeleteSchedule(userID.(int), c.Param("id")); err != nil {
+		scheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted"})
+}
+
+// scheduleError maps schedule service errors to HTTP responses
+func scheduleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// GetUsage reports the consumption of the current user against their quotas
+func (h *handler) GetUsage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	usage, err := h.quotaService.GetUsage(userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// GetRetention reports the retention policy applied to the runs of the current user
+func (h *handler) GetRetention(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	retention, err := h.retentionService.GetRetention(userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch retention policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, retention)
+}
+
+// UpdateRetention replaces the retention limits of the current user, null
+// limits falling back to the defaults
+func (h *handler) UpdateRetention(c *gin.Context) {
+	var req models.RetentionOverride
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	retention, err := h.retentionService.SetRetention(userID.(int), &req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRetention) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update retention policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, retention)
+}
+
+// quotaExceeded answers 429 with the quota detail when err is a quota error
+func quotaExceeded(c *gin.Context, err error) bool {
+	var quotaErr *services.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":     quotaErr.Error(),
+		"quota":     quotaErr.Quota,
+		"limit":     quotaErr.Limit,
+		"used":      quotaErr.Used,
+		"requested": quotaErr.Requested,
+	})
+	return true
+}
+
 // HealthCheck handles health check requests
 func (h *handler) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -226,7 +795,8 @@ func (h *handler) GetProfile(c *gin.Context) {
 	h.authHandler.GetProfile(c)
 }
 
-// GetMigrationStatus returns the status of all migrations
+// GetMigrationStatus returns the status of all migrations, listing those
+// compiled into the binary but not applied yet as pending
 func (h *handler) GetMigrationStatus(c *gin.Context) {
 	status, err := h.migrationManager.GetMigrationStatus()
 	if err != nil {
@@ -234,8 +804,16 @@ func (h *handler) GetMigrationStatus(c *gin.Context) {
 		return
 	}
 
+	pending := []models.MigrationStatus{}
+	for _, migration := range status {
+		if migration.Status == models.MigrationStatusPending {
+			pending = append(pending, migration)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"migrations": status,
+		"pending":    pending,
 		"total":      len(status),
 	})
 } 
\ No newline at end of file
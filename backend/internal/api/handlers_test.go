@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/events"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/internal/services"
+)
+
+// newTestRouter serves the crawl submission and event stream endpoints of a
+// user on a migrated SQLite database, with the given quotas
+func newTestRouter(t *testing.T, limits models.QuotaLimits, bus *events.Bus) *gin.Engine {
+	t.Helper()
+	conn, err := database.NewConnection("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewConnection: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := database.NewMigrationManager(conn).Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	now := time.Now()
+	user := &models.User{Email: "quota@example.com", Password: "x", FirstName: "Test", LastName: "User", CreatedAt: now, UpdatedAt: now}
+	if err := database.NewUserRepository(conn).CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	repo := database.NewCrawlRepository(conn, nil)
+	quotas := services.NewQuotaService(database.NewUsageRepository(conn), limits)
+	queue := services.NewJobQueue(database.NewJobRepository(conn), repo, nil, nil)
+	crawls := services.NewCrawlService(repo, database.NewAgentRepository(conn), nil, queue, quotas, nil)
+	h := NewHandler(crawls, nil, nil, quotas, nil, nil, bus, nil, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", user.ID) })
+	router.POST("/api/crawls", h.SubmitCrawl)
+	router.GET("/api/usage", h.GetUsage)
+	router.GET("/api/events", h.StreamEvents)
+	router.GET("/api/results/:id/events", h.StreamResultEvents)
+	return router
+}
+
+func TestSubmitCrawlOverQuota(t *testing.T) {
+	router := newTestRouter(t, models.QuotaLimits{CrawlsPerDay: 10, PagesPerMonth: 1}, nil)
+
+	submit := func(url string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/crawls", strings.NewReader(`{"url": "`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := submit("https://example.com/a"); w.Code >= 300 {
+		t.Fatalf("first submit = %d %s, want success", w.Code, w.Body)
+	}
+
+	w := submit("https://example.com/b")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("submit over quota = %d %s, want 429", w.Code, w.Body)
+	}
+	var body struct {
+		Quota     string `json:"quota"`
+		Limit     int    `json:"limit"`
+		Used      int    `json:"used"`
+		Requested int    `json:"requested"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if body.Quota != services.QuotaPagesPerMonth || body.Limit != 1 || body.Used != 1 || body.Requested != 1 {
+		t.Errorf("429 detail = %+v, want pages_per_month with 1 of 1 used and 1 requested", body)
+	}
+
+	// The rejected submit counted against no quota
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/usage", nil))
+	var usage models.Usage
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("decoding usage: %v", err)
+	}
+	if usage.CrawlsToday.Used != 1 || usage.PagesThisMonth.Used != 1 {
+		t.Errorf("usage = %d crawls, %d pages, want 1 of each", usage.CrawlsToday.Used, usage.PagesThisMonth.Used)
+	}
+}
@@ -14,15 +14,17 @@ type Router struct {
 	handler     Handler
 	config      *config.Config
 	authService *services.AuthService
+	agentService services.AgentService
 	migrationManager *database.MigrationManager
 }
 
 // NewRouter creates a new router instance
-func NewRouter(handler Handler, config *config.Config, authService *services.AuthService, migrationManager *database.MigrationManager) *Router {
+func NewRouter(handler Handler, config *config.Config, authService *services.AuthService, agentService services.AgentService, migrationManager *database.MigrationManager) *Router {
 	return &Router{
 		handler:     handler,
 		config:      config,
 		authService: authService,
+		agentService: agentService,
 		migrationManager: migrationManager,
 	}
 }
@@ -58,17 +60,73 @@ func (r *Router) SetupRoutes() *gin.Engine {
 	protected.GET("/results/:id", r.handler.GetResultByID)
 	protected.GET("/results/:id/links", r.handler.GetLinksByID)
 	protected.GET("/results/:id/headings", r.handler.GetHeadingsByID)
+	protected.GET("/results/:id/forms", r.handler.GetFormsByID)
+	protected.GET("/results/:id/security", r.handler.GetSecurityByID)
+	protected.GET("/results/:id/issues", r.handler.GetIssuesByID)
+	protected.GET("/results/:id/resources", r.handler.GetResourcesByID)
+	protected.GET("/results/:id/runs", r.handler.GetRunsByID)
+	protected.GET("/results/:id/runs/:runId", r.handler.GetRunByID)
+	protected.GET("/results/:id/diff", r.handler.DiffRuns)
+	protected.GET("/results/:id/warc", r.handler.DownloadArchive)
+	protected.GET("/results/:id/snapshot", r.handler.GetSnapshot)
+	protected.POST("/results/:id/replay", r.handler.ReplayCrawl)
+	protected.POST("/results/:id/reanalyze", r.handler.ReanalyzeCrawl)
 
 	// Bulk action routes
 	protected.POST("/bulk/rerun", r.handler.BulkRerun)
+	protected.POST("/bulk/reanalyze", r.handler.BulkReanalyze)
 	protected.DELETE("/bulk/delete", r.handler.BulkDelete)
 
+	// Schedule routes
+	protected.GET("/schedules", r.handler.GetSchedules)
+	protected.POST("/schedules", r.handler.CreateSchedule)
+	protected.GET("/schedules/:id", r.handler.GetSchedule)
+	protected.PUT("/schedules/:id", r.handler.UpdateSchedule)
+	protected.DELETE("/schedules/:id", r.handler.DeleteSchedule)
+
+	// Search routes
+	protected.GET("/search", r.handler.Search)
+
+	// Usage routes
+	protected.GET("/usage", r.handler.GetUsage)
+
+	// Retention routes
+	protected.GET("/retention", r.handler.GetRetention)
+	protected.PUT("/retention", r.handler.UpdateRetention)
+
+	// Webhook routes
+	protected.GET("/webhooks", r.handler.GetWebhooks)
+	protected.POST("/webhooks", r.handler.CreateWebhook)
+	protected.GET("/webhooks/:id", r.handler.GetWebhook)
+	protected.PUT("/webhooks/:id", r.handler.UpdateWebhook)
+	protected.DELETE("/webhooks/:id", r.handler.DeleteWebhook)
+	protected.GET("/webhooks/:id/deliveries", r.handler.GetWebhookDeliveries)
+	protected.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", r.handler.RedeliverWebhook)
+
+	// Remote crawl agent routes
+	protected.GET("/agents", r.handler.GetAgents)
+	protected.POST("/agents", r.handler.CreateAgent)
+	protected.DELETE("/agents/:id", r.handler.DeleteAgent)
+
 	// Control routes
 	protected.POST("/stop/:id", r.handler.StopCrawl)
 
 	// User profile route
 	protected.GET("/profile", r.handler.GetProfile)
 
+	// Event stream routes, authenticated by header or query parameter
+	streams := router.Group("/api")
+	streams.Use(middleware.StreamAuthMiddleware(r.authService))
+	streams.GET("/events", r.handler.StreamEvents)
+	streams.GET("/results/:id/events", r.handler.StreamResultEvents)
+
+	// Job routes used by remote crawl agents, authenticated by agent token
+	agents := router.Group("/api/agent")
+	agents.Use(middleware.AgentAuthMiddleware(r.agentService))
+	agents.POST("/jobs/claim", r.handler.ClaimAgentJob)
+	agents.POST("/jobs/:id/heartbeat", r.handler.AgentHeartbeat)
+	agents.POST("/jobs/:id/complete", r.handler.CompleteAgentJob)
+
 	router.OPTIONS("/*path", func(c *gin.Context) {
 	    c.Status(204)
 	})
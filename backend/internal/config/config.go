@@ -2,29 +2,45 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"time"
 )
 
 // Config holds application configuration
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	API      APIConfig
-	JWT      JWTConfig
+	Database  DatabaseConfig
+	Server    ServerConfig
+	API       APIConfig
+	JWT       JWTConfig
+	Crawler   CrawlerConfig
+	Queue     QueueConfig
+	Scheduler SchedulerConfig
+	Webhooks  WebhookConfig
+	Events    EventConfig
+	Quotas    QuotaConfig
+	Retention RetentionConfig
 }
 
-// DatabaseConfig holds database configuration
+// DatabaseConfig holds database configuration. Driver is "mysql", "postgres"
+// or "sqlite", SQLite keeps the whole database in the file at Path.
 type DatabaseConfig struct {
+	Driver   string
+	Path     string
 	Host     string
 	Port     string
 	User     string
 	Password string
 	Database string
+	SSLMode  string
 }
 
 // ServerConfig holds server configuration
 type ServerConfig struct {
-	Port string
+	Port        string
+	DrainPeriod time.Duration
 }
 
 // APIConfig holds API configuration
@@ -37,18 +53,97 @@ type JWTConfig struct {
 	Secret string
 }
 
+// CrawlerConfig holds crawler configuration
+type CrawlerConfig struct {
+	WARCDir               string
+	SnapshotDir           string
+	HostRequestsPerSecond float64
+	HostConcurrency       int
+}
+
+// QueueConfig holds crawl job queue configuration
+type QueueConfig struct {
+	Workers           int
+	WorkerID          string
+	PollInterval      time.Duration
+	LeaseDuration     time.Duration
+	HeartbeatInterval time.Duration
+	ReclaimInterval   time.Duration
+	MaxAttempts       int
+	RetryBackoff      time.Duration
+}
+
+// SchedulerConfig holds recurring crawl scheduler configuration
+type SchedulerConfig struct {
+	Interval time.Duration
+}
+
+// WebhookConfig holds outgoing webhook delivery configuration
+type WebhookConfig struct {
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	PollInterval time.Duration
+}
+
+// EventConfig holds the relay of crawl events between processes sharing the database
+type EventConfig struct {
+	PollInterval time.Duration
+	Retention    time.Duration
+}
+
+// QuotaConfig holds the per-user limits, zero meaning unlimited
+type QuotaConfig struct {
+	ConcurrentCrawls   int
+	CrawlsPerDay       int
+	PagesPerMonth      int
+	LinkChecksPerCrawl int
+}
+
+// RetentionConfig holds the default retention policy, zero limits keeping runs
+// forever, and the janitor enforcing it. ArchiveDir, when set, receives a
+// compressed JSON copy of every purged run.
+type RetentionConfig struct {
+	KeepRuns   int
+	MaxAgeDays int
+	Interval   time.Duration
+	BatchSize  int
+	ArchiveDir string
+}
+
+// AgentConfig holds remote crawl agent configuration
+type AgentConfig struct {
+	ServerURL         string
+	Token             string
+	Insecure          bool
+	Concurrency       int
+	PollInterval      time.Duration
+	HeartbeatInterval time.Duration
+	DrainPeriod       time.Duration
+	Crawler           CrawlerConfig
+}
+
 // Load loads configuration from environment variables
 func Load() *Config {
+	driver := getEnv("DB_DRIVER", "mysql")
+	defaultPort := "3306"
+	if driver == "postgres" {
+		defaultPort = "5432"
+	}
+
 	return &Config{
 		Database: DatabaseConfig{
+			Driver:   driver,
+			Path:     getEnv("DB_PATH", "data/seo-crawler.db"),
 			Host:     getEnv("DB_HOST", "127.0.0.1"),
-			Port:     getEnv("DB_PORT", "3306"),
+			Port:     getEnv("DB_PORT", defaultPort),
 			User:     getEnv("DB_USER", "seo_user"),
 			Password: getEnv("DB_PASSWORD", "seo_password"),
 			Database: getEnv("DB_NAME", "seo_crawler"),
+			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
+			Port:        getEnv("SERVER_PORT", "8080"),
+			DrainPeriod: getEnvDuration("SHUTDOWN_DRAIN_PERIOD", 30*time.Second),
 		},
 		API: APIConfig{
 			Key: getEnv("API_KEY", "seo-crawler-api-key-2025"),
@@ -56,11 +151,82 @@ func Load() *Config {
 		JWT: JWTConfig{
 			Secret: getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
 		},
+		Crawler: CrawlerConfig{
+			WARCDir:               getEnv("WARC_DIR", "data/warc"),
+			SnapshotDir:           getEnv("SNAPSHOT_DIR", "data/snapshots"),
+			HostRequestsPerSecond: getEnvFloat("CRAWL_HOST_RPS", 2),
+			HostConcurrency:       getEnvInt("CRAWL_HOST_CONCURRENCY", 2),
+		},
+		Queue: QueueConfig{
+			Workers:           getEnvInt("CRAWL_WORKERS", 4),
+			WorkerID:          getEnv("WORKER_ID", ""),
+			PollInterval:      getEnvDuration("CRAWL_POLL_INTERVAL", 2*time.Second),
+			LeaseDuration:     getEnvDuration("CRAWL_LEASE_DURATION", time.Minute),
+			HeartbeatInterval: getEnvDuration("CRAWL_HEARTBEAT_INTERVAL", 15*time.Second),
+			ReclaimInterval:   getEnvDuration("CRAWL_RECLAIM_INTERVAL", time.Minute),
+			MaxAttempts:       getEnvInt("CRAWL_MAX_ATTEMPTS", 3),
+			RetryBackoff:      getEnvDuration("CRAWL_RETRY_BACKOFF", 30*time.Second),
+		},
+		Scheduler: SchedulerConfig{
+			Interval: getEnvDuration("SCHEDULER_INTERVAL", 30*time.Second),
+		},
+		Webhooks: WebhookConfig{
+			MaxAttempts:  getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+			RetryBackoff: getEnvDuration("WEBHOOK_RETRY_BACKOFF", time.Minute),
+			PollInterval: getEnvDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+		},
+		Events: EventConfig{
+			PollInterval: getEnvDuration("EVENT_POLL_INTERVAL", time.Second),
+			Retention:    getEnvDuration("EVENT_RETENTION", 10*time.Minute),
+		},
+		Quotas: QuotaConfig{
+			ConcurrentCrawls:   getEnvInt("QUOTA_CONCURRENT_CRAWLS", 2),
+			CrawlsPerDay:       getEnvInt("QUOTA_CRAWLS_PER_DAY", 1000),
+			PagesPerMonth:      getEnvInt("QUOTA_PAGES_PER_MONTH", 10000),
+			LinkChecksPerCrawl: getEnvInt("QUOTA_LINK_CHECKS_PER_CRAWL", 500),
+		},
+		Retention: RetentionConfig{
+			KeepRuns:   getEnvInt("RETENTION_KEEP_RUNS", 0),
+			MaxAgeDays: getEnvInt("RETENTION_MAX_AGE_DAYS", 0),
+			Interval:   getEnvDuration("RETENTION_INTERVAL", time.Hour),
+			BatchSize:  getEnvInt("RETENTION_BATCH_SIZE", 100),
+			ArchiveDir: getEnv("RETENTION_ARCHIVE_DIR", ""),
+		},
+	}
+}
+
+// LoadAgent loads remote crawl agent configuration from environment variables
+func LoadAgent() *AgentConfig {
+	return &AgentConfig{
+		ServerURL:         getEnv("AGENT_SERVER_URL", ""),
+		Token:             getEnv("AGENT_TOKEN", ""),
+		Insecure:          getEnv("AGENT_INSECURE", "") == "true",
+		Concurrency:       getEnvInt("AGENT_CONCURRENCY", 2),
+		PollInterval:      getEnvDuration("AGENT_POLL_INTERVAL", 5*time.Second),
+		HeartbeatInterval: getEnvDuration("AGENT_HEARTBEAT_INTERVAL", 15*time.Second),
+		DrainPeriod:       getEnvDuration("SHUTDOWN_DRAIN_PERIOD", 30*time.Second),
+		Crawler: CrawlerConfig{
+			HostRequestsPerSecond: getEnvFloat("CRAWL_HOST_RPS", 2),
+			HostConcurrency:       getEnvInt("CRAWL_HOST_CONCURRENCY", 2),
+		},
 	}
 }
 
-// GetDSN returns the database connection string
+// GetDSN returns the database connection string of the configured driver
 func (c *Config) GetDSN() string {
+	switch c.Database.Driver {
+	case "sqlite":
+		return c.Database.Path
+	case "postgres":
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(c.Database.User, c.Database.Password),
+			Host:     net.JoinHostPort(c.Database.Host, c.Database.Port),
+			Path:     "/" + c.Database.Database,
+			RawQuery: url.Values{"sslmode": {c.Database.SSLMode}}.Encode(),
+		}
+		return dsn.String()
+	}
 	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
 		c.Database.User,
 		c.Database.Password,
@@ -76,4 +242,28 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-} 
\ No newline at end of file
+}
+
+// getEnvInt gets an integer environment variable with a default value
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvFloat gets a floating point environment variable with a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "5s") with a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
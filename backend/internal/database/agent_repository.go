@@ -0,0 +1,150 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// AgentRepository defines the interface for remote crawl agent operations
+type AgentRepository interface {
+	CreateAgent(agent *models.Agent, tokenHash string) (int, error)
+	GetAgents(userID int) ([]models.Agent, error)
+	GetAgentByID(userID, id int) (*models.Agent, error)
+	GetAgentByTokenHash(tokenHash string) (*models.Agent, error)
+	TouchAgent(id int) error
+	DeleteAgent(userID, id int) error
+	AssignCrawlResult(userID, crawlResultID, agentID int) error
+}
+
+// AgentRepo implements the AgentRepository interface
+type AgentRepo struct {
+	conn *Connection
+}
+
+// NewAgentRepository creates a new agent repository
+func NewAgentRepository(conn *Connection) AgentRepository {
+	return &AgentRepo{conn: conn}
+}
+
+// agentColumns lists the columns read by scanAgents, in order
+const agentColumns = `id, user_id, name, last_seen_at, created_at`
+
+// CreateAgent stores a new agent with the hash of its token
+func (r *AgentRepo) CreateAgent(agent *models.Agent, tokenHash string) (int, error) {
+	id, err := r.conn.Insert(`
+		INSERT INTO agents (user_id, name, token_hash) VALUES (?, ?, ?)
+	`, agent.UserID, agent.Name, tokenHash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create agent: %w", err)
+	}
+
+	agent.ID = int(id)
+	return agent.ID, nil
+}
+
+// GetAgents returns all agents of a user
+func (r *AgentRepo) GetAgents(userID int) ([]models.Agent, error) {
+	rows, err := r.conn.Query(`SELECT `+agentColumns+` FROM agents WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agents: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanAgents(rows)
+}
+
+// GetAgentByID returns a single agent owned by a user
+func (r *AgentRepo) GetAgentByID(userID, id int) (*models.Agent, error) {
+	rows, err := r.conn.Query(`SELECT `+agentColumns+` FROM agents WHERE user_id = ? AND id = ?`, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanAgent(rows)
+}
+
+// GetAgentByTokenHash returns the agent a token was issued to
+func (r *AgentRepo) GetAgentByTokenHash(tokenHash string) (*models.Agent, error) {
+	rows, err := r.conn.Query(`SELECT `+agentColumns+` FROM agents WHERE token_hash = ?`, tokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanAgent(rows)
+}
+
+// TouchAgent records that an agent just contacted the server
+func (r *AgentRepo) TouchAgent(id int) error {
+	if _, err := r.conn.Exec(`UPDATE agents SET last_seen_at = CURRENT_TIMESTAMP WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to touch agent: %w", err)
+	}
+	return nil
+}
+
+// DeleteAgent removes an agent. Its crawl results go back to server-side crawling.
+func (r *AgentRepo) DeleteAgent(userID, id int) error {
+	result, err := r.conn.Exec("DELETE FROM agents WHERE user_id = ? AND id = ?", userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete agent: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete agent: %w", err)
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AssignCrawlResult makes an agent crawl a crawl result from now on. A zero
+// agentID moves it back to server-side crawling.
+func (r *AgentRepo) AssignCrawlResult(userID, crawlResultID, agentID int) error {
+	_, err := r.conn.Exec(`
+		UPDATE crawl_results SET agent_id = ? WHERE user_id = ? AND id = ?
+	`, nullInt(agentID), userID, crawlResultID)
+	if err != nil {
+		return fmt.Errorf("failed to assign crawl result to agent: %w", err)
+	}
+	return nil
+}
+
+// scanAgent scans the single agent expected in rows
+func (r *AgentRepo) scanAgent(rows *sql.Rows) (*models.Agent, error) {
+	agents, err := r.scanAgents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(agents) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &agents[0], nil
+}
+
+// scanAgents scans agents rows selected with agentColumns
+func (r *AgentRepo) scanAgents(rows *sql.Rows) ([]models.Agent, error) {
+	agents := []models.Agent{}
+	for rows.Next() {
+		var agent models.Agent
+		var lastSeenAt sql.NullTime
+
+		if err := rows.Scan(&agent.ID, &agent.UserID, &agent.Name, &lastSeenAt, &agent.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan agent: %w", err)
+		}
+		if lastSeenAt.Valid {
+			agent.LastSeenAt = &lastSeenAt.Time
+		}
+
+		agents = append(agents, agent)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read agents: %w", err)
+	}
+	return agents, nil
+}
@@ -1,21 +1,65 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
-// Connection represents a database connection
+// Dialect identifies the SQL dialect spoken by a database backend
+type Dialect string
+
+const (
+	DialectMySQL    Dialect = "mysql"
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// Connection represents a database connection. Queries are written with ?
+// placeholders, its Exec, Query, QueryRow and Begin rewrite them for dialects
+// numbering their placeholders.
 type Connection struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
 }
 
-// NewConnection creates a new database connection
-func NewConnection(dsn string) (*Connection, error) {
-	db, err := sql.Open("mysql", dsn+"?parseTime=true")
+// NewConnection creates a new database connection. driver is "mysql",
+// "postgres" or "sqlite", for SQLite dsn is the path of the database file.
+func NewConnection(driver, dsn string) (*Connection, error) {
+	var db *sql.DB
+	var err error
+
+	switch Dialect(driver) {
+	case DialectMySQL:
+		db, err = sql.Open("mysql", dsn+"?parseTime=true")
+	case DialectSQLite:
+		if err := os.MkdirAll(filepath.Dir(dsn), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+		// Transactions take the write lock up front so concurrent claims wait
+		// on the busy timeout instead of failing, WAL lets reads run meanwhile
+		db, err = sql.Open("sqlite", "file:"+dsn+
+			"?_pragma=foreign_keys(1)&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)"+
+			"&_txlock=immediate&_time_format=sqlite")
+	case DialectPostgres:
+		db, err = sql.Open("pgx", dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -24,11 +68,322 @@ func NewConnection(dsn string) (*Connection, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Connected to MySQL!")
-	return &Connection{DB: db}, nil
+	log.Printf("Connected to %s!", driver)
+	return &Connection{DB: db, Dialect: Dialect(driver)}, nil
 }
 
 // Close closes the database connection
 func (c *Connection) Close() error {
 	return c.DB.Close()
-} 
\ No newline at end of file
+}
+
+// Exec executes a statement
+func (c *Connection) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(c.rebind(query), args...)
+}
+
+// Query runs a query returning rows
+func (c *Connection) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.Query(c.rebind(query), args...)
+}
+
+// QueryRow runs a query returning at most one row
+func (c *Connection) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRow(c.rebind(query), args...)
+}
+
+// Insert executes an INSERT and returns the ID of the inserted row
+func (c *Connection) Insert(query string, args ...interface{}) (int64, error) {
+	return insert(c.DB, c.Dialect, query, args)
+}
+
+// Begin starts a transaction
+func (c *Connection) Begin() (*Tx, error) {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, conn: c}, nil
+}
+
+// Lock takes the advisory lock name, shared by every process using the
+// database, waiting at most timeout for it, and returns the function
+// releasing it. SQLite has no advisory locks, its immediate transactions
+// serialize writers instead and Lock returns at once.
+func (c *Connection) Lock(name string, timeout time.Duration) (func(), error) {
+	if c.Dialect == DialectSQLite {
+		return func() {}, nil
+	}
+
+	// The lock belongs to the session, so it is taken and released on one connection
+	ctx := context.Background()
+	conn, err := c.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	var unlock string
+	var key interface{}
+	switch c.Dialect {
+	case DialectPostgres:
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		key = int64(h.Sum64())
+		unlock = "SELECT pg_advisory_unlock($1)"
+
+		// pg_advisory_lock would wait forever, poll for the lock instead
+		deadline := time.Now().Add(timeout)
+		for {
+			var locked bool
+			if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("failed to take lock %s: %w", name, err)
+			}
+			if locked {
+				break
+			}
+			if time.Now().After(deadline) {
+				conn.Close()
+				return nil, fmt.Errorf("timed out waiting for lock %s", name)
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	default:
+		key = name
+		unlock = "SELECT RELEASE_LOCK(?)"
+
+		var locked sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(timeout.Seconds())).Scan(&locked); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to take lock %s: %w", name, err)
+		}
+		if locked.Int64 != 1 {
+			conn.Close()
+			return nil, fmt.Errorf("timed out waiting for lock %s", name)
+		}
+	}
+
+	return func() {
+		var released sql.NullBool
+		if err := conn.QueryRowContext(ctx, unlock, key).Scan(&released); err != nil {
+			log.Printf("Failed to release lock %s: %v", name, err)
+		}
+		conn.Close()
+	}, nil
+}
+
+// Tx is a transaction taking queries written with ? placeholders
+type Tx struct {
+	*sql.Tx
+	conn *Connection
+}
+
+// Exec executes a statement in the transaction
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.conn.rebind(query), args...)
+}
+
+// Query runs a query returning rows in the transaction
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.conn.rebind(query), args...)
+}
+
+// QueryRow runs a query returning at most one row in the transaction
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.conn.rebind(query), args...)
+}
+
+// Insert executes an INSERT in the transaction and returns the ID of the inserted row
+func (tx *Tx) Insert(query string, args ...interface{}) (int64, error) {
+	return insert(tx.Tx, tx.conn.Dialect, query, args)
+}
+
+// maxInsertRows caps the rows of a multi-row INSERT, keeping its placeholders
+// well under the limit of every backend
+const maxInsertRows = 500
+
+// InsertRows inserts rows into table with multi-row INSERTs, each row holding
+// a value per column
+func (tx *Tx) InsertRows(table string, columns []string, rows [][]interface{}) error {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	for start := 0; start < len(rows); start += maxInsertRows {
+		batch := rows[start:min(start+maxInsertRows, len(rows))]
+
+		values := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*len(columns))
+		for i, r := range batch {
+			values[i] = row
+			args = append(args, r...)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(columns, ", "), strings.Join(values, ", "))
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execer is the part of sql.DB and sql.Tx used by insert
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// insert executes an INSERT through db. Postgres has no LastInsertId, the ID
+// is returned by the statement instead.
+func insert(db execer, dialect Dialect, query string, args []interface{}) (int64, error) {
+	if dialect == DialectPostgres {
+		var id int64
+		if err := db.QueryRow(rebind(dialect, query)+" RETURNING id", args...).Scan(&id); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	return id, nil
+}
+
+// rebind rewrites the ? placeholders of query for the dialect of the connection
+func (c *Connection) rebind(query string) string {
+	return rebind(c.Dialect, query)
+}
+
+// rebind rewrites the ? placeholders of query into the $1, $2... placeholders
+// of Postgres. Question marks inside quoted strings are left alone.
+func rebind(dialect Dialect, query string) string {
+	if dialect != DialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			quoted = !quoted
+		case ch == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// secondsFromNow returns an expression for the current time plus the number
+// of seconds bound to its placeholder
+func (c *Connection) secondsFromNow() string {
+	switch c.Dialect {
+	case DialectSQLite:
+		return `datetime('now', '+' || ? || ' seconds')`
+	case DialectPostgres:
+		return `(CURRENT_TIMESTAMP + CAST(? AS INTEGER) * INTERVAL '1 second')`
+	}
+	return `DATE_ADD(NOW(), INTERVAL ? SECOND)`
+}
+
+// secondsAgo returns an expression for the current time minus the number of
+// seconds bound to its placeholder
+func (c *Connection) secondsAgo() string {
+	switch c.Dialect {
+	case DialectSQLite:
+		return `datetime('now', '-' || ? || ' seconds')`
+	case DialectPostgres:
+		return `(CURRENT_TIMESTAMP - CAST(? AS INTEGER) * INTERVAL '1 second')`
+	}
+	return `DATE_SUB(NOW(), INTERVAL ? SECOND)`
+}
+
+// daysAgo returns an expression for the current time minus the number of
+// days computed by the SQL expression days
+func (c *Connection) daysAgo(days string) string {
+	switch c.Dialect {
+	case DialectSQLite:
+		return `datetime('now', '-' || ` + days + ` || ' days')`
+	case DialectPostgres:
+		return `(CURRENT_TIMESTAMP - ` + days + ` * INTERVAL '1 day')`
+	}
+	return `DATE_SUB(NOW(), INTERVAL ` + days + ` DAY)`
+}
+
+// monthStart returns an expression for the first day of the current month
+func (c *Connection) monthStart() string {
+	switch c.Dialect {
+	case DialectSQLite:
+		return `DATE('now', 'start of month')`
+	case DialectPostgres:
+		return `CAST(DATE_TRUNC('month', CURRENT_DATE) AS DATE)`
+	}
+	return `DATE_FORMAT(CURDATE(), '%Y-%m-01')`
+}
+
+// skipLocked returns the locking clause of a SELECT claiming a row of table
+// alias. SQLite has no row locks, its immediate transactions already
+// serialize claims.
+func (c *Connection) skipLocked(alias string) string {
+	if c.Dialect == DialectSQLite {
+		return ""
+	}
+	return "FOR UPDATE OF " + alias + " SKIP LOCKED"
+}
+
+// upsertAdd returns the clause of an INSERT into table adding the inserted
+// value of column to the row already stored under the unique keys
+func (c *Connection) upsertAdd(table, keys, column string) string {
+	if c.Dialect != DialectMySQL {
+		return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s = %s.%s + excluded.%s", keys, column, table, column, column)
+	}
+	return fmt.Sprintf("ON DUPLICATE KEY UPDATE %s = %s + VALUES(%s)", column, column, column)
+}
+
+// upsertAddUpTo works like upsertAdd but leaves the stored row unchanged when
+// the sum would exceed the limit bound to its placeholder, in which case the
+// statement affects no row
+func (c *Connection) upsertAddUpTo(table, keys, column string) string {
+	if c.Dialect != DialectMySQL {
+		return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s = %s.%s + excluded.%s WHERE %s.%s + excluded.%s <= ?",
+			keys, column, table, column, column, table, column, column)
+	}
+	return fmt.Sprintf("ON DUPLICATE KEY UPDATE %s = IF(%s + VALUES(%s) <= ?, %s + VALUES(%s), %s)",
+		column, column, column, column, column, column)
+}
+
+// isUniqueViolation reports whether err is a statement rejected for breaking
+// a unique index, whatever the backend
+func isUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	var pgErr *pgconn.PgError
+	var sqliteErr *sqlite.Error
+	switch {
+	case errors.As(err, &mysqlErr):
+		return mysqlErr.Number == 1062 // ER_DUP_ENTRY
+	case errors.As(err, &pgErr):
+		return pgErr.Code == "23505" // unique_violation
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	}
+	return false
+}
+
+// like returns the case-insensitive LIKE operator. MySQL and SQLite compare
+// text case-insensitively already.
+func (c *Connection) like() string {
+	if c.Dialect == DialectPostgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// EventRepository defines the interface for the crawl events relayed between
+// the processes sharing the database
+type EventRepository interface {
+	AppendEvents(source string, events []models.CrawlEvent) error
+	GetEventsAfter(afterID int64, limit int) ([]models.RelayedEvent, error)
+	LatestEventID() (int64, error)
+	DeleteEventsBefore(age time.Duration) (int64, error)
+}
+
+// EventRepo implements the EventRepository interface
+type EventRepo struct {
+	conn *Connection
+}
+
+// NewEventRepository creates a new event repository
+func NewEventRepository(conn *Connection) EventRepository {
+	return &EventRepo{conn: conn}
+}
+
+// AppendEvents stores events published by source, in order
+func (r *EventRepo) AppendEvents(source string, events []models.CrawlEvent) error {
+	rows := make([][]interface{}, 0, len(events))
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		rows = append(rows, []interface{}{source, event.UserID, string(payload)})
+	}
+
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.InsertRows("crawl_events", []string{"source", "user_id", "payload"}, rows); err != nil {
+		return fmt.Errorf("failed to store events: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit events: %w", err)
+	}
+	return nil
+}
+
+// GetEventsAfter returns at most limit events stored after the event afterID,
+// oldest first
+func (r *EventRepo) GetEventsAfter(afterID int64, limit int) ([]models.RelayedEvent, error) {
+	rows, err := r.conn.Query(`
+		SELECT id, source, user_id, payload FROM crawl_events WHERE id > ? ORDER BY id LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.RelayedEvent
+	for rows.Next() {
+		var event models.RelayedEvent
+		var userID int
+		var payload string
+		if err := rows.Scan(&event.ID, &event.Source, &userID, &payload); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		if err := json.Unmarshal([]byte(payload), &event.Event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal event %d: %w", event.ID, err)
+		}
+		event.Event.UserID = userID
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// LatestEventID returns the ID of the last stored event, zero when there is none
+func (r *EventRepo) LatestEventID() (int64, error) {
+	var id int64
+	if err := r.conn.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM crawl_events`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get latest event: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteEventsBefore removes the events stored more than age ago and returns
+// how many were removed
+func (r *EventRepo) DeleteEventsBefore(age time.Duration) (int64, error) {
+	result, err := r.conn.Exec(`DELETE FROM crawl_events WHERE created_at < `+r.conn.secondsAgo(), int(age.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old events: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,419 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// JobRepository defines the interface for crawl job queue operations
+type JobRepository interface {
+	EnqueueJob(job *models.CrawlJob) (int, error)
+	ClaimNextJob(owner string, lease time.Duration, maxRunningPerUser int) (*models.CrawlJob, error)
+	ClaimAgentJob(agentID int, owner string, lease time.Duration, maxRunningPerUser int) (*models.CrawlJob, error)
+	GetJobByID(jobID int) (*models.CrawlJob, error)
+	RenewLease(jobID int, owner string, lease time.Duration) (bool, error)
+	GetCancelRequested(owner string) ([]int, error)
+	UpdateJobStatus(jobID int, owner, status, lastError string) error
+	RetryJob(jobID int, owner, lastError string, delay time.Duration) error
+	HasActiveJob(crawlResultID int) (bool, error)
+	CancelQueuedJob(crawlResultID int) (bool, error)
+	RequestCancel(crawlResultID int) (bool, error)
+	ReclaimJobs(maxAttempts int) (requeued, failed int64, err error)
+}
+
+// ErrActiveJob is returned when enqueueing a job for a crawl result that
+// already has a queued or running job
+var ErrActiveJob = errors.New("crawl result already has an active job")
+
+// JobRepo implements the JobRepository interface
+type JobRepo struct {
+	conn *Connection
+}
+
+// NewJobRepository creates a new job repository
+func NewJobRepository(conn *Connection) JobRepository {
+	return &JobRepo{conn: conn}
+}
+
+// expiredLease matches running jobs whose worker stopped renewing its lease.
+// Jobs claimed before leases existed have none and count as expired.
+const expiredLease = `status = 'running' AND (lease_expires_at IS NULL OR lease_expires_at < CURRENT_TIMESTAMP)`
+
+// jobColumns lists the columns read by scanJob, in order
+const jobColumns = `j.id, j.crawl_result_id, j.user_id, j.agent_id, j.url, j.job_type, j.source_run_id, j.status, j.attempts,
+	j.last_error, j.lease_owner, j.created_at, j.started_at, j.finished_at`
+
+// EnqueueJob adds a job to the end of the queue. Crawl jobs go to the agent
+// their crawl result is assigned to, if any. Replays and re-analyses read the
+// archive or snapshot on the server and always run there. A crawl result has
+// at most one queued or running job, ErrActiveJob is returned for another.
+func (r *JobRepo) EnqueueJob(job *models.CrawlJob) (int, error) {
+	id, err := r.conn.Insert(`
+		INSERT INTO crawl_jobs (crawl_result_id, user_id, agent_id, url, job_type, source_run_id, status)
+		VALUES (?, ?, CASE WHEN ? = 'crawl' THEN (SELECT agent_id FROM crawl_results WHERE id = ?) END, ?, ?, ?, 'queued')
+	`, job.CrawlResultID, job.UserID, job.Type, job.CrawlResultID, job.URL, job.Type, job.SourceRunID)
+	if isUniqueViolation(err) {
+		return 0, ErrActiveJob
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	job.ID = int(id)
+	job.Status = models.JobStatusQueued
+	return job.ID, nil
+}
+
+// ClaimNextJob leases the next queued job to owner and returns it, or nil when
+// no job can run. Jobs of users with the fewest running crawls go first,
+// oldest first among them, and users already running maxRunningPerUser crawls
+// are skipped. A zero maxRunningPerUser means no per-user limit. Rows locked
+// by another worker's claim are skipped, so workers never wait on each other.
+// Jobs assigned to remote agents are left to them.
+func (r *JobRepo) ClaimNextJob(owner string, lease time.Duration, maxRunningPerUser int) (*models.CrawlJob, error) {
+	return r.claimJob(`j.agent_id IS NULL`, owner, lease, maxRunningPerUser)
+}
+
+// ClaimAgentJob leases the next queued job assigned to a remote agent, with
+// the same ordering as ClaimNextJob
+func (r *JobRepo) ClaimAgentJob(agentID int, owner string, lease time.Duration, maxRunningPerUser int) (*models.CrawlJob, error) {
+	return r.claimJob(`j.agent_id = ?`, owner, lease, maxRunningPerUser, agentID)
+}
+
+// claimJob leases the next queued job matching filter, whose placeholders are
+// bound to filterArgs. Claims running concurrently can each see a user below
+// maxRunningPerUser, so the running crawls of the user are counted again once
+// the claim is committed and the job is handed back when the user went over.
+func (r *JobRepo) claimJob(filter, owner string, lease time.Duration, maxRunningPerUser int, filterArgs ...interface{}) (*models.CrawlJob, error) {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	args := append(filterArgs, maxRunningPerUser, maxRunningPerUser)
+	job, err := r.scanJob(tx.QueryRow(`
+		SELECT `+jobColumns+`
+		FROM crawl_jobs j
+		LEFT JOIN (
+			SELECT user_id, COUNT(*) AS running FROM crawl_jobs WHERE status = 'running' GROUP BY user_id
+		) r ON r.user_id = j.user_id
+		WHERE j.status = 'queued' AND (j.run_after IS NULL OR j.run_after <= CURRENT_TIMESTAMP) AND `+filter+`
+		  AND (? = 0 OR COALESCE(r.running, 0) < ?)
+		ORDER BY COALESCE(r.running, 0), j.id LIMIT 1
+		`+r.conn.skipLocked("j")+`
+	`, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch next job: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE crawl_jobs
+		SET status = 'running', attempts = attempts + 1, started_at = CURRENT_TIMESTAMP, cancel_requested = FALSE,
+			lease_owner = ?, lease_expires_at = `+r.conn.secondsFromNow()+`
+		WHERE id = ?
+	`, owner, int(lease.Seconds()), job.ID); err != nil {
+		return nil, fmt.Errorf("failed to claim job %d: %w", job.ID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit claim of job %d: %w", job.ID, err)
+	}
+
+	if maxRunningPerUser > 0 {
+		over, err := r.overRunningLimit(job, owner, maxRunningPerUser)
+		if err != nil {
+			return nil, err
+		}
+		if over {
+			return nil, nil
+		}
+	}
+
+	job.Status = models.JobStatusRunning
+	job.Attempts++
+	job.LeaseOwner = sql.NullString{String: owner, Valid: true}
+	return job, nil
+}
+
+// overRunningLimit counts the running crawls of the user of a job just
+// claimed by owner and, when there are more than maxRunningPerUser, puts the
+// job back in the queue as if it had never been claimed. It reports whether
+// the job was handed back.
+func (r *JobRepo) overRunningLimit(job *models.CrawlJob, owner string, maxRunningPerUser int) (bool, error) {
+	var running int
+	if err := r.conn.QueryRow(`
+		SELECT COUNT(*) FROM crawl_jobs WHERE user_id = ? AND status = 'running'
+	`, job.UserID).Scan(&running); err != nil {
+		return false, fmt.Errorf("failed to count running crawls of user %d: %w", job.UserID, err)
+	}
+	if running <= maxRunningPerUser {
+		return false, nil
+	}
+
+	if _, err := r.conn.Exec(`
+		UPDATE crawl_jobs
+		SET status = 'queued', attempts = attempts - 1, started_at = NULL, lease_owner = NULL, lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ? AND status = 'running'
+	`, job.ID, owner); err != nil {
+		return false, fmt.Errorf("failed to release job %d: %w", job.ID, err)
+	}
+	return true, nil
+}
+
+// GetJobByID returns a single job
+func (r *JobRepo) GetJobByID(jobID int) (*models.CrawlJob, error) {
+	return r.scanJob(r.conn.QueryRow(`SELECT `+jobColumns+` FROM crawl_jobs j WHERE j.id = ?`, jobID))
+}
+
+// RenewLease extends the lease of a running job. It reports whether owner
+// still holds the lease.
+func (r *JobRepo) RenewLease(jobID int, owner string, lease time.Duration) (bool, error) {
+	result, err := r.conn.Exec(`
+		UPDATE crawl_jobs SET lease_expires_at = `+r.conn.secondsFromNow()+`
+		WHERE id = ? AND lease_owner = ? AND status = 'running'
+	`, int(lease.Seconds()), jobID, owner)
+	if err != nil {
+		return false, fmt.Errorf("failed to renew lease of job %d: %w", jobID, err)
+	}
+	renewed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to renew lease of job %d: %w", jobID, err)
+	}
+
+	// MySQL only counts changed rows, a lease renewed twice within a second is
+	// left as it was
+	if renewed == 0 && r.conn.Dialect == DialectMySQL {
+		if err := r.conn.QueryRow(`
+			SELECT COUNT(*) FROM crawl_jobs WHERE id = ? AND lease_owner = ? AND status = 'running'
+		`, jobID, owner).Scan(&renewed); err != nil {
+			return false, fmt.Errorf("failed to get lease of job %d: %w", jobID, err)
+		}
+	}
+
+	return renewed > 0, nil
+}
+
+// GetCancelRequested returns the IDs of the jobs leased to owner that a user
+// asked to stop
+func (r *JobRepo) GetCancelRequested(owner string) ([]int, error) {
+	rows, err := r.conn.Query(`
+		SELECT id FROM crawl_jobs WHERE lease_owner = ? AND status = 'running' AND cancel_requested = TRUE
+	`, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cancelled jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan job id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// UpdateJobStatus records a state transition of a job and releases its lease.
+// Nothing is written when owner no longer holds the lease.
+func (r *JobRepo) UpdateJobStatus(jobID int, owner, status, lastError string) error {
+	var errValue interface{}
+	if lastError != "" {
+		errValue = lastError
+	}
+
+	finished := status == models.JobStatusDone || status == models.JobStatusFailed || status == models.JobStatusCancelled
+	_, err := r.conn.Exec(`
+		UPDATE crawl_jobs
+		SET status = ?, last_error = COALESCE(?, last_error),
+			finished_at = CASE WHEN ? THEN CURRENT_TIMESTAMP ELSE finished_at END,
+			lease_owner = NULL, lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ?
+	`, status, errValue, finished, jobID, owner)
+	if err != nil {
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+	return nil
+}
+
+// RetryJob puts a failed job back in the queue, to be claimed once delay has
+// passed. Nothing is written when owner no longer holds the lease.
+func (r *JobRepo) RetryJob(jobID int, owner, lastError string, delay time.Duration) error {
+	_, err := r.conn.Exec(`
+		UPDATE crawl_jobs
+		SET status = 'queued', last_error = ?, started_at = NULL,
+			run_after = `+r.conn.secondsFromNow()+`,
+			lease_owner = NULL, lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ?
+	`, lastError, int(delay.Seconds()), jobID, owner)
+	if err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+	return nil
+}
+
+// HasActiveJob reports whether a crawl result has a queued or running job
+func (r *JobRepo) HasActiveJob(crawlResultID int) (bool, error) {
+	var count int
+	err := r.conn.QueryRow(`
+		SELECT COUNT(*) FROM crawl_jobs
+		WHERE crawl_result_id = ? AND status IN ('queued', 'running')
+	`, crawlResultID).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check active jobs: %w", err)
+	}
+	return count > 0, nil
+}
+
+// CancelQueuedJob cancels the queued job of a crawl result before a worker
+// claims it. It reports whether a job was cancelled.
+func (r *JobRepo) CancelQueuedJob(crawlResultID int) (bool, error) {
+	result, err := r.conn.Exec(`
+		UPDATE crawl_jobs SET status = 'cancelled', finished_at = CURRENT_TIMESTAMP
+		WHERE crawl_result_id = ? AND status = 'queued'
+	`, crawlResultID)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel queued job: %w", err)
+	}
+
+	cancelled, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel queued job: %w", err)
+	}
+	return cancelled > 0, nil
+}
+
+// RequestCancel flags the running job of a crawl result so that the worker
+// holding it stops the crawl. It reports whether a
+// running job was flagged.
+func (r *JobRepo) RequestCancel(crawlResultID int) (bool, error) {
+	var count int
+	err := r.conn.QueryRow(`
+		SELECT COUNT(*) FROM crawl_jobs WHERE crawl_result_id = ? AND status = 'running'
+	`, crawlResultID).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to find running job: %w", err)
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	if _, err := r.conn.Exec(`
+		UPDATE crawl_jobs SET cancel_requested = TRUE WHERE crawl_result_id = ? AND status = 'running'
+	`, crawlResultID); err != nil {
+		return false, fmt.Errorf("failed to request cancellation: %w", err)
+	}
+	return true, nil
+}
+
+// ReclaimJobs puts jobs interrupted by a shutdown, and jobs whose worker let
+// its lease expire, back in the queue with their crawl results reset to
+// pending. Expired jobs that already used maxAttempts attempts are failed
+// instead, so a page that keeps killing workers is not retried forever.
+func (r *JobRepo) ReclaimJobs(maxAttempts int) (int64, int64, error) {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE crawl_results
+		SET status = 'error', error_class = 'unknown', error_message = 'worker stopped responding', updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT crawl_result_id FROM crawl_jobs WHERE `+expiredLease+` AND attempts >= ?)
+	`, maxAttempts); err != nil {
+		return 0, 0, fmt.Errorf("failed to fail abandoned crawl results: %w", err)
+	}
+
+	// The runs abandoned by a dead worker never finished, close them
+	if _, err := tx.Exec(`
+		UPDATE crawl_runs
+		SET status = 'error', error_class = 'unknown', error_message = 'worker stopped responding', finished_at = CURRENT_TIMESTAMP
+		WHERE finished_at IS NULL AND id IN (SELECT last_run_id FROM crawl_results WHERE id IN (
+			SELECT crawl_result_id FROM crawl_jobs WHERE `+expiredLease+` AND attempts >= ?))
+	`, maxAttempts); err != nil {
+		return 0, 0, fmt.Errorf("failed to fail abandoned crawl runs: %w", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE crawl_runs SET status = 'interrupted', finished_at = CURRENT_TIMESTAMP
+		WHERE finished_at IS NULL AND id IN (SELECT last_run_id FROM crawl_results WHERE id IN (
+			SELECT crawl_result_id FROM crawl_jobs WHERE ` + expiredLease + `))
+	`); err != nil {
+		return 0, 0, fmt.Errorf("failed to interrupt abandoned crawl runs: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		UPDATE crawl_jobs
+		SET status = 'failed', last_error = 'lease expired', finished_at = CURRENT_TIMESTAMP,
+			lease_owner = NULL, lease_expires_at = NULL
+		WHERE `+expiredLease+` AND attempts >= ?
+	`, maxAttempts)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fail abandoned jobs: %w", err)
+	}
+	failed, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fail abandoned jobs: %w", err)
+	}
+
+	// A crawl result queued again since its job was interrupted has moved on,
+	// and only one of its jobs may be active. Its interrupted job is cancelled
+	// before the statuses are reset, leaving the status of the newer job alone.
+	// The inner select keeps MySQL from refusing a subquery on the table being
+	// updated.
+	if _, err := tx.Exec(`
+		UPDATE crawl_jobs SET status = 'cancelled', finished_at = CURRENT_TIMESTAMP
+		WHERE status = 'interrupted' AND crawl_result_id IN (
+			SELECT crawl_result_id FROM (SELECT crawl_result_id FROM crawl_jobs WHERE status IN ('queued', 'running')) active)
+	`); err != nil {
+		return 0, 0, fmt.Errorf("failed to cancel superseded interrupted jobs: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE crawl_results SET status = 'pending', updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT crawl_result_id FROM crawl_jobs WHERE status = 'interrupted' OR (` + expiredLease + `))
+	`); err != nil {
+		return 0, 0, fmt.Errorf("failed to reset interrupted crawl results: %w", err)
+	}
+
+	result, err = tx.Exec(`
+		UPDATE crawl_jobs
+		SET status = 'queued', started_at = NULL, lease_owner = NULL, lease_expires_at = NULL
+		WHERE status = 'interrupted' OR (` + expiredLease + `)
+	`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to requeue interrupted jobs: %w", err)
+	}
+	requeued, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to requeue interrupted jobs: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit reclaim: %w", err)
+	}
+
+	return requeued, failed, nil
+}
+
+// scanJob scans a single crawl_jobs row
+func (r *JobRepo) scanJob(row *sql.Row) (*models.CrawlJob, error) {
+	var job models.CrawlJob
+	err := row.Scan(
+		&job.ID, &job.CrawlResultID, &job.UserID, &job.AgentID, &job.URL, &job.Type, &job.SourceRunID, &job.Status, &job.Attempts,
+		&job.LastError, &job.LeaseOwner, &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
@@ -1,23 +1,153 @@
 package database
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/seo-crawler-app/internal/models"
 )
 
-// Migration represents a database migration
+// Migration represents a database migration. SQL is written for MySQL,
+// SQLite and Postgres hold the versions for those databases when the MySQL
+// one does not run there. Down, SQLiteDown and PostgresDown undo the
+// migration the same way, a migration without Down cannot be rolled back.
+// Each may hold several statements separated by semicolons, they are run one
+// at a time. Applied migrations must never be edited, fix them with a new
+// one. Constraints dropped by a Down need a name given by a migration rather
+// than one the database generated.
 type Migration struct {
-	ID          int
-	Name        string
-	SQL         string
-	Description string
+	ID           int
+	Name         string
+	SQL          string
+	SQLite       string
+	Postgres     string
+	Down         string
+	SQLiteDown   string
+	PostgresDown string
+	Description  string
+}
+
+// statement returns the SQL of the migration for dialect
+func (m Migration) statement(dialect Dialect) string {
+	return forDialect(dialect, m.SQL, m.SQLite, m.Postgres)
+}
+
+// downStatement returns the SQL undoing the migration for dialect, empty
+// when it cannot be undone
+func (m Migration) downStatement(dialect Dialect) string {
+	return forDialect(dialect, m.Down, m.SQLiteDown, m.PostgresDown)
+}
+
+// checksum identifies the SQL of the migration for dialect, telling an
+// applied migration apart from one edited since
+func (m Migration) checksum(dialect Dialect) string {
+	sum := sha256.Sum256([]byte(m.statement(dialect)))
+	return hex.EncodeToString(sum[:])
+}
+
+// forDialect picks the version of a statement for dialect, falling back to
+// the MySQL one
+func forDialect(dialect Dialect, mysql, sqlite, postgres string) string {
+	switch {
+	case dialect == DialectSQLite && sqlite != "":
+		return sqlite
+	case dialect == DialectPostgres && postgres != "":
+		return postgres
+	}
+	return mysql
 }
 
+// splitStatements splits SQL into its statements, as drivers run one
+// statement per Exec. Semicolons inside quotes, comments and BEGIN or CASE
+// blocks, such as trigger bodies, do not end a statement. Statements holding
+// nothing but comments are dropped.
+func splitStatements(sql string) []string {
+	var statements []string
+	start, depth, hasCode := 0, 0, false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// A doubled quote closes the literal and opens it again
+			end := strings.IndexByte(sql[i+1:], c)
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 1
+			}
+			hasCode = true
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end
+			}
+		case c == ';' && depth == 0:
+			if hasCode {
+				statements = append(statements, strings.TrimSpace(sql[start:i]))
+			}
+			start, hasCode = i+1, false
+		case isWordByte(c):
+			end := i
+			for end < len(sql) && isWordByte(sql[end]) {
+				end++
+			}
+			switch strings.ToUpper(sql[i:end]) {
+			case "BEGIN", "CASE":
+				depth++
+			case "END":
+				if depth > 0 {
+					depth--
+				}
+			}
+			i = end - 1
+			hasCode = true
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			hasCode = true
+		}
+	}
+	if hasCode {
+		statements = append(statements, strings.TrimSpace(sql[start:]))
+	}
+	return statements
+}
+
+// isWordByte reports whether c can be part of an SQL keyword or identifier
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+var (
+	// ErrMigrationModified is returned when an applied migration was edited since
+	ErrMigrationModified = errors.New("applied migration was modified")
+	// ErrIrreversibleMigration is returned when rolling back a migration without Down
+	ErrIrreversibleMigration = errors.New("migration cannot be rolled back")
+)
+
+const (
+	// migrationLock is the advisory lock held while migrating, so that
+	// instances starting together apply each migration once
+	migrationLock = "seo_crawler_migrations"
+	// migrationLockTimeout is how long to wait for another instance to finish migrating
+	migrationLockTimeout = 5 * time.Minute
+)
+
 // MigrationManager handles database migrations
 type MigrationManager struct {
 	conn *Connection
+	// DryRun receives the statements of the migrations that would run instead
+	// of the database when set. Nothing is written to the database, not even
+	// the migrations table.
+	DryRun io.Writer
 }
 
 // NewMigrationManager creates a new migration manager
@@ -27,17 +157,33 @@ func NewMigrationManager(conn *Connection) *MigrationManager {
 
 // Initialize creates the migrations table and runs pending migrations
 func (mm *MigrationManager) Initialize() error {
-	// Create migrations table if it doesn't exist
+	if err := mm.Prepare(); err != nil {
+		return err
+	}
+
+	if _, err := mm.Up(); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	return nil
+}
+
+// Prepare creates the migrations tracking table, or upgrades one created by
+// an older version. A dry run leaves the table as it is.
+func (mm *MigrationManager) Prepare() error {
+	if mm.DryRun != nil {
+		return nil
+	}
+
 	if err := mm.createMigrationsTable(); err != nil {
 		return fmt.Errorf("failed to create migrations table: %w", err)
 	}
 
-	// Get all migrations
-	migrations := mm.getMigrations()
-
-	// Run pending migrations
-	if err := mm.runPendingMigrations(migrations); err != nil {
-		return fmt.Errorf("failed to run migrations: %w", err)
+	// Migrations applied before checksums were recorded get theirs on the next run
+	if _, err := mm.conn.Exec(`SELECT checksum FROM migrations WHERE 1 = 0`); err != nil {
+		if _, err := mm.conn.Exec(`ALTER TABLE migrations ADD COLUMN checksum CHAR(64) NULL`); err != nil {
+			return fmt.Errorf("failed to add checksum to migrations table: %w", err)
+		}
 	}
 
 	return nil
@@ -49,15 +195,34 @@ func (mm *MigrationManager) createMigrationsTable() error {
 		id INT AUTO_INCREMENT PRIMARY KEY,
 		name VARCHAR(255) NOT NULL UNIQUE,
 		description TEXT,
+		checksum CHAR(64) NULL,
 		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		INDEX idx_name (name)
 	)`
-	
-	_, err := mm.conn.DB.Exec(query)
+	switch mm.conn.Dialect {
+	case DialectSQLite:
+		query = `CREATE TABLE IF NOT EXISTS migrations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name VARCHAR(255) NOT NULL UNIQUE,
+			description TEXT,
+			checksum CHAR(64) NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`
+	case DialectPostgres:
+		query = `CREATE TABLE IF NOT EXISTS migrations (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL UNIQUE,
+			description TEXT,
+			checksum CHAR(64) NULL,
+			applied_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		)`
+	}
+
+	_, err := mm.conn.Exec(query)
 	if err != nil {
 		return fmt.Errorf("failed to create migrations table: %w", err)
 	}
-	
+
 	return nil
 }
 
@@ -78,6 +243,24 @@ func (mm *MigrationManager) getMigrations() []Migration {
 				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 				INDEX idx_email (email)
 			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				email VARCHAR(255) UNIQUE NOT NULL,
+				password VARCHAR(255) NOT NULL,
+				first_name VARCHAR(100) NOT NULL,
+				last_name VARCHAR(100) NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS users (
+				id SERIAL PRIMARY KEY,
+				email VARCHAR(255) UNIQUE NOT NULL,
+				password VARCHAR(255) NOT NULL,
+				first_name VARCHAR(100) NOT NULL,
+				last_name VARCHAR(100) NOT NULL,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
 		},
 		{
 			ID:          2,
@@ -103,6 +286,44 @@ func (mm *MigrationManager) getMigrations() []Migration {
 				INDEX idx_created_at (created_at),
 				UNIQUE KEY unique_user_url (user_id, url)
 			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_results (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				url VARCHAR(500) NOT NULL,
+				html_version VARCHAR(50),
+				title VARCHAR(500),
+				headings TEXT,
+				internal_links INTEGER DEFAULT 0,
+				external_links INTEGER DEFAULT 0,
+				inaccessible_links INTEGER DEFAULT 0,
+				has_login_form BOOLEAN DEFAULT FALSE,
+				status VARCHAR(50) DEFAULT 'pending',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (user_id, url)
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_results_user_id ON crawl_results (user_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_results_status ON crawl_results (status);
+			CREATE INDEX IF NOT EXISTS idx_crawl_results_created_at ON crawl_results (created_at)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_results (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				url VARCHAR(500) NOT NULL,
+				html_version VARCHAR(50),
+				title VARCHAR(500),
+				headings JSONB,
+				internal_links INTEGER DEFAULT 0,
+				external_links INTEGER DEFAULT 0,
+				inaccessible_links INTEGER DEFAULT 0,
+				has_login_form BOOLEAN DEFAULT FALSE,
+				status VARCHAR(50) DEFAULT 'pending',
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (user_id, url)
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_results_user_id ON crawl_results (user_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_results_status ON crawl_results (status);
+			CREATE INDEX IF NOT EXISTS idx_crawl_results_created_at ON crawl_results (created_at)`,
 		},
 		{
 			ID:          3,
@@ -122,6 +343,32 @@ func (mm *MigrationManager) getMigrations() []Migration {
 				INDEX idx_link_type (link_type),
 				INDEX idx_is_accessible (is_accessible)
 			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_links (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				link_url VARCHAR(1000) NOT NULL,
+				link_text VARCHAR(500),
+				link_type VARCHAR(20) NOT NULL,
+				status_code INTEGER,
+				is_accessible BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_links_crawl_result_id ON crawl_links (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_links_link_type ON crawl_links (link_type);
+			CREATE INDEX IF NOT EXISTS idx_crawl_links_is_accessible ON crawl_links (is_accessible)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_links (
+				id SERIAL PRIMARY KEY,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				link_url VARCHAR(1000) NOT NULL,
+				link_text VARCHAR(500),
+				link_type VARCHAR(20) NOT NULL,
+				status_code INTEGER,
+				is_accessible BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_links_crawl_result_id ON crawl_links (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_links_link_type ON crawl_links (link_type);
+			CREATE INDEX IF NOT EXISTS idx_crawl_links_is_accessible ON crawl_links (is_accessible)`,
 		},
 		{
 			ID:          4,
@@ -138,106 +385,1452 @@ func (mm *MigrationManager) getMigrations() []Migration {
 				INDEX idx_crawl_result_id (crawl_result_id),
 				INDEX idx_heading_level (heading_level)
 			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_headings (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				heading_level VARCHAR(10) NOT NULL,
+				heading_text VARCHAR(500),
+				heading_order INTEGER,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_headings_crawl_result_id ON crawl_headings (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_headings_heading_level ON crawl_headings (heading_level)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_headings (
+				id SERIAL PRIMARY KEY,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				heading_level VARCHAR(10) NOT NULL,
+				heading_text VARCHAR(500),
+				heading_order INTEGER,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_headings_crawl_result_id ON crawl_headings (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_headings_heading_level ON crawl_headings (heading_level)`,
+		},
+		{
+			ID:          5,
+			Name:        "005_create_crawl_forms_table",
+			Description: "Create crawl_forms table for storing classified forms",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_forms (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				crawl_result_id INT NOT NULL,
+				form_type ENUM('login', 'signup', 'search', 'contact', 'newsletter', 'payment', 'other') NOT NULL,
+				form_action VARCHAR(1000),
+				form_method VARCHAR(10),
+				input_count INT DEFAULT 0,
+				has_password BOOLEAN DEFAULT FALSE,
+				insecure_action BOOLEAN DEFAULT FALSE,
+				password_missing_autocomplete BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (crawl_result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+				INDEX idx_crawl_result_id (crawl_result_id),
+				INDEX idx_form_type (form_type)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_forms (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				form_type VARCHAR(20) NOT NULL,
+				form_action VARCHAR(1000),
+				form_method VARCHAR(10),
+				input_count INTEGER DEFAULT 0,
+				has_password BOOLEAN DEFAULT FALSE,
+				insecure_action BOOLEAN DEFAULT FALSE,
+				password_missing_autocomplete BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_forms_crawl_result_id ON crawl_forms (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_forms_form_type ON crawl_forms (form_type)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_forms (
+				id SERIAL PRIMARY KEY,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				form_type VARCHAR(20) NOT NULL,
+				form_action VARCHAR(1000),
+				form_method VARCHAR(10),
+				input_count INTEGER DEFAULT 0,
+				has_password BOOLEAN DEFAULT FALSE,
+				insecure_action BOOLEAN DEFAULT FALSE,
+				password_missing_autocomplete BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_forms_crawl_result_id ON crawl_forms (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_forms_form_type ON crawl_forms (form_type)`,
+		},
+		{
+			ID:          6,
+			Name:        "006_create_crawl_security_table",
+			Description: "Create crawl_security table for HTTPS and TLS certificate checks",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_security (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				crawl_result_id INT NOT NULL,
+				is_https BOOLEAN DEFAULT FALSE,
+				redirects_to_https BOOLEAN DEFAULT FALSE,
+				tls_version VARCHAR(20),
+				cert_subject VARCHAR(255),
+				cert_issuer VARCHAR(255),
+				cert_expires_at TIMESTAMP NULL,
+				hostname_match BOOLEAN DEFAULT FALSE,
+				chain_valid BOOLEAN DEFAULT FALSE,
+				chain_error VARCHAR(500),
+				mixed_content_count INT DEFAULT 0,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (crawl_result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+				INDEX idx_crawl_result_id (crawl_result_id),
+				INDEX idx_cert_expires_at (cert_expires_at)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_security (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				is_https BOOLEAN DEFAULT FALSE,
+				redirects_to_https BOOLEAN DEFAULT FALSE,
+				tls_version VARCHAR(20),
+				cert_subject VARCHAR(255),
+				cert_issuer VARCHAR(255),
+				cert_expires_at TIMESTAMP NULL,
+				hostname_match BOOLEAN DEFAULT FALSE,
+				chain_valid BOOLEAN DEFAULT FALSE,
+				chain_error VARCHAR(500),
+				mixed_content_count INTEGER DEFAULT 0,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_security_crawl_result_id ON crawl_security (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_security_cert_expires_at ON crawl_security (cert_expires_at)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_security (
+				id SERIAL PRIMARY KEY,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				is_https BOOLEAN DEFAULT FALSE,
+				redirects_to_https BOOLEAN DEFAULT FALSE,
+				tls_version VARCHAR(20),
+				cert_subject VARCHAR(255),
+				cert_issuer VARCHAR(255),
+				cert_expires_at TIMESTAMPTZ NULL,
+				hostname_match BOOLEAN DEFAULT FALSE,
+				chain_valid BOOLEAN DEFAULT FALSE,
+				chain_error VARCHAR(500),
+				mixed_content_count INTEGER DEFAULT 0,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_security_crawl_result_id ON crawl_security (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_security_cert_expires_at ON crawl_security (cert_expires_at)`,
+		},
+		{
+			ID:          7,
+			Name:        "007_create_crawl_issues_table",
+			Description: "Create crawl_issues table for problems detected on crawled pages",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_issues (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				crawl_result_id INT NOT NULL,
+				category VARCHAR(50) NOT NULL,
+				severity ENUM('error', 'warning', 'info') NOT NULL,
+				code VARCHAR(100) NOT NULL,
+				message VARCHAR(1000) NOT NULL,
+				resource_url VARCHAR(1000),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (crawl_result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+				INDEX idx_crawl_result_id (crawl_result_id),
+				INDEX idx_category (category),
+				INDEX idx_severity (severity)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_issues (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				category VARCHAR(50) NOT NULL,
+				severity VARCHAR(20) NOT NULL,
+				code VARCHAR(100) NOT NULL,
+				message VARCHAR(1000) NOT NULL,
+				resource_url VARCHAR(1000),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_issues_crawl_result_id ON crawl_issues (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_issues_category ON crawl_issues (category);
+			CREATE INDEX IF NOT EXISTS idx_crawl_issues_severity ON crawl_issues (severity)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_issues (
+				id SERIAL PRIMARY KEY,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				category VARCHAR(50) NOT NULL,
+				severity VARCHAR(20) NOT NULL,
+				code VARCHAR(100) NOT NULL,
+				message VARCHAR(1000) NOT NULL,
+				resource_url VARCHAR(1000),
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_issues_crawl_result_id ON crawl_issues (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_issues_category ON crawl_issues (category);
+			CREATE INDEX IF NOT EXISTS idx_crawl_issues_severity ON crawl_issues (severity)`,
+		},
+		{
+			ID:          8,
+			Name:        "008_create_crawl_resources_table",
+			Description: "Create crawl_resources table for the page resource inventory",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_resources (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				crawl_result_id INT NOT NULL,
+				resource_url VARCHAR(1000) NOT NULL,
+				resource_type ENUM('script', 'stylesheet', 'preload', 'font', 'iframe') NOT NULL,
+				status_code INT DEFAULT 0,
+				size BIGINT DEFAULT 0,
+				content_type VARCHAR(255) DEFAULT '',
+				compression VARCHAR(50) DEFAULT '',
+				cache_control VARCHAR(255) DEFAULT '',
+				expires VARCHAR(100) DEFAULT '',
+				is_render_blocking BOOLEAN DEFAULT FALSE,
+				is_third_party BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (crawl_result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+				INDEX idx_crawl_result_id (crawl_result_id),
+				INDEX idx_resource_type (resource_type)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_resources (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				resource_url VARCHAR(1000) NOT NULL,
+				resource_type VARCHAR(20) NOT NULL,
+				status_code INTEGER DEFAULT 0,
+				size BIGINT DEFAULT 0,
+				content_type VARCHAR(255) DEFAULT '',
+				compression VARCHAR(50) DEFAULT '',
+				cache_control VARCHAR(255) DEFAULT '',
+				expires VARCHAR(100) DEFAULT '',
+				is_render_blocking BOOLEAN DEFAULT FALSE,
+				is_third_party BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_resources_crawl_result_id ON crawl_resources (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_resources_resource_type ON crawl_resources (resource_type)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_resources (
+				id SERIAL PRIMARY KEY,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				resource_url VARCHAR(1000) NOT NULL,
+				resource_type VARCHAR(20) NOT NULL,
+				status_code INTEGER DEFAULT 0,
+				size BIGINT DEFAULT 0,
+				content_type VARCHAR(255) DEFAULT '',
+				compression VARCHAR(50) DEFAULT '',
+				cache_control VARCHAR(255) DEFAULT '',
+				expires VARCHAR(100) DEFAULT '',
+				is_render_blocking BOOLEAN DEFAULT FALSE,
+				is_third_party BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_resources_crawl_result_id ON crawl_resources (crawl_result_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_resources_resource_type ON crawl_resources (resource_type)`,
+		},
+		{
+			ID:          9,
+			Name:        "009_add_html_size_to_crawl_results",
+			Description: "Add html_size column to crawl_results for page weight",
+			SQL:         `ALTER TABLE crawl_results ADD COLUMN html_size BIGINT DEFAULT 0 AFTER has_login_form`,
+			SQLite:      `ALTER TABLE crawl_results ADD COLUMN html_size BIGINT DEFAULT 0`,
+			Postgres:    `ALTER TABLE crawl_results ADD COLUMN html_size BIGINT DEFAULT 0`,
+		},
+		{
+			ID:          10,
+			Name:        "010_create_crawl_jobs_table",
+			Description: "Create crawl_jobs table for the persistent crawl queue",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_jobs (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				crawl_result_id INT NOT NULL,
+				user_id INT NOT NULL,
+				url VARCHAR(500) NOT NULL,
+				job_type ENUM('crawl', 'replay') NOT NULL DEFAULT 'crawl',
+				status ENUM('queued', 'running', 'done', 'failed', 'cancelled') NOT NULL DEFAULT 'queued',
+				attempts INT DEFAULT 0,
+				last_error TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				started_at TIMESTAMP NULL,
+				finished_at TIMESTAMP NULL,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (crawl_result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+				INDEX idx_status_id (status, id),
+				INDEX idx_crawl_result_id (crawl_result_id)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_jobs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				url VARCHAR(500) NOT NULL,
+				job_type VARCHAR(20) NOT NULL DEFAULT 'crawl',
+				status VARCHAR(20) NOT NULL DEFAULT 'queued',
+				attempts INTEGER DEFAULT 0,
+				last_error TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				started_at TIMESTAMP NULL,
+				finished_at TIMESTAMP NULL,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_jobs_status_id ON crawl_jobs (status, id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_jobs_crawl_result_id ON crawl_jobs (crawl_result_id)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_jobs (
+				id SERIAL PRIMARY KEY,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				url VARCHAR(500) NOT NULL,
+				job_type VARCHAR(20) NOT NULL DEFAULT 'crawl',
+				status VARCHAR(20) NOT NULL DEFAULT 'queued',
+				attempts INTEGER DEFAULT 0,
+				last_error TEXT,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				started_at TIMESTAMPTZ NULL,
+				finished_at TIMESTAMPTZ NULL,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_jobs_status_id ON crawl_jobs (status, id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_jobs_crawl_result_id ON crawl_jobs (crawl_result_id)`,
+		},
+		{
+			ID:          11,
+			Name:        "011_create_crawl_schedules_table",
+			Description: "Create crawl_schedules table for recurring crawls",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_schedules (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				cron_expr VARCHAR(100),
+				interval_minutes INT,
+				urls JSON NOT NULL,
+				enabled BOOLEAN DEFAULT TRUE,
+				last_run_at TIMESTAMP NULL,
+				next_run_at TIMESTAMP NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+				INDEX idx_user_id (user_id),
+				INDEX idx_enabled_next_run (enabled, next_run_at)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_schedules (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name VARCHAR(255) NOT NULL,
+				cron_expr VARCHAR(100),
+				interval_minutes INTEGER,
+				urls TEXT NOT NULL,
+				enabled BOOLEAN DEFAULT TRUE,
+				last_run_at TIMESTAMP NULL,
+				next_run_at TIMESTAMP NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_schedules_user_id ON crawl_schedules (user_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_schedules_enabled_next_run ON crawl_schedules (enabled, next_run_at)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_schedules (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name VARCHAR(255) NOT NULL,
+				cron_expr VARCHAR(100),
+				interval_minutes INTEGER,
+				urls JSONB NOT NULL,
+				enabled BOOLEAN DEFAULT TRUE,
+				last_run_at TIMESTAMPTZ NULL,
+				next_run_at TIMESTAMPTZ NULL,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_schedules_user_id ON crawl_schedules (user_id);
+			CREATE INDEX IF NOT EXISTS idx_crawl_schedules_enabled_next_run ON crawl_schedules (enabled, next_run_at)`,
+		},
+		{
+			ID:          12,
+			Name:        "012_add_error_columns_to_crawl_results",
+			Description: "Add error class and message columns to crawl_results",
+			SQL: `ALTER TABLE crawl_results
+				ADD COLUMN error_class VARCHAR(32) NULL AFTER status,
+				ADD COLUMN error_message TEXT NULL AFTER error_class`,
+			SQLite: `ALTER TABLE crawl_results ADD COLUMN error_class VARCHAR(32) NULL;
+			ALTER TABLE crawl_results ADD COLUMN error_message TEXT NULL`,
+			Postgres: `ALTER TABLE crawl_results
+				ADD COLUMN error_class VARCHAR(32) NULL,
+				ADD COLUMN error_message TEXT NULL`,
+		},
+		{
+			ID:          13,
+			Name:        "013_add_run_after_to_crawl_jobs",
+			Description: "Add run_after column to crawl_jobs for delayed retries",
+			SQL:         `ALTER TABLE crawl_jobs ADD COLUMN run_after TIMESTAMP NULL AFTER last_error`,
+			SQLite:      `ALTER TABLE crawl_jobs ADD COLUMN run_after TIMESTAMP NULL`,
+			Postgres:    `ALTER TABLE crawl_jobs ADD COLUMN run_after TIMESTAMPTZ NULL`,
+		},
+		{
+			ID:          14,
+			Name:        "014_create_webhooks_table",
+			Description: "Create webhooks table for outgoing crawl lifecycle events",
+			SQL: `CREATE TABLE IF NOT EXISTS webhooks (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				url VARCHAR(500) NOT NULL,
+				secret VARCHAR(255) NOT NULL,
+				events JSON NOT NULL,
+				enabled BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+				INDEX idx_user_id (user_id)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS webhooks (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				url VARCHAR(500) NOT NULL,
+				secret VARCHAR(255) NOT NULL,
+				events TEXT NOT NULL,
+				enabled BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks (user_id)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS webhooks (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				url VARCHAR(500) NOT NULL,
+				secret VARCHAR(255) NOT NULL,
+				events JSONB NOT NULL,
+				enabled BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks (user_id)`,
+		},
+		{
+			ID:          15,
+			Name:        "015_create_webhook_deliveries_table",
+			Description: "Create webhook_deliveries table logging every webhook delivery",
+			SQL: `CREATE TABLE IF NOT EXISTS webhook_deliveries (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				webhook_id INT NOT NULL,
+				event_type VARCHAR(50) NOT NULL,
+				payload JSON NOT NULL,
+				status ENUM('pending', 'succeeded', 'failed') NOT NULL DEFAULT 'pending',
+				attempts INT DEFAULT 0,
+				response_status INT,
+				last_error TEXT,
+				next_attempt_at TIMESTAMP NULL,
+				delivered_at TIMESTAMP NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+				INDEX idx_webhook_id (webhook_id),
+				INDEX idx_status_next_attempt (status, next_attempt_at)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS webhook_deliveries (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+				event_type VARCHAR(50) NOT NULL,
+				payload TEXT NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				attempts INTEGER DEFAULT 0,
+				response_status INTEGER,
+				last_error TEXT,
+				next_attempt_at TIMESTAMP NULL,
+				delivered_at TIMESTAMP NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
+			CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next_attempt ON webhook_deliveries (status, next_attempt_at)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS webhook_deliveries (
+				id SERIAL PRIMARY KEY,
+				webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+				event_type VARCHAR(50) NOT NULL,
+				payload JSON NOT NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				attempts INTEGER DEFAULT 0,
+				response_status INTEGER,
+				last_error TEXT,
+				next_attempt_at TIMESTAMPTZ NULL,
+				delivered_at TIMESTAMPTZ NULL,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
+			CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next_attempt ON webhook_deliveries (status, next_attempt_at)`,
+		},
+		{
+			ID:          16,
+			Name:        "016_create_user_usage_table",
+			Description: "Create user_usage table counting crawls and page fetches per user and day",
+			SQL: `CREATE TABLE IF NOT EXISTS user_usage (
+				user_id INT NOT NULL,
+				day DATE NOT NULL,
+				crawls INT NOT NULL DEFAULT 0,
+				pages INT NOT NULL DEFAULT 0,
+				PRIMARY KEY (user_id, day),
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+		},
+		{
+			ID:          17,
+			Name:        "017_add_user_status_index_to_crawl_jobs",
+			Description: "Index crawl_jobs by user and status for fair scheduling and quota checks",
+			SQL:         `ALTER TABLE crawl_jobs ADD INDEX idx_user_status (user_id, status)`,
+			SQLite:      `CREATE INDEX IF NOT EXISTS idx_crawl_jobs_user_status ON crawl_jobs (user_id, status)`,
+			Postgres:    `CREATE INDEX IF NOT EXISTS idx_crawl_jobs_user_status ON crawl_jobs (user_id, status)`,
+		},
+		{
+			ID:          18,
+			Name:        "018_add_interrupted_status_to_crawl_jobs",
+			Description: "Allow crawl jobs to be marked interrupted by a shutdown",
+			SQL: `ALTER TABLE crawl_jobs MODIFY COLUMN status
+				ENUM('queued', 'running', 'done', 'failed', 'cancelled', 'interrupted') NOT NULL DEFAULT 'queued'`,
+			SQLite:   `-- crawl_jobs.status is a plain VARCHAR in SQLite and accepts 'interrupted' as is`,
+			Postgres: `-- crawl_jobs.status is a plain VARCHAR in Postgres and accepts 'interrupted' as is`,
+		},
+		{
+			ID:          19,
+			Name:        "019_add_leases_to_crawl_jobs",
+			Description: "Add lease and cancellation columns to crawl_jobs for separate worker processes",
+			SQL: `ALTER TABLE crawl_jobs
+				ADD COLUMN lease_owner VARCHAR(255) NULL AFTER run_after,
+				ADD COLUMN lease_expires_at TIMESTAMP NULL AFTER lease_owner,
+				ADD COLUMN cancel_requested BOOLEAN NOT NULL DEFAULT FALSE AFTER lease_expires_at,
+				ADD INDEX idx_status_lease (status, lease_expires_at)`,
+			SQLite: `ALTER TABLE crawl_jobs ADD COLUMN lease_owner VARCHAR(255) NULL;
+			ALTER TABLE crawl_jobs ADD COLUMN lease_expires_at TIMESTAMP NULL;
+			ALTER TABLE crawl_jobs ADD COLUMN cancel_requested BOOLEAN NOT NULL DEFAULT FALSE;
+			CREATE INDEX IF NOT EXISTS idx_crawl_jobs_status_lease ON crawl_jobs (status, lease_expires_at)`,
+			Postgres: `ALTER TABLE crawl_jobs
+				ADD COLUMN lease_owner VARCHAR(255) NULL,
+				ADD COLUMN lease_expires_at TIMESTAMPTZ NULL,
+				ADD COLUMN cancel_requested BOOLEAN NOT NULL DEFAULT FALSE;
+			CREATE INDEX IF NOT EXISTS idx_crawl_jobs_status_lease ON crawl_jobs (status, lease_expires_at)`,
+		},
+		{
+			ID:          20,
+			Name:        "020_create_agents_table",
+			Description: "Create agents table for remote crawl agents",
+			SQL: `CREATE TABLE IF NOT EXISTS agents (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				token_hash CHAR(64) NOT NULL UNIQUE,
+				last_seen_at TIMESTAMP NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+				INDEX idx_user_id (user_id)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS agents (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name VARCHAR(255) NOT NULL,
+				token_hash CHAR(64) NOT NULL UNIQUE,
+				last_seen_at TIMESTAMP NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_agents_user_id ON agents (user_id)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS agents (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name VARCHAR(255) NOT NULL,
+				token_hash CHAR(64) NOT NULL UNIQUE,
+				last_seen_at TIMESTAMPTZ NULL,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_agents_user_id ON agents (user_id)`,
+		},
+		{
+			ID:          21,
+			Name:        "021_add_agent_id_to_crawl_results",
+			Description: "Assign crawl results to the remote agent crawling them",
+			SQL: `ALTER TABLE crawl_results
+				ADD COLUMN agent_id INT NULL AFTER user_id,
+				ADD FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE SET NULL`,
+			SQLite:   `ALTER TABLE crawl_results ADD COLUMN agent_id INTEGER NULL REFERENCES agents(id) ON DELETE SET NULL`,
+			Postgres: `ALTER TABLE crawl_results ADD COLUMN agent_id INTEGER NULL REFERENCES agents(id) ON DELETE SET NULL`,
+		},
+		{
+			ID:          22,
+			Name:        "022_add_agent_id_to_crawl_jobs",
+			Description: "Route crawl jobs to remote agents",
+			SQL: `ALTER TABLE crawl_jobs
+				ADD COLUMN agent_id INT NULL AFTER user_id,
+				ADD INDEX idx_agent_status (agent_id, status),
+				ADD FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE SET NULL`,
+			SQLite: `ALTER TABLE crawl_jobs ADD COLUMN agent_id INTEGER NULL REFERENCES agents(id) ON DELETE SET NULL;
+			CREATE INDEX IF NOT EXISTS idx_crawl_jobs_agent_status ON crawl_jobs (agent_id, status)`,
+			Postgres: `ALTER TABLE crawl_jobs ADD COLUMN agent_id INTEGER NULL REFERENCES agents(id) ON DELETE SET NULL;
+			CREATE INDEX IF NOT EXISTS idx_crawl_jobs_agent_status ON crawl_jobs (agent_id, status)`,
+		},
+		{
+			ID:          23,
+			Name:        "023_create_crawl_runs_table",
+			Description: "Create crawl_runs table keeping every execution of a crawl",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_runs (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				crawl_result_id INT NOT NULL,
+				run_type ENUM('crawl', 'replay') NOT NULL DEFAULT 'crawl',
+				status VARCHAR(50) NOT NULL DEFAULT 'running',
+				html_version VARCHAR(50),
+				title VARCHAR(500),
+				headings JSON,
+				internal_links INT DEFAULT 0,
+				external_links INT DEFAULT 0,
+				inaccessible_links INT DEFAULT 0,
+				has_login_form BOOLEAN DEFAULT FALSE,
+				html_size BIGINT DEFAULT 0,
+				error_class VARCHAR(32) NULL,
+				error_message TEXT NULL,
+				started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				finished_at TIMESTAMP NULL,
+				FOREIGN KEY (crawl_result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+				INDEX idx_crawl_result_id (crawl_result_id, id)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_runs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				run_type VARCHAR(20) NOT NULL DEFAULT 'crawl',
+				status VARCHAR(50) NOT NULL DEFAULT 'running',
+				html_version VARCHAR(50),
+				title VARCHAR(500),
+				headings TEXT,
+				internal_links INTEGER DEFAULT 0,
+				external_links INTEGER DEFAULT 0,
+				inaccessible_links INTEGER DEFAULT 0,
+				has_login_form BOOLEAN DEFAULT FALSE,
+				html_size BIGINT DEFAULT 0,
+				error_class VARCHAR(32) NULL,
+				error_message TEXT NULL,
+				started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				finished_at TIMESTAMP NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_runs_crawl_result_id ON crawl_runs (crawl_result_id, id)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_runs (
+				id SERIAL PRIMARY KEY,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				run_type VARCHAR(20) NOT NULL DEFAULT 'crawl',
+				status VARCHAR(50) NOT NULL DEFAULT 'running',
+				html_version VARCHAR(50),
+				title VARCHAR(500),
+				headings JSONB,
+				internal_links INTEGER DEFAULT 0,
+				external_links INTEGER DEFAULT 0,
+				inaccessible_links INTEGER DEFAULT 0,
+				has_login_form BOOLEAN DEFAULT FALSE,
+				html_size BIGINT DEFAULT 0,
+				error_class VARCHAR(32) NULL,
+				error_message TEXT NULL,
+				started_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				finished_at TIMESTAMPTZ NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_runs_crawl_result_id ON crawl_runs (crawl_result_id, id)`,
+		},
+		{
+			ID:          24,
+			Name:        "024_add_last_run_id_to_crawl_results",
+			Description: "Point crawl results at their latest run",
+			SQL:         `ALTER TABLE crawl_results ADD COLUMN last_run_id INT NULL AFTER agent_id`,
+			SQLite:      `ALTER TABLE crawl_results ADD COLUMN last_run_id INTEGER NULL`,
+			Postgres:    `ALTER TABLE crawl_results ADD COLUMN last_run_id INTEGER NULL`,
+		},
+		{
+			ID:          25,
+			Name:        "025_backfill_crawl_runs",
+			Description: "Create a run for every crawl result finished before runs existed",
+			SQL: `INSERT INTO crawl_runs (crawl_result_id, run_type, status, html_version, title, headings,
+				internal_links, external_links, inaccessible_links, has_login_form, html_size,
+				error_class, error_message, started_at, finished_at)
+				SELECT id, 'crawl', status, html_version, title, headings,
+				internal_links, external_links, inaccessible_links, has_login_form, html_size,
+				error_class, error_message, created_at, updated_at
+				FROM crawl_results WHERE status IN ('done', 'error', 'stopped', 'interrupted')`,
+		},
+		{
+			ID:          26,
+			Name:        "026_backfill_last_run_id",
+			Description: "Point crawl results at their backfilled run",
+			SQL: `UPDATE crawl_results r JOIN crawl_runs run ON run.crawl_result_id = r.id
+				SET r.last_run_id = run.id`,
+			SQLite: `UPDATE crawl_results
+				SET last_run_id = (SELECT MAX(id) FROM crawl_runs WHERE crawl_result_id = crawl_results.id)`,
+			Postgres: `UPDATE crawl_results
+				SET last_run_id = (SELECT MAX(id) FROM crawl_runs WHERE crawl_result_id = crawl_results.id)`,
+			Down: `UPDATE crawl_results SET last_run_id = NULL`,
+		},
+		{
+			ID:          27,
+			Name:        "027_add_crawl_run_id_to_crawl_links",
+			Description: "Scope links to the crawl run that found them",
+			SQL: `ALTER TABLE crawl_links
+				ADD COLUMN crawl_run_id INT NULL AFTER crawl_result_id,
+				ADD FOREIGN KEY (crawl_run_id) REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			SQLite:   `ALTER TABLE crawl_links ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Postgres: `ALTER TABLE crawl_links ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Down: `ALTER TABLE crawl_links DROP FOREIGN KEY fk_crawl_links_crawl_run_id;
+			ALTER TABLE crawl_links DROP COLUMN crawl_run_id`,
+			SQLiteDown:   `ALTER TABLE crawl_links DROP COLUMN crawl_run_id`,
+			PostgresDown: `ALTER TABLE crawl_links DROP COLUMN crawl_run_id`,
+		},
+		{
+			ID:          28,
+			Name:        "028_add_crawl_run_id_to_crawl_headings",
+			Description: "Scope headings to the crawl run that found them",
+			SQL: `ALTER TABLE crawl_headings
+				ADD COLUMN crawl_run_id INT NULL AFTER crawl_result_id,
+				ADD FOREIGN KEY (crawl_run_id) REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			SQLite:   `ALTER TABLE crawl_headings ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Postgres: `ALTER TABLE crawl_headings ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Down: `ALTER TABLE crawl_headings DROP FOREIGN KEY fk_crawl_headings_crawl_run_id;
+			ALTER TABLE crawl_headings DROP COLUMN crawl_run_id`,
+			SQLiteDown:   `ALTER TABLE crawl_headings DROP COLUMN crawl_run_id`,
+			PostgresDown: `ALTER TABLE crawl_headings DROP COLUMN crawl_run_id`,
+		},
+		{
+			ID:          29,
+			Name:        "029_add_crawl_run_id_to_crawl_forms",
+			Description: "Scope forms to the crawl run that found them",
+			SQL: `ALTER TABLE crawl_forms
+				ADD COLUMN crawl_run_id INT NULL AFTER crawl_result_id,
+				ADD FOREIGN KEY (crawl_run_id) REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			SQLite:   `ALTER TABLE crawl_forms ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Postgres: `ALTER TABLE crawl_forms ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Down: `ALTER TABLE crawl_forms DROP FOREIGN KEY fk_crawl_forms_crawl_run_id;
+			ALTER TABLE crawl_forms DROP COLUMN crawl_run_id`,
+			SQLiteDown:   `ALTER TABLE crawl_forms DROP COLUMN crawl_run_id`,
+			PostgresDown: `ALTER TABLE crawl_forms DROP COLUMN crawl_run_id`,
+		},
+		{
+			ID:          30,
+			Name:        "030_add_crawl_run_id_to_crawl_security",
+			Description: "Scope security checks to the crawl run that found them",
+			SQL: `ALTER TABLE crawl_security
+				ADD COLUMN crawl_run_id INT NULL AFTER crawl_result_id,
+				ADD FOREIGN KEY (crawl_run_id) REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			SQLite:   `ALTER TABLE crawl_security ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Postgres: `ALTER TABLE crawl_security ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Down: `ALTER TABLE crawl_security DROP FOREIGN KEY fk_crawl_security_crawl_run_id;
+			ALTER TABLE crawl_security DROP COLUMN crawl_run_id`,
+			SQLiteDown:   `ALTER TABLE crawl_security DROP COLUMN crawl_run_id`,
+			PostgresDown: `ALTER TABLE crawl_security DROP COLUMN crawl_run_id`,
+		},
+		{
+			ID:          31,
+			Name:        "031_add_crawl_run_id_to_crawl_issues",
+			Description: "Scope issues to the crawl run that found them",
+			SQL: `ALTER TABLE crawl_issues
+				ADD COLUMN crawl_run_id INT NULL AFTER crawl_result_id,
+				ADD FOREIGN KEY (crawl_run_id) REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			SQLite:   `ALTER TABLE crawl_issues ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Postgres: `ALTER TABLE crawl_issues ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Down: `ALTER TABLE crawl_issues DROP FOREIGN KEY fk_crawl_issues_crawl_run_id;
+			ALTER TABLE crawl_issues DROP COLUMN crawl_run_id`,
+			SQLiteDown:   `ALTER TABLE crawl_issues DROP COLUMN crawl_run_id`,
+			PostgresDown: `ALTER TABLE crawl_issues DROP COLUMN crawl_run_id`,
+		},
+		{
+			ID:          32,
+			Name:        "032_add_crawl_run_id_to_crawl_resources",
+			Description: "Scope resources to the crawl run that found them",
+			SQL: `ALTER TABLE crawl_resources
+				ADD COLUMN crawl_run_id INT NULL AFTER crawl_result_id,
+				ADD FOREIGN KEY (crawl_run_id) REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			SQLite:   `ALTER TABLE crawl_resources ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Postgres: `ALTER TABLE crawl_resources ADD COLUMN crawl_run_id INTEGER NULL REFERENCES crawl_runs(id) ON DELETE CASCADE`,
+			Down: `ALTER TABLE crawl_resources DROP FOREIGN KEY fk_crawl_resources_crawl_run_id;
+			ALTER TABLE crawl_resources DROP COLUMN crawl_run_id`,
+			SQLiteDown:   `ALTER TABLE crawl_resources DROP COLUMN crawl_run_id`,
+			PostgresDown: `ALTER TABLE crawl_resources DROP COLUMN crawl_run_id`,
+		},
+		{
+			ID:          33,
+			Name:        "033_backfill_crawl_run_id_of_crawl_links",
+			Description: "Assign existing links to the backfilled runs",
+			SQL: `UPDATE crawl_links d JOIN crawl_results r ON r.id = d.crawl_result_id
+				SET d.crawl_run_id = r.last_run_id`,
+			SQLite: `UPDATE crawl_links
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_links.crawl_result_id)`,
+			Postgres: `UPDATE crawl_links
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_links.crawl_result_id)`,
+			Down: `UPDATE crawl_links SET crawl_run_id = NULL`,
+		},
+		{
+			ID:          34,
+			Name:        "034_backfill_crawl_run_id_of_crawl_headings",
+			Description: "Assign existing headings to the backfilled runs",
+			SQL: `UPDATE crawl_headings d JOIN crawl_results r ON r.id = d.crawl_result_id
+				SET d.crawl_run_id = r.last_run_id`,
+			SQLite: `UPDATE crawl_headings
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_headings.crawl_result_id)`,
+			Postgres: `UPDATE crawl_headings
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_headings.crawl_result_id)`,
+			Down: `UPDATE crawl_headings SET crawl_run_id = NULL`,
+		},
+		{
+			ID:          35,
+			Name:        "035_backfill_crawl_run_id_of_crawl_forms",
+			Description: "Assign existing forms to the backfilled runs",
+			SQL: `UPDATE crawl_forms d JOIN crawl_results r ON r.id = d.crawl_result_id
+				SET d.crawl_run_id = r.last_run_id`,
+			SQLite: `UPDATE crawl_forms
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_forms.crawl_result_id)`,
+			Postgres: `UPDATE crawl_forms
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_forms.crawl_result_id)`,
+			Down: `UPDATE crawl_forms SET crawl_run_id = NULL`,
+		},
+		{
+			ID:          36,
+			Name:        "036_backfill_crawl_run_id_of_crawl_security",
+			Description: "Assign existing security checks to the backfilled runs",
+			SQL: `UPDATE crawl_security d JOIN crawl_results r ON r.id = d.crawl_result_id
+				SET d.crawl_run_id = r.last_run_id`,
+			SQLite: `UPDATE crawl_security
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_security.crawl_result_id)`,
+			Postgres: `UPDATE crawl_security
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_security.crawl_result_id)`,
+			Down: `UPDATE crawl_security SET crawl_run_id = NULL`,
+		},
+		{
+			ID:          37,
+			Name:        "037_backfill_crawl_run_id_of_crawl_issues",
+			Description: "Assign existing issues to the backfilled runs",
+			SQL: `UPDATE crawl_issues d JOIN crawl_results r ON r.id = d.crawl_result_id
+				SET d.crawl_run_id = r.last_run_id`,
+			SQLite: `UPDATE crawl_issues
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_issues.crawl_result_id)`,
+			Postgres: `UPDATE crawl_issues
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_issues.crawl_result_id)`,
+			Down: `UPDATE crawl_issues SET crawl_run_id = NULL`,
+		},
+		{
+			ID:          38,
+			Name:        "038_backfill_crawl_run_id_of_crawl_resources",
+			Description: "Assign existing resources to the backfilled runs",
+			SQL: `UPDATE crawl_resources d JOIN crawl_results r ON r.id = d.crawl_result_id
+				SET d.crawl_run_id = r.last_run_id`,
+			SQLite: `UPDATE crawl_resources
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_resources.crawl_result_id)`,
+			Postgres: `UPDATE crawl_resources
+				SET crawl_run_id = (SELECT last_run_id FROM crawl_results WHERE id = crawl_resources.crawl_result_id)`,
+			Down: `UPDATE crawl_resources SET crawl_run_id = NULL`,
+		},
+		{
+			ID:          39,
+			Name:        "039_add_meta_description_to_crawl_results",
+			Description: "Add meta description column to crawl_results",
+			SQL:         `ALTER TABLE crawl_results ADD COLUMN meta_description TEXT NULL AFTER title`,
+			SQLite:      `ALTER TABLE crawl_results ADD COLUMN meta_description TEXT NULL`,
+			Postgres:    `ALTER TABLE crawl_results ADD COLUMN meta_description TEXT NULL`,
+			Down:        `ALTER TABLE crawl_results DROP COLUMN meta_description`,
+		},
+		{
+			ID:          40,
+			Name:        "040_add_meta_description_to_crawl_runs",
+			Description: "Add meta description column to crawl_runs",
+			SQL:         `ALTER TABLE crawl_runs ADD COLUMN meta_description TEXT NULL AFTER title`,
+			SQLite:      `ALTER TABLE crawl_runs ADD COLUMN meta_description TEXT NULL`,
+			Postgres:    `ALTER TABLE crawl_runs ADD COLUMN meta_description TEXT NULL`,
+			Down:        `ALTER TABLE crawl_runs DROP COLUMN meta_description`,
+		},
+		{
+			ID:          41,
+			Name:        "041_create_crawl_snapshots_table",
+			Description: "Create crawl_snapshots table referencing the raw responses of crawl runs",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_snapshots (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				crawl_result_id INT NOT NULL,
+				crawl_run_id INT NOT NULL,
+				final_url VARCHAR(2048) NOT NULL,
+				status_code INT DEFAULT 0,
+				content_type VARCHAR(255) DEFAULT '',
+				body_hash CHAR(64) NOT NULL,
+				headers_hash CHAR(64) NOT NULL,
+				body_size BIGINT DEFAULT 0,
+				fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (crawl_result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+				FOREIGN KEY (crawl_run_id) REFERENCES crawl_runs(id) ON DELETE CASCADE,
+				UNIQUE KEY unique_crawl_run_id (crawl_run_id),
+				INDEX idx_body_hash (body_hash),
+				INDEX idx_headers_hash (headers_hash)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_snapshots (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				crawl_run_id INTEGER NOT NULL UNIQUE REFERENCES crawl_runs(id) ON DELETE CASCADE,
+				final_url VARCHAR(2048) NOT NULL,
+				status_code INTEGER DEFAULT 0,
+				content_type VARCHAR(255) DEFAULT '',
+				body_hash CHAR(64) NOT NULL,
+				headers_hash CHAR(64) NOT NULL,
+				body_size BIGINT DEFAULT 0,
+				fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_snapshots_body_hash ON crawl_snapshots (body_hash);
+			CREATE INDEX IF NOT EXISTS idx_crawl_snapshots_headers_hash ON crawl_snapshots (headers_hash)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_snapshots (
+				id SERIAL PRIMARY KEY,
+				crawl_result_id INTEGER NOT NULL REFERENCES crawl_results(id) ON DELETE CASCADE,
+				crawl_run_id INTEGER NOT NULL UNIQUE REFERENCES crawl_runs(id) ON DELETE CASCADE,
+				final_url VARCHAR(2048) NOT NULL,
+				status_code INTEGER DEFAULT 0,
+				content_type VARCHAR(255) DEFAULT '',
+				body_hash CHAR(64) NOT NULL,
+				headers_hash CHAR(64) NOT NULL,
+				body_size BIGINT DEFAULT 0,
+				fetched_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_snapshots_body_hash ON crawl_snapshots (body_hash);
+			CREATE INDEX IF NOT EXISTS idx_crawl_snapshots_headers_hash ON crawl_snapshots (headers_hash)`,
+			Down: `DROP TABLE IF EXISTS crawl_snapshots`,
+		},
+		{
+			ID:          42,
+			Name:        "042_add_reanalyze_to_crawl_jobs",
+			Description: "Allow jobs re-analyzing the snapshot of an earlier run",
+			SQL: `ALTER TABLE crawl_jobs
+				MODIFY COLUMN job_type ENUM('crawl', 'replay', 'reanalyze') NOT NULL DEFAULT 'crawl',
+				ADD COLUMN source_run_id INT NULL AFTER job_type`,
+			SQLite:   `ALTER TABLE crawl_jobs ADD COLUMN source_run_id INTEGER NULL`,
+			Postgres: `ALTER TABLE crawl_jobs ADD COLUMN source_run_id INTEGER NULL`,
+			Down: `ALTER TABLE crawl_jobs
+				MODIFY COLUMN job_type ENUM('crawl', 'replay') NOT NULL DEFAULT 'crawl',
+				DROP COLUMN source_run_id`,
+			SQLiteDown:   `ALTER TABLE crawl_jobs DROP COLUMN source_run_id`,
+			PostgresDown: `ALTER TABLE crawl_jobs DROP COLUMN source_run_id`,
+		},
+		{
+			ID:          43,
+			Name:        "043_add_reanalyze_to_crawl_runs",
+			Description: "Record re-analysis runs and the run they read their snapshot from",
+			SQL: `ALTER TABLE crawl_runs
+				MODIFY COLUMN run_type ENUM('crawl', 'replay', 'reanalyze') NOT NULL DEFAULT 'crawl',
+				ADD COLUMN source_run_id INT NULL AFTER run_type`,
+			SQLite:   `ALTER TABLE crawl_runs ADD COLUMN source_run_id INTEGER NULL`,
+			Postgres: `ALTER TABLE crawl_runs ADD COLUMN source_run_id INTEGER NULL`,
+			Down: `ALTER TABLE crawl_runs
+				MODIFY COLUMN run_type ENUM('crawl', 'replay') NOT NULL DEFAULT 'crawl',
+				DROP COLUMN source_run_id`,
+			SQLiteDown:   `ALTER TABLE crawl_runs DROP COLUMN source_run_id`,
+			PostgresDown: `ALTER TABLE crawl_runs DROP COLUMN source_run_id`,
+		},
+		{
+			ID:          44,
+			Name:        "044_create_user_retention_table",
+			Description: "Create user_retention table overriding the retention policy per user",
+			SQL: `CREATE TABLE IF NOT EXISTS user_retention (
+				user_id INT NOT NULL PRIMARY KEY,
+				keep_runs INT NULL,
+				max_age_days INT NULL,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS user_retention (
+				user_id INTEGER NOT NULL PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				keep_runs INTEGER NULL,
+				max_age_days INTEGER NULL,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+			Down: `DROP TABLE IF EXISTS user_retention`,
+		},
+		{
+			ID:           45,
+			Name:         "045_add_started_at_index_to_crawl_runs",
+			Description:  "Index crawl_runs by start time for purging old runs",
+			SQL:          `ALTER TABLE crawl_runs ADD INDEX idx_started_at (started_at)`,
+			SQLite:       `CREATE INDEX IF NOT EXISTS idx_crawl_runs_started_at ON crawl_runs (started_at)`,
+			Postgres:     `CREATE INDEX IF NOT EXISTS idx_crawl_runs_started_at ON crawl_runs (started_at)`,
+			Down:         `ALTER TABLE crawl_runs DROP INDEX idx_started_at`,
+			SQLiteDown:   `DROP INDEX IF EXISTS idx_crawl_runs_started_at`,
+			PostgresDown: `DROP INDEX IF EXISTS idx_crawl_runs_started_at`,
+		},
+		{
+			ID:          46,
+			Name:        "046_create_crawl_search_table",
+			Description: "Create crawl_search table indexing the text of the latest run of every crawl result",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_search (
+				crawl_result_id INT NOT NULL PRIMARY KEY,
+				crawl_run_id INT NOT NULL,
+				title TEXT NOT NULL,
+				meta_description TEXT NOT NULL,
+				headings MEDIUMTEXT NOT NULL,
+				anchors MEDIUMTEXT NOT NULL,
+				body MEDIUMTEXT NOT NULL,
+				FOREIGN KEY (crawl_result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+				FOREIGN KEY (crawl_run_id) REFERENCES crawl_runs(id) ON DELETE CASCADE,
+				FULLTEXT INDEX ft_title (title),
+				FULLTEXT INDEX ft_content (title, meta_description, headings, anchors, body)
+			)`,
+			// The FTS5 index reads its text from crawl_search, triggers keep it in sync
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_search (
+				crawl_result_id INTEGER NOT NULL PRIMARY KEY REFERENCES crawl_results(id) ON DELETE CASCADE,
+				crawl_run_id INTEGER NOT NULL REFERENCES crawl_runs(id) ON DELETE CASCADE,
+				title TEXT NOT NULL,
+				meta_description TEXT NOT NULL,
+				headings TEXT NOT NULL,
+				anchors TEXT NOT NULL,
+				body TEXT NOT NULL
+			);
+			CREATE VIRTUAL TABLE IF NOT EXISTS crawl_search_fts USING fts5(
+				title, meta_description, headings, anchors, body,
+				content='crawl_search', content_rowid='crawl_result_id',
+				tokenize='porter unicode61 remove_diacritics 2'
+			);
+			CREATE TRIGGER IF NOT EXISTS crawl_search_insert AFTER INSERT ON crawl_search BEGIN
+				INSERT INTO crawl_search_fts (rowid, title, meta_description, headings, anchors, body)
+				VALUES (new.crawl_result_id, new.title, new.meta_description, new.headings, new.anchors, new.body);
+			END;
+			CREATE TRIGGER IF NOT EXISTS crawl_search_delete AFTER DELETE ON crawl_search BEGIN
+				INSERT INTO crawl_search_fts (crawl_search_fts, rowid, title, meta_description, headings, anchors, body)
+				VALUES ('delete', old.crawl_result_id, old.title, old.meta_description, old.headings, old.anchors, old.body);
+			END`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_search (
+				crawl_result_id INTEGER NOT NULL PRIMARY KEY REFERENCES crawl_results(id) ON DELETE CASCADE,
+				crawl_run_id INTEGER NOT NULL REFERENCES crawl_runs(id) ON DELETE CASCADE,
+				title TEXT NOT NULL,
+				meta_description TEXT NOT NULL,
+				headings TEXT NOT NULL,
+				anchors TEXT NOT NULL,
+				body TEXT NOT NULL,
+				document TSVECTOR GENERATED ALWAYS AS (
+					setweight(to_tsvector('english', title), 'A') ||
+					setweight(to_tsvector('english', meta_description), 'B') ||
+					setweight(to_tsvector('english', headings), 'B') ||
+					setweight(to_tsvector('english', anchors), 'C') ||
+					setweight(to_tsvector('english', body), 'D')
+				) STORED
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_search_document ON crawl_search USING GIN (document)`,
+			Down: `DROP TABLE IF EXISTS crawl_search`,
+			SQLiteDown: `DROP TABLE IF EXISTS crawl_search_fts;
+			DROP TABLE IF EXISTS crawl_search`,
+		},
+		{
+			ID:          47,
+			Name:        "047_add_active_job_index_to_crawl_jobs",
+			Description: "Allow a single queued or running job per crawl result",
+			// MySQL has no partial indexes, the generated column is NULL for
+			// inactive jobs and NULLs never collide in a unique index
+			SQL: `ALTER TABLE crawl_jobs
+				ADD COLUMN active_crawl_result_id INT GENERATED ALWAYS AS
+					(CASE WHEN status IN ('queued', 'running') THEN crawl_result_id END) STORED,
+				ADD UNIQUE INDEX uq_active_crawl_result_id (active_crawl_result_id)`,
+			SQLite: `CREATE UNIQUE INDEX IF NOT EXISTS uq_crawl_jobs_active ON crawl_jobs (crawl_result_id)
+				WHERE status IN ('queued', 'running')`,
+			Postgres: `CREATE UNIQUE INDEX IF NOT EXISTS uq_crawl_jobs_active ON crawl_jobs (crawl_result_id)
+				WHERE status IN ('queued', 'running')`,
+			Down: `ALTER TABLE crawl_jobs
+				DROP INDEX uq_active_crawl_result_id,
+				DROP COLUMN active_crawl_result_id`,
+			SQLiteDown:   `DROP INDEX IF EXISTS uq_crawl_jobs_active`,
+			PostgresDown: `DROP INDEX IF EXISTS uq_crawl_jobs_active`,
+		},
+		{
+			ID:          48,
+			Name:        "048_create_crawl_events_table",
+			Description: "Create crawl_events table relaying crawl progress between processes",
+			SQL: `CREATE TABLE IF NOT EXISTS crawl_events (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				source VARCHAR(255) NOT NULL,
+				user_id INT NOT NULL,
+				payload TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_created_at (created_at)
+			)`,
+			SQLite: `CREATE TABLE IF NOT EXISTS crawl_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				source VARCHAR(255) NOT NULL,
+				user_id INTEGER NOT NULL,
+				payload TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_events_created_at ON crawl_events (created_at)`,
+			Postgres: `CREATE TABLE IF NOT EXISTS crawl_events (
+				id BIGSERIAL PRIMARY KEY,
+				source VARCHAR(255) NOT NULL,
+				user_id INTEGER NOT NULL,
+				payload TEXT NOT NULL,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_crawl_events_created_at ON crawl_events (created_at)`,
+			Down: `DROP TABLE IF EXISTS crawl_events`,
+		},
+		{
+			ID:          49,
+			Name:        "049_name_crawl_run_foreign_keys",
+			Description: "Give the crawl_run_id foreign keys the names their rollbacks drop",
+			// MySQL named the constraints added by 027 to 032 itself, the
+			// generated name is looked up and the constraint added again
+			SQL:      perRunTable(mysqlNameRunForeignKey),
+			SQLite:   `-- SQLite constraints have no name to change`,
+			Postgres: perRunTable(`ALTER TABLE {table} RENAME CONSTRAINT {table}_crawl_run_id_fkey TO fk_{table}_crawl_run_id`),
+			// The constraints keep their names, the downs of 027 to 032 drop them by these names
+			Down:         `-- MySQL constraints keep their names`,
+			SQLiteDown:   `-- SQLite constraints have no name to change`,
+			PostgresDown: perRunTable(`ALTER TABLE {table} RENAME CONSTRAINT fk_{table}_crawl_run_id TO {table}_crawl_run_id_fkey`),
+		},
+		{
+			ID:          50,
+			Name:        "050_create_user_page_usage_table",
+			Description: "Create user_page_usage table counting the pages of every user per month",
+			// Starts from the pages fetched so far this month
+			SQL:      userPageUsageTable + ";\n" + seedUserPageUsage(`DATE_FORMAT(CURDATE(), '%Y-%m-01')`),
+			SQLite:   userPageUsageTable + ";\n" + seedUserPageUsage(`DATE('now', 'start of month')`),
+			Postgres: userPageUsageTable + ";\n" + seedUserPageUsage(`CAST(DATE_TRUNC('month', CURRENT_DATE) AS DATE)`),
+			Down:     `DROP TABLE IF EXISTS user_page_usage`,
 		},
 	}
 }
 
-// runPendingMigrations runs all migrations that haven't been applied yet
-func (mm *MigrationManager) runPendingMigrations(migrations []Migration) error {
-	for _, migration := range migrations {
-		applied, err := mm.isMigrationApplied(migration.Name)
-		if err != nil {
-			return fmt.Errorf("failed to check migration status: %w", err)
-		}
+// userPageUsageTable creates the table of migration 050
+const userPageUsageTable = `CREATE TABLE IF NOT EXISTS user_page_usage (
+				user_id INT NOT NULL,
+				month DATE NOT NULL,
+				pages INT NOT NULL DEFAULT 0,
+				PRIMARY KEY (user_id, month),
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`
+
+// seedUserPageUsage copies the pages counted per day in user_usage since
+// monthStart into user_page_usage
+func seedUserPageUsage(monthStart string) string {
+	return `INSERT INTO user_page_usage (user_id, month, pages)
+			SELECT user_id, ` + monthStart + `, SUM(pages) FROM user_usage WHERE day >= ` + monthStart + ` GROUP BY user_id`
+}
+
+// runTables are the tables scoped to a crawl run by migrations 027 to 032
+var runTables = []string{"crawl_links", "crawl_headings", "crawl_forms", "crawl_security", "crawl_issues", "crawl_resources"}
+
+// mysqlNameRunForeignKey replaces the crawl_run_id foreign key of a table by
+// one named fk_{table}_crawl_run_id, whatever its current name
+const mysqlNameRunForeignKey = `SET @fk = (SELECT CONSTRAINT_NAME FROM information_schema.KEY_COLUMN_USAGE
+				WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = '{table}' AND COLUMN_NAME = 'crawl_run_id'
+				AND REFERENCED_TABLE_NAME IS NOT NULL LIMIT 1);
+			SET @drop_fk = IF(@fk IS NULL, 'DO 0', CONCAT('ALTER TABLE {table} DROP FOREIGN KEY ` + "`" + `', @fk, '` + "`" + `'));
+			PREPARE drop_fk FROM @drop_fk;
+			EXECUTE drop_fk;
+			DEALLOCATE PREPARE drop_fk;
+			ALTER TABLE {table} ADD CONSTRAINT fk_{table}_crawl_run_id FOREIGN KEY (crawl_run_id) REFERENCES crawl_runs(id) ON DELETE CASCADE`
+
+// perRunTable repeats statement for each of runTables, in place of {table}
+func perRunTable(statement string) string {
+	statements := make([]string, 0, len(runTables))
+	for _, table := range runTables {
+		statements = append(statements, strings.ReplaceAll(statement, "{table}", table))
+	}
+	return strings.Join(statements, ";\n")
+}
 
-		if applied {
-			log.Printf("Migration %s already applied, skipping", migration.Name)
+// Up applies every pending migration in order and returns them. It refuses
+// to run when an applied migration was modified since.
+func (mm *MigrationManager) Up() ([]Migration, error) {
+	unlock, err := mm.conn.Lock(migrationLock, migrationLockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer unlock()
+
+	applied, err := mm.appliedMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	if err := mm.verifyChecksums(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range mm.getMigrations() {
+		if _, ok := applied[migration.Name]; ok {
 			continue
 		}
+		if err := mm.apply(migration); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first, and
+// returns them. Nothing is rolled back when one of them cannot be.
+func (mm *MigrationManager) Down(steps int) ([]Migration, error) {
+	unlock, err := mm.conn.Lock(migrationLock, migrationLockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer unlock()
+
+	return mm.down(steps)
+}
+
+// Redo rolls back the last steps applied migrations and applies them again,
+// recording their current checksums. It returns them in the order applied.
+func (mm *MigrationManager) Redo(steps int) ([]Migration, error) {
+	unlock, err := mm.conn.Lock(migrationLock, migrationLockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer unlock()
+
+	reverted, err := mm.down(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(reverted) - 1; i >= 0; i-- {
+		if err := mm.apply(reverted[i]); err != nil {
+			return done, err
+		}
+		done = append(done, reverted[i])
+	}
+
+	return done, nil
+}
 
-		log.Printf("Applying migration: %s - %s", migration.Name, migration.Description)
-		
-		tx, err := mm.conn.DB.Begin()
-		if err != nil {
-			return fmt.Errorf("failed to begin transaction: %w", err)
+// down rolls back the last steps applied migrations, the lock being held
+func (mm *MigrationManager) down(steps int) ([]Migration, error) {
+	applied, err := mm.appliedMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	migrations := mm.getMigrations()
+	var targets []Migration
+	for i := len(migrations) - 1; i >= 0 && len(targets) < steps; i-- {
+		if _, ok := applied[migrations[i].Name]; ok {
+			targets = append(targets, migrations[i])
 		}
+	}
 
-		if _, err := tx.Exec(migration.SQL); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to execute migration %s: %w", migration.Name, err)
+	for _, migration := range targets {
+		if migration.downStatement(mm.conn.Dialect) == "" {
+			return nil, fmt.Errorf("%w: %s", ErrIrreversibleMigration, migration.Name)
 		}
+	}
 
-		if err := mm.recordMigrationApplied(tx, migration); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to record migration %s: %w", migration.Name, err)
+	var done []Migration
+	for _, migration := range targets {
+		if err := mm.revert(migration); err != nil {
+			return done, err
 		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// apply runs a migration and records it as applied, in one transaction.
+// MySQL commits every DDL statement on its own, so there a migration failing
+// part way keeps the statements run before the failure and is not recorded.
+// The error tells how far it got, the rest has to be finished or undone by
+// hand before running it again.
+func (mm *MigrationManager) apply(migration Migration) error {
+	statements := splitStatements(migration.statement(mm.conn.Dialect))
+	if mm.DryRun != nil {
+		mm.printDryRun("up", migration, statements)
+		return nil
+	}
+
+	log.Printf("Applying migration: %s - %s", migration.Name, migration.Description)
+
+	tx, err := mm.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit migration %s: %w", migration.Name, err)
+	// SQLite has no advisory lock, another instance may have got here first
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM migrations WHERE name = ?", migration.Name).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check migration status: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	for i, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			if mm.conn.Dialect == DialectMySQL && i > 0 {
+				return fmt.Errorf("failed to execute statement %d of migration %s, the statements before it may have been committed: %w",
+					i+1, migration.Name, err)
+			}
+			return fmt.Errorf("failed to execute migration %s: %w", migration.Name, err)
 		}
+	}
 
-		log.Printf("Successfully applied migration: %s", migration.Name)
+	if err := mm.recordMigrationApplied(tx, migration); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migration.Name, err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", migration.Name, err)
+	}
+
+	log.Printf("Successfully applied migration: %s", migration.Name)
 	return nil
 }
 
-// isMigrationApplied checks if a migration has already been applied
-func (mm *MigrationManager) isMigrationApplied(name string) (bool, error) {
-	var count int
-	err := mm.conn.DB.QueryRow("SELECT COUNT(*) FROM migrations WHERE name = ?", name).Scan(&count)
+// revert undoes a migration and forgets it was applied, in one transaction
+// except on MySQL, as for apply
+func (mm *MigrationManager) revert(migration Migration) error {
+	statements := splitStatements(migration.downStatement(mm.conn.Dialect))
+	if mm.DryRun != nil {
+		mm.printDryRun("down", migration, statements)
+		return nil
+	}
+
+	log.Printf("Rolling back migration: %s - %s", migration.Name, migration.Description)
+
+	tx, err := mm.conn.Begin()
 	if err != nil {
-		return false, err
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	return count > 0, nil
+	defer tx.Rollback()
+
+	for i, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			if mm.conn.Dialect == DialectMySQL && i > 0 {
+				return fmt.Errorf("failed to roll back statement %d of migration %s, the statements before it may have been committed: %w",
+					i+1, migration.Name, err)
+			}
+			return fmt.Errorf("failed to roll back migration %s: %w", migration.Name, err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM migrations WHERE name = ?", migration.Name); err != nil {
+		return fmt.Errorf("failed to record rollback of migration %s: %w", migration.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rollback of migration %s: %w", migration.Name, err)
+	}
+
+	log.Printf("Successfully rolled back migration: %s", migration.Name)
+	return nil
+}
+
+// printDryRun writes the statements a migration would run in direction
+func (mm *MigrationManager) printDryRun(direction string, migration Migration, statements []string) {
+	fmt.Fprintf(mm.DryRun, "-- %s %s: %s\n", direction, migration.Name, migration.Description)
+	for _, statement := range statements {
+		fmt.Fprintf(mm.DryRun, "%s;\n", statement)
+	}
+	fmt.Fprintln(mm.DryRun)
 }
 
 // recordMigrationApplied records that a migration has been applied
-func (mm *MigrationManager) recordMigrationApplied(tx *sql.Tx, migration Migration) error {
-	query := `INSERT INTO migrations (name, description, applied_at) VALUES (?, ?, ?)`
-	_, err := tx.Exec(query, migration.Name, migration.Description, time.Now())
+func (mm *MigrationManager) recordMigrationApplied(tx *Tx, migration Migration) error {
+	query := `INSERT INTO migrations (name, description, checksum, applied_at) VALUES (?, ?, ?, ?)`
+	_, err := tx.Exec(query, migration.Name, migration.Description, migration.checksum(mm.conn.Dialect), time.Now())
 	return err
 }
 
-// GetMigrationStatus returns the status of all migrations
-func (mm *MigrationManager) GetMigrationStatus() ([]map[string]interface{}, error) {
-	query := `
-		SELECT 
-			m.name,
-			m.description,
-			m.applied_at,
-			CASE WHEN m.name IS NOT NULL THEN 'applied' ELSE 'pending' END as status
-		FROM migrations m
-		ORDER BY m.applied_at
-	`
-	
-	rows, err := mm.conn.DB.Query(query)
+// appliedMigration is a row of the migrations table
+type appliedMigration struct {
+	description string
+	checksum    sql.NullString
+	appliedAt   sql.NullTime
+}
+
+// appliedMigrations returns the applied migrations by name
+func (mm *MigrationManager) appliedMigrations() (map[string]appliedMigration, error) {
+	query := `SELECT name, description, checksum, applied_at FROM migrations`
+	if mm.DryRun != nil {
+		// Prepare did not create or upgrade the table, read it as it is
+		if _, err := mm.conn.Exec(`SELECT name FROM migrations WHERE 1 = 0`); err != nil {
+			return map[string]appliedMigration{}, nil
+		}
+		if _, err := mm.conn.Exec(`SELECT checksum FROM migrations WHERE 1 = 0`); err != nil {
+			query = `SELECT name, description, CAST(NULL AS CHAR(64)), applied_at FROM migrations`
+		}
+	}
+
+	rows, err := mm.conn.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var statusList []map[string]interface{}
+	applied := make(map[string]appliedMigration)
 	for rows.Next() {
-		var name, description, status string
-		var appliedAt sql.NullTime
-		
-		if err := rows.Scan(&name, &description, &appliedAt, &status); err != nil {
+		var name string
+		var description sql.NullString
+		var row appliedMigration
+		if err := rows.Scan(&name, &description, &row.checksum, &row.appliedAt); err != nil {
 			return nil, err
 		}
+		row.description = description.String
+		applied[name] = row
+	}
+
+	return applied, rows.Err()
+}
 
-		statusMap := map[string]interface{}{
-			"name":        name,
-			"description": description,
-			"status":      status,
+// verifyChecksums fails when an applied migration was edited since. Migrations
+// applied before checksums were recorded are trusted and get theirs now.
+func (mm *MigrationManager) verifyChecksums(applied map[string]appliedMigration) error {
+	var modified []string
+	for _, migration := range mm.getMigrations() {
+		row, ok := applied[migration.Name]
+		if !ok {
+			continue
 		}
-		
-		if appliedAt.Valid {
-			statusMap["applied_at"] = appliedAt.Time
+
+		checksum := migration.checksum(mm.conn.Dialect)
+		if !row.checksum.Valid {
+			if mm.DryRun != nil {
+				continue
+			}
+			if _, err := mm.conn.Exec(`UPDATE migrations SET checksum = ? WHERE name = ?`, checksum, migration.Name); err != nil {
+				return fmt.Errorf("failed to record checksum of migration %s: %w", migration.Name, err)
+			}
+			continue
+		}
+		if row.checksum.String != checksum {
+			modified = append(modified, migration.Name)
+		}
+	}
+
+	if len(modified) > 0 {
+		return fmt.Errorf("%w: %s", ErrMigrationModified, strings.Join(modified, ", "))
+	}
+	return nil
+}
+
+// GetMigrationStatus returns the status of every migration compiled into the
+// binary, in order, followed by applied migrations it does not know about
+func (mm *MigrationManager) GetMigrationStatus() ([]models.MigrationStatus, error) {
+	applied, err := mm.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statusList []models.MigrationStatus
+	known := make(map[string]bool)
+	for _, migration := range mm.getMigrations() {
+		known[migration.Name] = true
+		status := models.MigrationStatus{
+			ID:          migration.ID,
+			Name:        migration.Name,
+			Description: migration.Description,
+			Status:      models.MigrationStatusPending,
+			Reversible:  migration.downStatement(mm.conn.Dialect) != "",
+		}
+
+		if row, ok := applied[migration.Name]; ok {
+			status.Status = models.MigrationStatusApplied
+			if row.checksum.Valid && row.checksum.String != migration.checksum(mm.conn.Dialect) {
+				status.Status = models.MigrationStatusModified
+			}
+			if row.appliedAt.Valid {
+				status.AppliedAt = &row.appliedAt.Time
+			}
 		}
 
-		statusList = append(statusList, statusMap)
+		statusList = append(statusList, status)
+	}
+
+	// Applied by a newer version of the application
+	var unknown []string
+	for name := range applied {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		row := applied[name]
+		status := models.MigrationStatus{
+			Name:        name,
+			Description: row.description,
+			Status:      models.MigrationStatusUnknown,
+		}
+		if row.appliedAt.Valid {
+			status.AppliedAt = &row.appliedAt.Time
+		}
+		statusList = append(statusList, status)
 	}
 
 	return statusList, nil
-} 
\ No newline at end of file
+}
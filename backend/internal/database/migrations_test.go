@@ -0,0 +1,297 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// newSQLiteConnection opens an empty SQLite database in a temporary directory
+func newSQLiteConnection(t *testing.T) *Connection {
+	t.Helper()
+	conn, err := NewConnection("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewConnection: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "single",
+			sql:  `ALTER TABLE t ADD COLUMN c INT`,
+			want: []string{`ALTER TABLE t ADD COLUMN c INT`},
+		},
+		{
+			name: "several",
+			sql: `CREATE TABLE t (id INT);
+			CREATE INDEX idx_t ON t (id);`,
+			want: []string{`CREATE TABLE t (id INT)`, `CREATE INDEX idx_t ON t (id)`},
+		},
+		{
+			name: "semicolons in literals and comments",
+			sql: `INSERT INTO t VALUES ('a;b', "c;d"); -- e;f
+			UPDATE t SET v = 'it''s;'`,
+			want: []string{`INSERT INTO t VALUES ('a;b', "c;d")`, "-- e;f\n\t\t\tUPDATE t SET v = 'it''s;'"},
+		},
+		{
+			name: "trigger body",
+			sql: `CREATE TRIGGER tr AFTER INSERT ON t BEGIN
+				INSERT INTO u VALUES (new.id);
+				DELETE FROM v WHERE id = CASE WHEN new.id > 0 THEN new.id END;
+			END;
+			DROP TABLE w`,
+			want: []string{`CREATE TRIGGER tr AFTER INSERT ON t BEGIN
+				INSERT INTO u VALUES (new.id);
+				DELETE FROM v WHERE id = CASE WHEN new.id > 0 THEN new.id END;
+			END`, `DROP TABLE w`},
+		},
+		{
+			name: "comments only",
+			sql:  `-- nothing to do in this dialect`,
+			want: nil,
+		},
+		{
+			name: "identifiers holding keywords",
+			sql:  `UPDATE t SET backend = 1, case_id = 2; SELECT 1`,
+			want: []string{`UPDATE t SET backend = 1, case_id = 2`, `SELECT 1`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrationChecksums(t *testing.T) {
+	conn := newSQLiteConnection(t)
+	mm := NewMigrationManager(conn)
+	if err := mm.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	migrations := mm.getMigrations()
+	first, last := migrations[0], migrations[len(migrations)-1]
+
+	// Migrations applied before checksums existed are trusted and get theirs
+	if _, err := conn.Exec(`UPDATE migrations SET checksum = NULL WHERE name = ?`, first.Name); err != nil {
+		t.Fatalf("clearing checksum: %v", err)
+	}
+	if _, err := mm.Up(); err != nil {
+		t.Fatalf("Up with a missing checksum: %v", err)
+	}
+	var checksum string
+	if err := conn.QueryRow(`SELECT checksum FROM migrations WHERE name = ?`, first.Name).Scan(&checksum); err != nil {
+		t.Fatalf("reading checksum: %v", err)
+	}
+	if checksum != first.checksum(DialectSQLite) {
+		t.Errorf("recorded checksum = %q, want %q", checksum, first.checksum(DialectSQLite))
+	}
+
+	// An applied migration edited since is refused and reported
+	if _, err := conn.Exec(`UPDATE migrations SET checksum = ? WHERE name = ?`, "edited", last.Name); err != nil {
+		t.Fatalf("editing checksum: %v", err)
+	}
+	if _, err := mm.Up(); !errors.Is(err, ErrMigrationModified) {
+		t.Errorf("Up with an edited migration error = %v, want ErrMigrationModified", err)
+	}
+
+	statuses, err := mm.GetMigrationStatus()
+	if err != nil {
+		t.Fatalf("GetMigrationStatus: %v", err)
+	}
+	byName := make(map[string]string)
+	for _, status := range statuses {
+		byName[status.Name] = status.Status
+	}
+	if got := byName[last.Name]; got != models.MigrationStatusModified {
+		t.Errorf("status of edited migration = %q, want %q", got, models.MigrationStatusModified)
+	}
+	if got := byName[first.Name]; got != models.MigrationStatusApplied {
+		t.Errorf("status of untouched migration = %q, want %q", got, models.MigrationStatusApplied)
+	}
+}
+
+func TestShippedMigrationsUnchanged(t *testing.T) {
+	// Checksums recorded by databases migrated with earlier releases. Editing
+	// these migrations makes those databases refuse to start, fix them with a
+	// new migration instead.
+	shipped := map[string]string{
+		"027_add_crawl_run_id_to_crawl_links":     "2e06946b2fd8baec6d935d45f87de391599877764bbb745fa20eef1dacff93ce",
+		"028_add_crawl_run_id_to_crawl_headings":  "062c18b4500d11801e40cdc19d7bfc616c3ea776183ec07e5cf827cb9429d796",
+		"029_add_crawl_run_id_to_crawl_forms":     "a35d6a45bf0b675928c69109677fdb58a2356339c46306615f7e3cb4221c817a",
+		"030_add_crawl_run_id_to_crawl_security":  "7c66c42b31490cd73f02c62a13569ca96ce8965381ae930a69f4df9dec6666c3",
+		"031_add_crawl_run_id_to_crawl_issues":    "b73e566454f5ce368fdb89ae5d80ba38333bfcaf42401b5f07f5e295e7d99d07",
+		"032_add_crawl_run_id_to_crawl_resources": "5b6a4fc4e46338df8f947dea767d1c3af81d21b8cdc4c1edcbca096f612c1274",
+	}
+
+	found := 0
+	for _, migration := range (&MigrationManager{}).getMigrations() {
+		want, ok := shipped[migration.Name]
+		if !ok {
+			continue
+		}
+		found++
+		if got := migration.checksum(DialectMySQL); got != want {
+			t.Errorf("MySQL checksum of %s = %s, want %s", migration.Name, got, want)
+		}
+	}
+	if found != len(shipped) {
+		t.Errorf("found %d of %d shipped migrations", found, len(shipped))
+	}
+}
+
+func TestNameRunForeignKeysStatements(t *testing.T) {
+	var migration Migration
+	for _, m := range (&MigrationManager{}).getMigrations() {
+		if m.Name == "049_name_crawl_run_foreign_keys" {
+			migration = m
+		}
+	}
+
+	// The constraint name is read and dropped in the same session, one statement at a time
+	statements := splitStatements(migration.statement(DialectMySQL))
+	if len(statements) != 6*len(runTables) {
+		t.Fatalf("MySQL migration has %d statements, want %d", len(statements), 6*len(runTables))
+	}
+	for i, table := range runTables {
+		add := statements[6*i+5]
+		if !strings.HasPrefix(add, "ALTER TABLE "+table+" ADD CONSTRAINT fk_"+table+"_crawl_run_id ") {
+			t.Errorf("last statement for %s = %q", table, add)
+		}
+	}
+
+	// SQLite has nothing to rename but the migration can still be rolled back
+	if got := splitStatements(migration.statement(DialectSQLite)); len(got) != 0 {
+		t.Errorf("SQLite statements = %q, want none", got)
+	}
+	if migration.downStatement(DialectSQLite) == "" {
+		t.Error("SQLite migration cannot be rolled back")
+	}
+}
+
+func TestMigrationDryRun(t *testing.T) {
+	conn := newSQLiteConnection(t)
+	var out bytes.Buffer
+	mm := NewMigrationManager(conn)
+	mm.DryRun = &out
+
+	if err := mm.Prepare(); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	migrations, err := mm.Up()
+	if err != nil {
+		t.Fatalf("dry run Up: %v", err)
+	}
+	if len(migrations) != len(mm.getMigrations()) {
+		t.Errorf("dry run Up listed %d migrations, want %d", len(migrations), len(mm.getMigrations()))
+	}
+	if !strings.Contains(out.String(), "-- up 001_") || !strings.Contains(out.String(), "CREATE TABLE") {
+		t.Errorf("dry run output lacks the migrations:\n%.200s", out.String())
+	}
+
+	// Not even the migrations table is created
+	var tables int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables); err != nil {
+		t.Fatalf("counting tables: %v", err)
+	}
+	if tables != 0 {
+		t.Errorf("dry run created %d tables", tables)
+	}
+
+	// On a migrated database a dry rollback prints the down and keeps the migration
+	if err := NewMigrationManager(conn).Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	out.Reset()
+	reverted, err := mm.Down(1)
+	if err != nil || len(reverted) != 1 {
+		t.Fatalf("dry run Down(1) = %d migrations, %v", len(reverted), err)
+	}
+	if !strings.Contains(out.String(), "-- down "+reverted[0].Name) {
+		t.Errorf("dry run output = %q, want the down of %s", out.String(), reverted[0].Name)
+	}
+	statuses, err := mm.GetMigrationStatus()
+	if err != nil {
+		t.Fatalf("GetMigrationStatus: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Status != models.MigrationStatusApplied {
+			t.Errorf("status of %s after a dry rollback = %q", status.Name, status.Status)
+		}
+	}
+}
+
+func TestMigrationStatusPending(t *testing.T) {
+	conn := newSQLiteConnection(t)
+	mm := NewMigrationManager(conn)
+	if err := mm.Prepare(); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+
+	statuses, err := mm.GetMigrationStatus()
+	if err != nil {
+		t.Fatalf("GetMigrationStatus: %v", err)
+	}
+	if len(statuses) != len(mm.getMigrations()) {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(mm.getMigrations()))
+	}
+	for _, status := range statuses {
+		if status.Status != models.MigrationStatusPending {
+			t.Errorf("status of %s = %q, want %q", status.Name, status.Status, models.MigrationStatusPending)
+		}
+	}
+}
+
+func TestMigrationsRollBackAndReapply(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, conn *Connection) {
+		mm := NewMigrationManager(conn)
+		if err := mm.Initialize(); err != nil {
+			t.Fatalf("Initialize: %v", err)
+		}
+
+		reversible := 0
+		migrations := mm.getMigrations()
+		for i := len(migrations) - 1; i >= 0 && migrations[i].downStatement(conn.Dialect) != ""; i-- {
+			reversible++
+		}
+
+		redone, err := mm.Redo(reversible)
+		if err != nil {
+			t.Fatalf("Redo(%d): %v", reversible, err)
+		}
+		if len(redone) != reversible {
+			t.Errorf("Redo(%d) reapplied %d migrations", reversible, len(redone))
+		}
+
+		// The baseline cannot be rolled back, and nothing is when it is reached
+		if _, err := mm.Down(reversible + 1); !errors.Is(err, ErrIrreversibleMigration) {
+			t.Errorf("Down past the baseline error = %v, want ErrIrreversibleMigration", err)
+		}
+
+		statuses, err := mm.GetMigrationStatus()
+		if err != nil {
+			t.Fatalf("GetMigrationStatus: %v", err)
+		}
+		for _, status := range statuses {
+			if status.Status != models.MigrationStatusApplied {
+				t.Errorf("status of %s after Redo = %q, want %q", status.Name, status.Status, models.MigrationStatusApplied)
+			}
+		}
+	})
+}
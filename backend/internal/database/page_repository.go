@@ -0,0 +1,200 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// SavePageResult stores everything a run found on a page and finishes the run,
+// in a single transaction: either the whole result is stored or none of it.
+// The crawl result summary is only updated while the run is its latest one.
+// Snapshot blobs are written beforehand, blobs of a failed save are left
+// unreferenced.
+func (r *CrawlRepository) SavePageResult(runID int, page *models.PageResult) error {
+	data := page.Data
+
+	hasSnapshot := false
+	if page.Snapshot != nil {
+		var err error
+		if hasSnapshot, err = r.putSnapshot(page.Snapshot); err != nil {
+			return err
+		}
+	}
+
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var crawlResultID int
+	err = tx.QueryRow(`SELECT crawl_result_id FROM crawl_runs WHERE id = ?`, runID).Scan(&crawlResultID)
+	if err != nil {
+		return fmt.Errorf("failed to get crawl run: %w", err)
+	}
+
+	links := make([][]interface{}, len(data.Links))
+	for i, link := range data.Links {
+		links[i] = []interface{}{crawlResultID, runID, link.URL, link.Text, link.Type, link.StatusCode, link.IsAccessible}
+	}
+	if err := tx.InsertRows("crawl_links", []string{"crawl_result_id", "crawl_run_id", "link_url", "link_text",
+		"link_type", "status_code", "is_accessible"}, links); err != nil {
+		return fmt.Errorf("failed to create links: %w", err)
+	}
+
+	headings := make([][]interface{}, len(data.HeadingDetails))
+	for i, heading := range data.HeadingDetails {
+		headings[i] = []interface{}{crawlResultID, runID, heading.Level, heading.Text, heading.Order}
+	}
+	if err := tx.InsertRows("crawl_headings", []string{"crawl_result_id", "crawl_run_id", "heading_level",
+		"heading_text", "heading_order"}, headings); err != nil {
+		return fmt.Errorf("failed to create headings: %w", err)
+	}
+
+	forms := make([][]interface{}, len(data.Forms))
+	for i, form := range data.Forms {
+		forms[i] = []interface{}{crawlResultID, runID, form.Type, form.Action, form.Method, form.InputCount,
+			form.HasPassword, form.InsecureAction, form.PasswordMissingAutocomplete}
+	}
+	if err := tx.InsertRows("crawl_forms", []string{"crawl_result_id", "crawl_run_id", "form_type", "form_action",
+		"form_method", "input_count", "has_password", "insecure_action", "password_missing_autocomplete"}, forms); err != nil {
+		return fmt.Errorf("failed to create forms: %w", err)
+	}
+
+	issues := make([][]interface{}, len(data.Issues))
+	for i, issue := range data.Issues {
+		issues[i] = []interface{}{crawlResultID, runID, issue.Category, issue.Severity, issue.Code, issue.Message, issue.URL}
+	}
+	if err := tx.InsertRows("crawl_issues", []string{"crawl_result_id", "crawl_run_id", "category", "severity",
+		"code", "message", "resource_url"}, issues); err != nil {
+		return fmt.Errorf("failed to create issues: %w", err)
+	}
+
+	resources := make([][]interface{}, len(data.Resources))
+	for i, resource := range data.Resources {
+		resources[i] = []interface{}{crawlResultID, runID, resource.URL, resource.Type, resource.StatusCode, resource.Size,
+			resource.ContentType, resource.Compression, resource.CacheControl, resource.Expires,
+			resource.IsRenderBlocking, resource.IsThirdParty}
+	}
+	if err := tx.InsertRows("crawl_resources", []string{"crawl_result_id", "crawl_run_id", "resource_url",
+		"resource_type", "status_code", "size", "content_type", "compression", "cache_control", "expires",
+		"is_render_blocking", "is_third_party"}, resources); err != nil {
+		return fmt.Errorf("failed to create resources: %w", err)
+	}
+
+	if security := data.Security; security != nil {
+		var certExpiresAt interface{}
+		if security.CertExpiresAt != nil {
+			certExpiresAt = *security.CertExpiresAt
+		}
+		_, err := tx.Exec(`
+			INSERT INTO crawl_security (crawl_result_id, crawl_run_id, is_https, redirects_to_https, tls_version, cert_subject,
+				cert_issuer, cert_expires_at, hostname_match, chain_valid, chain_error, mixed_content_count)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, crawlResultID, runID, security.IsHTTPS, security.RedirectsToHTTPS, security.TLSVersion, security.CertSubject,
+			security.CertIssuer, certExpiresAt, security.HostnameMatch, security.ChainValid, security.ChainError,
+			security.MixedContentCount)
+		if err != nil {
+			return fmt.Errorf("failed to create security check: %w", err)
+		}
+	}
+
+	if hasSnapshot {
+		snapshot := page.Snapshot
+		id, err := tx.Insert(`
+			INSERT INTO crawl_snapshots (crawl_result_id, crawl_run_id, final_url, status_code, content_type,
+				body_hash, headers_hash, body_size, fetched_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, crawlResultID, runID, snapshot.URL, snapshot.StatusCode, snapshot.ContentType,
+			snapshot.BodyHash, snapshot.HeadersHash, snapshot.BodySize, snapshot.FetchedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot: %w", err)
+		}
+		snapshot.ID = int(id)
+		snapshot.RunID = runID
+	}
+
+	// A failed run leaves the text of the last successful crawl searchable
+	if data.Status == "error" {
+		err = finishRunWithError(tx, crawlResultID, runID, data.ErrorClass, data.ErrorMessage)
+	} else if err = finishRun(tx, crawlResultID, runID, data); err == nil {
+		err = indexPage(tx, crawlResultID, runID, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit page result: %w", err)
+	}
+	return nil
+}
+
+// finishRun records the page summary of a run and of its crawl result, clearing any error
+func finishRun(tx *Tx, crawlResultID, runID int, data *models.CrawlData) error {
+	headingsJSON, _ := json.Marshal(data.Headings)
+
+	// Handle nullable values
+	var htmlVersion, title, metaDescription interface{}
+	if data.HTMLVersion.Valid {
+		htmlVersion = data.HTMLVersion.String
+	}
+	if data.Title.Valid {
+		title = data.Title.String
+	}
+	if data.MetaDescription.Valid {
+		metaDescription = data.MetaDescription.String
+	}
+
+	_, err := tx.Exec(`
+		UPDATE crawl_results
+		SET html_version = ?, title = ?, meta_description = ?, headings = ?, internal_links = ?,
+			external_links = ?, inaccessible_links = ?, has_login_form = ?, html_size = ?,
+			status = ?, error_class = NULL, error_message = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND last_run_id = ?
+	`, htmlVersion, title, metaDescription, headingsJSON, data.InternalLinks,
+		data.ExternalLinks, data.InaccessibleLinks, data.HasLoginForm, data.HTMLSize, data.Status, crawlResultID, runID)
+	if err != nil {
+		return fmt.Errorf("failed to update crawl data: %w", err)
+	}
+
+	// Finished runs are never changed
+	_, err = tx.Exec(`
+		UPDATE crawl_runs
+		SET html_version = ?, title = ?, meta_description = ?, headings = ?, internal_links = ?,
+			external_links = ?, inaccessible_links = ?, has_login_form = ?, html_size = ?,
+			status = ?, finished_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND finished_at IS NULL
+	`, htmlVersion, title, metaDescription, headingsJSON, data.InternalLinks,
+		data.ExternalLinks, data.InaccessibleLinks, data.HasLoginForm, data.HTMLSize, data.Status, runID)
+	if err != nil {
+		return fmt.Errorf("failed to finish crawl run: %w", err)
+	}
+	return nil
+}
+
+// finishRunWithError marks a run and its crawl result as failed and records
+// why, leaving the summary of the last successful crawl in place
+func finishRunWithError(tx *Tx, crawlResultID, runID int, errorClass, errorMessage sql.NullString) error {
+	_, err := tx.Exec(`
+		UPDATE crawl_results
+		SET status = 'error', error_class = ?, error_message = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND last_run_id = ?
+	`, errorClass, errorMessage, crawlResultID, runID)
+	if err != nil {
+		return fmt.Errorf("failed to update crawl error: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE crawl_runs
+		SET status = 'error', error_class = ?, error_message = ?, finished_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND finished_at IS NULL
+	`, errorClass, errorMessage, runID)
+	if err != nil {
+		return fmt.Errorf("failed to finish crawl run: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/blob"
+)
+
+// countRunRows returns the rows of each page detail table stored for a run
+func countRunRows(t *testing.T, conn *Connection, runID int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for _, table := range []string{"crawl_links", "crawl_headings", "crawl_forms", "crawl_issues", "crawl_resources", "crawl_security", "crawl_snapshots"} {
+		var n int
+		if err := conn.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE crawl_run_id = ?`, runID).Scan(&n); err != nil {
+			t.Fatalf("counting %s: %v", table, err)
+		}
+		counts[table] = n
+	}
+	return counts
+}
+
+// testPage returns a crawled page with every kind of detail, and links
+// enough to take several multi-row inserts
+func testPage(links int) *models.PageResult {
+	data := &models.CrawlData{
+		Status:          "done",
+		Title:           sql.NullString{String: "Example", Valid: true},
+		MetaDescription: sql.NullString{String: "An example page", Valid: true},
+		HTMLVersion:     sql.NullString{String: "HTML5", Valid: true},
+		Headings:        map[string]int{"h1": 1, "h2": 1},
+		HTMLSize:        1234,
+		HeadingDetails: []models.HeadingData{
+			{Level: "h1", Text: "Welcome", Order: 1},
+			{Level: "h2", Text: "Details", Order: 2},
+		},
+		Forms: []models.FormData{
+			{Type: "login", Action: "http://example.com/login", Method: "POST", InputCount: 2, HasPassword: true, InsecureAction: true},
+		},
+		Issues: []models.IssueData{
+			{Category: "security", Severity: "error", Code: "insecure_form", Message: "Form posts over HTTP", URL: "http://example.com/login"},
+		},
+		Resources: []models.ResourceData{
+			{URL: "https://example.com/app.js", Type: "script", StatusCode: 200, Size: 5120, ContentType: "text/javascript", IsRenderBlocking: true},
+		},
+		Security: &models.SecurityData{IsHTTPS: true, TLSVersion: "TLS 1.3", CertSubject: "example.com", HostnameMatch: true, ChainValid: true},
+	}
+	for i := 0; i < links; i++ {
+		data.Links = append(data.Links, models.LinkData{
+			URL: fmt.Sprintf("https://example.com/page/%d", i), Text: "Page", Type: "internal", StatusCode: 200, IsAccessible: true,
+		})
+		data.InternalLinks++
+	}
+	return &models.PageResult{
+		Data: data,
+		Snapshot: &models.Snapshot{
+			URL:         "https://example.com/",
+			StatusCode:  200,
+			ContentType: "text/html",
+			FetchedAt:   time.Now().UTC().Truncate(time.Second),
+			Headers:     http.Header{"Content-Type": {"text/html"}},
+			Body:        []byte("<html><title>Example</title></html>"),
+		},
+	}
+}
+
+func TestSavePageResult(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, conn *Connection) {
+		repo := NewCrawlRepository(conn, blob.NewFSStore(t.TempDir()))
+		userID := createTestUser(t, conn, "page@example.com")
+		resultID, err := repo.CreateCrawlResult(userID, "https://example.com/")
+		if err != nil {
+			t.Fatalf("CreateCrawlResult: %v", err)
+		}
+		runID, err := repo.StartCrawlRun(resultID, models.JobTypeCrawl, 0)
+		if err != nil {
+			t.Fatalf("StartCrawlRun: %v", err)
+		}
+
+		page := testPage(maxInsertRows*2 + 1)
+		if err := repo.SavePageResult(runID, page); err != nil {
+			t.Fatalf("SavePageResult: %v", err)
+		}
+
+		want := map[string]int{"crawl_links": maxInsertRows*2 + 1, "crawl_headings": 2, "crawl_forms": 1, "crawl_issues": 1,
+			"crawl_resources": 1, "crawl_security": 1, "crawl_snapshots": 1}
+		if got := countRunRows(t, conn, runID); !reflect.DeepEqual(got, want) {
+			t.Errorf("rows stored = %v, want %v", got, want)
+		}
+
+		links, err := repo.GetLinksByRunID(runID)
+		if err != nil {
+			t.Fatalf("GetLinksByRunID: %v", err)
+		}
+		if len(links) != len(page.Data.Links) || links[len(links)-1].URL != page.Data.Links[len(links)-1].URL {
+			t.Errorf("links read back = %d, want the %d stored, in order", len(links), len(page.Data.Links))
+		}
+		forms, err := repo.GetFormsByRunID(runID)
+		if err != nil {
+			t.Fatalf("GetFormsByRunID: %v", err)
+		}
+		if len(forms) != 1 || forms[0].Type != "login" || !forms[0].HasPassword || !forms[0].InsecureAction {
+			t.Errorf("forms = %+v, want the insecure login form", forms)
+		}
+		security, err := repo.GetSecurityCheckByRunID(runID)
+		if err != nil {
+			t.Fatalf("GetSecurityCheckByRunID: %v", err)
+		}
+		if !security.IsHTTPS || security.TLSVersion != "TLS 1.3" || !security.ChainValid {
+			t.Errorf("security check = %+v, want the stored one", security)
+		}
+		snapshot, err := repo.GetSnapshotByRunID(runID)
+		if err != nil {
+			t.Fatalf("GetSnapshotByRunID: %v", err)
+		}
+		if string(snapshot.Body) != string(page.Snapshot.Body) || snapshot.Headers.Get("Content-Type") != "text/html" {
+			t.Errorf("snapshot = %+v, want the stored body and headers", snapshot)
+		}
+
+		// The run and its crawl result carry the page summary
+		run, err := repo.GetCrawlRun(resultID, runID)
+		if err != nil {
+			t.Fatalf("GetCrawlRun: %v", err)
+		}
+		result, err := repo.GetCrawlResultByID(userID, resultID)
+		if err != nil {
+			t.Fatalf("GetCrawlResultByID: %v", err)
+		}
+		for name, data := range map[string]models.CrawlData{"run": run.CrawlData, "crawl result": result.CrawlData} {
+			if data.Status != "done" || data.Title.String != "Example" || data.InternalLinks != maxInsertRows*2+1 || data.Headings["h2"] != 1 {
+				t.Errorf("%s = %+v, want the summary of the page", name, data)
+			}
+		}
+		if run.FinishedAt == nil {
+			t.Error("run not finished")
+		}
+	})
+}
+
+func TestSavePageResultIsAtomic(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, conn *Connection) {
+		repo := NewCrawlRepository(conn, nil)
+		userID := createTestUser(t, conn, "atomic@example.com")
+		resultID, err := repo.CreateCrawlResult(userID, "https://example.com/")
+		if err != nil {
+			t.Fatalf("CreateCrawlResult: %v", err)
+		}
+		runID, err := repo.StartCrawlRun(resultID, models.JobTypeCrawl, 0)
+		if err != nil {
+			t.Fatalf("StartCrawlRun: %v", err)
+		}
+
+		// The security check is stored after the links, headings and others
+		if _, err := conn.Exec(`DROP TABLE crawl_security`); err != nil {
+			t.Fatalf("dropping crawl_security: %v", err)
+		}
+		if err := repo.SavePageResult(runID, testPage(maxInsertRows+1)); err == nil {
+			t.Fatal("SavePageResult succeeded without a security table")
+		}
+
+		for _, table := range []string{"crawl_links", "crawl_headings", "crawl_forms", "crawl_issues", "crawl_resources"} {
+			var n int
+			if err := conn.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE crawl_run_id = ?`, runID).Scan(&n); err != nil {
+				t.Fatalf("counting %s: %v", table, err)
+			}
+			if n != 0 {
+				t.Errorf("%d rows left in %s by the failed save, want none", n, table)
+			}
+		}
+		run, err := repo.GetCrawlRun(resultID, runID)
+		if err != nil {
+			t.Fatalf("GetCrawlRun: %v", err)
+		}
+		if run.FinishedAt != nil || run.CrawlData.Title.Valid {
+			t.Errorf("run = %+v, want it left running without a summary", run)
+		}
+		result, err := repo.GetCrawlResultByID(userID, resultID)
+		if err != nil {
+			t.Fatalf("GetCrawlResultByID: %v", err)
+		}
+		if result.CrawlData.Status != "pending" || result.CrawlData.Title.Valid {
+			t.Errorf("crawl result = %+v, want it untouched", result.CrawlData)
+		}
+	})
+}
+
+func TestSavePageResultOfOlderRun(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, conn *Connection) {
+		repo := NewCrawlRepository(conn, nil)
+		userID := createTestUser(t, conn, "older@example.com")
+		resultID, err := repo.CreateCrawlResult(userID, "https://example.com/")
+		if err != nil {
+			t.Fatalf("CreateCrawlResult: %v", err)
+		}
+		older, err := repo.StartCrawlRun(resultID, models.JobTypeCrawl, 0)
+		if err != nil {
+			t.Fatalf("StartCrawlRun: %v", err)
+		}
+		newer := saveTestRun(t, repo, resultID, "Newer")
+
+		// A run finishing after a newer one stores its details but leaves the summary alone
+		if err := repo.SavePageResult(older, testPage(1)); err != nil {
+			t.Fatalf("SavePageResult: %v", err)
+		}
+		result, err := repo.GetCrawlResultByID(userID, resultID)
+		if err != nil {
+			t.Fatalf("GetCrawlResultByID: %v", err)
+		}
+		if result.CrawlData.Title.String != "Newer" {
+			t.Errorf("crawl result title = %q, want the one of run %d", result.CrawlData.Title.String, newer)
+		}
+		run, err := repo.GetCrawlRun(resultID, older)
+		if err != nil {
+			t.Fatalf("GetCrawlRun: %v", err)
+		}
+		if run.CrawlData.Title.String != "Example" || run.FinishedAt == nil {
+			t.Errorf("older run = %+v, want it finished with its own summary", run)
+		}
+
+		// A finished run is never changed
+		again := testPage(0)
+		again.Data.Title.String = "Changed"
+		again.Snapshot = nil
+		if err := repo.SavePageResult(older, again); err != nil {
+			t.Fatalf("SavePageResult again: %v", err)
+		}
+		if run, err := repo.GetCrawlRun(resultID, older); err != nil || run.CrawlData.Title.String != "Example" {
+			t.Errorf("finished run title = %q, %v, want Example kept", run.CrawlData.Title.String, err)
+		}
+	})
+}
+
+func TestSavePageResultWithError(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, conn *Connection) {
+		repo := NewCrawlRepository(conn, nil)
+		userID := createTestUser(t, conn, "failed@example.com")
+		resultID, err := repo.CreateCrawlResult(userID, "https://example.com/")
+		if err != nil {
+			t.Fatalf("CreateCrawlResult: %v", err)
+		}
+		saveTestRun(t, repo, resultID, "Working")
+
+		runID, err := repo.StartCrawlRun(resultID, models.JobTypeCrawl, 0)
+		if err != nil {
+			t.Fatalf("StartCrawlRun: %v", err)
+		}
+		failed := &models.CrawlData{
+			Status:       "error",
+			Headings:     map[string]int{},
+			ErrorClass:   sql.NullString{String: "timeout", Valid: true},
+			ErrorMessage: sql.NullString{String: "request timed out", Valid: true},
+		}
+		if err := repo.SavePageResult(runID, &models.PageResult{Data: failed}); err != nil {
+			t.Fatalf("SavePageResult: %v", err)
+		}
+
+		// The failure is recorded over the summary of the last working crawl
+		result, err := repo.GetCrawlResultByID(userID, resultID)
+		if err != nil {
+			t.Fatalf("GetCrawlResultByID: %v", err)
+		}
+		if result.CrawlData.Status != "error" || result.CrawlData.ErrorClass.String != "timeout" || result.CrawlData.Title.String != "Working" {
+			t.Errorf("crawl result = status %q, error %q, title %q, want error, timeout, Working",
+				result.CrawlData.Status, result.CrawlData.ErrorClass.String, result.CrawlData.Title.String)
+		}
+		run, err := repo.GetCrawlRun(resultID, runID)
+		if err != nil {
+			t.Fatalf("GetCrawlRun: %v", err)
+		}
+		if run.CrawlData.Status != "error" || run.CrawlData.ErrorMessage.String != "request timed out" || run.FinishedAt == nil {
+			t.Errorf("run = %+v, want it finished with the error", run)
+		}
+	})
+}
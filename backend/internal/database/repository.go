@@ -1,27 +1,45 @@
 package database
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/blob"
 )
 
 // Repository defines the interface for database operations
 type Repository interface {
 	CreateCrawlResult(userID int, url string) (int, error)
 	GetCrawlResultIDByURL(userID int, url string) (int, error)
+	StartCrawlRun(crawlResultID int, runType string, sourceRunID int) (int, error)
+	GetCrawlRuns(crawlResultID, limit int) ([]models.CrawlRun, error)
+	GetCrawlRun(crawlResultID, runID int) (*models.CrawlRun, error)
 	UpdateCrawlResultStatus(userID int, url, status string) error
 	GetCrawlResultByID(userID int, id int) (*models.URLData, error)
 	GetCrawlResults(userID int, page, pageSize int, status, search, sortBy, sortOrder string) ([]models.URLData, int, error)
-	UpdateCrawlData(userID int, url string, data *models.CrawlData) error
+	SearchPages(userID int, terms []string, page, pageSize int) ([]models.SearchResult, int, error)
+	UpdateCrawlError(userID int, url, errorClass, errorMessage string) error
+	SavePageResult(runID int, page *models.PageResult) error
 	GetLinksByCrawlID(crawlID int) ([]models.LinkData, error)
 	GetHeadingsByCrawlID(crawlID int) ([]models.HeadingData, error)
-	CreateLink(crawlID int, link *models.LinkData) (int64, error)
-	UpdateLinkStatus(linkID int64, statusCode int, isAccessible bool) error
-	CreateHeading(crawlID int, heading *models.HeadingData) error
+	GetLinksByRunID(runID int) ([]models.LinkData, error)
+	GetHeadingsByRunID(runID int) ([]models.HeadingData, error)
+	GetFormsByCrawlID(crawlID int) ([]models.FormData, error)
+	GetFormsByRunID(runID int) ([]models.FormData, error)
+	GetSecurityCheckByCrawlID(crawlID int) (*models.SecurityData, error)
+	GetSecurityCheckByRunID(runID int) (*models.SecurityData, error)
+	GetIssuesByCrawlID(crawlID int) ([]models.IssueData, error)
+	GetIssuesByRunID(runID int) ([]models.IssueData, error)
+	GetResourcesByCrawlID(crawlID int) ([]models.ResourceData, error)
+	GetResourcesByRunID(runID int) ([]models.ResourceData, error)
+	GetSnapshotByCrawlID(crawlID int) (*models.Snapshot, error)
+	GetSnapshotByRunID(runID int) (*models.Snapshot, error)
+	FindSnapshotRun(crawlID, runID int) (int, error)
 	BulkUpdateStatus(userID int, urls []string, status string) error
 	BulkDelete(userID int, urls []string) error
 }
@@ -29,25 +47,53 @@ type Repository interface {
 // CrawlRepository implements the Repository interface
 type CrawlRepository struct {
 	conn *Connection
+	// snapshots holds the raw responses of crawled pages, nil disables snapshots
+	snapshots blob.Store
 }
 
 // NewCrawlRepository creates a new crawl repository
-func NewCrawlRepository(conn *Connection) Repository {
-	return &CrawlRepository{conn: conn}
+func NewCrawlRepository(conn *Connection, snapshots blob.Store) Repository {
+	return &CrawlRepository{conn: conn, snapshots: snapshots}
 }
 
+// lastRunOf selects the latest run of the crawl result bound to its placeholder.
+// Page details are read from that run only, older runs stay in the history.
+const lastRunOf = `(SELECT last_run_id FROM crawl_results WHERE id = ?)`
+
+// runColumns lists the columns read by scanRun, in order
+const runColumns = `id, crawl_result_id, run_type, source_run_id, status, html_version, title, meta_description, headings, internal_links,
+	external_links, inaccessible_links, has_login_form, html_size, error_class, error_message,
+	started_at, finished_at`
+
 func (r *CrawlRepository) CreateCrawlResult(userID int, url string) (int, error) {
 	log.Printf("Creating crawl result for user_id: %d, url: %s", userID, url)
 	
-	result, err := r.conn.DB.Exec("INSERT INTO crawl_results (user_id, url, status) VALUES (?, ?, 'pending')", userID, url)
-	if err != nil {
-		log.Printf("Failed to create crawl result for user_id: %d, url: %s, error: %v", userID, url, err)
-		return 0, fmt.Errorf("failed to create crawl result: %w", err)
-	}
-	
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get last insert id: %w", err)
+	// A URL already submitted keeps its crawl result, new crawls add runs to it
+	var id int64
+	if r.conn.Dialect == DialectMySQL {
+		result, err := r.conn.Exec(`
+			INSERT INTO crawl_results (user_id, url, status) VALUES (?, ?, 'pending')
+			ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)
+		`, userID, url)
+		if err != nil {
+			log.Printf("Failed to create crawl result for user_id: %d, url: %s, error: %v", userID, url, err)
+			return 0, fmt.Errorf("failed to create crawl result: %w", err)
+		}
+
+		id, err = result.LastInsertId()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get last insert id: %w", err)
+		}
+	} else {
+		err := r.conn.QueryRow(`
+			INSERT INTO crawl_results (user_id, url, status) VALUES (?, ?, 'pending')
+			ON CONFLICT (user_id, url) DO UPDATE SET url = excluded.url
+			RETURNING id
+		`, userID, url).Scan(&id)
+		if err != nil {
+			log.Printf("Failed to create crawl result for user_id: %d, url: %s, error: %v", userID, url, err)
+			return 0, fmt.Errorf("failed to create crawl result: %w", err)
+		}
 	}
 	
 	log.Printf("Successfully created crawl result with id: %d for user_id: %d, url: %s", id, userID, url)
@@ -55,7 +101,7 @@ func (r *CrawlRepository) CreateCrawlResult(userID int, url string) (int, error)
 	// Verify the record was created with correct user_id
 	var storedUserID int
 	var storedURL string
-	err = r.conn.DB.QueryRow("SELECT user_id, url FROM crawl_results WHERE id = ?", id).Scan(&storedUserID, &storedURL)
+	err := r.conn.QueryRow("SELECT user_id, url FROM crawl_results WHERE id = ?", id).Scan(&storedUserID, &storedURL)
 	if err != nil {
 		log.Printf("Warning: Could not verify stored record for id %d: %v", id, err)
 	} else {
@@ -67,7 +113,7 @@ func (r *CrawlRepository) CreateCrawlResult(userID int, url string) (int, error)
 
 func (r *CrawlRepository) GetCrawlResultIDByURL(userID int, url string) (int, error) {
 	var id int
-	err := r.conn.DB.QueryRow("SELECT id FROM crawl_results WHERE user_id = ? AND url = ?", userID, url).Scan(&id)
+	err := r.conn.QueryRow("SELECT id FROM crawl_results WHERE user_id = ? AND url = ?", userID, url).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get crawl result ID for URL %s: %w", url, err)
 	}
@@ -75,7 +121,7 @@ func (r *CrawlRepository) GetCrawlResultIDByURL(userID int, url string) (int, er
 }
 
 func (r *CrawlRepository) UpdateCrawlResultStatus(userID int, url, status string) error {
-	_, err := r.conn.DB.Exec("UPDATE crawl_results SET status = ?, updated_at = NOW() WHERE user_id = ? AND url = ?", status, userID, url)
+	_, err := r.conn.Exec("UPDATE crawl_results SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND url = ?", status, userID, url)
 	if err != nil {
 		return fmt.Errorf("failed to update crawl result status: %w", err)
 	}
@@ -86,15 +132,18 @@ func (r *CrawlRepository) GetCrawlResultByID(userID int, id int) (*models.URLDat
 	var urlData models.URLData
 	var headings []byte
 
-	err := r.conn.DB.QueryRow(`
-		SELECT id, url, html_version, title, headings, internal_links, external_links, 
-			   inaccessible_links, has_login_form, status, created_at, updated_at 
+	err := r.conn.QueryRow(`
+		SELECT id, url, html_version, title, meta_description, headings, internal_links, external_links, 
+			   inaccessible_links, has_login_form, html_size, status, error_class, error_message,
+			   created_at, updated_at 
 		FROM crawl_results WHERE user_id = ? AND id = ?
 	`, userID, id).Scan(
 		&urlData.ID, &urlData.URL, &urlData.CrawlData.HTMLVersion, &urlData.CrawlData.Title,
+		&urlData.CrawlData.MetaDescription,
 		&headings, &urlData.CrawlData.InternalLinks, &urlData.CrawlData.ExternalLinks,
-		&urlData.CrawlData.InaccessibleLinks, &urlData.CrawlData.HasLoginForm,
-		&urlData.CrawlData.Status, &urlData.CrawlData.CreatedAt, &urlData.CrawlData.UpdatedAt,
+		&urlData.CrawlData.InaccessibleLinks, &urlData.CrawlData.HasLoginForm, &urlData.CrawlData.HTMLSize,
+		&urlData.CrawlData.Status, &urlData.CrawlData.ErrorClass, &urlData.CrawlData.ErrorMessage,
+		&urlData.CrawlData.CreatedAt, &urlData.CrawlData.UpdatedAt,
 	)
 
 	if err != nil {
@@ -124,7 +173,7 @@ func (r *CrawlRepository) GetCrawlResults(userID int, page, pageSize int, status
 	}
 
 	if search != "" {
-		whereClause += " AND (url LIKE ? OR title LIKE ?)"
+		whereClause += " AND (url " + r.conn.like() + " ? OR title " + r.conn.like() + " ?)"
 		searchTerm := "%" + search + "%"
 		args = append(args, searchTerm, searchTerm)
 	}
@@ -144,7 +193,7 @@ func (r *CrawlRepository) GetCrawlResults(userID int, page, pageSize int, status
 	// Get total count
 	var total int
 	countQuery := "SELECT COUNT(*) FROM crawl_results " + whereClause
-	err := r.conn.DB.QueryRow(countQuery, args...).Scan(&total)
+	err := r.conn.QueryRow(countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get count: %w", err)
 	}
@@ -152,15 +201,16 @@ func (r *CrawlRepository) GetCrawlResults(userID int, page, pageSize int, status
 	// Get paginated results
 	offset := (page - 1) * pageSize
 	query := fmt.Sprintf(`
-		SELECT id, url, html_version, title, headings, internal_links, external_links, 
-			   inaccessible_links, has_login_form, status, created_at, updated_at 
+		SELECT id, url, html_version, title, meta_description, headings, internal_links, external_links, 
+			   inaccessible_links, has_login_form, html_size, status, error_class, error_message,
+			   created_at, updated_at 
 		FROM crawl_results %s 
 		ORDER BY %s %s 
 		LIMIT ? OFFSET ?
 	`, whereClause, sortBy, sortOrder)
 
 	args = append(args, pageSize, offset)
-	rows, err := r.conn.DB.Query(query, args...)
+	rows, err := r.conn.Query(query, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to fetch results: %w", err)
 	}
@@ -176,12 +226,16 @@ func (r *CrawlRepository) GetCrawlResults(userID int, page, pageSize int, status
 			&urlData.URL, 
 			&urlData.CrawlData.HTMLVersion, 
 			&urlData.CrawlData.Title,
+			&urlData.CrawlData.MetaDescription,
 			&headings, 
 			&urlData.CrawlData.InternalLinks, 
 			&urlData.CrawlData.ExternalLinks,
 			&urlData.CrawlData.InaccessibleLinks, 
 			&urlData.CrawlData.HasLoginForm,
+			&urlData.CrawlData.HTMLSize,
 			&urlData.CrawlData.Status, 
+			&urlData.CrawlData.ErrorClass,
+			&urlData.CrawlData.ErrorMessage,
 			&urlData.CrawlData.CreatedAt, 
 			&urlData.CrawlData.UpdatedAt,
 		); err != nil {
@@ -208,42 +262,161 @@ func (r *CrawlRepository) GetCrawlResults(userID int, page, pageSize int, status
 	return results, total, nil
 }
 
-func (r *CrawlRepository) UpdateCrawlData(userID int, url string, data *models.CrawlData) error {
-	headingsJSON, _ := json.Marshal(data.Headings)
-	
-	// Handle nullable values
-	var htmlVersion, title interface{}
-	if data.HTMLVersion.Valid {
-		htmlVersion = data.HTMLVersion.String
-	} else {
-		htmlVersion = nil
-	}
-	if data.Title.Valid {
-		title = data.Title.String
-	} else {
-		title = nil
+// UpdateCrawlError marks a crawl result as failed and records why
+func (r *CrawlRepository) UpdateCrawlError(userID int, url, errorClass, errorMessage string) error {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	
-	_, err := r.conn.DB.Exec(`
-		UPDATE crawl_results 
-		SET html_version = ?, title = ?, headings = ?, internal_links = ?, 
-			external_links = ?, inaccessible_links = ?, has_login_form = ?, 
-			status = 'done', updated_at = NOW() 
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE crawl_results
+		SET status = 'error', error_class = ?, error_message = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE user_id = ? AND url = ?
-	`, htmlVersion, title, headingsJSON, data.InternalLinks,
-		data.ExternalLinks, data.InaccessibleLinks, data.HasLoginForm, userID, url)
-	
+	`, errorClass, errorMessage, userID, url)
+	if err != nil {
+		return fmt.Errorf("failed to update crawl error: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE crawl_runs
+		SET status = 'error', error_class = ?, error_message = ?, finished_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT last_run_id FROM crawl_results WHERE user_id = ? AND url = ?) AND finished_at IS NULL
+	`, errorClass, errorMessage, userID, url)
 	if err != nil {
-		return fmt.Errorf("failed to update crawl data: %w", err)
+		return fmt.Errorf("failed to finish crawl run: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit crawl error: %w", err)
 	}
 	return nil
 }
 
+// StartCrawlRun opens a new run of a crawl result and makes it the latest one.
+// sourceRunID is the run a re-analysis reads its snapshot from, zero otherwise.
+// Page details are then stored against the returned run ID.
+func (r *CrawlRepository) StartCrawlRun(crawlResultID int, runType string, sourceRunID int) (int, error) {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	id, err := tx.Insert(`
+		INSERT INTO crawl_runs (crawl_result_id, run_type, source_run_id, status)
+		VALUES (?, ?, NULLIF(?, 0), 'running')
+	`, crawlResultID, runType, sourceRunID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create crawl run: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE crawl_results SET last_run_id = ? WHERE id = ?`, id, crawlResultID); err != nil {
+		return 0, fmt.Errorf("failed to update last run: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit crawl run: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetCrawlRuns returns the most recent runs of a crawl result, newest first
+func (r *CrawlRepository) GetCrawlRuns(crawlResultID, limit int) ([]models.CrawlRun, error) {
+	rows, err := r.conn.Query(`
+		SELECT `+runColumns+` FROM crawl_runs WHERE crawl_result_id = ? ORDER BY id DESC LIMIT ?
+	`, crawlResultID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get crawl runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []models.CrawlRun{}
+	for rows.Next() {
+		run, err := r.scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read crawl runs: %w", err)
+	}
+	return runs, nil
+}
+
+// GetCrawlRun returns a single run of a crawl result
+func (r *CrawlRepository) GetCrawlRun(crawlResultID, runID int) (*models.CrawlRun, error) {
+	rows, err := r.conn.Query(`
+		SELECT `+runColumns+` FROM crawl_runs WHERE crawl_result_id = ? AND id = ?
+	`, crawlResultID, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get crawl run: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read crawl run: %w", err)
+		}
+		return nil, sql.ErrNoRows
+	}
+	return r.scanRun(rows)
+}
+
+// scanRun scans a crawl_runs row selected with runColumns
+func (r *CrawlRepository) scanRun(rows *sql.Rows) (*models.CrawlRun, error) {
+	var run models.CrawlRun
+	var headings []byte
+	var finishedAt sql.NullTime
+	var sourceRunID sql.NullInt64
+
+	if err := rows.Scan(
+		&run.ID, &run.CrawlResultID, &run.Type, &sourceRunID, &run.CrawlData.Status, &run.CrawlData.HTMLVersion,
+		&run.CrawlData.Title, &run.CrawlData.MetaDescription, &headings, &run.CrawlData.InternalLinks, &run.CrawlData.ExternalLinks,
+		&run.CrawlData.InaccessibleLinks, &run.CrawlData.HasLoginForm, &run.CrawlData.HTMLSize,
+		&run.CrawlData.ErrorClass, &run.CrawlData.ErrorMessage, &run.StartedAt, &finishedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan crawl run: %w", err)
+	}
+
+	run.CrawlData.Headings = make(map[string]int)
+	if headings != nil {
+		if err := json.Unmarshal(headings, &run.CrawlData.Headings); err != nil {
+			log.Printf("Error unmarshaling headings of run %d: %v", run.ID, err)
+		}
+	}
+
+	run.CrawlData.CreatedAt = sql.NullTime{Time: run.StartedAt, Valid: true}
+	run.CrawlData.UpdatedAt = finishedAt
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	if sourceRunID.Valid {
+		id := int(sourceRunID.Int64)
+		run.SourceRunID = &id
+	}
+	return &run, nil
+}
+
+// GetLinksByCrawlID returns the links found by the latest run of a crawl result
 func (r *CrawlRepository) GetLinksByCrawlID(crawlID int) ([]models.LinkData, error) {
-	rows, err := r.conn.DB.Query(`
+	return r.getLinks(lastRunOf, crawlID)
+}
+
+// GetLinksByRunID returns the links found by a run
+func (r *CrawlRepository) GetLinksByRunID(runID int) ([]models.LinkData, error) {
+	return r.getLinks("?", runID)
+}
+
+// getLinks returns the links of the run selected by runQuery
+func (r *CrawlRepository) getLinks(runQuery string, id int) ([]models.LinkData, error) {
+	rows, err := r.conn.Query(`
 		SELECT id, link_url, link_text, link_type, status_code, is_accessible
-		FROM crawl_links WHERE crawl_result_id = ? ORDER BY id
-	`, crawlID)
+		FROM crawl_links WHERE crawl_run_id = `+runQuery+` ORDER BY id
+	`, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch links: %w", err)
 	}
@@ -261,11 +434,22 @@ func (r *CrawlRepository) GetLinksByCrawlID(crawlID int) ([]models.LinkData, err
 	return links, nil
 }
 
+// GetHeadingsByCrawlID returns the headings found by the latest run of a crawl result
 func (r *CrawlRepository) GetHeadingsByCrawlID(crawlID int) ([]models.HeadingData, error) {
-	rows, err := r.conn.DB.Query(`
+	return r.getHeadings(lastRunOf, crawlID)
+}
+
+// GetHeadingsByRunID returns the headings found by a run
+func (r *CrawlRepository) GetHeadingsByRunID(runID int) ([]models.HeadingData, error) {
+	return r.getHeadings("?", runID)
+}
+
+// getHeadings returns the headings of the run selected by runQuery
+func (r *CrawlRepository) getHeadings(runQuery string, id int) ([]models.HeadingData, error) {
+	rows, err := r.conn.Query(`
 		SELECT id, heading_level, heading_text, heading_order
-		FROM crawl_headings WHERE crawl_result_id = ? ORDER BY heading_order
-	`, crawlID)
+		FROM crawl_headings WHERE crawl_run_id = `+runQuery+` ORDER BY heading_order
+	`, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch headings: %w", err)
 	}
@@ -283,44 +467,155 @@ func (r *CrawlRepository) GetHeadingsByCrawlID(crawlID int) ([]models.HeadingDat
 	return headings, nil
 }
 
-func (r *CrawlRepository) CreateLink(crawlID int, link *models.LinkData) (int64, error) {
-	result, err := r.conn.DB.Exec(`
-		INSERT INTO crawl_links (crawl_result_id, link_url, link_text, link_type, status_code, is_accessible)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, crawlID, link.URL, link.Text, link.Type, link.StatusCode, link.IsAccessible)
+// GetFormsByCrawlID returns the forms of the latest run of a crawl result
+func (r *CrawlRepository) GetFormsByCrawlID(crawlID int) ([]models.FormData, error) {
+	return r.getForms(lastRunOf, crawlID)
+}
+
+// GetFormsByRunID returns the forms of a run
+func (r *CrawlRepository) GetFormsByRunID(runID int) ([]models.FormData, error) {
+	return r.getForms("?", runID)
+}
+
+// getForms returns the forms of the run selected by runQuery
+func (r *CrawlRepository) getForms(runQuery string, id int) ([]models.FormData, error) {
+	rows, err := r.conn.Query(`
+		SELECT id, form_type, form_action, form_method, input_count, has_password,
+			   insecure_action, password_missing_autocomplete
+		FROM crawl_forms WHERE crawl_run_id = `+runQuery+` ORDER BY id
+	`, id)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create link: %w", err)
+		return nil, fmt.Errorf("failed to fetch forms: %w", err)
 	}
-	
-	return result.LastInsertId()
+	defer rows.Close()
+
+	var forms []models.FormData
+	for rows.Next() {
+		var form models.FormData
+		err := rows.Scan(&form.ID, &form.Type, &form.Action, &form.Method, &form.InputCount,
+			&form.HasPassword, &form.InsecureAction, &form.PasswordMissingAutocomplete)
+		if err == nil {
+			forms = append(forms, form)
+		}
+	}
+
+	return forms, nil
+}
+
+// GetSecurityCheckByCrawlID returns the security check of the latest run of a crawl result
+func (r *CrawlRepository) GetSecurityCheckByCrawlID(crawlID int) (*models.SecurityData, error) {
+	return r.getSecurityCheck(lastRunOf, crawlID)
 }
 
-func (r *CrawlRepository) UpdateLinkStatus(linkID int64, statusCode int, isAccessible bool) error {
-	_, err := r.conn.DB.Exec(`
-		UPDATE crawl_links 
-		SET status_code = ?, is_accessible = ? 
-		WHERE id = ?
-	`, statusCode, isAccessible, linkID)
+// GetSecurityCheckByRunID returns the security check of a run
+func (r *CrawlRepository) GetSecurityCheckByRunID(runID int) (*models.SecurityData, error) {
+	return r.getSecurityCheck("?", runID)
+}
+
+// getSecurityCheck returns the security check of the run selected by runQuery
+func (r *CrawlRepository) getSecurityCheck(runQuery string, id int) (*models.SecurityData, error) {
+	var security models.SecurityData
+	var tlsVersion, certSubject, certIssuer, chainError sql.NullString
+	var certExpiresAt sql.NullTime
+
+	err := r.conn.QueryRow(`
+		SELECT id, is_https, redirects_to_https, tls_version, cert_subject, cert_issuer,
+			   cert_expires_at, hostname_match, chain_valid, chain_error, mixed_content_count
+		FROM crawl_security WHERE crawl_run_id = `+runQuery+` ORDER BY id DESC LIMIT 1
+	`, id).Scan(
+		&security.ID, &security.IsHTTPS, &security.RedirectsToHTTPS, &tlsVersion, &certSubject, &certIssuer,
+		&certExpiresAt, &security.HostnameMatch, &security.ChainValid, &chainError, &security.MixedContentCount,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to update link status: %w", err)
+		return nil, fmt.Errorf("failed to get security check: %w", err)
 	}
-	return nil
+
+	security.TLSVersion = tlsVersion.String
+	security.CertSubject = certSubject.String
+	security.CertIssuer = certIssuer.String
+	security.ChainError = chainError.String
+	if certExpiresAt.Valid {
+		security.CertExpiresAt = &certExpiresAt.Time
+		security.CertDaysRemaining = int(time.Until(certExpiresAt.Time).Hours() / 24)
+	}
+
+	return &security, nil
+}
+
+// GetIssuesByCrawlID returns the issues of the latest run of a crawl result
+func (r *CrawlRepository) GetIssuesByCrawlID(crawlID int) ([]models.IssueData, error) {
+	return r.getIssues(lastRunOf, crawlID)
+}
+
+// GetIssuesByRunID returns the issues of a run
+func (r *CrawlRepository) GetIssuesByRunID(runID int) ([]models.IssueData, error) {
+	return r.getIssues("?", runID)
 }
 
-func (r *CrawlRepository) CreateHeading(crawlID int, heading *models.HeadingData) error {
-	_, err := r.conn.DB.Exec(`
-		INSERT INTO crawl_headings (crawl_result_id, heading_level, heading_text, heading_order)
-		VALUES (?, ?, ?, ?)
-	`, crawlID, heading.Level, heading.Text, heading.Order)
+// getIssues returns the issues of the run selected by runQuery
+func (r *CrawlRepository) getIssues(runQuery string, id int) ([]models.IssueData, error) {
+	rows, err := r.conn.Query(`
+		SELECT id, category, severity, code, message, resource_url
+		FROM crawl_issues WHERE crawl_run_id = `+runQuery+` ORDER BY id
+	`, id)
 	if err != nil {
-		return fmt.Errorf("failed to create heading: %w", err)
+		return nil, fmt.Errorf("failed to fetch issues: %w", err)
 	}
-	return nil
+	defer rows.Close()
+
+	var issues []models.IssueData
+	for rows.Next() {
+		var issue models.IssueData
+		var resourceURL sql.NullString
+		err := rows.Scan(&issue.ID, &issue.Category, &issue.Severity, &issue.Code, &issue.Message, &resourceURL)
+		if err == nil {
+			issue.URL = resourceURL.String
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues, nil
+}
+
+// GetResourcesByCrawlID returns the resources of the latest run of a crawl result
+func (r *CrawlRepository) GetResourcesByCrawlID(crawlID int) ([]models.ResourceData, error) {
+	return r.getResources(lastRunOf, crawlID)
+}
+
+// GetResourcesByRunID returns the resources of a run
+func (r *CrawlRepository) GetResourcesByRunID(runID int) ([]models.ResourceData, error) {
+	return r.getResources("?", runID)
+}
+
+// getResources returns the resources of the run selected by runQuery
+func (r *CrawlRepository) getResources(runQuery string, id int) ([]models.ResourceData, error) {
+	rows, err := r.conn.Query(`
+		SELECT id, resource_url, resource_type, status_code, size, content_type, compression,
+			   cache_control, expires, is_render_blocking, is_third_party
+		FROM crawl_resources WHERE crawl_run_id = `+runQuery+` ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch resources: %w", err)
+	}
+	defer rows.Close()
+
+	var resources []models.ResourceData
+	for rows.Next() {
+		var resource models.ResourceData
+		err := rows.Scan(&resource.ID, &resource.URL, &resource.Type, &resource.StatusCode, &resource.Size,
+			&resource.ContentType, &resource.Compression, &resource.CacheControl, &resource.Expires,
+			&resource.IsRenderBlocking, &resource.IsThirdParty)
+		if err == nil {
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, nil
 }
 
 func (r *CrawlRepository) BulkUpdateStatus(userID int, urls []string, status string) error {
 	placeholders := strings.Repeat("?,", len(urls)-1) + "?"
-	query := fmt.Sprintf("UPDATE crawl_results SET status = ?, updated_at = NOW() WHERE user_id = ? AND url IN (%s)", placeholders)
+	query := fmt.Sprintf("UPDATE crawl_results SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND url IN (%s)", placeholders)
 	
 	args := make([]interface{}, len(urls)+2)
 	args[0] = status
@@ -329,7 +624,7 @@ func (r *CrawlRepository) BulkUpdateStatus(userID int, urls []string, status str
 		args[i+2] = url
 	}
 
-	_, err := r.conn.DB.Exec(query, args...)
+	_, err := r.conn.Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to bulk update status: %w", err)
 	}
@@ -346,7 +641,7 @@ func (r *CrawlRepository) BulkDelete(userID int, urls []string) error {
 		args[i+1] = url
 	}
 
-	_, err := r.conn.DB.Exec(query, args...)
+	_, err := r.conn.Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to bulk delete: %w", err)
 	}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// saveTestRun stores a finished crawl run of a crawl result with a title,
+// an h1 of the same text and links to urls
+func saveTestRun(t *testing.T, repo Repository, resultID int, title string, urls ...string) int {
+	t.Helper()
+	runID, err := repo.StartCrawlRun(resultID, models.JobTypeCrawl, 0)
+	if err != nil {
+		t.Fatalf("StartCrawlRun: %v", err)
+	}
+	data := &models.CrawlData{
+		Status:         "done",
+		Title:          sql.NullString{String: title, Valid: true},
+		Headings:       map[string]int{"h1": 1},
+		HeadingDetails: []models.HeadingData{{Level: "h1", Text: title, Order: 1}},
+	}
+	for _, url := range urls {
+		data.Links = append(data.Links, models.LinkData{URL: url, Type: "internal", StatusCode: 200, IsAccessible: true})
+		data.InternalLinks++
+	}
+	if err := repo.SavePageResult(runID, &models.PageResult{Data: data}); err != nil {
+		t.Fatalf("SavePageResult: %v", err)
+	}
+	return runID
+}
+
+// linkURLs returns the URLs of links, in order
+func linkURLs(links []models.LinkData) []string {
+	var urls []string
+	for _, link := range links {
+		urls = append(urls, link.URL)
+	}
+	return urls
+}
+
+func TestCrawlRunHistory(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, conn *Connection) {
+		repo := NewCrawlRepository(conn, nil)
+		userID := createTestUser(t, conn, "history@example.com")
+
+		resultID, err := repo.CreateCrawlResult(userID, "https://example.com/")
+		if err != nil {
+			t.Fatalf("CreateCrawlResult: %v", err)
+		}
+		first := saveTestRun(t, repo, resultID, "First", "https://example.com/a", "https://example.com/b")
+
+		// Submitting the URL again keeps its crawl result and adds a run
+		again, err := repo.CreateCrawlResult(userID, "https://example.com/")
+		if err != nil {
+			t.Fatalf("CreateCrawlResult again: %v", err)
+		}
+		if again != resultID {
+			t.Fatalf("CreateCrawlResult again = %d, want the existing result %d", again, resultID)
+		}
+		second := saveTestRun(t, repo, resultID, "Second", "https://example.com/b", "https://example.com/c")
+
+		runs, err := repo.GetCrawlRuns(resultID, 10)
+		if err != nil {
+			t.Fatalf("GetCrawlRuns: %v", err)
+		}
+		if len(runs) != 2 || runs[0].ID != second || runs[1].ID != first {
+			t.Fatalf("runs = %+v, want %d then %d", runs, second, first)
+		}
+		for i, want := range []string{"Second", "First"} {
+			run := runs[i]
+			if run.Type != models.JobTypeCrawl || run.CrawlData.Status != "done" || run.CrawlData.Title.String != want || run.FinishedAt == nil {
+				t.Errorf("run %d = %+v, want a finished crawl titled %s", run.ID, run, want)
+			}
+		}
+		if limited, err := repo.GetCrawlRuns(resultID, 1); err != nil || len(limited) != 1 || limited[0].ID != second {
+			t.Errorf("GetCrawlRuns limited to 1 = %+v, %v, want only %d", limited, err, second)
+		}
+
+		// Every run keeps its own links and headings
+		for runID, want := range map[int][]string{
+			first:  {"https://example.com/a", "https://example.com/b"},
+			second: {"https://example.com/b", "https://example.com/c"},
+		} {
+			links, err := repo.GetLinksByRunID(runID)
+			if err != nil {
+				t.Fatalf("GetLinksByRunID: %v", err)
+			}
+			if got := linkURLs(links); !reflect.DeepEqual(got, want) {
+				t.Errorf("links of run %d = %v, want %v", runID, got, want)
+			}
+			headings, err := repo.GetHeadingsByRunID(runID)
+			if err != nil {
+				t.Fatalf("GetHeadingsByRunID: %v", err)
+			}
+			if len(headings) != 1 {
+				t.Errorf("headings of run %d = %+v, want one", runID, headings)
+			}
+		}
+
+		// The crawl result shows its latest run only
+		result, err := repo.GetCrawlResultByID(userID, resultID)
+		if err != nil {
+			t.Fatalf("GetCrawlResultByID: %v", err)
+		}
+		if result.CrawlData.Title.String != "Second" {
+			t.Errorf("crawl result title = %q, want Second", result.CrawlData.Title.String)
+		}
+		links, err := repo.GetLinksByCrawlID(resultID)
+		if err != nil {
+			t.Fatalf("GetLinksByCrawlID: %v", err)
+		}
+		if got, want := linkURLs(links), []string{"https://example.com/b", "https://example.com/c"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("links of the crawl result = %v, want %v", got, want)
+		}
+		headings, err := repo.GetHeadingsByCrawlID(resultID)
+		if err != nil {
+			t.Fatalf("GetHeadingsByCrawlID: %v", err)
+		}
+		if len(headings) != 1 || headings[0].Text != "Second" {
+			t.Errorf("headings of the crawl result = %+v, want the h1 of the latest run", headings)
+		}
+	})
+}
+
+func TestGetCrawlRunOfAnotherResult(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, conn *Connection) {
+		repo := NewCrawlRepository(conn, nil)
+		userID := createTestUser(t, conn, "runs@example.com")
+		resultID, err := repo.CreateCrawlResult(userID, "https://example.com/")
+		if err != nil {
+			t.Fatalf("CreateCrawlResult: %v", err)
+		}
+		otherID, err := repo.CreateCrawlResult(userID, "https://example.com/other")
+		if err != nil {
+			t.Fatalf("CreateCrawlResult: %v", err)
+		}
+		runID := saveTestRun(t, repo, resultID, "Page")
+
+		run, err := repo.GetCrawlRun(resultID, runID)
+		if err != nil || run.ID != runID || run.CrawlResultID != resultID {
+			t.Errorf("GetCrawlRun = %+v, %v, want run %d", run, err, runID)
+		}
+		if _, err := repo.GetCrawlRun(otherID, runID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetCrawlRun through another result error = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
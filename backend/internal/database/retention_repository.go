@@ -0,0 +1,227 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// RetentionRepository defines the interface for retention policies and the
+// purging of expired runs
+type RetentionRepository interface {
+	GetRetentionOverride(userID int) (*models.RetentionOverride, error)
+	SetRetentionOverride(userID int, override *models.RetentionOverride) error
+	FindExpiredRuns(defaults models.RetentionPolicy, afterID, limit int) ([]models.ExpiredRun, error)
+	DeleteRuns(runIDs []int) ([]string, error)
+	UnreferencedBlobs(keys []string) ([]string, error)
+}
+
+// RetentionRepo implements the RetentionRepository interface
+type RetentionRepo struct {
+	conn *Connection
+}
+
+// NewRetentionRepository creates a new retention repository
+func NewRetentionRepository(conn *Connection) RetentionRepository {
+	return &RetentionRepo{conn: conn}
+}
+
+// GetRetentionOverride returns the retention limits set for a user, an empty
+// override when there are none
+func (r *RetentionRepo) GetRetentionOverride(userID int) (*models.RetentionOverride, error) {
+	var keepRuns, maxAgeDays sql.NullInt64
+	err := r.conn.QueryRow(`SELECT keep_runs, max_age_days FROM user_retention WHERE user_id = ?`, userID).Scan(&keepRuns, &maxAgeDays)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.RetentionOverride{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention override: %w", err)
+	}
+
+	override := &models.RetentionOverride{}
+	if keepRuns.Valid {
+		n := int(keepRuns.Int64)
+		override.KeepRuns = &n
+	}
+	if maxAgeDays.Valid {
+		n := int(maxAgeDays.Int64)
+		override.MaxAgeDays = &n
+	}
+	return override, nil
+}
+
+// SetRetentionOverride replaces the retention limits set for a user. An empty
+// override returns the user to the default policy.
+func (r *RetentionRepo) SetRetentionOverride(userID int, override *models.RetentionOverride) error {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_retention WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to clear retention override: %w", err)
+	}
+
+	if override.KeepRuns != nil || override.MaxAgeDays != nil {
+		_, err := tx.Exec(`
+			INSERT INTO user_retention (user_id, keep_runs, max_age_days, updated_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		`, userID, override.KeepRuns, override.MaxAgeDays)
+		if err != nil {
+			return fmt.Errorf("failed to set retention override: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit retention override: %w", err)
+	}
+	return nil
+}
+
+// FindExpiredRuns returns up to limit finished runs with an ID above afterID
+// past the retention policy of their owner, oldest first: the default policy
+// with the user's override. The latest run of a URL and runs a queued
+// re-analysis reads are kept.
+func (r *RetentionRepo) FindExpiredRuns(defaults models.RetentionPolicy, afterID, limit int) ([]models.ExpiredRun, error) {
+	rows, err := r.conn.Query(`
+		SELECT run.id, run.crawl_result_id, r.user_id, r.url
+		FROM crawl_runs run
+		JOIN crawl_results r ON r.id = run.crawl_result_id
+		LEFT JOIN user_retention ur ON ur.user_id = r.user_id
+		WHERE run.id > ? AND run.id <> r.last_run_id AND run.finished_at IS NOT NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM crawl_jobs j WHERE j.source_run_id = run.id AND j.status IN ('queued', 'running')
+			)
+			AND (
+				(COALESCE(ur.keep_runs, ?) > 0 AND (
+					SELECT COUNT(*) FROM crawl_runs newer
+					WHERE newer.crawl_result_id = run.crawl_result_id AND newer.id > run.id
+				) >= COALESCE(ur.keep_runs, ?))
+				OR (COALESCE(ur.max_age_days, ?) > 0
+					AND run.started_at < `+r.conn.daysAgo("COALESCE(ur.max_age_days, ?)")+`)
+			)
+		ORDER BY run.id
+		LIMIT ?
+	`, afterID, defaults.KeepRuns, defaults.KeepRuns, defaults.MaxAgeDays, defaults.MaxAgeDays, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expired runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []models.ExpiredRun
+	for rows.Next() {
+		var run models.ExpiredRun
+		if err := rows.Scan(&run.ID, &run.CrawlResultID, &run.UserID, &run.URL); err != nil {
+			return nil, fmt.Errorf("failed to scan expired run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// DeleteRuns deletes runs in one transaction. Their links, headings, forms,
+// security checks, issues, resources and snapshots go with them through the
+// cascading foreign keys. It returns the blob keys of the deleted snapshots,
+// which may be unreferenced now.
+func (r *RetentionRepo) DeleteRuns(runIDs []int) ([]string, error) {
+	if len(runIDs) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(runIDs)-1) + "?"
+	args := make([]interface{}, len(runIDs))
+	for i, id := range runIDs {
+		args[i] = id
+	}
+
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT body_hash, headers_hash FROM crawl_snapshots WHERE crawl_run_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshots of runs: %w", err)
+	}
+	var keys []string
+	for rows.Next() {
+		var bodyHash, headersHash string
+		if err := rows.Scan(&bodyHash, &headersHash); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan snapshot: %w", err)
+		}
+		keys = append(keys, bodyHash, headersHash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get snapshots of runs: %w", err)
+	}
+
+	// Re-analyses keep pointing at their source run by ID only
+	if _, err := tx.Exec(`UPDATE crawl_runs SET source_run_id = NULL WHERE source_run_id IN (`+placeholders+`)`, args...); err != nil {
+		return nil, fmt.Errorf("failed to detach re-analysis runs: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE crawl_jobs SET source_run_id = NULL WHERE source_run_id IN (`+placeholders+`)`, args...); err != nil {
+		return nil, fmt.Errorf("failed to detach re-analysis jobs: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM crawl_runs WHERE id IN (`+placeholders+`)`, args...); err != nil {
+		return nil, fmt.Errorf("failed to delete runs: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit run deletion: %w", err)
+	}
+	return keys, nil
+}
+
+// UnreferencedBlobs returns the blob keys no snapshot refers to anymore
+func (r *RetentionRepo) UnreferencedBlobs(keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(keys)-1) + "?"
+	args := make([]interface{}, 0, len(keys)*2)
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	args = append(args, args...)
+
+	rows, err := r.conn.Query(`
+		SELECT body_hash, headers_hash FROM crawl_snapshots
+		WHERE body_hash IN (`+placeholders+`) OR headers_hash IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find referenced blobs: %w", err)
+	}
+	defer rows.Close()
+
+	referenced := make(map[string]bool)
+	for rows.Next() {
+		var bodyHash, headersHash string
+		if err := rows.Scan(&bodyHash, &headersHash); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot: %w", err)
+		}
+		referenced[bodyHash] = true
+		referenced[headersHash] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find referenced blobs: %w", err)
+	}
+
+	var unreferenced []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if !referenced[key] && !seen[key] {
+			unreferenced = append(unreferenced, key)
+		}
+		seen[key] = true
+	}
+	return unreferenced, nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// addTestRun stores a finished run of a crawl result started daysOld days ago
+// and makes it the latest run of the result
+func addTestRun(t *testing.T, conn *Connection, resultID, daysOld int) int {
+	t.Helper()
+	// Postgres cannot tell the type of a bare placeholder multiplied by an interval
+	days := "?"
+	if conn.Dialect == DialectPostgres {
+		days = "CAST(? AS INTEGER)"
+	}
+	id, err := conn.Insert(`
+		INSERT INTO crawl_runs (crawl_result_id, run_type, status, started_at, finished_at)
+		VALUES (?, 'crawl', 'done', `+conn.daysAgo(days)+`, CURRENT_TIMESTAMP)
+	`, resultID, daysOld)
+	if err != nil {
+		t.Fatalf("inserting run: %v", err)
+	}
+	if _, err := conn.Exec(`UPDATE crawl_results SET last_run_id = ? WHERE id = ?`, id, resultID); err != nil {
+		t.Fatalf("setting last run: %v", err)
+	}
+	return int(id)
+}
+
+// createTestResult stores a crawl result with runs started the given numbers
+// of days ago, oldest first, and returns their IDs
+func createTestResult(t *testing.T, conn *Connection, userID int, url string, daysOld ...int) []int {
+	t.Helper()
+	resultID, err := NewCrawlRepository(conn, nil).CreateCrawlResult(userID, url)
+	if err != nil {
+		t.Fatalf("CreateCrawlResult: %v", err)
+	}
+	var ids []int
+	for _, days := range daysOld {
+		ids = append(ids, addTestRun(t, conn, resultID, days))
+	}
+	return ids
+}
+
+func TestFindExpiredRuns(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, conn *Connection) {
+		retention := NewRetentionRepository(conn)
+		owner := createTestUser(t, conn, "retention@example.com")
+		runs := createTestResult(t, conn, owner, "https://example.com/", 100, 50, 10, 1)
+		// The only run of a URL is its latest and is always kept
+		createTestResult(t, conn, owner, "https://example.com/once", 200)
+
+		tests := []struct {
+			name   string
+			policy models.RetentionPolicy
+			want   []int
+		}{
+			{name: "no policy", policy: models.RetentionPolicy{}, want: nil},
+			{name: "keep runs", policy: models.RetentionPolicy{KeepRuns: 2}, want: runs[:2]},
+			{name: "max age", policy: models.RetentionPolicy{MaxAgeDays: 30}, want: runs[:2]},
+			{name: "short max age", policy: models.RetentionPolicy{MaxAgeDays: 5}, want: runs[:3]},
+			{name: "either limit", policy: models.RetentionPolicy{KeepRuns: 3, MaxAgeDays: 60}, want: runs[:1]},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := expiredRunIDs(t, retention, tt.policy, 0); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("FindExpiredRuns(%+v) = %v, want %v", tt.policy, got, tt.want)
+				}
+			})
+		}
+
+		policy := models.RetentionPolicy{KeepRuns: 1}
+		if got := expiredRunIDs(t, retention, policy, runs[0]); !reflect.DeepEqual(got, runs[1:3]) {
+			t.Errorf("FindExpiredRuns after run %d = %v, want %v", runs[0], got, runs[1:3])
+		}
+
+		// A run a queued re-analysis reads is kept until the job is done
+		jobs := NewJobRepository(conn)
+		if _, err := jobs.EnqueueJob(&models.CrawlJob{
+			CrawlResultID: resultIDOf(t, conn, runs[0]), UserID: owner, URL: "https://example.com/",
+			Type: models.JobTypeReanalyze, SourceRunID: sql.NullInt64{Int64: int64(runs[0]), Valid: true},
+		}); err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+		if got := expiredRunIDs(t, retention, policy, 0); !reflect.DeepEqual(got, runs[1:3]) {
+			t.Errorf("FindExpiredRuns with a queued re-analysis = %v, want %v", got, runs[1:3])
+		}
+
+		// A run still in progress is never expired
+		if _, err := conn.Exec(`UPDATE crawl_runs SET finished_at = NULL WHERE id = ?`, runs[1]); err != nil {
+			t.Fatalf("unfinishing run: %v", err)
+		}
+		if got := expiredRunIDs(t, retention, policy, 0); !reflect.DeepEqual(got, runs[2:3]) {
+			t.Errorf("FindExpiredRuns with a run in progress = %v, want %v", got, runs[2:3])
+		}
+	})
+}
+
+func TestFindExpiredRunsOverride(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, conn *Connection) {
+		retention := NewRetentionRepository(conn)
+		defaulted := createTestResult(t, conn, createTestUser(t, conn, "default@example.com"), "https://example.com/", 40, 20, 1)
+		overriddenUser := createTestUser(t, conn, "override@example.com")
+		overridden := createTestResult(t, conn, overriddenUser, "https://example.org/", 40, 20, 1)
+
+		keepOne, noMaxAge := 1, 0
+		if err := retention.SetRetentionOverride(overriddenUser, &models.RetentionOverride{KeepRuns: &keepOne, MaxAgeDays: &noMaxAge}); err != nil {
+			t.Fatalf("SetRetentionOverride: %v", err)
+		}
+
+		// The default drops runs older than 30 days, the override keeps only
+		// the latest run whatever its age
+		got := expiredRunIDs(t, retention, models.RetentionPolicy{MaxAgeDays: 30}, 0)
+		want := []int{defaulted[0], overridden[0], overridden[1]}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("FindExpiredRuns = %v, want %v", got, want)
+		}
+
+		// Clearing the override returns the user to the default
+		if err := retention.SetRetentionOverride(overriddenUser, &models.RetentionOverride{}); err != nil {
+			t.Fatalf("SetRetentionOverride: %v", err)
+		}
+		got = expiredRunIDs(t, retention, models.RetentionPolicy{MaxAgeDays: 30}, 0)
+		if want := []int{defaulted[0], overridden[0]}; !reflect.DeepEqual(got, want) {
+			t.Errorf("FindExpiredRuns without override = %v, want %v", got, want)
+		}
+	})
+}
+
+// expiredRunIDs returns the IDs of the runs FindExpiredRuns reports
+func expiredRunIDs(t *testing.T, retention RetentionRepository, policy models.RetentionPolicy, afterID int) []int {
+	t.Helper()
+	expired, err := retention.FindExpiredRuns(policy, afterID, 100)
+	if err != nil {
+		t.Fatalf("FindExpiredRuns: %v", err)
+	}
+	var ids []int
+	for _, run := range expired {
+		ids = append(ids, run.ID)
+	}
+	return ids
+}
+
+// resultIDOf returns the crawl result of a run
+func resultIDOf(t *testing.T, conn *Connection, runID int) int {
+	t.Helper()
+	var id int
+	if err := conn.QueryRow(`SELECT crawl_result_id FROM crawl_runs WHERE id = ?`, runID).Scan(&id); err != nil {
+		t.Fatalf("reading run %d: %v", runID, err)
+	}
+	return id
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// ScheduleRepository defines the interface for crawl schedule operations
+type ScheduleRepository interface {
+	CreateSchedule(schedule *models.Schedule) (int, error)
+	GetSchedules(userID int) ([]models.Schedule, error)
+	GetScheduleByID(userID, id int) (*models.Schedule, error)
+	UpdateSchedule(schedule *models.Schedule) error
+	DeleteSchedule(userID, id int) error
+	GetDueSchedules(now time.Time) ([]models.Schedule, error)
+	ClaimScheduleRun(id int, now, nextRun time.Time) (bool, error)
+}
+
+// ScheduleRepo implements the ScheduleRepository interface
+type ScheduleRepo struct {
+	conn *Connection
+}
+
+// NewScheduleRepository creates a new schedule repository
+func NewScheduleRepository(conn *Connection) ScheduleRepository {
+	return &ScheduleRepo{conn: conn}
+}
+
+// scheduleColumns lists the columns read by scanSchedule, in order
+const scheduleColumns = `id, user_id, name, cron_expr, interval_minutes, urls, enabled,
+	last_run_at, next_run_at, created_at, updated_at`
+
+// CreateSchedule stores a new schedule
+func (r *ScheduleRepo) CreateSchedule(schedule *models.Schedule) (int, error) {
+	urls, err := json.Marshal(schedule.URLs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal urls: %w", err)
+	}
+
+	id, err := r.conn.Insert(`
+		INSERT INTO crawl_schedules (user_id, name, cron_expr, interval_minutes, urls, enabled, next_run_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, schedule.UserID, schedule.Name, nullString(schedule.CronExpr), nullInt(schedule.IntervalMinutes),
+		urls, schedule.Enabled, schedule.NextRunAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create schedule: %w", err)
+	}
+
+	schedule.ID = int(id)
+	return schedule.ID, nil
+}
+
+// GetSchedules returns all schedules of a user
+func (r *ScheduleRepo) GetSchedules(userID int) ([]models.Schedule, error) {
+	rows, err := r.conn.Query(`
+		SELECT `+scheduleColumns+` FROM crawl_schedules WHERE user_id = ? ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedules: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanSchedules(rows)
+}
+
+// GetScheduleByID returns a single schedule owned by a user
+func (r *ScheduleRepo) GetScheduleByID(userID, id int) (*models.Schedule, error) {
+	rows, err := r.conn.Query(`
+		SELECT `+scheduleColumns+` FROM crawl_schedules WHERE user_id = ? AND id = ?
+	`, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+	defer rows.Close()
+
+	schedules, err := r.scanSchedules(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &schedules[0], nil
+}
+
+// UpdateSchedule replaces the settings of a schedule
+func (r *ScheduleRepo) UpdateSchedule(schedule *models.Schedule) error {
+	urls, err := json.Marshal(schedule.URLs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal urls: %w", err)
+	}
+
+	_, err = r.conn.Exec(`
+		UPDATE crawl_schedules
+		SET name = ?, cron_expr = ?, interval_minutes = ?, urls = ?, enabled = ?, next_run_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND id = ?
+	`, schedule.Name, nullString(schedule.CronExpr), nullInt(schedule.IntervalMinutes), urls,
+		schedule.Enabled, schedule.NextRunAt, schedule.UserID, schedule.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule: %w", err)
+	}
+	return nil
+}
+
+// DeleteSchedule removes a schedule owned by a user
+func (r *ScheduleRepo) DeleteSchedule(userID, id int) error {
+	result, err := r.conn.Exec("DELETE FROM crawl_schedules WHERE user_id = ? AND id = ?", userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetDueSchedules returns the enabled schedules whose next run is at or before now
+func (r *ScheduleRepo) GetDueSchedules(now time.Time) ([]models.Schedule, error) {
+	rows, err := r.conn.Query(`
+		SELECT `+scheduleColumns+` FROM crawl_schedules
+		WHERE enabled = TRUE AND next_run_at IS NOT NULL AND next_run_at <= ?
+		ORDER BY next_run_at
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due schedules: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanSchedules(rows)
+}
+
+// ClaimScheduleRun records that a schedule due at now runs now and next runs
+// at nextRun, unless another scheduler claimed the run first by moving its
+// next run past now. It reports whether the run was claimed.
+func (r *ScheduleRepo) ClaimScheduleRun(id int, now, nextRun time.Time) (bool, error) {
+	result, err := r.conn.Exec(`
+		UPDATE crawl_schedules SET last_run_at = ?, next_run_at = ?
+		WHERE id = ? AND next_run_at <= ?
+	`, now, nextRun, id, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim schedule run: %w", err)
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim schedule run: %w", err)
+	}
+	return claimed > 0, nil
+}
+
+// scanSchedules scans crawl_schedules rows selected with scheduleColumns
+func (r *ScheduleRepo) scanSchedules(rows *sql.Rows) ([]models.Schedule, error) {
+	schedules := []models.Schedule{}
+	for rows.Next() {
+		var schedule models.Schedule
+		var cronExpr sql.NullString
+		var intervalMinutes sql.NullInt64
+		var urls []byte
+		var lastRun, nextRun sql.NullTime
+
+		if err := rows.Scan(
+			&schedule.ID, &schedule.UserID, &schedule.Name, &cronExpr, &intervalMinutes, &urls,
+			&schedule.Enabled, &lastRun, &nextRun, &schedule.CreatedAt, &schedule.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+
+		schedule.CronExpr = cronExpr.String
+		schedule.IntervalMinutes = int(intervalMinutes.Int64)
+		if err := json.Unmarshal(urls, &schedule.URLs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal urls of schedule %d: %w", schedule.ID, err)
+		}
+		if lastRun.Valid {
+			schedule.LastRunAt = &lastRun.Time
+		}
+		if nextRun.Valid {
+			schedule.NextRunAt = &nextRun.Time
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// nullString maps an empty string to NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullInt maps zero to NULL
+func nullInt(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
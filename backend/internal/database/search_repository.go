@@ -0,0 +1,126 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// indexPage replaces the search document of a crawl result with the text the
+// run found, while the run is its latest one
+func indexPage(tx *Tx, crawlResultID, runID int, data *models.CrawlData) error {
+	_, err := tx.Exec(`
+		DELETE FROM crawl_search WHERE crawl_result_id = ?
+			AND EXISTS (SELECT 1 FROM crawl_results WHERE id = ? AND last_run_id = ?)
+	`, crawlResultID, crawlResultID, runID)
+	if err != nil {
+		return fmt.Errorf("failed to clear search document: %w", err)
+	}
+
+	doc := searchDocument(data)
+	_, err = tx.Exec(`
+		INSERT INTO crawl_search (crawl_result_id, crawl_run_id, title, meta_description, headings, anchors, body)
+		SELECT id, last_run_id, ?, ?, ?, ?, ? FROM crawl_results WHERE id = ? AND last_run_id = ?
+	`, doc.Title, doc.MetaDescription, doc.Headings, doc.Anchors, doc.Body, crawlResultID, runID)
+	if err != nil {
+		return fmt.Errorf("failed to index page: %w", err)
+	}
+	return nil
+}
+
+// searchDocument collects the text of a page indexed for full-text search
+func searchDocument(data *models.CrawlData) models.SearchDocument {
+	headings := make([]string, 0, len(data.HeadingDetails))
+	for _, heading := range data.HeadingDetails {
+		headings = append(headings, heading.Text)
+	}
+	anchors := make([]string, 0, len(data.Links))
+	for _, link := range data.Links {
+		if link.Text != "" {
+			anchors = append(anchors, link.Text)
+		}
+	}
+
+	return models.SearchDocument{
+		Title:           data.Title.String,
+		MetaDescription: data.MetaDescription.String,
+		Headings:        strings.Join(headings, "\n"),
+		Anchors:         strings.Join(anchors, "\n"),
+		Body:            data.BodyText,
+	}
+}
+
+// SearchPages returns the pages of a user containing every one of terms, best
+// match first, and how many there are. Terms are words of letters and digits.
+// Titles weigh the most, then meta descriptions and headings, anchor texts and
+// finally the body.
+func (r *CrawlRepository) SearchPages(userID int, terms []string, page, pageSize int) ([]models.SearchResult, int, error) {
+	from := `crawl_search s JOIN crawl_results r ON r.id = s.crawl_result_id`
+	var match, score string
+	var matchArg interface{}
+	var scoreArgs []interface{}
+
+	switch r.conn.Dialect {
+	case DialectSQLite:
+		from = `crawl_search_fts JOIN crawl_search s ON s.crawl_result_id = crawl_search_fts.rowid
+			JOIN crawl_results r ON r.id = s.crawl_result_id`
+		match = `crawl_search_fts MATCH ?`
+		matchArg = `"` + strings.Join(terms, `" "`) + `"`
+		score = `-bm25(crawl_search_fts, 10.0, 5.0, 5.0, 2.0, 1.0)`
+	case DialectPostgres:
+		match = `s.document @@ plainto_tsquery('english', ?)`
+		matchArg = strings.Join(terms, " ")
+		score = `ts_rank(s.document, plainto_tsquery('english', ?))`
+		scoreArgs = []interface{}{matchArg}
+	default:
+		// Every term is required, as a prefix standing in for stemming. A
+		// title containing any of them ranks higher.
+		required := make([]string, len(terms))
+		anyOf := make([]string, len(terms))
+		for i, term := range terms {
+			required[i] = "+" + term + "*"
+			anyOf[i] = term + "*"
+		}
+		content := `MATCH(s.title, s.meta_description, s.headings, s.anchors, s.body)`
+		match = content + ` AGAINST(? IN BOOLEAN MODE)`
+		matchArg = strings.Join(required, " ")
+		score = `MATCH(s.title) AGAINST(? IN BOOLEAN MODE) * 2 + ` + match
+		scoreArgs = []interface{}{strings.Join(anyOf, " "), matchArg}
+	}
+	where := `WHERE r.user_id = ? AND ` + match
+
+	var total int
+	if err := r.conn.QueryRow(`SELECT COUNT(*) FROM `+from+` `+where, userID, matchArg).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	args := append(scoreArgs, userID, matchArg, pageSize, (page-1)*pageSize)
+	rows, err := r.conn.Query(`
+		SELECT r.id, r.url, s.crawl_run_id, r.status, s.title, s.meta_description, s.headings, s.anchors, s.body,
+			`+score+` AS score
+		FROM `+from+` `+where+`
+		ORDER BY score DESC, r.id DESC
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search pages: %w", err)
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		doc := &result.Document
+		if err := rows.Scan(&result.ID, &result.URL, &result.RunID, &result.Status, &doc.Title, &doc.MetaDescription,
+			&doc.Headings, &doc.Anchors, &doc.Body, &result.Score); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		result.Title = doc.Title
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to search pages: %w", err)
+	}
+	return results, total, nil
+}
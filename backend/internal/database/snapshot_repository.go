@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// GetSnapshotByCrawlID returns the snapshot taken by the latest run of a crawl result
+func (r *CrawlRepository) GetSnapshotByCrawlID(crawlID int) (*models.Snapshot, error) {
+	return r.getSnapshot(lastRunOf, crawlID)
+}
+
+// GetSnapshotByRunID returns the snapshot taken by a run
+func (r *CrawlRepository) GetSnapshotByRunID(runID int) (*models.Snapshot, error) {
+	return r.getSnapshot("?", runID)
+}
+
+// FindSnapshotRun returns the run of a crawl result that has a snapshot:
+// runID when it has one, or the latest such run when runID is zero
+func (r *CrawlRepository) FindSnapshotRun(crawlID, runID int) (int, error) {
+	if r.snapshots == nil {
+		return 0, sql.ErrNoRows
+	}
+
+	var id int
+	err := r.conn.QueryRow(`
+		SELECT crawl_run_id FROM crawl_snapshots
+		WHERE crawl_result_id = ? AND (? = 0 OR crawl_run_id = ?)
+		ORDER BY crawl_run_id DESC LIMIT 1
+	`, crawlID, runID, runID).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// getSnapshot returns the snapshot of the run selected by runQuery, with its
+// headers and body loaded from blob storage
+func (r *CrawlRepository) getSnapshot(runQuery string, id int) (*models.Snapshot, error) {
+	if r.snapshots == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	var snapshot models.Snapshot
+	err := r.conn.QueryRow(`
+		SELECT id, crawl_run_id, final_url, status_code, content_type, body_hash, headers_hash, body_size, fetched_at
+		FROM crawl_snapshots WHERE crawl_run_id = `+runQuery+`
+	`, id).Scan(
+		&snapshot.ID, &snapshot.RunID, &snapshot.URL, &snapshot.StatusCode, &snapshot.ContentType,
+		&snapshot.BodyHash, &snapshot.HeadersHash, &snapshot.BodySize, &snapshot.FetchedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := r.snapshots.Get(snapshot.HeadersHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot headers: %w", err)
+	}
+	if err := json.Unmarshal(headers, &snapshot.Headers); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot headers: %w", err)
+	}
+
+	snapshot.Body, err = r.snapshots.Get(snapshot.BodyHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot body: %w", err)
+	}
+
+	return &snapshot, nil
+}
+
+// putSnapshot stores the headers and body of a snapshot in blob storage, where
+// identical content is only kept once, and fills in their hashes. It reports
+// false when snapshots are disabled.
+func (r *CrawlRepository) putSnapshot(snapshot *models.Snapshot) (bool, error) {
+	if r.snapshots == nil {
+		return false, nil
+	}
+
+	headers, err := json.Marshal(snapshot.Headers)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode snapshot headers: %w", err)
+	}
+	snapshot.HeadersHash, err = r.snapshots.Put(headers)
+	if err != nil {
+		return false, fmt.Errorf("failed to store snapshot headers: %w", err)
+	}
+	snapshot.BodyHash, err = r.snapshots.Put(snapshot.Body)
+	if err != nil {
+		return false, fmt.Errorf("failed to store snapshot body: %w", err)
+	}
+	snapshot.BodySize = int64(len(snapshot.Body))
+	return true, nil
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// UsageRepository defines the interface for per-user usage accounting
+type UsageRepository interface {
+	RecordCrawls(userID, count int) error
+	ReserveCrawls(userID, count, limit int) (bool, error)
+	ReleaseCrawls(userID, count int) error
+	RecordPages(userID, count int) error
+	ReservePages(userID, count, limit int) (bool, error)
+	ReleasePages(userID, count int) error
+	GetUsageCounts(userID int) (*models.UsageCounts, error)
+}
+
+// UsageRepo implements the UsageRepository interface. Usage is kept in its own
+// tables so deleting crawl results does not give quota back. Crawls are
+// counted per day in user_usage, pages per month in user_page_usage, so the
+// monthly page quota can be checked and counted in one statement like the
+// daily crawl quota.
+type UsageRepo struct {
+	conn *Connection
+}
+
+// NewUsageRepository creates a new usage repository
+func NewUsageRepository(conn *Connection) UsageRepository {
+	return &UsageRepo{conn: conn}
+}
+
+// RecordCrawls adds submitted crawls to today's usage of a user
+func (r *UsageRepo) RecordCrawls(userID, count int) error {
+	_, err := r.conn.Exec(`
+		INSERT INTO user_usage (user_id, day, crawls) VALUES (?, CURRENT_DATE, ?)
+		`+r.conn.upsertAdd("user_usage", "user_id, day", "crawls")+`
+	`, userID, count)
+	if err != nil {
+		return fmt.Errorf("failed to record crawls: %w", err)
+	}
+	return nil
+}
+
+// ReserveCrawls adds submitted crawls to today's usage of a user unless that
+// takes it over limit, checking and adding in one statement so concurrent
+// submissions cannot both pass. It reports whether the crawls were added.
+func (r *UsageRepo) ReserveCrawls(userID, count, limit int) (bool, error) {
+	if count > limit {
+		return false, nil
+	}
+
+	result, err := r.conn.Exec(`
+		INSERT INTO user_usage (user_id, day, crawls) VALUES (?, CURRENT_DATE, ?)
+		`+r.conn.upsertAddUpTo("user_usage", "user_id, day", "crawls")+`
+	`, userID, count, limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve crawls: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve crawls: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ReleaseCrawls takes reserved crawls that were never queued back out of
+// today's usage of a user
+func (r *UsageRepo) ReleaseCrawls(userID, count int) error {
+	_, err := r.conn.Exec(`
+		UPDATE user_usage SET crawls = crawls - ?
+		WHERE user_id = ? AND day = CURRENT_DATE AND crawls >= ?
+	`, count, userID, count)
+	if err != nil {
+		return fmt.Errorf("failed to release crawls: %w", err)
+	}
+	return nil
+}
+
+// RecordPages adds pages to this month's usage of a user
+func (r *UsageRepo) RecordPages(userID, count int) error {
+	_, err := r.conn.Exec(`
+		INSERT INTO user_page_usage (user_id, month, pages) VALUES (?, `+r.conn.monthStart()+`, ?)
+		`+r.conn.upsertAdd("user_page_usage", "user_id, month", "pages")+`
+	`, userID, count)
+	if err != nil {
+		return fmt.Errorf("failed to record pages: %w", err)
+	}
+	return nil
+}
+
+// ReservePages adds pages to this month's usage of a user unless that takes
+// it over limit, checking and adding in one statement. It reports whether the
+// pages were added.
+func (r *UsageRepo) ReservePages(userID, count, limit int) (bool, error) {
+	if count > limit {
+		return false, nil
+	}
+
+	result, err := r.conn.Exec(`
+		INSERT INTO user_page_usage (user_id, month, pages) VALUES (?, `+r.conn.monthStart()+`, ?)
+		`+r.conn.upsertAddUpTo("user_page_usage", "user_id, month", "pages")+`
+	`, userID, count, limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve pages: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve pages: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ReleasePages takes reserved pages that will not be fetched back out of this
+// month's usage of a user
+func (r *UsageRepo) ReleasePages(userID, count int) error {
+	_, err := r.conn.Exec(`
+		UPDATE user_page_usage SET pages = pages - ?
+		WHERE user_id = ? AND month = `+r.conn.monthStart()+` AND pages >= ?
+	`, count, userID, count)
+	if err != nil {
+		return fmt.Errorf("failed to release pages: %w", err)
+	}
+	return nil
+}
+
+// GetUsageCounts returns the running and queued crawls of a user, the crawls
+// submitted today and the pages counted this calendar month
+func (r *UsageRepo) GetUsageCounts(userID int) (*models.UsageCounts, error) {
+	var counts models.UsageCounts
+
+	err := r.conn.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN status = 'running' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'queued' AND job_type = 'crawl' THEN 1 ELSE 0 END), 0)
+		FROM crawl_jobs
+		WHERE user_id = ? AND status IN ('queued', 'running')
+	`, userID).Scan(&counts.RunningCrawls, &counts.QueuedCrawls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active crawls: %w", err)
+	}
+
+	err = r.conn.QueryRow(`
+		SELECT COALESCE(SUM(crawls), 0) FROM user_usage WHERE user_id = ? AND day = CURRENT_DATE
+	`, userID).Scan(&counts.CrawlsToday)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	err = r.conn.QueryRow(`
+		SELECT COALESCE(SUM(pages), 0) FROM user_page_usage WHERE user_id = ? AND month = `+r.conn.monthStart()+`
+	`, userID).Scan(&counts.PagesThisMonth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	return &counts, nil
+}
@@ -9,12 +9,12 @@ import (
 
 // UserRepository handles user-related database operations
 type UserRepository struct {
-	db *sql.DB
+	conn *Connection
 }
 
 // NewUserRepository creates a new user repository
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(conn *Connection) *UserRepository {
+	return &UserRepository{conn: conn}
 }
 
 // CreateUser creates a new user in the database
@@ -22,12 +22,7 @@ func (r *UserRepository) CreateUser(user *models.User) error {
 	query := `INSERT INTO users (email, password, first_name, last_name, created_at, updated_at) 
 			  VALUES (?, ?, ?, ?, ?, ?)`
 	
-	result, err := r.db.Exec(query, user.Email, user.Password, user.FirstName, user.LastName, user.CreatedAt, user.UpdatedAt)
-	if err != nil {
-		return err
-	}
-	
-	id, err := result.LastInsertId()
+	id, err := r.conn.Insert(query, user.Email, user.Password, user.FirstName, user.LastName, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -42,7 +37,7 @@ func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
 			  FROM users WHERE email = ?`
 	
 	user := &models.User{}
-	err := r.db.QueryRow(query, email).Scan(
+	err := r.conn.QueryRow(query, email).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Password,
@@ -68,7 +63,7 @@ func (r *UserRepository) GetUserByID(id int) (*models.User, error) {
 			  FROM users WHERE id = ?`
 	
 	user := &models.User{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.conn.QueryRow(query, id).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Password,
@@ -93,7 +88,7 @@ func (r *UserRepository) UpdateUser(user *models.User) error {
 	query := `UPDATE users SET first_name = ?, last_name = ?, updated_at = ? WHERE id = ?`
 	
 	user.UpdatedAt = time.Now()
-	_, err := r.db.Exec(query, user.FirstName, user.LastName, user.UpdatedAt, user.ID)
+	_, err := r.conn.Exec(query, user.FirstName, user.LastName, user.UpdatedAt, user.ID)
 	return err
 }
 
@@ -102,7 +97,7 @@ func (r *UserRepository) EmailExists(email string) (bool, error) {
 	query := `SELECT COUNT(*) FROM users WHERE email = ?`
 	
 	var count int
-	err := r.db.QueryRow(query, email).Scan(&count)
+	err := r.conn.QueryRow(query, email).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,328 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// WebhookRepository defines the interface for webhook and delivery log operations
+type WebhookRepository interface {
+	CreateWebhook(webhook *models.Webhook) (int, error)
+	GetWebhooks(userID int) ([]models.Webhook, error)
+	GetWebhookByID(userID, id int) (*models.Webhook, error)
+	GetEnabledWebhooks(userID int) ([]models.Webhook, error)
+	GetWebhook(id int) (*models.Webhook, error)
+	UpdateWebhook(webhook *models.Webhook) error
+	DeleteWebhook(userID, id int) error
+	CreateDelivery(delivery *models.WebhookDelivery) (int, error)
+	GetDeliveries(webhookID, limit int) ([]models.WebhookDelivery, error)
+	GetDeliveryByID(webhookID, id int) (*models.WebhookDelivery, error)
+	ClaimDueDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordDeliveryAttempt(delivery *models.WebhookDelivery, retryIn time.Duration) error
+}
+
+// WebhookRepo implements the WebhookRepository interface
+type WebhookRepo struct {
+	conn *Connection
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(conn *Connection) WebhookRepository {
+	return &WebhookRepo{conn: conn}
+}
+
+// webhookColumns lists the columns read by scanWebhooks, in order
+const webhookColumns = `id, user_id, url, secret, events, enabled, created_at, updated_at`
+
+// deliveryColumns lists the columns read by scanDeliveries, in order
+const deliveryColumns = `id, webhook_id, event_type, payload, status, attempts, response_status,
+	last_error, next_attempt_at, delivered_at, created_at`
+
+// CreateWebhook stores a new webhook
+func (r *WebhookRepo) CreateWebhook(webhook *models.Webhook) (int, error) {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	id, err := r.conn.Insert(`
+		INSERT INTO webhooks (user_id, url, secret, events, enabled) VALUES (?, ?, ?, ?, ?)
+	`, webhook.UserID, webhook.URL, webhook.Secret, events, webhook.Enabled)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	webhook.ID = int(id)
+	return webhook.ID, nil
+}
+
+// GetWebhooks returns all webhooks of a user
+func (r *WebhookRepo) GetWebhooks(userID int) ([]models.Webhook, error) {
+	rows, err := r.conn.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanWebhooks(rows)
+}
+
+// GetWebhookByID returns a single webhook owned by a user
+func (r *WebhookRepo) GetWebhookByID(userID, id int) (*models.Webhook, error) {
+	rows, err := r.conn.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE user_id = ? AND id = ?`, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks, err := r.scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &webhooks[0], nil
+}
+
+// GetEnabledWebhooks returns the enabled webhooks of a user
+func (r *WebhookRepo) GetEnabledWebhooks(userID int) ([]models.Webhook, error) {
+	rows, err := r.conn.Query(`
+		SELECT `+webhookColumns+` FROM webhooks WHERE user_id = ? AND enabled = TRUE ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get enabled webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanWebhooks(rows)
+}
+
+// GetWebhook returns a webhook regardless of its owner, for delivering events
+func (r *WebhookRepo) GetWebhook(id int) (*models.Webhook, error) {
+	rows, err := r.conn.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks, err := r.scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &webhooks[0], nil
+}
+
+// UpdateWebhook replaces the settings of a webhook
+func (r *WebhookRepo) UpdateWebhook(webhook *models.Webhook) error {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	_, err = r.conn.Exec(`
+		UPDATE webhooks SET url = ?, secret = ?, events = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND id = ?
+	`, webhook.URL, webhook.Secret, events, webhook.Enabled, webhook.UserID, webhook.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (r *WebhookRepo) DeleteWebhook(userID, id int) error {
+	result, err := r.conn.Exec("DELETE FROM webhooks WHERE user_id = ? AND id = ?", userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateDelivery logs a new delivery, due immediately
+func (r *WebhookRepo) CreateDelivery(delivery *models.WebhookDelivery) (int, error) {
+	id, err := r.conn.Insert(`
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, next_attempt_at)
+		VALUES (?, ?, ?, 'pending', CURRENT_TIMESTAMP)
+	`, delivery.WebhookID, delivery.EventType, []byte(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create delivery: %w", err)
+	}
+
+	delivery.ID = int(id)
+	delivery.Status = models.DeliveryStatusPending
+	return delivery.ID, nil
+}
+
+// GetDeliveries returns the most recent deliveries of a webhook
+func (r *WebhookRepo) GetDeliveries(webhookID, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := r.conn.Query(`
+		SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = ? ORDER BY id DESC LIMIT ?
+	`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanDeliveries(rows)
+}
+
+// GetDeliveryByID returns a single delivery of a webhook
+func (r *WebhookRepo) GetDeliveryByID(webhookID, id int) (*models.WebhookDelivery, error) {
+	rows, err := r.conn.Query(`
+		SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? AND id = ?
+	`, webhookID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries, err := r.scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &deliveries[0], nil
+}
+
+// ClaimDueDeliveries returns pending deliveries whose next attempt is due and
+// pushes that attempt back by lease, so other dispatchers sharing the database
+// skip them while they are sent. A delivery whose attempt is never recorded
+// becomes due again once the lease is over.
+func (r *WebhookRepo) ClaimDueDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT `+deliveryColumns+` FROM webhook_deliveries d
+		WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY next_attempt_at LIMIT ?
+		`+r.conn.skipLocked("d")+`
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due deliveries: %w", err)
+	}
+	deliveries, err := r.scanDeliveries(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+
+	args := []interface{}{int(lease.Seconds())}
+	for _, delivery := range deliveries {
+		args = append(args, delivery.ID)
+	}
+	if _, err := tx.Exec(`
+		UPDATE webhook_deliveries SET next_attempt_at = `+r.conn.secondsFromNow()+`
+		WHERE id IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(deliveries)), ", ")+`)
+	`, args...); err != nil {
+		return nil, fmt.Errorf("failed to claim due deliveries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit claim of due deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RecordDeliveryAttempt stores the outcome of a delivery attempt. A pending
+// delivery is attempted again once retryIn has passed.
+func (r *WebhookRepo) RecordDeliveryAttempt(delivery *models.WebhookDelivery, retryIn time.Duration) error {
+	_, err := r.conn.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, response_status = ?, last_error = ?,
+			next_attempt_at = CASE WHEN ? = 'pending' THEN `+r.conn.secondsFromNow()+` ELSE NULL END,
+			delivered_at = CASE WHEN ? = 'succeeded' THEN CURRENT_TIMESTAMP ELSE NULL END
+		WHERE id = ?
+	`, delivery.Status, delivery.Attempts, nullInt(delivery.ResponseStatus), nullString(delivery.LastError),
+		delivery.Status, int(retryIn.Seconds()), delivery.Status, delivery.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record delivery attempt: %w", err)
+	}
+	return nil
+}
+
+// scanWebhooks scans webhooks rows selected with webhookColumns
+func (r *WebhookRepo) scanWebhooks(rows *sql.Rows) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		var events []byte
+
+		if err := rows.Scan(
+			&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, &events,
+			&webhook.Enabled, &webhook.CreatedAt, &webhook.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		if err := json.Unmarshal(events, &webhook.Events); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal events of webhook %d: %w", webhook.ID, err)
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// scanDeliveries scans webhook_deliveries rows selected with deliveryColumns
+func (r *WebhookRepo) scanDeliveries(rows *sql.Rows) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var payload []byte
+		var responseStatus sql.NullInt64
+		var lastError sql.NullString
+		var deliveredAt sql.NullTime
+
+		if err := rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.EventType, &payload, &delivery.Status,
+			&delivery.Attempts, &responseStatus, &lastError, &delivery.NextAttemptAt, &deliveredAt,
+			&delivery.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+
+		delivery.Payload = payload
+		delivery.ResponseStatus = int(responseStatus.Int64)
+		delivery.LastError = lastError.String
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read deliveries: %w", err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber before
+// further events are dropped for it
+const subscriberBuffer = 64
+
+// Bus fans crawl events out to the subscribers of the owning user
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[int]map[chan models.CrawlEvent]struct{}
+	listeners   []func(models.CrawlEvent)
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[int]map[chan models.CrawlEvent]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Close signals subscribers that no more events should be streamed, so
+// long-lived streams end and let the server shut down. Publishing keeps
+// working for listeners.
+func (b *Bus) Close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// Done returns a channel closed once the bus is closed
+func (b *Bus) Done() <-chan struct{} {
+	return b.done
+}
+
+// Publish delivers an event to every subscriber of its user without blocking.
+// Subscribers that fall behind miss events rather than slowing the crawler.
+func (b *Bus) Publish(event models.CrawlEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, listener := range b.listeners {
+		listener(event)
+	}
+	b.deliver(event)
+}
+
+// Forward delivers an event published by another process to the subscribers
+// of its user. Listeners are skipped, they already ran where it was published.
+func (b *Bus) Forward(event models.CrawlEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	b.deliver(event)
+}
+
+// deliver hands an event to every subscriber of its user without blocking.
+// Callers must hold b.mu.
+func (b *Bus) deliver(event models.CrawlEvent) {
+	for ch := range b.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Dropped %s event of crawl %d for a slow subscriber", event.Type, event.CrawlResultID)
+		}
+	}
+}
+
+// Listen registers a function called with every event of every user. It runs
+// on the publishing goroutine, so it must return quickly.
+func (b *Bus) Listen(listener func(models.CrawlEvent)) {
+	b.mu.Lock()
+	b.listeners = append(b.listeners, listener)
+	b.mu.Unlock()
+}
+
+// Subscribe returns a channel receiving the events of a user's crawls and a
+// function to unsubscribe, which closes the channel
+func (b *Bus) Subscribe(userID int) (<-chan models.CrawlEvent, func()) {
+	ch := make(chan models.CrawlEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan models.CrawlEvent]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers[userID], ch)
+			if len(b.subscribers[userID]) == 0 {
+				delete(b.subscribers, userID)
+			}
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
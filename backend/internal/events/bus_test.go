@@ -0,0 +1,156 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// received drains the events buffered on ch
+func received(ch <-chan models.CrawlEvent) []int {
+	var ids []int
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, event.CrawlResultID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestBusPublish(t *testing.T) {
+	bus := NewBus()
+	first, unsubscribeFirst := bus.Subscribe(1)
+	defer unsubscribeFirst()
+	second, unsubscribeSecond := bus.Subscribe(1)
+	defer unsubscribeSecond()
+	other, unsubscribeOther := bus.Subscribe(2)
+	defer unsubscribeOther()
+
+	var heard []int
+	bus.Listen(func(event models.CrawlEvent) {
+		heard = append(heard, event.CrawlResultID)
+	})
+
+	bus.Publish(models.CrawlEvent{Type: models.EventStatus, UserID: 1, CrawlResultID: 10})
+	bus.Publish(models.CrawlEvent{Type: models.EventStatus, UserID: 2, CrawlResultID: 20})
+	// Events from other processes reach subscribers only
+	bus.Forward(models.CrawlEvent{Type: models.EventStatus, UserID: 1, CrawlResultID: 11})
+
+	tests := []struct {
+		name string
+		ch   <-chan models.CrawlEvent
+		want []int
+	}{
+		{name: "first subscriber", ch: first, want: []int{10, 11}},
+		{name: "second subscriber", ch: second, want: []int{10, 11}},
+		{name: "other user", ch: other, want: []int{20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := received(tt.ch); !equal(got, tt.want) {
+				t.Errorf("received %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !equal(heard, []int{10, 20}) {
+		t.Errorf("listener heard %v, want [10 20]", heard)
+	}
+}
+
+func TestBusPublishSetsTime(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	before := time.Now()
+	bus.Publish(models.CrawlEvent{UserID: 1})
+	stamped := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bus.Publish(models.CrawlEvent{UserID: 1, Time: stamped})
+
+	if event := <-ch; event.Time.Before(before) {
+		t.Errorf("event time = %v, want the time it was published", event.Time)
+	}
+	if event := <-ch; !event.Time.Equal(stamped) {
+		t.Errorf("event time = %v, want %v kept", event.Time, stamped)
+	}
+}
+
+func TestBusDropsEventsForSlowSubscribers(t *testing.T) {
+	bus := NewBus()
+	slow, unsubscribeSlow := bus.Subscribe(1)
+	defer unsubscribeSlow()
+
+	// Publishing never blocks on a full subscriber
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < subscriberBuffer*2; i++ {
+			bus.Publish(models.CrawlEvent{UserID: 1, CrawlResultID: i})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a subscriber that does not read")
+	}
+
+	got := received(slow)
+	if len(got) != subscriberBuffer || got[0] != 0 || got[len(got)-1] != subscriberBuffer-1 {
+		t.Errorf("slow subscriber received %d events, want the first %d", len(got), subscriberBuffer)
+	}
+}
+
+func TestBusUnsubscribe(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe(1)
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-ch; ok {
+		t.Error("channel still open after unsubscribing")
+	}
+	// Publishing to a user without subscribers is harmless
+	bus.Publish(models.CrawlEvent{UserID: 1})
+	if len(bus.subscribers) != 0 {
+		t.Errorf("%d users still subscribed, want none", len(bus.subscribers))
+	}
+}
+
+func TestBusClose(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	bus.Close()
+	bus.Close()
+	select {
+	case <-bus.Done():
+	default:
+		t.Fatal("Done not closed after Close")
+	}
+
+	// Events keep flowing to whoever still listens
+	bus.Publish(models.CrawlEvent{UserID: 1, CrawlResultID: 1})
+	if got := received(ch); !equal(got, []int{1}) {
+		t.Errorf("received %v after Close, want [1]", got)
+	}
+}
+
+// equal reports whether two lists of IDs are the same
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
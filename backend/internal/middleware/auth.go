@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -40,6 +41,39 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 	}
 }
 
+// StreamAuthMiddleware checks for a valid JWT token given either in the
+// Authorization header or in the access_token query parameter, since browsers
+// cannot set headers on EventSource requests
+func StreamAuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("access_token")
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			tokenParts := strings.Split(authHeader, " ")
+			if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+				c.Abort()
+				return
+			}
+			token = tokenParts[1]
+		}
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or access_token required"})
+			c.Abort()
+			return
+		}
+
+		userID, err := authService.ValidateToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", userID)
+		c.Next()
+	}
+}
+
 // OptionalAuthMiddleware checks for JWT token but doesn't require it
 func OptionalAuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -62,4 +96,30 @@ func OptionalAuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		}
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+// AgentAuthMiddleware checks for a valid remote crawl agent token and sets
+// the authenticated agent in the context
+func AgentAuthMiddleware(agentService services.AgentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenParts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Agent token required"})
+			c.Abort()
+			return
+		}
+
+		agent, err := agentService.Authenticate(tokenParts[1])
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAgentToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid agent token"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate agent"})
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("agent", agent)
+		c.Next()
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Agent is a crawl agent running inside a client's network. It crawls the
+// URLs assigned to it and uploads the results, for sites the server cannot reach.
+type Agent struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// AgentRequest represents a request to register an agent
+type AgentRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// AgentRegistration is returned once when an agent is registered. The token
+// is not stored and cannot be retrieved again.
+type AgentRegistration struct {
+	Agent
+	Token string `json:"token"`
+}
@@ -24,28 +24,113 @@ type HeadingData struct {
 	Order int    `json:"order"`
 }
 
+// FormData represents a single form found on the page
+type FormData struct {
+	ID                          int    `json:"id"`
+	Type                        string `json:"type"` // "login", "signup", "search", "contact", "newsletter", "payment" or "other"
+	Action                      string `json:"action"`
+	Method                      string `json:"method"`
+	InputCount                  int    `json:"input_count"`
+	HasPassword                 bool   `json:"has_password"`
+	InsecureAction              bool   `json:"insecure_action"`               // posts to HTTP from an HTTPS page
+	PasswordMissingAutocomplete bool   `json:"password_missing_autocomplete"` // password field without an autocomplete hint
+}
+
+// SecurityData represents the HTTPS and TLS checks run against a crawled page
+type SecurityData struct {
+	ID                int        `json:"id"`
+	IsHTTPS           bool       `json:"is_https"`
+	RedirectsToHTTPS  bool       `json:"redirects_to_https"`
+	TLSVersion        string     `json:"tls_version,omitempty"`
+	CertSubject       string     `json:"cert_subject,omitempty"`
+	CertIssuer        string     `json:"cert_issuer,omitempty"`
+	CertExpiresAt     *time.Time `json:"cert_expires_at,omitempty"`
+	CertDaysRemaining int        `json:"cert_days_remaining"`
+	HostnameMatch     bool       `json:"hostname_match"`
+	ChainValid        bool       `json:"chain_valid"`
+	ChainError        string     `json:"chain_error,omitempty"`
+	MixedContentCount int        `json:"mixed_content_count"`
+}
+
+// IssueData represents a single problem detected on the page
+type IssueData struct {
+	ID       int    `json:"id"`
+	Category string `json:"category"` // "security", ...
+	Severity string `json:"severity"` // "error", "warning" or "info"
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	URL      string `json:"url,omitempty"` // offending resource, if any
+}
+
+// ResourceData represents a script, stylesheet, preload, font or iframe referenced by the page
+type ResourceData struct {
+	ID               int    `json:"id"`
+	URL              string `json:"url"`
+	Type             string `json:"type"` // "script", "stylesheet", "preload", "font" or "iframe"
+	StatusCode       int    `json:"status_code"`
+	Size             int64  `json:"size"` // transferred bytes
+	ContentType      string `json:"content_type,omitempty"`
+	Compression      string `json:"compression,omitempty"` // Content-Encoding of the response
+	CacheControl     string `json:"cache_control,omitempty"`
+	Expires          string `json:"expires,omitempty"`
+	IsRenderBlocking bool   `json:"is_render_blocking"`
+	IsThirdParty     bool   `json:"is_third_party"`
+}
+
+// ResourceSummary summarizes the weight of a page and its resources
+type ResourceSummary struct {
+	HTMLSize            int64            `json:"html_size"`
+	ResourceCount       int              `json:"resource_count"`
+	TotalSize           int64            `json:"total_size"` // HTML plus all resources
+	SizeByType          map[string]int64 `json:"size_by_type"`
+	RenderBlockingCount int              `json:"render_blocking_count"`
+	UncompressedCount   int              `json:"uncompressed_count"`
+	UncachedCount       int              `json:"uncached_count"`
+	ThirdPartyDomains   []string         `json:"third_party_domains"`
+}
+
+// ResourceReport is the page-weight report of a crawled page
+type ResourceReport struct {
+	Resources []ResourceData  `json:"resources"`
+	Summary   ResourceSummary `json:"summary"`
+}
+
 // CrawlData represents the data collected for a crawled URL.
 type CrawlData struct {
 	HTMLVersion       sql.NullString `json:"-"`
 	Title             sql.NullString `json:"-"`
+	MetaDescription   sql.NullString `json:"-"`
 	Headings          map[string]int `json:"headings"`
 	InternalLinks     int            `json:"internal_links"`
 	ExternalLinks     int            `json:"external_links"`
 	InaccessibleLinks int            `json:"inaccessible_links"`
 	HasLoginForm      bool           `json:"has_login_form"`
+	HTMLSize          int64          `json:"html_size"`
 	Status            string         `json:"status"`
+	ErrorClass        sql.NullString `json:"-"`
+	ErrorMessage      sql.NullString `json:"-"`
 	CreatedAt         sql.NullTime   `json:"-"`
 	UpdatedAt         sql.NullTime   `json:"-"`
 	
 	// JSON fields
 	HTMLVersionStr    string         `json:"html_version"`
 	TitleStr          string         `json:"title"`
+	MetaDescriptionStr string        `json:"meta_description"`
+	ErrorClassStr     string         `json:"error_class,omitempty"`
+	ErrorMessageStr   string         `json:"error_message,omitempty"`
 	CreatedAtStr      string         `json:"created_at"`
 	UpdatedAtStr      string         `json:"updated_at"`
 	
 	// Detailed data
 	Links             []LinkData     `json:"links,omitempty"`
 	HeadingDetails    []HeadingData  `json:"heading_details,omitempty"`
+	Forms             []FormData     `json:"forms,omitempty"`
+	Security          *SecurityData  `json:"security,omitempty"`
+	Issues            []IssueData    `json:"issues,omitempty"`
+	Resources         []ResourceData `json:"resources,omitempty"`
+
+	// BodyText is the visible text of the page, only kept for full-text search
+	BodyText string `json:"-"`
 }
 
 // MarshalJSON implements custom JSON marshaling
@@ -59,6 +144,15 @@ func (c CrawlData) MarshalJSON() ([]byte, error) {
 	if c.Title.Valid {
 		c.TitleStr = c.Title.String
 	}
+	if c.MetaDescription.Valid {
+		c.MetaDescriptionStr = c.MetaDescription.String
+	}
+	if c.ErrorClass.Valid {
+		c.ErrorClassStr = c.ErrorClass.String
+	}
+	if c.ErrorMessage.Valid {
+		c.ErrorMessageStr = c.ErrorMessage.String
+	}
 	if c.CreatedAt.Valid {
 		c.CreatedAtStr = c.CreatedAt.Time.Format(time.RFC3339)
 	}
@@ -80,6 +174,15 @@ type URLData struct {
 	CrawlData CrawlData `json:"crawl_data"`
 }
 
+// PageResult is everything a crawl run found on a page, collected in memory
+// and stored at once when the run finishes
+type PageResult struct {
+	// Data holds the summary and details of the page, its Status the outcome of the run
+	Data *CrawlData
+	// Snapshot is the response that was audited, nil when none was kept
+	Snapshot *Snapshot
+}
+
 // PaginationResponse represents a paginated response
 type PaginationResponse struct {
 	Data       []URLData `json:"data"`
@@ -92,6 +195,8 @@ type PaginationResponse struct {
 // CrawlRequest represents a crawl request
 type CrawlRequest struct {
 	URL string `json:"url" binding:"required"`
+	// AgentID optionally assigns the URL to a remote crawl agent
+	AgentID int `json:"agent_id"`
 }
 
 // BulkActionRequest represents bulk action requests
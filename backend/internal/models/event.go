@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Crawl event types
+const (
+	EventStatus      = "status"
+	EventPageFetched = "page_fetched"
+	EventLinkFound   = "link_found"
+	EventLinkChecked = "link_checked"
+	// EventFailed is published once a crawl job has failed for good, after
+	// its last attempt. An "error" status only reports the current attempt.
+	EventFailed = "failed"
+)
+
+// CrawlEvent reports the progress of a crawl. Counters are cumulative for the
+// current run of the crawl.
+type CrawlEvent struct {
+	Type          string    `json:"type"`
+	CrawlResultID int       `json:"crawl_result_id"`
+	UserID        int       `json:"-"`
+	URL           string    `json:"url"`
+	Status        string    `json:"status,omitempty"`
+	PagesFetched  int       `json:"pages_fetched"`
+	LinksFound    int       `json:"links_found"`
+	LinksChecked  int       `json:"links_checked"`
+	LinksFailed   int       `json:"links_failed"`
+	Time          time.Time `json:"time"`
+}
+
+// RelayedEvent is a crawl event stored for the other processes sharing the
+// database. Source identifies the process that published it.
+type RelayedEvent struct {
+	ID     int64
+	Source string
+	Event  CrawlEvent
+}
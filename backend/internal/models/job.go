@@ -0,0 +1,42 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Job types
+const (
+	JobTypeCrawl  = "crawl"
+	JobTypeReplay = "replay"
+	// JobTypeReanalyze re-runs the analyzers on the snapshot of an earlier run
+	JobTypeReanalyze = "reanalyze"
+)
+
+// Job statuses
+const (
+	JobStatusQueued      = "queued"
+	JobStatusRunning     = "running"
+	JobStatusDone        = "done"
+	JobStatusFailed      = "failed"
+	JobStatusCancelled   = "cancelled"
+	JobStatusInterrupted = "interrupted"
+)
+
+// CrawlJob represents a queued crawl of a URL
+type CrawlJob struct {
+	ID            int            `json:"id"`
+	CrawlResultID int            `json:"crawl_result_id"`
+	UserID        int            `json:"user_id"`
+	AgentID       sql.NullInt64  `json:"-"`
+	URL           string         `json:"url"`
+	Type          string         `json:"type"`
+	SourceRunID   sql.NullInt64  `json:"-"` // run re-analyzed by a reanalyze job
+	Status        string         `json:"status"`
+	Attempts      int            `json:"attempts"`
+	LastError     sql.NullString `json:"-"`
+	LeaseOwner    sql.NullString `json:"-"`
+	CreatedAt     time.Time      `json:"created_at"`
+	StartedAt     sql.NullTime   `json:"-"`
+	FinishedAt    sql.NullTime   `json:"-"`
+}
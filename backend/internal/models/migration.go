@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Migration statuses
+const (
+	MigrationStatusApplied = "applied"
+	MigrationStatusPending = "pending"
+	// MigrationStatusModified is an applied migration whose SQL was edited since
+	MigrationStatusModified = "modified"
+	// MigrationStatusUnknown is an applied migration this version does not have
+	MigrationStatusUnknown = "unknown"
+)
+
+// MigrationStatus reports whether a database migration was applied
+type MigrationStatus struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+	// Reversible tells whether the migration can be rolled back
+	Reversible bool `json:"reversible"`
+}
@@ -0,0 +1,60 @@
+package models
+
+// RetentionPolicy decides how long the runs of a URL are kept. A zero limit
+// keeps runs forever. The latest run of a URL is always kept.
+type RetentionPolicy struct {
+	// KeepRuns is the number of most recent runs kept per URL
+	KeepRuns int `json:"keep_runs"`
+	// MaxAgeDays is the age in days past which runs are deleted
+	MaxAgeDays int `json:"max_age_days"`
+}
+
+// RetentionOverride replaces limits of the default policy for a user. A nil
+// limit keeps the default one.
+type RetentionOverride struct {
+	KeepRuns   *int `json:"keep_runs"`
+	MaxAgeDays *int `json:"max_age_days"`
+}
+
+// Apply returns policy with the limits of the override
+func (o RetentionOverride) Apply(policy RetentionPolicy) RetentionPolicy {
+	if o.KeepRuns != nil {
+		policy.KeepRuns = *o.KeepRuns
+	}
+	if o.MaxAgeDays != nil {
+		policy.MaxAgeDays = *o.MaxAgeDays
+	}
+	return policy
+}
+
+// Retention reports the retention policy applied to a user
+type Retention struct {
+	Default   RetentionPolicy   `json:"default"`
+	Override  RetentionOverride `json:"override"`
+	Effective RetentionPolicy   `json:"effective"`
+}
+
+// ExpiredRun is a run past the retention policy of its owner
+type ExpiredRun struct {
+	ID            int
+	CrawlResultID int
+	UserID        int
+	URL           string
+}
+
+// RunArchive is everything stored about a run, written out before the run is
+// purged
+type RunArchive struct {
+	UserID    int            `json:"user_id"`
+	URL       string         `json:"url"`
+	Run       *CrawlRun      `json:"run"`
+	Links     []LinkData     `json:"links"`
+	Headings  []HeadingData  `json:"headings"`
+	Forms     []FormData     `json:"forms"`
+	Security  *SecurityData  `json:"security,omitempty"`
+	Issues    []IssueData    `json:"issues"`
+	Resources []ResourceData `json:"resources"`
+	Snapshot  *Snapshot      `json:"snapshot,omitempty"`
+	// SnapshotBody is the body of Snapshot, which leaves it out of its JSON
+	SnapshotBody []byte `json:"snapshot_body,omitempty"`
+}
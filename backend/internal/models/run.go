@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// CrawlRun is a single execution of a crawl of a URL. A run is never changed
+// once finished, so the runs of a crawl result form its history.
+type CrawlRun struct {
+	ID            int    `json:"id"`
+	CrawlResultID int    `json:"crawl_result_id"`
+	Type          string `json:"type"` // "crawl", "replay" or "reanalyze"
+	// SourceRunID is the run whose snapshot a re-analysis read
+	SourceRunID *int       `json:"source_run_id,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CrawlData   CrawlData  `json:"crawl_data"`
+}
+
+// RunRef identifies one side of a run comparison
+type RunRef struct {
+	ID         int        `json:"id"`
+	Type       string     `json:"type"`
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// ValueChange is a page field that differs between two runs
+type ValueChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// LinkStatusChange is a link found by both runs whose check result differs
+type LinkStatusChange struct {
+	URL            string `json:"url"`
+	Text           string `json:"text"`
+	Type           string `json:"type"`
+	FromStatusCode int    `json:"from_status_code"`
+	ToStatusCode   int    `json:"to_status_code"`
+	FromAccessible bool   `json:"from_accessible"`
+	ToAccessible   bool   `json:"to_accessible"`
+}
+
+// RunDiff describes what changed on a page between two runs
+type RunDiff struct {
+	From              RunRef             `json:"from"`
+	To                RunRef             `json:"to"`
+	Status            *ValueChange       `json:"status,omitempty"`
+	Title             *ValueChange       `json:"title,omitempty"`
+	MetaDescription   *ValueChange       `json:"meta_description,omitempty"`
+	HTMLVersion       *ValueChange       `json:"html_version,omitempty"`
+	HeadingsAdded     []HeadingData      `json:"headings_added"`
+	HeadingsRemoved   []HeadingData      `json:"headings_removed"`
+	LinksAdded        []LinkData         `json:"links_added"`
+	LinksRemoved      []LinkData         `json:"links_removed"`
+	LinkStatusChanges []LinkStatusChange `json:"link_status_changes"`
+	NewBrokenLinks    []LinkData         `json:"new_broken_links"`
+	// Summary lists the changes in plain sentences, most important first
+	Summary []string `json:"summary"`
+}
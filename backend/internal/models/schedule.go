@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Schedule represents a recurring crawl of a set of URLs, run either on a
+// cron expression or at a fixed interval
+type Schedule struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	Name            string     `json:"name"`
+	CronExpr        string     `json:"cron,omitempty"`
+	IntervalMinutes int        `json:"interval_minutes,omitempty"`
+	URLs            []string   `json:"urls"`
+	Enabled         bool       `json:"enabled"`
+	LastRunAt       *time.Time `json:"last_run_at"`
+	NextRunAt       *time.Time `json:"next_run_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// ScheduleRequest represents a request to create or update a schedule. The
+// URLs to crawl are given directly, through existing crawl results, or both.
+type ScheduleRequest struct {
+	Name            string   `json:"name" binding:"required"`
+	CronExpr        string   `json:"cron"`
+	IntervalMinutes int      `json:"interval_minutes"`
+	URLs            []string `json:"urls"`
+	CrawlResultIDs  []int    `json:"crawl_result_ids"`
+	Enabled         *bool    `json:"enabled"`
+}
@@ -0,0 +1,34 @@
+package models
+
+// SearchDocument is the text of a page indexed for full-text search.
+// Headings and Anchors hold one heading or link text per line.
+type SearchDocument struct {
+	Title           string
+	MetaDescription string
+	Headings        string
+	Anchors         string
+	Body            string
+}
+
+// SearchResult is a crawled page matching a full-text search
+type SearchResult struct {
+	ID     int     `json:"id"` // crawl result
+	URL    string  `json:"url"`
+	RunID  int     `json:"run_id"` // run whose text matched
+	Title  string  `json:"title"`
+	Status string  `json:"status"`
+	Score  float64 `json:"score"`
+	// Snippet is an HTML-escaped excerpt with the matching words in <mark> tags
+	Snippet  string         `json:"snippet"`
+	Document SearchDocument `json:"-"`
+}
+
+// SearchResponse represents a page of full-text search results, best match first
+type SearchResponse struct {
+	Query      string         `json:"query"`
+	Data       []SearchResult `json:"data"`
+	Total      int            `json:"total"`
+	Page       int            `json:"page"`
+	PageSize   int            `json:"page_size"`
+	TotalPages int            `json:"total_pages"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// Snapshot is the raw response a crawl run audited. Its headers and body are
+// kept in blob storage, shared by every snapshot with the same content.
+type Snapshot struct {
+	ID          int         `json:"id"`
+	RunID       int         `json:"run_id"`
+	URL         string      `json:"url"` // final URL, after redirects
+	StatusCode  int         `json:"status_code"`
+	ContentType string      `json:"content_type"`
+	BodyHash    string      `json:"body_hash"`
+	HeadersHash string      `json:"headers_hash"`
+	BodySize    int64       `json:"body_size"`
+	FetchedAt   time.Time   `json:"fetched_at"`
+	Headers     http.Header `json:"headers"`
+	Body        []byte      `json:"-"`
+}
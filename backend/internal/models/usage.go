@@ -0,0 +1,32 @@
+package models
+
+// QuotaLimits holds the limits applied to every user. A zero limit means unlimited.
+type QuotaLimits struct {
+	ConcurrentCrawls   int `json:"concurrent_crawls"`
+	CrawlsPerDay       int `json:"crawls_per_day"`
+	PagesPerMonth      int `json:"pages_per_month"`
+	LinkChecksPerCrawl int `json:"link_checks_per_crawl"`
+}
+
+// QuotaUsage reports the consumption of a single quota
+type QuotaUsage struct {
+	Used  int `json:"used"`
+	Limit int `json:"limit"`
+}
+
+// Usage reports the consumption of a user against their quotas
+type Usage struct {
+	ConcurrentCrawls   QuotaUsage `json:"concurrent_crawls"`
+	QueuedCrawls       int        `json:"queued_crawls"`
+	CrawlsToday        QuotaUsage `json:"crawls_today"`
+	PagesThisMonth     QuotaUsage `json:"pages_this_month"`
+	LinkChecksPerCrawl int        `json:"link_checks_per_crawl"`
+}
+
+// UsageCounts holds the raw counters a Usage report is built from
+type UsageCounts struct {
+	RunningCrawls  int
+	QueuedCrawls   int
+	CrawlsToday    int
+	PagesThisMonth int
+}
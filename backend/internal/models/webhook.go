@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Webhook event types
+const (
+	WebhookEventCrawlStarted     = "crawl.started"
+	WebhookEventCrawlCompleted   = "crawl.completed"
+	WebhookEventCrawlFailed      = "crawl.failed"
+	WebhookEventBrokenLinksFound = "broken_links.found"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{
+	WebhookEventCrawlStarted,
+	WebhookEventCrawlCompleted,
+	WebhookEventCrawlFailed,
+	WebhookEventBrokenLinksFound,
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// Webhook is an endpoint receiving signed crawl lifecycle events
+type Webhook struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookRequest represents a request to create or update a webhook. An
+// empty secret generates a new one, empty events subscribe to all events.
+type WebhookRequest struct {
+	URL     string   `json:"url" binding:"required"`
+	Secret  string   `json:"secret"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// WebhookDelivery is the log entry of one event sent to a webhook
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  sql.NullTime    `json:"-"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// WebhookPayload is the JSON body sent to webhook endpoints
+type WebhookPayload struct {
+	Event     string           `json:"event"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookCrawlData `json:"data"`
+}
+
+// WebhookCrawlData describes the crawl an event is about
+type WebhookCrawlData struct {
+	CrawlResultID int        `json:"crawl_result_id"`
+	URL           string     `json:"url"`
+	Status        string     `json:"status"`
+	PagesFetched  int        `json:"pages_fetched"`
+	LinksFound    int        `json:"links_found"`
+	LinksChecked  int        `json:"links_checked"`
+	LinksFailed   int        `json:"links_failed"`
+	ErrorClass    string     `json:"error_class,omitempty"`
+	ErrorMessage  string     `json:"error_message,omitempty"`
+	BrokenLinks   []LinkData `json:"broken_links,omitempty"`
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/agent"
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// agentTokenPrefix marks agent tokens, making leaked ones easy to recognise
+const agentTokenPrefix = "agt_"
+
+// ErrAgentNotFound is returned when an agent does not exist or belongs to another user
+var ErrAgentNotFound = errors.New("agent not found")
+
+// ErrInvalidAgent is returned when an agent request fails validation
+var ErrInvalidAgent = errors.New("invalid agent")
+
+// ErrInvalidAgentToken is returned when an agent authenticates with an unknown token
+var ErrInvalidAgentToken = errors.New("invalid agent token")
+
+// ErrJobNotLeased is returned when an agent reports on a job it does not hold,
+// typically because its lease expired and the job was handed out again
+var ErrJobNotLeased = errors.New("job is not leased to this agent")
+
+// ErrInvalidCompletion is returned when an agent uploads a malformed job outcome
+var ErrInvalidCompletion = errors.New("invalid job completion")
+
+// AgentService defines the interface for registering remote crawl agents and
+// exchanging jobs and results with them
+type AgentService interface {
+	CreateAgent(userID int, req *models.AgentRequest) (*models.AgentRegistration, error)
+	GetAgents(userID int) ([]models.Agent, error)
+	DeleteAgent(userID int, id string) error
+	Authenticate(token string) (*models.Agent, error)
+	ClaimJob(a *models.Agent) (*agent.Job, error)
+	Heartbeat(a *models.Agent, jobID int) (*agent.Heartbeat, error)
+	CompleteJob(a *models.Agent, jobID int, completion *agent.Completion) error
+}
+
+// agentService implements the AgentService interface. Agents lease jobs like
+// workers do, under the owner name "agent-<id>", so expired agent jobs are
+// reclaimed by the workers' regular reclaim.
+type agentService struct {
+	agents database.AgentRepository
+	jobs   database.JobRepository
+	repo   database.Repository
+	quotas QuotaService
+	events crawler.EventSink
+	lease  time.Duration
+	retry  RetryPolicy
+}
+
+// NewAgentService creates a new agent service
+func NewAgentService(agents database.AgentRepository, jobs database.JobRepository, repo database.Repository, quotas QuotaService, events crawler.EventSink, lease time.Duration, retry RetryPolicy) AgentService {
+	return &agentService{
+		agents: agents,
+		jobs:   jobs,
+		repo:   repo,
+		quotas: quotas,
+		events: events,
+		lease:  lease,
+		retry:  retry,
+	}
+}
+
+// CreateAgent registers a new agent and returns its token, which is only
+// stored hashed and cannot be retrieved again
+func (s *agentService) CreateAgent(userID int, req *models.AgentRequest) (*models.AgentRegistration, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidAgent)
+	}
+
+	token, err := generateAgentToken()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &models.Agent{UserID: userID, Name: name}
+	if _, err := s.agents.CreateAgent(a, hashAgentToken(token)); err != nil {
+		return nil, fmt.Errorf("failed to create agent: %w", err)
+	}
+
+	created, err := s.agents.GetAgentByID(userID, a.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent: %w", err)
+	}
+	return &models.AgentRegistration{Agent: *created, Token: token}, nil
+}
+
+// GetAgents returns all agents of a user
+func (s *agentService) GetAgents(userID int) ([]models.Agent, error) {
+	agents, err := s.agents.GetAgents(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agents: %w", err)
+	}
+	return agents, nil
+}
+
+// DeleteAgent removes an agent, revoking its token. Its URLs and queued jobs
+// go back to server-side crawling.
+func (s *agentService) DeleteAgent(userID int, id string) error {
+	agentID, err := strconv.Atoi(id)
+	if err != nil {
+		return ErrAgentNotFound
+	}
+
+	err = s.agents.DeleteAgent(userID, agentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAgentNotFound
+	}
+	return err
+}
+
+// Authenticate returns the agent a token was issued to and records its visit
+func (s *agentService) Authenticate(token string) (*models.Agent, error) {
+	if !strings.HasPrefix(token, agentTokenPrefix) {
+		return nil, ErrInvalidAgentToken
+	}
+
+	a, err := s.agents.GetAgentByTokenHash(hashAgentToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAgentToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate agent: %w", err)
+	}
+
+	if err := s.agents.TouchAgent(a.ID); err != nil {
+		log.Printf("Failed to record visit of agent %d: %v", a.ID, err)
+	}
+	return a, nil
+}
+
+// ClaimJob leases the next job assigned to an agent, or returns nil when none
+// can run
+func (s *agentService) ClaimJob(a *models.Agent) (*agent.Job, error) {
+	job, err := s.jobs.ClaimAgentJob(a.ID, agentOwner(a), s.lease, s.quotas.Limits().ConcurrentCrawls)
+	if err != nil || job == nil {
+		return nil, err
+	}
+
+	log.Printf("Agent %d claimed job %d for %s", a.ID, job.ID, job.URL)
+	// The first attempt fetches the page reserved when the crawl was submitted
+	if job.Attempts > 1 {
+		if err := s.quotas.RecordPage(job.UserID); err != nil {
+			log.Printf("Failed to record page fetch of job %d: %v", job.ID, err)
+		}
+	}
+	if err := s.repo.UpdateCrawlResultStatus(job.UserID, job.URL, "running"); err != nil {
+		log.Printf("Failed to update status of %s: %v", job.URL, err)
+	}
+	publishStatus(s.events, job.UserID, job.CrawlResultID, job.URL, "running")
+
+	return &agent.Job{
+		ID:            job.ID,
+		CrawlResultID: job.CrawlResultID,
+		URL:           job.URL,
+		Attempts:      job.Attempts,
+		MaxLinkChecks: s.quotas.Limits().LinkChecksPerCrawl,
+	}, nil
+}
+
+// Heartbeat renews the lease of a job and tells the agent whether to stop it
+func (s *agentService) Heartbeat(a *models.Agent, jobID int) (*agent.Heartbeat, error) {
+	owner := agentOwner(a)
+	held, err := s.jobs.RenewLease(jobID, owner, s.lease)
+	if err != nil {
+		return nil, err
+	}
+	if !held {
+		return &agent.Heartbeat{}, nil
+	}
+
+	cancelled, err := s.jobs.GetCancelRequested(owner)
+	if err != nil {
+		return nil, err
+	}
+	heartbeat := &agent.Heartbeat{Held: true}
+	for _, id := range cancelled {
+		if id == jobID {
+			heartbeat.CancelRequested = true
+		}
+	}
+	return heartbeat, nil
+}
+
+// CompleteJob stores the result uploaded by an agent and records the outcome
+// of its job, the way a worker records a crawl it ran itself
+func (s *agentService) CompleteJob(a *models.Agent, jobID int, completion *agent.Completion) error {
+	status := ""
+	switch completion.Outcome {
+	case agent.OutcomeDone:
+		status = models.JobStatusDone
+	case agent.OutcomeFailed:
+		status = models.JobStatusFailed
+	case agent.OutcomeCancelled:
+		status = models.JobStatusCancelled
+	case agent.OutcomeInterrupted:
+		status = models.JobStatusInterrupted
+	default:
+		return fmt.Errorf("%w: unknown outcome %q", ErrInvalidCompletion, completion.Outcome)
+	}
+	if completion.Result == nil {
+		return fmt.Errorf("%w: result is required", ErrInvalidCompletion)
+	}
+
+	owner := agentOwner(a)
+	job, err := s.jobs.GetJobByID(jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrJobNotLeased
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+	if job.Status != models.JobStatusRunning || job.LeaseOwner.String != owner {
+		return ErrJobNotLeased
+	}
+
+	err = completion.Result.Apply(s.repo, job.UserID, job.CrawlResultID, job.URL, job.Type)
+	if errors.Is(err, crawler.ErrUnfinishedResult) {
+		return fmt.Errorf("%w: %v", ErrInvalidCompletion, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store result of job %d: %w", job.ID, err)
+	}
+	s.publishResult(job, completion.Result)
+
+	if status == models.JobStatusFailed && completion.Transient && job.Attempts < s.retry.MaxAttempts {
+		delay := s.retry.Delay(job.Attempts)
+		log.Printf("Agent %d job %d failed for %s: %s, retrying in %s (attempt %d of %d)",
+			a.ID, job.ID, job.URL, completion.Error, delay, job.Attempts, s.retry.MaxAttempts)
+
+		if err := s.repo.UpdateCrawlResultStatus(job.UserID, job.URL, "pending"); err != nil {
+			log.Printf("Failed to reset status of %s: %v", job.URL, err)
+		}
+		publishStatus(s.events, job.UserID, job.CrawlResultID, job.URL, "pending")
+		return s.jobs.RetryJob(job.ID, owner, completion.Error, delay)
+	}
+
+	log.Printf("Agent %d finished job %d for %s: %s", a.ID, job.ID, job.URL, status)
+	if err := s.jobs.UpdateJobStatus(job.ID, owner, status, completion.Error); err != nil {
+		return err
+	}
+	if status == models.JobStatusFailed {
+		publishFailure(s.events, job)
+	}
+	return nil
+}
+
+// publishResult sends the final status of a crawl run by an agent, with the
+// counters a server-side crawl would have reported
+func (s *agentService) publishResult(job *models.CrawlJob, result *crawler.Result) {
+	if s.events == nil {
+		return
+	}
+
+	event := models.CrawlEvent{
+		Type:          models.EventStatus,
+		CrawlResultID: job.CrawlResultID,
+		UserID:        job.UserID,
+		URL:           job.URL,
+		Status:        result.Status,
+		LinksFound:    len(result.Links),
+		Time:          time.Now(),
+	}
+	if result.Status != "error" {
+		event.PagesFetched = 1
+	}
+	// Unchecked links have neither a status code nor a failure
+	for _, link := range result.Links {
+		if link.StatusCode != 0 || !link.IsAccessible {
+			event.LinksChecked++
+			if !link.IsAccessible {
+				event.LinksFailed++
+			}
+		}
+	}
+	s.events.Publish(event)
+}
+
+// agentOwner is the lease owner name of an agent's jobs
+func agentOwner(a *models.Agent) string {
+	return fmt.Sprintf("agent-%d", a.ID)
+}
+
+// generateAgentToken returns a new random agent token
+func generateAgentToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate agent token: %w", err)
+	}
+	return agentTokenPrefix + hex.EncodeToString(token), nil
+}
+
+// hashAgentToken returns the form an agent token is stored in
+func hashAgentToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/agent"
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// newTestAgentService creates an agent service without quota limits
+func newTestAgentService(conn *database.Connection) AgentService {
+	return NewAgentService(
+		database.NewAgentRepository(conn),
+		database.NewJobRepository(conn),
+		database.NewCrawlRepository(conn, nil),
+		NewQuotaService(database.NewUsageRepository(conn), models.QuotaLimits{}),
+		nil, time.Minute, RetryPolicy{MaxAttempts: 3, Backoff: time.Minute},
+	)
+}
+
+// createTestAgentJob registers an agent of a new user and queues a crawl of a
+// URL assigned to it
+func createTestAgentJob(t *testing.T, conn *database.Connection, service AgentService) (*models.AgentRegistration, int) {
+	t.Helper()
+	userID := createTestUser(t, conn, "agent@example.com")
+	registration, err := service.CreateAgent(userID, &models.AgentRequest{Name: "office"})
+	if err != nil {
+		t.Fatalf("CreateAgent: %v", err)
+	}
+
+	resultID, err := database.NewCrawlRepository(conn, nil).CreateCrawlResult(userID, "https://example.com/")
+	if err != nil {
+		t.Fatalf("CreateCrawlResult: %v", err)
+	}
+	if err := database.NewAgentRepository(conn).AssignCrawlResult(userID, resultID, registration.Agent.ID); err != nil {
+		t.Fatalf("AssignCrawlResult: %v", err)
+	}
+	if _, err := database.NewJobRepository(conn).EnqueueJob(&models.CrawlJob{
+		CrawlResultID: resultID, UserID: userID, URL: "https://example.com/", Type: models.JobTypeCrawl,
+	}); err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+	return registration, resultID
+}
+
+func TestAgentAuthenticate(t *testing.T) {
+	conn := newTestConnection(t)
+	service := newTestAgentService(conn)
+	userID := createTestUser(t, conn, "agent@example.com")
+	registration, err := service.CreateAgent(userID, &models.AgentRequest{Name: "office"})
+	if err != nil {
+		t.Fatalf("CreateAgent: %v", err)
+	}
+
+	a, err := service.Authenticate(registration.Token)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if a.ID != registration.Agent.ID || a.UserID != userID {
+		t.Errorf("Authenticate = agent %d of user %d, want agent %d of user %d", a.ID, a.UserID, registration.Agent.ID, userID)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "without prefix", token: registration.Token[len(agentTokenPrefix):]},
+		{name: "unknown", token: agentTokenPrefix + "0000"},
+		{name: "user token", token: "Bearer " + registration.Token},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.Authenticate(tt.token); !errors.Is(err, ErrInvalidAgentToken) {
+				t.Errorf("Authenticate(%q) error = %v, want %v", tt.token, err, ErrInvalidAgentToken)
+			}
+		})
+	}
+
+	// Deleting an agent revokes its token
+	if err := service.DeleteAgent(userID, strconv.Itoa(registration.Agent.ID)); err != nil {
+		t.Fatalf("DeleteAgent: %v", err)
+	}
+	if _, err := service.Authenticate(registration.Token); !errors.Is(err, ErrInvalidAgentToken) {
+		t.Errorf("Authenticate after DeleteAgent error = %v, want %v", err, ErrInvalidAgentToken)
+	}
+}
+
+func TestAgentClaimAndComplete(t *testing.T) {
+	conn := newTestConnection(t)
+	service := newTestAgentService(conn)
+	registration, resultID := createTestAgentJob(t, conn, service)
+	a := &registration.Agent
+
+	// Another agent of the same user gets nothing and cannot report on the job
+	other, err := service.CreateAgent(a.UserID, &models.AgentRequest{Name: "laptop"})
+	if err != nil {
+		t.Fatalf("CreateAgent: %v", err)
+	}
+	if job, err := service.ClaimJob(&other.Agent); err != nil || job != nil {
+		t.Fatalf("ClaimJob by another agent = %+v, %v, want nothing", job, err)
+	}
+
+	job, err := service.ClaimJob(a)
+	if err != nil {
+		t.Fatalf("ClaimJob: %v", err)
+	}
+	if job == nil || job.CrawlResultID != resultID || job.URL != "https://example.com/" {
+		t.Fatalf("ClaimJob = %+v, want the job of crawl result %d", job, resultID)
+	}
+	if again, err := service.ClaimJob(a); err != nil || again != nil {
+		t.Fatalf("ClaimJob of a claimed job = %+v, %v, want nothing", again, err)
+	}
+
+	heartbeat, err := service.Heartbeat(a, job.ID)
+	if err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if !heartbeat.Held || heartbeat.CancelRequested {
+		t.Errorf("Heartbeat = %+v, want held and not cancelled", heartbeat)
+	}
+	if heartbeat, err := service.Heartbeat(&other.Agent, job.ID); err != nil || heartbeat.Held {
+		t.Errorf("Heartbeat by another agent = %+v, %v, want not held", heartbeat, err)
+	}
+
+	title := "Example"
+	done := &agent.Completion{
+		Outcome: agent.OutcomeDone,
+		// The run type comes from the job whatever the agent claims
+		Result: &crawler.Result{RunType: models.JobTypeReanalyze, Status: "done", Title: &title, Headings: map[string]int{}},
+	}
+	if err := service.CompleteJob(&other.Agent, job.ID, done); !errors.Is(err, ErrJobNotLeased) {
+		t.Errorf("CompleteJob by another agent error = %v, want %v", err, ErrJobNotLeased)
+	}
+
+	invalid := []struct {
+		name       string
+		completion *agent.Completion
+	}{
+		{name: "unknown outcome", completion: &agent.Completion{Outcome: "paused", Result: done.Result}},
+		{name: "no result", completion: &agent.Completion{Outcome: agent.OutcomeDone}},
+		{name: "unfinished result", completion: &agent.Completion{Outcome: agent.OutcomeDone, Result: &crawler.Result{Status: "running"}}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := service.CompleteJob(a, job.ID, tt.completion); !errors.Is(err, ErrInvalidCompletion) {
+				t.Errorf("CompleteJob error = %v, want %v", err, ErrInvalidCompletion)
+			}
+		})
+	}
+
+	repo := database.NewCrawlRepository(conn, nil)
+	if runs, err := repo.GetCrawlRuns(resultID, 10); err != nil || len(runs) != 0 {
+		t.Fatalf("runs after rejected completions = %+v, %v, want none", runs, err)
+	}
+
+	if err := service.CompleteJob(a, job.ID, done); err != nil {
+		t.Fatalf("CompleteJob: %v", err)
+	}
+
+	runs, err := repo.GetCrawlRuns(resultID, 10)
+	if err != nil {
+		t.Fatalf("GetCrawlRuns: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Type != models.JobTypeCrawl || runs[0].FinishedAt == nil {
+		t.Fatalf("runs = %+v, want a single finished crawl run", runs)
+	}
+	result, err := repo.GetCrawlResultByID(a.UserID, resultID)
+	if err != nil {
+		t.Fatalf("GetCrawlResultByID: %v", err)
+	}
+	if result.CrawlData.Status != "done" || result.CrawlData.Title.String != title {
+		t.Errorf("crawl result = status %q, title %q, want done, %q", result.CrawlData.Status, result.CrawlData.Title.String, title)
+	}
+
+	stored, err := database.NewJobRepository(conn).GetJobByID(job.ID)
+	if err != nil {
+		t.Fatalf("GetJobByID: %v", err)
+	}
+	if stored.Status != models.JobStatusDone {
+		t.Errorf("job status = %q, want %q", stored.Status, models.JobStatusDone)
+	}
+
+	// A job is completed once
+	if err := service.CompleteJob(a, job.ID, done); !errors.Is(err, ErrJobNotLeased) {
+		t.Errorf("second CompleteJob error = %v, want %v", err, ErrJobNotLeased)
+	}
+}
+
+func TestAgentCompleteTransientFailure(t *testing.T) {
+	conn := newTestConnection(t)
+	service := newTestAgentService(conn)
+	registration, resultID := createTestAgentJob(t, conn, service)
+	a := &registration.Agent
+
+	job, err := service.ClaimJob(a)
+	if err != nil || job == nil {
+		t.Fatalf("ClaimJob = %+v, %v", job, err)
+	}
+
+	failed := &agent.Completion{
+		Outcome:   agent.OutcomeFailed,
+		Error:     "connection refused",
+		Transient: true,
+		Result:    &crawler.Result{Status: "error", ErrorClass: "network", ErrorMessage: "connection refused", Headings: map[string]int{}},
+	}
+	if err := service.CompleteJob(a, job.ID, failed); err != nil {
+		t.Fatalf("CompleteJob: %v", err)
+	}
+
+	stored, err := database.NewJobRepository(conn).GetJobByID(job.ID)
+	if err != nil {
+		t.Fatalf("GetJobByID: %v", err)
+	}
+	if stored.Status != models.JobStatusQueued {
+		t.Errorf("job status = %q, want %q", stored.Status, models.JobStatusQueued)
+	}
+	// The retry waits for its backoff
+	if again, err := service.ClaimJob(a); err != nil || again != nil {
+		t.Errorf("ClaimJob before the backoff = %+v, %v, want nothing", again, err)
+	}
+	result, err := database.NewCrawlRepository(conn, nil).GetCrawlResultByID(a.UserID, resultID)
+	if err != nil {
+		t.Fatalf("GetCrawlResultByID: %v", err)
+	}
+	if result.CrawlData.Status != "pending" {
+		t.Errorf("crawl result status = %q, want pending until the retry", result.CrawlData.Status)
+	}
+}
@@ -1,39 +1,82 @@
 package services
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
+	"os"
 	"strconv"
 
 	"github.com/seo-crawler-app/internal/database"
 	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/blob"
 	"github.com/seo-crawler-app/pkg/crawler"
 )
 
+// runHistoryLimit is the number of most recent runs listed in a crawl history
+const runHistoryLimit = 100
+
+// ErrResultNotFound is returned when a crawl result does not exist or belongs to another user
+var ErrResultNotFound = errors.New("crawl result not found")
+
+// ErrRunNotFound is returned when a crawl run does not exist or belongs to another crawl result
+var ErrRunNotFound = errors.New("crawl run not found")
+
+// ErrNoRunToCompare is returned when a diff has no earlier run to compare with
+var ErrNoRunToCompare = errors.New("no earlier crawl run to compare with")
+
+// ErrSnapshotNotFound is returned when a crawl run kept no snapshot of its page
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// ErrArchiveNotFound is returned when a crawl run has no WARC archive
+var ErrArchiveNotFound = errors.New("WARC archive not found")
+
 // CrawlService defines the interface for crawl business logic
 type CrawlService interface {
 	SubmitCrawl(userID int, crawlReq *models.CrawlRequest) error
 	GetCrawlResults(userID int, page, pageSize int, status, search, sortBy, sortOrder string) (*models.PaginationResponse, error)
+	Search(userID int, query string, page, pageSize int) (*models.SearchResponse, error)
 	GetCrawlResultByID(userID int, id string) (*models.URLData, error)
 	GetLinksByCrawlID(id string) ([]models.LinkData, error)
 	GetHeadingsByCrawlID(id string) ([]models.HeadingData, error)
+	GetFormsByCrawlID(userID int, id string) ([]models.FormData, error)
+	GetSecurityByCrawlID(userID int, id string) (*models.SecurityData, error)
+	GetIssuesByCrawlID(userID int, id string) ([]models.IssueData, error)
+	GetResourceReport(userID int, id string) (*models.ResourceReport, error)
+	GetCrawlRuns(userID int, id string) ([]models.CrawlRun, error)
+	GetCrawlRun(userID int, id, runID string) (*models.CrawlRun, error)
+	DiffCrawlRuns(userID int, id, fromRunID, toRunID string) (*models.RunDiff, error)
 	BulkRerun(userID int, urls []string) error
 	BulkDelete(userID int, urls []string) error
 	StopCrawl(userID int, id string) error
+	ReplayCrawl(userID int, id, runID string) error
+	GetArchivePath(userID int, id, runID string) (string, error)
+	GetSnapshot(userID int, id, runID string) (*models.Snapshot, error)
+	ReanalyzeCrawl(userID int, id, runID string) error
+	BulkReanalyze(userID int, urls []string) error
 }
 
 // crawlService implements the CrawlService interface
 type crawlService struct {
 	repo    database.Repository
+	agents  database.AgentRepository
 	crawler crawler.CrawlerService
+	queue   JobQueue
+	quotas  QuotaService
+	events  crawler.EventSink
 }
 
 // NewCrawlService creates a new crawl service
-func NewCrawlService(repo database.Repository, crawler crawler.CrawlerService) CrawlService {
+func NewCrawlService(repo database.Repository, agents database.AgentRepository, crawler crawler.CrawlerService, queue JobQueue, quotas QuotaService, events crawler.EventSink) CrawlService {
 	return &crawlService{
 		repo:    repo,
+		agents:  agents,
 		crawler: crawler,
+		queue:   queue,
+		quotas:  quotas,
+		events:  events,
 	}
 }
 
@@ -46,19 +89,46 @@ func (s *crawlService) SubmitCrawl(userID int, crawlReq *models.CrawlRequest) er
 		return fmt.Errorf("invalid URL format: %w", err)
 	}
 
-	// Check if URL already exists and update status to pending for re-crawl
-	// For now, we'll create a new entry each time
-	_, err := s.repo.CreateCrawlResult(userID, crawlReq.URL)
+	if crawlReq.AgentID != 0 {
+		if _, err := s.agents.GetAgentByID(userID, crawlReq.AgentID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAgentNotFound
+			}
+			return fmt.Errorf("failed to get agent: %w", err)
+		}
+	}
+
+	if err := s.quotas.ReserveCrawls(userID, 1); err != nil {
+		return err
+	}
+	queued := false
+	defer func() {
+		if queued {
+			return
+		}
+		if err := s.quotas.ReleaseCrawls(userID, 1); err != nil {
+			log.Printf("Failed to release crawl quota of user %d: %v", userID, err)
+		}
+	}()
+
+	// Submitting a URL again re-crawls its existing result, adding a run to its history
+	crawlID, err := s.repo.CreateCrawlResult(userID, crawlReq.URL)
 	if err != nil {
 		return fmt.Errorf("failed to create crawl result: %w", err)
 	}
 
-	// Start crawling in background
-	go func() {
-		if err := s.crawler.CrawlURL(userID, crawlReq.URL, s.repo); err != nil {
-			log.Printf("Failed to crawl URL %s: %v", crawlReq.URL, err)
+	// Crawl results assigned to an agent are crawled by it from now on
+	if crawlReq.AgentID != 0 {
+		if err := s.agents.AssignCrawlResult(userID, crawlID, crawlReq.AgentID); err != nil {
+			return fmt.Errorf("failed to assign crawl to agent: %w", err)
 		}
-	}()
+	}
+
+	// Queue the crawl for the worker pool
+	if err := s.queue.Enqueue(userID, crawlID, crawlReq.URL, models.JobTypeCrawl); err != nil {
+		return fmt.Errorf("failed to queue crawl: %w", err)
+	}
+	queued = true
 
 	return nil
 }
@@ -117,6 +187,38 @@ func (s *crawlService) GetCrawlResultByID(userID int, id string) (*models.URLDat
 		urlData.CrawlData.HeadingDetails = headings
 	}
 
+	// Get classified forms
+	forms, err := s.repo.GetFormsByCrawlID(crawlID)
+	if err != nil {
+		log.Printf("Failed to get forms for crawl ID %d: %v", crawlID, err)
+	} else {
+		urlData.CrawlData.Forms = forms
+	}
+
+	// Get HTTPS and TLS checks
+	security, err := s.repo.GetSecurityCheckByCrawlID(crawlID)
+	if err != nil {
+		log.Printf("Failed to get security check for crawl ID %d: %v", crawlID, err)
+	} else {
+		urlData.CrawlData.Security = security
+	}
+
+	// Get detected issues
+	issues, err := s.repo.GetIssuesByCrawlID(crawlID)
+	if err != nil {
+		log.Printf("Failed to get issues for crawl ID %d: %v", crawlID, err)
+	} else {
+		urlData.CrawlData.Issues = issues
+	}
+
+	// Get page resources
+	resources, err := s.repo.GetResourcesByCrawlID(crawlID)
+	if err != nil {
+		log.Printf("Failed to get resources for crawl ID %d: %v", crawlID, err)
+	} else {
+		urlData.CrawlData.Resources = resources
+	}
+
 	return urlData, nil
 }
 
@@ -150,19 +252,238 @@ func (s *crawlService) GetHeadingsByCrawlID(id string) ([]models.HeadingData, er
 	return headings, nil
 }
 
-// BulkRerun re-runs crawling for multiple URLs
+// GetFormsByCrawlID retrieves classified forms for a specific crawl result
+func (s *crawlService) GetFormsByCrawlID(userID int, id string) ([]models.FormData, error) {
+	crawlID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	if _, err := s.repo.GetCrawlResultByID(userID, crawlID); err != nil {
+		return nil, fmt.Errorf("failed to get crawl result: %w", err)
+	}
+
+	forms, err := s.repo.GetFormsByCrawlID(crawlID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forms: %w", err)
+	}
+
+	return forms, nil
+}
+
+// GetSecurityByCrawlID retrieves the HTTPS and TLS checks for a specific crawl result
+func (s *crawlService) GetSecurityByCrawlID(userID int, id string) (*models.SecurityData, error) {
+	crawlID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	if _, err := s.repo.GetCrawlResultByID(userID, crawlID); err != nil {
+		return nil, fmt.Errorf("failed to get crawl result: %w", err)
+	}
+
+	security, err := s.repo.GetSecurityCheckByCrawlID(crawlID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get security check: %w", err)
+	}
+
+	return security, nil
+}
+
+// GetIssuesByCrawlID retrieves detected issues for a specific crawl result
+func (s *crawlService) GetIssuesByCrawlID(userID int, id string) ([]models.IssueData, error) {
+	crawlID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	if _, err := s.repo.GetCrawlResultByID(userID, crawlID); err != nil {
+		return nil, fmt.Errorf("failed to get crawl result: %w", err)
+	}
+
+	issues, err := s.repo.GetIssuesByCrawlID(crawlID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get issues: %w", err)
+	}
+
+	return issues, nil
+}
+
+// GetResourceReport retrieves the page resources and page-weight summary for a specific crawl result
+func (s *crawlService) GetResourceReport(userID int, id string) (*models.ResourceReport, error) {
+	crawlID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	urlData, err := s.repo.GetCrawlResultByID(userID, crawlID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get crawl result: %w", err)
+	}
+
+	resources, err := s.repo.GetResourcesByCrawlID(crawlID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resources: %w", err)
+	}
+	if resources == nil {
+		resources = []models.ResourceData{}
+	}
+
+	return &models.ResourceReport{
+		Resources: resources,
+		Summary:   crawler.SummarizeResources(urlData.CrawlData.HTMLSize, resources),
+	}, nil
+}
+
+// GetCrawlRuns retrieves the run history of a specific crawl result, newest first
+func (s *crawlService) GetCrawlRuns(userID int, id string) ([]models.CrawlRun, error) {
+	crawlID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	if _, err := s.repo.GetCrawlResultByID(userID, crawlID); err != nil {
+		return nil, fmt.Errorf("failed to get crawl result: %w", err)
+	}
+
+	runs, err := s.repo.GetCrawlRuns(crawlID, runHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get crawl runs: %w", err)
+	}
+	if runs == nil {
+		runs = []models.CrawlRun{}
+	}
+
+	return runs, nil
+}
+
+// GetCrawlRun retrieves a single run of a specific crawl result, with the links
+// and headings it found
+func (s *crawlService) GetCrawlRun(userID int, id, runID string) (*models.CrawlRun, error) {
+	crawlID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	if _, err := s.repo.GetCrawlResultByID(userID, crawlID); err != nil {
+		return nil, fmt.Errorf("failed to get crawl result: %w", err)
+	}
+
+	return s.getCrawlRun(crawlID, runID)
+}
+
+// DiffCrawlRuns compares two runs of a specific crawl result. Without toRunID
+// the latest run is used, and without fromRunID the run before it.
+func (s *crawlService) DiffCrawlRuns(userID int, id, fromRunID, toRunID string) (*models.RunDiff, error) {
+	crawlID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	if _, err := s.repo.GetCrawlResultByID(userID, crawlID); err != nil {
+		return nil, fmt.Errorf("failed to get crawl result: %w", err)
+	}
+
+	if fromRunID == "" || toRunID == "" {
+		runs, err := s.repo.GetCrawlRuns(crawlID, runHistoryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get crawl runs: %w", err)
+		}
+		if toRunID == "" {
+			if len(runs) == 0 {
+				return nil, ErrRunNotFound
+			}
+			toRunID = strconv.Itoa(runs[0].ID)
+		}
+		if fromRunID == "" {
+			to, err := strconv.Atoi(toRunID)
+			if err != nil {
+				return nil, ErrRunNotFound
+			}
+			// Runs are listed newest first
+			for _, run := range runs {
+				if run.ID < to {
+					fromRunID = strconv.Itoa(run.ID)
+					break
+				}
+			}
+			if fromRunID == "" {
+				return nil, ErrNoRunToCompare
+			}
+		}
+	}
+
+	from, err := s.getCrawlRun(crawlID, fromRunID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.getCrawlRun(crawlID, toRunID)
+	if err != nil {
+		return nil, err
+	}
+
+	return crawler.DiffRuns(from, to), nil
+}
+
+// getCrawlRun loads a run of a crawl result with its links and headings
+func (s *crawlService) getCrawlRun(crawlID int, runID string) (*models.CrawlRun, error) {
+	id, err := strconv.Atoi(runID)
+	if err != nil {
+		return nil, ErrRunNotFound
+	}
+
+	run, err := s.repo.GetCrawlRun(crawlID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRunNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get crawl run: %w", err)
+	}
+
+	links, err := s.repo.GetLinksByRunID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get links: %w", err)
+	}
+	run.CrawlData.Links = links
+
+	headings, err := s.repo.GetHeadingsByRunID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get headings: %w", err)
+	}
+	run.CrawlData.HeadingDetails = headings
+
+	return run, nil
+}
+
+// BulkRerun re-runs crawling for multiple URLs. The whole batch is rejected
+// when it does not fit in the user's quotas.
 func (s *crawlService) BulkRerun(userID int, urls []string) error {
-	if err := s.repo.BulkUpdateStatus(userID, urls, "pending"); err != nil {
-		return fmt.Errorf("failed to update URLs status: %w", err)
+	if err := s.quotas.ReserveCrawls(userID, len(urls)); err != nil {
+		return err
 	}
 
-	// Start crawling for each URL
+	queued := 0
+	defer func() {
+		if err := s.quotas.ReleaseCrawls(userID, len(urls)-queued); err != nil {
+			log.Printf("Failed to release crawl quota of user %d: %v", userID, err)
+		}
+	}()
+
+	// Queue a crawl for each URL, skipping those already queued or running
 	for _, url := range urls {
-		go func(u string) {
-			if err := s.crawler.CrawlURL(userID, u, s.repo); err != nil {
-				log.Printf("Failed to crawl URL %s: %v", u, err)
+		crawlID, err := s.repo.GetCrawlResultIDByURL(userID, url)
+		if err != nil {
+			return fmt.Errorf("failed to get crawl result: %w", err)
+		}
+
+		if err := s.queue.Enqueue(userID, crawlID, url, models.JobTypeCrawl); err != nil {
+			if errors.Is(err, ErrJobActive) {
+				log.Printf("Skipping re-run of %s: %v", url, err)
+				continue
 			}
-		}(url)
+			return fmt.Errorf("failed to queue crawl: %w", err)
+		}
+		queued++
 	}
 
 	return nil
@@ -177,24 +498,225 @@ func (s *crawlService) BulkDelete(userID int, urls []string) error {
 	return nil
 }
 
-// StopCrawl stops crawling for a specific URL
+// StopCrawl stops crawling for a specific URL. A running crawl is cancelled
+// and stores its partial results as stopped once its fetches have aborted.
 func (s *crawlService) StopCrawl(userID int, id string) error {
-	// This would need to be implemented in the repository
-	// For now, we'll update the status to stopped
 	crawlID, err := strconv.Atoi(id)
 	if err != nil {
 		return fmt.Errorf("invalid ID format: %w", err)
 	}
 
-	// Get the URL first, then update its status
+	// Get the URL first, then cancel its crawl
 	urlData, err := s.repo.GetCrawlResultByID(userID, crawlID)
 	if err != nil {
 		return fmt.Errorf("failed to get crawl result: %w", err)
 	}
 
+	running, err := s.queue.Cancel(crawlID)
+	if err != nil {
+		return fmt.Errorf("failed to stop crawling: %w", err)
+	}
+	if running {
+		return nil
+	}
+
 	if err := s.repo.UpdateCrawlResultStatus(userID, urlData.URL, "stopped"); err != nil {
 		return fmt.Errorf("failed to stop crawling: %w", err)
 	}
+	publishStatus(s.events, userID, crawlID, urlData.URL, "stopped")
+
+	return nil
+}
+
+// ReplayCrawl re-runs the analyzers against the WARC archive of a run of a
+// crawl result, the latest run with an archive when runID is empty, without
+// fetching anything from the network
+func (s *crawlService) ReplayCrawl(userID int, id, runID string) error {
+	crawlID, urlData, err := s.ownedCrawlResult(userID, id)
+	if err != nil {
+		return err
+	}
+
+	sourceRunID, archivePath, err := s.findArchive(crawlID, runID)
+	if err != nil {
+		return err
+	}
+
+	// Queue the replay for the worker pool
+	if err := s.queue.EnqueueReplay(userID, crawlID, urlData.URL, sourceRunID); err != nil {
+		return fmt.Errorf("failed to queue replay of %s: %w", archivePath, err)
+	}
+
+	return nil
+}
+
+// GetArchivePath returns the WARC archive of a run of a crawl result, the
+// latest run with an archive when runID is empty
+func (s *crawlService) GetArchivePath(userID int, id, runID string) (string, error) {
+	crawlID, _, err := s.ownedCrawlResult(userID, id)
+	if err != nil {
+		return "", err
+	}
+
+	_, archivePath, err := s.findArchive(crawlID, runID)
+	return archivePath, err
+}
+
+// ownedCrawlResult returns a crawl result of a user by its ID, or
+// ErrResultNotFound when there is none
+func (s *crawlService) ownedCrawlResult(userID int, id string) (int, *models.URLData, error) {
+	crawlID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, nil, ErrResultNotFound
+	}
+
+	urlData, err := s.repo.GetCrawlResultByID(userID, crawlID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, ErrResultNotFound
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get crawl result: %w", err)
+	}
+	return crawlID, urlData, nil
+}
+
+// findArchive returns the run and path of the WARC archive of run runID of a
+// crawl result, or of its latest run with an archive when runID is empty.
+// Only live crawls are archived, replays and re-analyses are not.
+func (s *crawlService) findArchive(crawlID int, runID string) (int, string, error) {
+	if runID != "" {
+		run, err := strconv.Atoi(runID)
+		if err != nil {
+			return 0, "", ErrRunNotFound
+		}
+		// The run must belong to the crawl result
+		if _, err := s.repo.GetCrawlRun(crawlID, run); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, "", ErrRunNotFound
+			}
+			return 0, "", fmt.Errorf("failed to get crawl run: %w", err)
+		}
+		archivePath := s.crawler.ArchivePath(run)
+		if _, err := os.Stat(archivePath); errors.Is(err, os.ErrNotExist) {
+			return 0, "", ErrArchiveNotFound
+		} else if err != nil {
+			return 0, "", fmt.Errorf("failed to open archive: %w", err)
+		}
+		return run, archivePath, nil
+	}
+
+	runs, err := s.repo.GetCrawlRuns(crawlID, runHistoryLimit)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get crawl runs: %w", err)
+	}
+	for _, run := range runs {
+		archivePath := s.crawler.ArchivePath(run.ID)
+		_, err := os.Stat(archivePath)
+		if err == nil {
+			return run.ID, archivePath, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return 0, "", fmt.Errorf("failed to open archive: %w", err)
+		}
+	}
+	return 0, "", ErrArchiveNotFound
+}
+
+// GetSnapshot returns the raw response audited by a run of a crawl result,
+// the latest run when runID is empty
+func (s *crawlService) GetSnapshot(userID int, id, runID string) (*models.Snapshot, error) {
+	crawlID, _, err := s.ownedCrawlResult(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot *models.Snapshot
+	if runID == "" {
+		snapshot, err = s.repo.GetSnapshotByCrawlID(crawlID)
+	} else {
+		run, convErr := strconv.Atoi(runID)
+		if convErr != nil {
+			return nil, ErrRunNotFound
+		}
+		// The run must belong to the crawl result
+		if _, err := s.repo.GetCrawlRun(crawlID, run); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrRunNotFound
+			}
+			return nil, fmt.Errorf("failed to get crawl run: %w", err)
+		}
+		snapshot, err = s.repo.GetSnapshotByRunID(run)
+	}
+	// A body collected from the blob store is as gone as a missing snapshot
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, blob.ErrNotFound) {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// ReanalyzeCrawl queues a re-analysis of the snapshot of a run of a crawl
+// result, the latest run with a snapshot when runID is empty. The analyzers
+// run again without any fetch, and their results form a new run.
+func (s *crawlService) ReanalyzeCrawl(userID int, id, runID string) error {
+	crawlID, urlData, err := s.ownedCrawlResult(userID, id)
+	if err != nil {
+		return err
+	}
+
+	run := 0
+	if runID != "" {
+		if run, err = strconv.Atoi(runID); err != nil || run <= 0 {
+			return ErrRunNotFound
+		}
+	}
+
+	sourceRunID, err := s.repo.FindSnapshotRun(crawlID, run)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSnapshotNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find snapshot: %w", err)
+	}
+
+	// Queue the re-analysis for the worker pool
+	if err := s.queue.EnqueueReanalysis(userID, crawlID, urlData.URL, sourceRunID); err != nil {
+		return fmt.Errorf("failed to queue re-analysis: %w", err)
+	}
 
 	return nil
-} 
\ No newline at end of file
+}
+
+// BulkReanalyze re-analyzes the latest snapshot of multiple URLs, skipping
+// those without a snapshot or already queued or running. Re-analyses fetch
+// nothing, so they do not count against crawl quotas.
+func (s *crawlService) BulkReanalyze(userID int, urls []string) error {
+	for _, url := range urls {
+		crawlID, err := s.repo.GetCrawlResultIDByURL(userID, url)
+		if err != nil {
+			return fmt.Errorf("failed to get crawl result: %w", err)
+		}
+
+		sourceRunID, err := s.repo.FindSnapshotRun(crawlID, 0)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Skipping re-analysis of %s: no snapshot", url)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find snapshot: %w", err)
+		}
+
+		if err := s.queue.EnqueueReanalysis(userID, crawlID, url, sourceRunID); err != nil {
+			if errors.Is(err, ErrJobActive) {
+				log.Printf("Skipping re-analysis of %s: %v", url, err)
+				continue
+			}
+			return fmt.Errorf("failed to queue re-analysis: %w", err)
+		}
+	}
+
+	return nil
+}
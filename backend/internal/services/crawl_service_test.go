@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// waitForStatus waits until a crawl result has status and returns it
+func waitForStatus(t *testing.T, repo database.Repository, userID, crawlResultID int, status string) *models.URLData {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		result, err := repo.GetCrawlResultByID(userID, crawlResultID)
+		if err != nil {
+			t.Fatalf("GetCrawlResultByID: %v", err)
+		}
+		if result.CrawlData.Status == status {
+			return result
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("crawl result %d status = %q, want %q", crawlResultID, result.CrawlData.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStopCrawl(t *testing.T) {
+	// The page links to one that never answers, holding the crawl in its link checks
+	checking := make(chan struct{}, 1)
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			checking <- struct{}{}
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Stopped</title></head><body><a href="/slow">Slow</a></body></html>`))
+	}))
+	defer server.Close()
+	defer close(done)
+
+	conn := newTestConnection(t)
+	repo := database.NewCrawlRepository(conn, nil)
+	c := crawler.NewCrawler(crawler.Options{})
+	jobs := database.NewJobRepository(conn)
+	crawls := NewCrawlService(repo, database.NewAgentRepository(conn), c, NewJobQueue(jobs, repo, nil, nil),
+		NewQuotaService(database.NewUsageRepository(conn), models.QuotaLimits{}), nil)
+	userID := createTestUser(t, conn, "stop@example.com")
+
+	stop := func(url string) int {
+		t.Helper()
+		id, err := repo.GetCrawlResultIDByURL(userID, url)
+		if err != nil {
+			t.Fatalf("GetCrawlResultIDByURL: %v", err)
+		}
+		if err := crawls.StopCrawl(userID, strconv.Itoa(id)); err != nil {
+			t.Fatalf("StopCrawl: %v", err)
+		}
+		return id
+	}
+
+	// A crawl stopped while queued never runs
+	queuedURL := server.URL + "/queued"
+	if err := crawls.SubmitCrawl(userID, &models.CrawlRequest{URL: queuedURL}); err != nil {
+		t.Fatalf("SubmitCrawl: %v", err)
+	}
+	queuedID := stop(queuedURL)
+	waitForStatus(t, repo, userID, queuedID, "stopped")
+
+	pageURL := server.URL + "/"
+	if err := crawls.SubmitCrawl(userID, &models.CrawlRequest{URL: pageURL}); err != nil {
+		t.Fatalf("SubmitCrawl: %v", err)
+	}
+	w := newTestWorker(conn, repo, c)
+	w.Start()
+	select {
+	case <-checking:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the link check never started")
+	}
+
+	// Stopping a running crawl aborts its link check and keeps what it collected
+	resultID := stop(pageURL)
+	result := waitForStatus(t, repo, userID, resultID, "stopped")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if result.CrawlData.Title.String != "Stopped" {
+		t.Errorf("title = %q, want the one collected before the stop", result.CrawlData.Title.String)
+	}
+	runs, err := repo.GetCrawlRuns(resultID, 10)
+	if err != nil {
+		t.Fatalf("GetCrawlRuns: %v", err)
+	}
+	if len(runs) != 1 || runs[0].FinishedAt == nil {
+		t.Fatalf("runs = %+v, want a single finished run", runs)
+	}
+	links, err := repo.GetLinksByRunID(runs[0].ID)
+	if err != nil {
+		t.Fatalf("GetLinksByRunID: %v", err)
+	}
+	if len(links) != 1 || links[0].StatusCode != 0 {
+		t.Errorf("links = %+v, want the unchecked /slow", links)
+	}
+
+	// The stop is final, nothing overwrites it once the crawl has ended
+	if result := waitForStatus(t, repo, userID, resultID, "stopped"); result.CrawlData.Title.String != "Stopped" {
+		t.Errorf("title after shutdown = %q, want Stopped", result.CrawlData.Title.String)
+	}
+	var statuses []string
+	rows, err := conn.Query(`SELECT status FROM crawl_jobs WHERE crawl_result_id IN (?, ?) ORDER BY id`, queuedID, resultID)
+	if err != nil {
+		t.Fatalf("reading jobs: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			t.Fatalf("reading jobs: %v", err)
+		}
+		statuses = append(statuses, status)
+	}
+	if len(statuses) != 2 || statuses[0] != models.JobStatusCancelled || statuses[1] != models.JobStatusCancelled {
+		t.Errorf("job statuses = %v, want both cancelled", statuses)
+	}
+	if runs, err := repo.GetCrawlRuns(queuedID, 10); err != nil || len(runs) != 0 {
+		t.Errorf("runs of the crawl stopped while queued = %+v, %v, want none", runs, err)
+	}
+}
+
+func TestCrawlRunHistoryAndDiff(t *testing.T) {
+	conn := newTestConnection(t)
+	repo := database.NewCrawlRepository(conn, nil)
+	crawls := NewCrawlService(repo, database.NewAgentRepository(conn), nil, NewJobQueue(database.NewJobRepository(conn), repo, nil, nil),
+		NewQuotaService(database.NewUsageRepository(conn), models.QuotaLimits{}), nil)
+	userID := createTestUser(t, conn, "history@example.com")
+	otherUserID := createTestUser(t, conn, "other@example.com")
+
+	resultID, err := repo.CreateCrawlResult(userID, "https://example.com/")
+	if err != nil {
+		t.Fatalf("CreateCrawlResult: %v", err)
+	}
+	id := strconv.Itoa(resultID)
+
+	save := func(title string, links ...models.LinkData) int {
+		t.Helper()
+		runID, err := repo.StartCrawlRun(resultID, models.JobTypeCrawl, 0)
+		if err != nil {
+			t.Fatalf("StartCrawlRun: %v", err)
+		}
+		data := &models.CrawlData{Status: "done", Headings: map[string]int{}, Links: links}
+		data.Title.String, data.Title.Valid = title, true
+		if err := repo.SavePageResult(runID, &models.PageResult{Data: data}); err != nil {
+			t.Fatalf("SavePageResult: %v", err)
+		}
+		return runID
+	}
+	first := save("Old", models.LinkData{URL: "https://example.com/a", StatusCode: 200, IsAccessible: true})
+	// A single run has nothing to be compared with
+	if _, err := crawls.DiffCrawlRuns(userID, id, "", ""); !errors.Is(err, ErrNoRunToCompare) {
+		t.Errorf("DiffCrawlRuns of a single run error = %v, want %v", err, ErrNoRunToCompare)
+	}
+	second := save("New", models.LinkData{URL: "https://example.com/a", StatusCode: 404})
+	third := save("Newer", models.LinkData{URL: "https://example.com/b", StatusCode: 200, IsAccessible: true})
+
+	runs, err := crawls.GetCrawlRuns(userID, id)
+	if err != nil {
+		t.Fatalf("GetCrawlRuns: %v", err)
+	}
+	if len(runs) != 3 || runs[0].ID != third || runs[2].ID != first {
+		t.Errorf("GetCrawlRuns = %+v, want runs %d to %d, newest first", runs, third, first)
+	}
+	if _, err := crawls.GetCrawlRuns(otherUserID, id); err == nil {
+		t.Error("GetCrawlRuns of another user's result succeeded")
+	}
+
+	tests := []struct {
+		name       string
+		from, to   string
+		wantFrom   int
+		wantTo     int
+		wantTitle  string
+		wantBroken int
+	}{
+		{name: "latest against the one before", wantFrom: second, wantTo: third, wantTitle: "Newer"},
+		{name: "run against the one before", to: strconv.Itoa(second), wantFrom: first, wantTo: second, wantTitle: "New", wantBroken: 1},
+		{name: "chosen runs", from: strconv.Itoa(first), to: strconv.Itoa(third), wantFrom: first, wantTo: third, wantTitle: "Newer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := crawls.DiffCrawlRuns(userID, id, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("DiffCrawlRuns: %v", err)
+			}
+			if diff.From.ID != tt.wantFrom || diff.To.ID != tt.wantTo {
+				t.Errorf("diff of runs %d to %d, want %d to %d", diff.From.ID, diff.To.ID, tt.wantFrom, tt.wantTo)
+			}
+			if diff.Title == nil || diff.Title.To != tt.wantTitle {
+				t.Errorf("title change = %+v, want to %s", diff.Title, tt.wantTitle)
+			}
+			if len(diff.NewBrokenLinks) != tt.wantBroken {
+				t.Errorf("new broken links = %+v, want %d", diff.NewBrokenLinks, tt.wantBroken)
+			}
+		})
+	}
+
+	// Runs are only reachable through their own crawl result
+	otherID, err := repo.CreateCrawlResult(userID, "https://example.com/other")
+	if err != nil {
+		t.Fatalf("CreateCrawlResult: %v", err)
+	}
+	if _, err := crawls.GetCrawlRun(userID, strconv.Itoa(otherID), strconv.Itoa(first)); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetCrawlRun through another result error = %v, want %v", err, ErrRunNotFound)
+	}
+	if _, err := crawls.DiffCrawlRuns(userID, id, "x", ""); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("DiffCrawlRuns from an invalid run error = %v, want %v", err, ErrRunNotFound)
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/events"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+const (
+	// relayBuffer is the number of events waiting to be stored before further
+	// events are dropped
+	relayBuffer = 1024
+	// relayBatchSize is the number of events stored or read in one query
+	relayBatchSize = 500
+	// relayGapWait is how long events behind a missing event ID are held back
+	// waiting for it
+	relayGapWait = 2 * time.Second
+	// relayCleanupInterval is how often expired events are deleted
+	relayCleanupInterval = time.Minute
+)
+
+// EventRelay defines the interface for the relay of crawl events between the
+// processes sharing the database
+type EventRelay interface {
+	Start()
+	Stop()
+}
+
+// EventRelayOptions configures an event relay
+type EventRelayOptions struct {
+	// Forward delivers the events of other processes to the local subscribers.
+	// Only processes serving event streams need it.
+	Forward bool
+	// PollInterval is how often the events of other processes are read
+	PollInterval time.Duration
+	// Retention is how long stored events are kept
+	Retention time.Duration
+}
+
+// eventRelay stores the events published on the local bus in the crawl_events
+// table and forwards the events stored by other processes to the local
+// subscribers, so a stream served by one API instance follows crawls running
+// in separate workers. Relayed events skip the bus listeners, webhooks are
+// only logged by the process that published the event.
+type eventRelay struct {
+	repo     database.EventRepository
+	bus      *events.Bus
+	source   string
+	options  EventRelayOptions
+	pending  chan models.CrawlEvent
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	// lastID is the last event forwarded, -1 until it is known
+	lastID int64
+	// held records when events following a missing ID were first read
+	held map[int64]time.Time
+}
+
+// NewEventRelay creates a new event relay for bus
+func NewEventRelay(repo database.EventRepository, bus *events.Bus, options EventRelayOptions) EventRelay {
+	if options.PollInterval <= 0 {
+		options.PollInterval = time.Second
+	}
+	if options.Retention <= 0 {
+		options.Retention = 10 * time.Minute
+	}
+	return &eventRelay{
+		repo:    repo,
+		bus:     bus,
+		source:  generateWorkerID(),
+		options: options,
+		pending: make(chan models.CrawlEvent, relayBuffer),
+		stop:    make(chan struct{}),
+		lastID:  -1,
+		held:    make(map[int64]time.Time),
+	}
+}
+
+// Start relays events in the background until Stop is called
+func (r *eventRelay) Start() {
+	r.bus.Listen(r.enqueue)
+
+	r.wg.Add(1)
+	go r.store()
+
+	if r.options.Forward {
+		// Only events stored from now on are forwarded
+		r.poll(time.Now())
+
+		r.wg.Add(1)
+		go r.forward()
+	}
+	log.Printf("Started event relay %s", r.source)
+}
+
+// Stop stops forwarding and stores the events published until then
+func (r *eventRelay) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	r.wg.Wait()
+}
+
+// enqueue queues a locally published event for storage without blocking the publisher
+func (r *eventRelay) enqueue(event models.CrawlEvent) {
+	select {
+	case r.pending <- event:
+	default:
+		log.Printf("Dropped %s event of crawl %d, the event relay is behind", event.Type, event.CrawlResultID)
+	}
+}
+
+// store writes queued events to the database and deletes expired ones
+func (r *eventRelay) store() {
+	defer r.wg.Done()
+
+	cleanup := time.NewTicker(relayCleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case event := <-r.pending:
+			r.flush(event)
+		case <-cleanup.C:
+			if _, err := r.repo.DeleteEventsBefore(r.options.Retention); err != nil {
+				log.Printf("Failed to delete relayed events: %v", err)
+			}
+		case <-r.stop:
+			for {
+				select {
+				case event := <-r.pending:
+					r.flush(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush stores an event together with the events queued behind it
+func (r *eventRelay) flush(first models.CrawlEvent) {
+	batch := []models.CrawlEvent{first}
+collect:
+	for len(batch) < relayBatchSize {
+		select {
+		case event := <-r.pending:
+			batch = append(batch, event)
+		default:
+			break collect
+		}
+	}
+
+	if err := r.repo.AppendEvents(r.source, batch); err != nil {
+		log.Printf("Failed to relay %d events: %v", len(batch), err)
+	}
+}
+
+// forward polls for the events of other processes
+func (r *eventRelay) forward() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.poll(time.Now())
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// poll forwards the events stored by other processes since the last poll.
+// IDs are allocated before the storing transaction commits, so a missing ID
+// may be an event about to appear. The events behind it are held back until
+// it does or relayGapWait has passed since they were read.
+func (r *eventRelay) poll(now time.Time) {
+	if r.lastID < 0 {
+		lastID, err := r.repo.LatestEventID()
+		if err != nil {
+			log.Printf("Failed to read relayed events: %v", err)
+			return
+		}
+		r.lastID = lastID
+		return
+	}
+
+	for {
+		stored, err := r.repo.GetEventsAfter(r.lastID, relayBatchSize)
+		if err != nil {
+			log.Printf("Failed to read relayed events: %v", err)
+			return
+		}
+
+		previous := r.lastID
+		for _, event := range stored {
+			if event.ID != previous+1 {
+				if _, ok := r.held[event.ID]; !ok {
+					r.held[event.ID] = now
+				}
+			}
+			previous = event.ID
+		}
+
+		for _, event := range stored {
+			if since, ok := r.held[event.ID]; ok && event.ID != r.lastID+1 {
+				if now.Sub(since) < relayGapWait {
+					return
+				}
+			}
+			delete(r.held, event.ID)
+			r.lastID = event.ID
+			if event.Source != r.source {
+				r.bus.Forward(event.Event)
+			}
+		}
+
+		if len(stored) < relayBatchSize {
+			return
+		}
+	}
+}
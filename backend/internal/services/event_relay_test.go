@@ -0,0 +1,132 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/events"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// receive waits for the next event on ch
+func receive(t *testing.T, ch <-chan models.CrawlEvent) models.CrawlEvent {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	return models.CrawlEvent{}
+}
+
+// expectNone checks that nothing arrives on ch for a while
+func expectNone(t *testing.T, ch <-chan models.CrawlEvent, wait time.Duration) {
+	t.Helper()
+	select {
+	case event := <-ch:
+		t.Errorf("unexpected event %+v", event)
+	case <-time.After(wait):
+	}
+}
+
+func TestEventRelayAcrossProcesses(t *testing.T) {
+	conn := newTestConnection(t)
+	repo := database.NewEventRepository(conn)
+
+	// The API serves streams, the worker only publishes
+	apiBus, workerBus := events.NewBus(), events.NewBus()
+	api := NewEventRelay(repo, apiBus, EventRelayOptions{Forward: true, PollInterval: 20 * time.Millisecond})
+	worker := NewEventRelay(repo, workerBus, EventRelayOptions{PollInterval: 20 * time.Millisecond})
+	api.Start()
+	worker.Start()
+	defer api.Stop()
+
+	var listened []models.CrawlEvent
+	apiBus.Listen(func(event models.CrawlEvent) { listened = append(listened, event) })
+
+	stream, unsubscribe := apiBus.Subscribe(7)
+	defer unsubscribe()
+
+	workerBus.Publish(models.CrawlEvent{Type: models.EventStatus, UserID: 7, CrawlResultID: 3, Status: models.JobStatusRunning})
+	workerBus.Publish(models.CrawlEvent{Type: models.EventPageFetched, UserID: 8, CrawlResultID: 4, PagesFetched: 1})
+	workerBus.Publish(models.CrawlEvent{Type: models.EventPageFetched, UserID: 7, CrawlResultID: 3, PagesFetched: 2})
+	// Stopping stores what was published
+	worker.Stop()
+
+	first := receive(t, stream)
+	if first.Type != models.EventStatus || first.CrawlResultID != 3 || first.Status != models.JobStatusRunning {
+		t.Errorf("first relayed event = %+v", first)
+	}
+	if second := receive(t, stream); second.PagesFetched != 2 {
+		t.Errorf("second relayed event = %+v, want the other user's event skipped", second)
+	}
+
+	// Events published by the API itself reach its streams once
+	apiBus.Publish(models.CrawlEvent{Type: models.EventStatus, UserID: 7, CrawlResultID: 5, Status: "completed"})
+	if event := receive(t, stream); event.CrawlResultID != 5 {
+		t.Errorf("local event = %+v", event)
+	}
+	expectNone(t, stream, 200*time.Millisecond)
+
+	// Relayed events do not run the listeners a second time
+	if len(listened) != 1 || listened[0].CrawlResultID != 5 {
+		t.Errorf("listeners saw %+v, want only the local event", listened)
+	}
+}
+
+// fakeEventRepository serves a fixed list of stored events
+type fakeEventRepository struct {
+	database.EventRepository
+	stored []models.RelayedEvent
+}
+
+func (r *fakeEventRepository) GetEventsAfter(afterID int64, limit int) ([]models.RelayedEvent, error) {
+	var events []models.RelayedEvent
+	for _, event := range r.stored {
+		if event.ID > afterID && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func TestEventRelayWaitsForMissingIDs(t *testing.T) {
+	repo := &fakeEventRepository{}
+	bus := events.NewBus()
+	relay := NewEventRelay(repo, bus, EventRelayOptions{Forward: true}).(*eventRelay)
+	relay.lastID = 1
+
+	stream, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	stored := func(id int64) models.RelayedEvent {
+		return models.RelayedEvent{ID: id, Source: "worker", Event: models.CrawlEvent{UserID: 1, CrawlResultID: int(id)}}
+	}
+
+	// Event 3 is committed while event 2 is still being stored
+	now := time.Now()
+	repo.stored = []models.RelayedEvent{stored(3), stored(5)}
+	relay.poll(now)
+	expectNone(t, stream, 10*time.Millisecond)
+
+	// Event 2 shows up, 5 still waits for 4
+	repo.stored = []models.RelayedEvent{stored(2), stored(3), stored(5)}
+	relay.poll(now.Add(time.Second))
+	for _, want := range []int{2, 3} {
+		if event := receive(t, stream); event.CrawlResultID != want {
+			t.Errorf("forwarded crawl %d, want %d", event.CrawlResultID, want)
+		}
+	}
+	expectNone(t, stream, 10*time.Millisecond)
+
+	// Event 4 never came, 5 goes once the wait is over
+	relay.poll(now.Add(relayGapWait))
+	if event := receive(t, stream); event.CrawlResultID != 5 {
+		t.Errorf("forwarded crawl %d, want 5", event.CrawlResultID)
+	}
+	if relay.lastID != 5 || len(relay.held) != 0 {
+		t.Errorf("after the wait lastID = %d, held = %v", relay.lastID, relay.held)
+	}
+}
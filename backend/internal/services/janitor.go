@@ -0,0 +1,284 @@
+package services
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/blob"
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// blobGracePeriod keeps snapshot blobs put this recently, which a crawl may be
+// about to reference, when collecting unreferenced ones
+const blobGracePeriod = time.Hour
+
+// Janitor defines the interface for the background purging of expired runs
+type Janitor interface {
+	Start()
+	Stop()
+}
+
+// JanitorOptions configures a janitor
+type JanitorOptions struct {
+	Interval  time.Duration
+	BatchSize int
+	// ArchiveDir receives a gzipped JSON copy of every purged run, along with
+	// its WARC archive, nothing is archived when empty
+	ArchiveDir string
+	// WARCDir is where crawls write the WARC archives of their runs, the
+	// archive of a purged run is deleted or moved to ArchiveDir
+	WARCDir string
+	Default models.RetentionPolicy
+}
+
+// janitor deletes the runs past the retention policy of their owner, checking
+// at a fixed interval
+type janitor struct {
+	retention database.RetentionRepository
+	repo      database.Repository
+	snapshots blob.Store
+	options   JanitorOptions
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewJanitor creates a new janitor. snapshots may be nil when snapshots are
+// disabled.
+func NewJanitor(retention database.RetentionRepository, repo database.Repository, snapshots blob.Store, options JanitorOptions) Janitor {
+	return &janitor{
+		retention: retention,
+		repo:      repo,
+		snapshots: snapshots,
+		options:   options,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start runs the janitor in the background until Stop is called
+func (j *janitor) Start() {
+	go func() {
+		ticker := time.NewTicker(j.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			j.purge()
+			select {
+			case <-ticker.C:
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+	log.Printf("Started retention janitor, checking every %s", j.options.Interval)
+}
+
+// Stop stops purging. The batch in progress completes.
+func (j *janitor) Stop() {
+	j.stopOnce.Do(func() { close(j.stop) })
+}
+
+// purge deletes expired runs batch by batch until none is left. A run that
+// cannot be archived is kept until the next check, the runs after it are
+// purged meanwhile.
+func (j *janitor) purge() {
+	runs, blobs, kept := 0, 0, 0
+	defer func() {
+		if runs > 0 {
+			log.Printf("Purged %d expired runs and %d snapshot blobs", runs, blobs)
+		}
+		if kept > 0 {
+			log.Printf("Kept %d expired runs that could not be archived", kept)
+		}
+	}()
+
+	afterID := 0
+	for {
+		select {
+		case <-j.stop:
+			return
+		default:
+		}
+
+		expired, err := j.retention.FindExpiredRuns(j.options.Default, afterID, j.options.BatchSize)
+		if err != nil {
+			log.Printf("Failed to find expired runs: %v", err)
+			return
+		}
+		if len(expired) == 0 {
+			return
+		}
+		afterID = expired[len(expired)-1].ID
+
+		var ids []int
+		var archived []models.ExpiredRun
+		for _, run := range expired {
+			if j.options.ArchiveDir != "" {
+				if err := j.archive(run); err != nil {
+					log.Printf("Failed to archive run %d, keeping it: %v", run.ID, err)
+					kept++
+					continue
+				}
+			}
+			ids = append(ids, run.ID)
+			archived = append(archived, run)
+		}
+
+		if len(ids) > 0 {
+			keys, err := j.retention.DeleteRuns(ids)
+			if err != nil {
+				log.Printf("Failed to delete expired runs: %v", err)
+				return
+			}
+			runs += len(ids)
+			blobs += j.collect(keys)
+			for _, run := range archived {
+				j.purgeWARC(run)
+			}
+		}
+
+		if len(expired) < j.options.BatchSize {
+			return
+		}
+	}
+}
+
+// collect deletes the snapshot blobs among keys no snapshot refers to anymore
+// and returns how many were deleted
+func (j *janitor) collect(keys []string) int {
+	if j.snapshots == nil || len(keys) == 0 {
+		return 0
+	}
+
+	before := time.Now().Add(-blobGracePeriod)
+	unreferenced, err := j.retention.UnreferencedBlobs(keys)
+	if err != nil {
+		log.Printf("Failed to find unreferenced snapshot blobs: %v", err)
+		return 0
+	}
+
+	deleted := 0
+	for _, key := range unreferenced {
+		pruned, err := j.snapshots.Prune(key, before)
+		if err != nil {
+			log.Printf("Failed to delete snapshot blob %s: %v", key, err)
+			continue
+		}
+		if pruned {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// purgeWARC deletes the WARC archive of a purged run, or moves it next to the
+// archive of the run when archiving
+func (j *janitor) purgeWARC(run models.ExpiredRun) {
+	if j.options.WARCDir == "" {
+		return
+	}
+
+	path := crawler.ArchivePath(j.options.WARCDir, run.ID)
+	var err error
+	if j.options.ArchiveDir != "" {
+		dir := filepath.Join(j.options.ArchiveDir, strconv.Itoa(run.UserID), strconv.Itoa(run.CrawlResultID))
+		err = os.Rename(path, crawler.ArchivePath(dir, run.ID))
+	} else {
+		err = os.Remove(path)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to purge WARC archive of run %d: %v", run.ID, err)
+	}
+}
+
+// archive writes everything stored about a run to
+// <ArchiveDir>/<user id>/<crawl result id>/run-<run id>.json.gz
+func (j *janitor) archive(run models.ExpiredRun) error {
+	archive, err := j.load(run)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(j.options.ArchiveDir, strconv.Itoa(run.UserID), strconv.Itoa(run.CrawlResultID))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	// Written under a temporary name first, so an archive is either complete or absent
+	tmp, err := os.CreateTemp(dir, "run-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(archive); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, fmt.Sprintf("run-%d.json.gz", run.ID))); err != nil {
+		return fmt.Errorf("failed to save archive: %w", err)
+	}
+	return nil
+}
+
+// load reads a run and its details
+func (j *janitor) load(run models.ExpiredRun) (*models.RunArchive, error) {
+	archive := &models.RunArchive{UserID: run.UserID, URL: run.URL}
+
+	var err error
+	if archive.Run, err = j.repo.GetCrawlRun(run.CrawlResultID, run.ID); err != nil {
+		return nil, fmt.Errorf("failed to get run: %w", err)
+	}
+	if archive.Links, err = j.repo.GetLinksByRunID(run.ID); err != nil {
+		return nil, fmt.Errorf("failed to get links: %w", err)
+	}
+	if archive.Headings, err = j.repo.GetHeadingsByRunID(run.ID); err != nil {
+		return nil, fmt.Errorf("failed to get headings: %w", err)
+	}
+	if archive.Forms, err = j.repo.GetFormsByRunID(run.ID); err != nil {
+		return nil, fmt.Errorf("failed to get forms: %w", err)
+	}
+	if archive.Issues, err = j.repo.GetIssuesByRunID(run.ID); err != nil {
+		return nil, fmt.Errorf("failed to get issues: %w", err)
+	}
+	if archive.Resources, err = j.repo.GetResourcesByRunID(run.ID); err != nil {
+		return nil, fmt.Errorf("failed to get resources: %w", err)
+	}
+
+	archive.Security, err = j.repo.GetSecurityCheckByRunID(run.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get security check: %w", err)
+	}
+
+	// A snapshot whose blobs are gone is left out rather than keeping the run forever
+	archive.Snapshot, err = j.repo.GetSnapshotByRunID(run.ID)
+	switch {
+	case errors.Is(err, blob.ErrNotFound):
+		log.Printf("Archiving run %d without its snapshot: %v", run.ID, err)
+		archive.Snapshot = nil
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	if archive.Snapshot != nil {
+		archive.SnapshotBody = archive.Snapshot.Body
+	}
+	return archive, nil
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/blob"
+)
+
+// createTestRuns stores a crawl result with count finished runs, the last one
+// being its latest, and returns the result and run IDs
+func createTestRuns(t *testing.T, conn *database.Connection, userID int, url string, count int) (int, []int) {
+	t.Helper()
+	resultID, err := database.NewCrawlRepository(conn, nil).CreateCrawlResult(userID, url)
+	if err != nil {
+		t.Fatalf("CreateCrawlResult: %v", err)
+	}
+	var runs []int
+	for i := 0; i < count; i++ {
+		id, err := conn.Insert(`
+			INSERT INTO crawl_runs (crawl_result_id, run_type, status, finished_at) VALUES (?, 'crawl', 'done', CURRENT_TIMESTAMP)
+		`, resultID)
+		if err != nil {
+			t.Fatalf("inserting run: %v", err)
+		}
+		runs = append(runs, int(id))
+	}
+	if _, err := conn.Exec(`UPDATE crawl_results SET last_run_id = ? WHERE id = ?`, runs[count-1], resultID); err != nil {
+		t.Fatalf("setting last run: %v", err)
+	}
+	return resultID, runs
+}
+
+// remainingRuns reports which of runs are still stored
+func remainingRuns(t *testing.T, conn *database.Connection, runs []int) []int {
+	t.Helper()
+	var remaining []int
+	for _, id := range runs {
+		var n int
+		if err := conn.QueryRow(`SELECT COUNT(*) FROM crawl_runs WHERE id = ?`, id).Scan(&n); err != nil {
+			t.Fatalf("counting run %d: %v", id, err)
+		}
+		if n > 0 {
+			remaining = append(remaining, id)
+		}
+	}
+	return remaining
+}
+
+// newTestJanitor creates a janitor keeping the latest run of every URL and
+// archiving the purged ones under the returned directory
+func newTestJanitor(t *testing.T, conn *database.Connection, snapshots blob.Store, batchSize int) (*janitor, string) {
+	t.Helper()
+	archiveDir := t.TempDir()
+	j := NewJanitor(database.NewRetentionRepository(conn), database.NewCrawlRepository(conn, snapshots), snapshots, JanitorOptions{
+		Interval:   time.Hour,
+		BatchSize:  batchSize,
+		ArchiveDir: archiveDir,
+		Default:    models.RetentionPolicy{KeepRuns: 1},
+	})
+	return j.(*janitor), archiveDir
+}
+
+func TestJanitorSkipsRunsFailingToArchive(t *testing.T) {
+	conn := newTestConnection(t)
+	userID := createTestUser(t, conn, "janitor@example.com")
+	// The failing run has the lowest ID and heads every batch
+	blocked, blockedRuns := createTestRuns(t, conn, userID, "https://example.com/blocked", 2)
+	open, openRuns := createTestRuns(t, conn, userID, "https://example.com/open", 4)
+
+	j, archiveDir := newTestJanitor(t, conn, nil, 1)
+	// A file where the archive directory of the first URL goes makes its archiving fail
+	userDir := filepath.Join(archiveDir, strconv.Itoa(userID))
+	if err := os.MkdirAll(userDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(userDir, strconv.Itoa(blocked)), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	j.purge()
+
+	if got := remainingRuns(t, conn, blockedRuns); len(got) != 2 {
+		t.Errorf("runs of the URL failing to archive left = %v, want both", got)
+	}
+	if got := remainingRuns(t, conn, openRuns); len(got) != 1 || got[0] != openRuns[3] {
+		t.Errorf("runs of the other URL left = %v, want only the latest %d", got, openRuns[3])
+	}
+	for _, id := range openRuns[:3] {
+		path := filepath.Join(userDir, strconv.Itoa(open), "run-"+strconv.Itoa(id)+".json.gz")
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("archive of run %d: %v", id, err)
+		}
+	}
+
+	// Once archiving works again the kept run goes on the next check
+	if err := os.Remove(filepath.Join(userDir, strconv.Itoa(blocked))); err != nil {
+		t.Fatal(err)
+	}
+	j.purge()
+	if got := remainingRuns(t, conn, blockedRuns); len(got) != 1 || got[0] != blockedRuns[1] {
+		t.Errorf("runs left after the next check = %v, want only the latest %d", got, blockedRuns[1])
+	}
+}
+
+func TestJanitorArchivesRunsWithMissingSnapshot(t *testing.T) {
+	conn := newTestConnection(t)
+	snapshots := blob.NewFSStore(t.TempDir())
+	userID := createTestUser(t, conn, "snapshot@example.com")
+	resultID, runs := createTestRuns(t, conn, userID, "https://example.com/", 2)
+
+	// The snapshot of the old run refers to blobs that are gone
+	missing := blob.Key([]byte("gone"))
+	if _, err := conn.Exec(`
+		INSERT INTO crawl_snapshots (crawl_result_id, crawl_run_id, final_url, body_hash, headers_hash)
+		VALUES (?, ?, 'https://example.com/', ?, ?)
+	`, resultID, runs[0], missing, missing); err != nil {
+		t.Fatalf("inserting snapshot: %v", err)
+	}
+
+	j, archiveDir := newTestJanitor(t, conn, snapshots, 10)
+	j.purge()
+
+	if got := remainingRuns(t, conn, runs); len(got) != 1 || got[0] != runs[1] {
+		t.Fatalf("runs left = %v, want only the latest %d", got, runs[1])
+	}
+
+	f, err := os.Open(filepath.Join(archiveDir, strconv.Itoa(userID), strconv.Itoa(resultID), "run-"+strconv.Itoa(runs[0])+".json.gz"))
+	if err != nil {
+		t.Fatalf("opening archive: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	var archive models.RunArchive
+	if err := json.NewDecoder(zr).Decode(&archive); err != nil {
+		t.Fatalf("decoding archive: %v", err)
+	}
+	if archive.Run == nil || archive.Run.ID != runs[0] || archive.Snapshot != nil {
+		t.Errorf("archive = run %+v, snapshot %+v, want run %d without snapshot", archive.Run, archive.Snapshot, runs[0])
+	}
+}
+
+func TestJanitorStartStop(t *testing.T) {
+	conn := newTestConnection(t)
+	userID := createTestUser(t, conn, "loop@example.com")
+	_, runs := createTestRuns(t, conn, userID, "https://example.com/", 3)
+
+	j, _ := newTestJanitor(t, conn, nil, 1)
+	j.Start()
+	defer j.Stop()
+
+	// The first check runs at once, long before the interval
+	deadline := time.Now().Add(5 * time.Second)
+	for len(remainingRuns(t, conn, runs)) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("runs left after starting = %v, want only the latest", remainingRuns(t, conn, runs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Stopping twice is harmless, and a stopped janitor purges nothing more
+	j.Stop()
+	j.Stop()
+	_, more := createTestRuns(t, conn, userID, "https://example.com/later", 2)
+	j.purge()
+	if got := remainingRuns(t, conn, more); len(got) != 2 {
+		t.Errorf("runs purged after Stop: %v left, want 2", got)
+	}
+}
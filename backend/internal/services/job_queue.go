@@ -0,0 +1,199 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// ErrJobActive is returned when a crawl result already has a queued or running job
+var ErrJobActive = errors.New("crawl is already queued or running")
+
+// ErrQueueStopped is returned when a job is enqueued after shutdown has begun
+var ErrQueueStopped = errors.New("crawl queue is shutting down")
+
+// maxRetryDelay caps the backoff between two attempts of a job
+const maxRetryDelay = time.Hour
+
+// RetryPolicy controls how crawls failing with a transient error are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts of a job, including the first
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled on every further attempt
+	Backoff time.Duration
+}
+
+// Delay returns how long to wait before retrying a job that made attempts attempts
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// JobQueue defines the interface for adding crawls to the persistent queue.
+// Jobs are run by workers, in this process or in separate worker processes.
+type JobQueue interface {
+	Enqueue(userID, crawlResultID int, url, jobType string) error
+	EnqueueReanalysis(userID, crawlResultID int, url string, sourceRunID int) error
+	EnqueueReplay(userID, crawlResultID int, url string, sourceRunID int) error
+	Cancel(crawlResultID int) (bool, error)
+	Stop()
+}
+
+// jobQueue implements the JobQueue interface on top of the crawl_jobs table
+type jobQueue struct {
+	jobs   database.JobRepository
+	repo   database.Repository
+	events crawler.EventSink
+	wake   func()
+
+	// stopping is closed when shutdown begins, new jobs are then rejected
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+// NewJobQueue creates a new job queue. wake, when not nil, is called after
+// every enqueue so that a worker in this process claims the job without
+// waiting for its next poll.
+func NewJobQueue(jobs database.JobRepository, repo database.Repository, events crawler.EventSink, wake func()) JobQueue {
+	return &jobQueue{
+		jobs:     jobs,
+		repo:     repo,
+		events:   events,
+		wake:     wake,
+		stopping: make(chan struct{}),
+	}
+}
+
+// Enqueue marks a crawl result as pending and adds a job for it to the queue
+func (q *jobQueue) Enqueue(userID, crawlResultID int, url, jobType string) error {
+	return q.enqueue(&models.CrawlJob{
+		CrawlResultID: crawlResultID,
+		UserID:        userID,
+		URL:           url,
+		Type:          jobType,
+	})
+}
+
+// EnqueueReanalysis queues a re-analysis of the snapshot of run sourceRunID
+func (q *jobQueue) EnqueueReanalysis(userID, crawlResultID int, url string, sourceRunID int) error {
+	return q.enqueue(&models.CrawlJob{
+		CrawlResultID: crawlResultID,
+		UserID:        userID,
+		URL:           url,
+		Type:          models.JobTypeReanalyze,
+		SourceRunID:   sql.NullInt64{Int64: int64(sourceRunID), Valid: true},
+	})
+}
+
+// EnqueueReplay queues a replay of the WARC archive of run sourceRunID
+func (q *jobQueue) EnqueueReplay(userID, crawlResultID int, url string, sourceRunID int) error {
+	return q.enqueue(&models.CrawlJob{
+		CrawlResultID: crawlResultID,
+		UserID:        userID,
+		URL:           url,
+		Type:          models.JobTypeReplay,
+		SourceRunID:   sql.NullInt64{Int64: int64(sourceRunID), Valid: true},
+	})
+}
+
+// enqueue adds job to the queue unless its crawl result already has an active job
+func (q *jobQueue) enqueue(job *models.CrawlJob) error {
+	userID, crawlResultID, url := job.UserID, job.CrawlResultID, job.URL
+
+	select {
+	case <-q.stopping:
+		return ErrQueueStopped
+	default:
+	}
+
+	// Checked first so that the status of an active crawl is left alone, the
+	// unique index on active jobs settles concurrent enqueues
+	active, err := q.jobs.HasActiveJob(crawlResultID)
+	if err != nil {
+		return err
+	}
+	if active {
+		return ErrJobActive
+	}
+
+	if err := q.repo.UpdateCrawlResultStatus(userID, url, "pending"); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+
+	if _, err := q.jobs.EnqueueJob(job); err != nil {
+		if errors.Is(err, database.ErrActiveJob) {
+			return ErrJobActive
+		}
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	publishStatus(q.events, userID, crawlResultID, url, "pending")
+
+	if q.wake != nil {
+		q.wake()
+	}
+
+	return nil
+}
+
+// Cancel cancels the queued job of a crawl result, or asks the worker running
+// it to stop. It reports whether a running crawl was asked to stop, in which
+// case the worker records the stopped status itself once it notices.
+func (q *jobQueue) Cancel(crawlResultID int) (bool, error) {
+	cancelled, err := q.jobs.CancelQueuedJob(crawlResultID)
+	if err != nil {
+		return false, err
+	}
+	if cancelled {
+		return false, nil
+	}
+
+	return q.jobs.RequestCancel(crawlResultID)
+}
+
+// Stop rejects every further job
+func (q *jobQueue) Stop() {
+	q.stopOnce.Do(func() { close(q.stopping) })
+}
+
+// publishStatus sends a status transition of a crawl that happens outside the
+// crawler, such as queueing or stopping a queued crawl
+func publishStatus(events crawler.EventSink, userID, crawlResultID int, url, status string) {
+	if events == nil {
+		return
+	}
+	events.Publish(models.CrawlEvent{
+		Type:          models.EventStatus,
+		CrawlResultID: crawlResultID,
+		UserID:        userID,
+		URL:           url,
+		Status:        status,
+		Time:          time.Now(),
+	})
+}
+
+// publishFailure reports a crawl job that failed after its last attempt
+func publishFailure(events crawler.EventSink, job *models.CrawlJob) {
+	if events == nil {
+		return
+	}
+	events.Publish(models.CrawlEvent{
+		Type:          models.EventFailed,
+		CrawlResultID: job.CrawlResultID,
+		UserID:        job.UserID,
+		URL:           job.URL,
+		Status:        "error",
+		Time:          time.Now(),
+	})
+}
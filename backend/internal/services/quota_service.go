@@ -0,0 +1,165 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// Quota names reported when a limit is exceeded
+const (
+	QuotaCrawlsPerDay  = "crawls_per_day"
+	QuotaPagesPerMonth = "pages_per_month"
+)
+
+// QuotaError is returned when a request would take a user over one of their quotas
+type QuotaError struct {
+	Quota     string
+	Limit     int
+	Used      int
+	Requested int
+}
+
+// Error describes the exceeded quota
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d of %d used, %d requested", e.Quota, e.Used, e.Limit, e.Requested)
+}
+
+// QuotaService defines the interface for enforcing and reporting quotas. The
+// same limits apply to every user.
+type QuotaService interface {
+	ReserveCrawls(userID, count int) error
+	ReleaseCrawls(userID, count int) error
+	RecordPage(userID int) error
+	GetUsage(userID int) (*models.Usage, error)
+	Limits() models.QuotaLimits
+}
+
+// quotaService implements the QuotaService interface
+type quotaService struct {
+	usage  database.UsageRepository
+	limits models.QuotaLimits
+}
+
+// NewQuotaService creates a new quota service applying the same limits to every user
+func NewQuotaService(usage database.UsageRepository, limits models.QuotaLimits) QuotaService {
+	return &quotaService{
+		usage:  usage,
+		limits: limits,
+	}
+}
+
+// ReserveCrawls counts count crawls about to be submitted against the daily
+// crawl quota of a user, and their pages against the monthly page quota, or
+// returns a *QuotaError when they would exceed either. Each quota is checked
+// and counted at once, so concurrent submissions cannot both pass, and
+// crawls reserved but not queued are given back with ReleaseCrawls. The
+// concurrent crawl limit is applied when jobs are claimed, crawls over it are
+// accepted and wait in the queue.
+func (s *quotaService) ReserveCrawls(userID, count int) error {
+	if count == 0 {
+		return nil
+	}
+
+	if err := s.reservePages(userID, count); err != nil {
+		return err
+	}
+	if err := s.reserveCrawls(userID, count); err != nil {
+		if releaseErr := s.usage.ReleasePages(userID, count); releaseErr != nil {
+			log.Printf("Failed to release page quota of user %d: %v", userID, releaseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// reservePages counts the pages of count crawls against the monthly page quota
+func (s *quotaService) reservePages(userID, count int) error {
+	if s.limits.PagesPerMonth == 0 {
+		return s.usage.RecordPages(userID, count)
+	}
+	reserved, err := s.usage.ReservePages(userID, count, s.limits.PagesPerMonth)
+	if err != nil {
+		return err
+	}
+	if reserved {
+		return nil
+	}
+
+	counts, err := s.usage.GetUsageCounts(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get usage: %w", err)
+	}
+	return &QuotaError{
+		Quota:     QuotaPagesPerMonth,
+		Limit:     s.limits.PagesPerMonth,
+		Used:      counts.PagesThisMonth,
+		Requested: count,
+	}
+}
+
+// reserveCrawls counts count crawls against the daily crawl quota
+func (s *quotaService) reserveCrawls(userID, count int) error {
+	if s.limits.CrawlsPerDay == 0 {
+		return s.usage.RecordCrawls(userID, count)
+	}
+	reserved, err := s.usage.ReserveCrawls(userID, count, s.limits.CrawlsPerDay)
+	if err != nil {
+		return err
+	}
+	if reserved {
+		return nil
+	}
+
+	counts, err := s.usage.GetUsageCounts(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get usage: %w", err)
+	}
+	return &QuotaError{
+		Quota:     QuotaCrawlsPerDay,
+		Limit:     s.limits.CrawlsPerDay,
+		Used:      counts.CrawlsToday,
+		Requested: count,
+	}
+}
+
+// ReleaseCrawls gives back crawls reserved with ReserveCrawls that were not
+// queued, along with their pages
+func (s *quotaService) ReleaseCrawls(userID, count int) error {
+	if count == 0 {
+		return nil
+	}
+	if err := s.usage.ReleaseCrawls(userID, count); err != nil {
+		return err
+	}
+	return s.usage.ReleasePages(userID, count)
+}
+
+// RecordPage counts a page fetched again, by a retry, against the monthly
+// quota of a user. The first fetch of a crawl was counted when it was reserved.
+func (s *quotaService) RecordPage(userID int) error {
+	return s.usage.RecordPages(userID, 1)
+}
+
+// GetUsage reports the consumption of a user against every quota
+func (s *quotaService) GetUsage(userID int) (*models.Usage, error) {
+	counts, err := s.usage.GetUsageCounts(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	return &models.Usage{
+		ConcurrentCrawls:   models.QuotaUsage{Used: counts.RunningCrawls, Limit: s.limits.ConcurrentCrawls},
+		QueuedCrawls:       counts.QueuedCrawls,
+		CrawlsToday:        models.QuotaUsage{Used: counts.CrawlsToday, Limit: s.limits.CrawlsPerDay},
+		PagesThisMonth:     models.QuotaUsage{Used: counts.PagesThisMonth, Limit: s.limits.PagesPerMonth},
+		LinkChecksPerCrawl: s.limits.LinkChecksPerCrawl,
+	}, nil
+}
+
+// Limits returns the limits applied to every user
+func (s *quotaService) Limits() models.QuotaLimits {
+	return s.limits
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// usageOf returns the crawls a user submitted today and the pages counted
+// this month
+func usageOf(t *testing.T, quotas QuotaService, userID int) (int, int) {
+	t.Helper()
+	usage, err := quotas.GetUsage(userID)
+	if err != nil {
+		t.Fatalf("GetUsage: %v", err)
+	}
+	return usage.CrawlsToday.Used, usage.PagesThisMonth.Used
+}
+
+func TestReserveCrawls(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    models.QuotaLimits
+		reserved  int
+		request   int
+		wantQuota string
+		wantUsed  int
+	}{
+		{name: "unlimited", limits: models.QuotaLimits{}, reserved: 50, request: 50},
+		{name: "within limits", limits: models.QuotaLimits{CrawlsPerDay: 5, PagesPerMonth: 5}, reserved: 2, request: 3},
+		{name: "over daily crawls", limits: models.QuotaLimits{CrawlsPerDay: 3, PagesPerMonth: 10}, reserved: 2, request: 2, wantQuota: QuotaCrawlsPerDay, wantUsed: 2},
+		{name: "over monthly pages", limits: models.QuotaLimits{CrawlsPerDay: 10, PagesPerMonth: 3}, reserved: 2, request: 2, wantQuota: QuotaPagesPerMonth, wantUsed: 2},
+		{name: "batch larger than a limit", limits: models.QuotaLimits{PagesPerMonth: 3}, request: 4, wantQuota: QuotaPagesPerMonth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newTestConnection(t)
+			quotas := NewQuotaService(database.NewUsageRepository(conn), tt.limits)
+			userID := createTestUser(t, conn, "quota@example.com")
+
+			if err := quotas.ReserveCrawls(userID, tt.reserved); err != nil {
+				t.Fatalf("first ReserveCrawls: %v", err)
+			}
+
+			err := quotas.ReserveCrawls(userID, tt.request)
+			crawls, pages := usageOf(t, quotas, userID)
+			if tt.wantQuota == "" {
+				if err != nil {
+					t.Fatalf("ReserveCrawls: %v", err)
+				}
+				if want := tt.reserved + tt.request; crawls != want || pages != want {
+					t.Errorf("usage = %d crawls, %d pages, want %d of each", crawls, pages, want)
+				}
+				return
+			}
+
+			var quotaErr *QuotaError
+			if !errors.As(err, &quotaErr) {
+				t.Fatalf("ReserveCrawls error = %v, want a quota error", err)
+			}
+			if quotaErr.Quota != tt.wantQuota || quotaErr.Used != tt.wantUsed || quotaErr.Requested != tt.request {
+				t.Errorf("quota error = %+v, want %s with %d used and %d requested", quotaErr, tt.wantQuota, tt.wantUsed, tt.request)
+			}
+			// A rejected batch counts against neither quota
+			if crawls != tt.reserved || pages != tt.reserved {
+				t.Errorf("usage after the rejection = %d crawls, %d pages, want %d of each", crawls, pages, tt.reserved)
+			}
+		})
+	}
+}
+
+func TestReleaseCrawls(t *testing.T) {
+	conn := newTestConnection(t)
+	quotas := NewQuotaService(database.NewUsageRepository(conn), models.QuotaLimits{CrawlsPerDay: 3, PagesPerMonth: 3})
+	userID := createTestUser(t, conn, "release@example.com")
+
+	if err := quotas.ReserveCrawls(userID, 3); err != nil {
+		t.Fatalf("ReserveCrawls: %v", err)
+	}
+	if err := quotas.ReleaseCrawls(userID, 2); err != nil {
+		t.Fatalf("ReleaseCrawls: %v", err)
+	}
+	if crawls, pages := usageOf(t, quotas, userID); crawls != 1 || pages != 1 {
+		t.Errorf("usage after release = %d crawls, %d pages, want 1 of each", crawls, pages)
+	}
+
+	// Released crawls can be reserved again, and no more
+	if err := quotas.ReserveCrawls(userID, 2); err != nil {
+		t.Errorf("ReserveCrawls of the released crawls: %v", err)
+	}
+	var quotaErr *QuotaError
+	if err := quotas.ReserveCrawls(userID, 1); !errors.As(err, &quotaErr) {
+		t.Errorf("ReserveCrawls past the limit error = %v, want a quota error", err)
+	}
+
+	// Usage never goes below zero
+	if err := quotas.ReleaseCrawls(userID, 10); err != nil {
+		t.Fatalf("ReleaseCrawls: %v", err)
+	}
+	if crawls, pages := usageOf(t, quotas, userID); crawls != 3 || pages != 3 {
+		t.Errorf("usage after releasing too much = %d crawls, %d pages, want 3 of each", crawls, pages)
+	}
+}
+
+func TestReserveCrawlsConcurrently(t *testing.T) {
+	conn := newTestConnection(t)
+	quotas := NewQuotaService(database.NewUsageRepository(conn), models.QuotaLimits{CrawlsPerDay: 100, PagesPerMonth: 5})
+	userID := createTestUser(t, conn, "concurrent@example.com")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := quotas.ReserveCrawls(userID, 1)
+			var quotaErr *QuotaError
+			switch {
+			case err == nil:
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			case !errors.As(err, &quotaErr):
+				t.Errorf("ReserveCrawls: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != 5 {
+		t.Errorf("%d concurrent reservations passed, want 5", reserved)
+	}
+	if crawls, pages := usageOf(t, quotas, userID); crawls != 5 || pages != 5 {
+		t.Errorf("usage = %d crawls, %d pages, want 5 of each", crawls, pages)
+	}
+}
+
+func TestBulkRerunReleasesUnqueuedCrawls(t *testing.T) {
+	conn := newTestConnection(t)
+	repo := database.NewCrawlRepository(conn, nil)
+	quotas := NewQuotaService(database.NewUsageRepository(conn), models.QuotaLimits{CrawlsPerDay: 10, PagesPerMonth: 10})
+	queue := NewJobQueue(database.NewJobRepository(conn), repo, nil, nil)
+	crawls := NewCrawlService(repo, database.NewAgentRepository(conn), nil, queue, quotas, nil)
+	userID := createTestUser(t, conn, "bulk@example.com")
+
+	if err := crawls.SubmitCrawl(userID, &models.CrawlRequest{URL: "https://example.com/a"}); err != nil {
+		t.Fatalf("SubmitCrawl: %v", err)
+	}
+	if _, err := repo.CreateCrawlResult(userID, "https://example.com/b"); err != nil {
+		t.Fatalf("CreateCrawlResult: %v", err)
+	}
+
+	// The crawl of a is still queued, b is queued and c does not exist
+	err := crawls.BulkRerun(userID, []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"})
+	if err == nil {
+		t.Fatal("BulkRerun of an unknown URL succeeded")
+	}
+	// Only the submit and the re-run of b were queued
+	if used, pages := usageOf(t, quotas, userID); used != 2 || pages != 2 {
+		t.Errorf("usage = %d crawls, %d pages, want 2 of each", used, pages)
+	}
+}
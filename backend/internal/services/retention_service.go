@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// ErrInvalidRetention is returned when a retention override has a negative limit
+var ErrInvalidRetention = errors.New("invalid retention policy")
+
+// RetentionService defines the interface for managing the retention policy of users
+type RetentionService interface {
+	GetRetention(userID int) (*models.Retention, error)
+	SetRetention(userID int, override *models.RetentionOverride) (*models.Retention, error)
+}
+
+// retentionService implements the RetentionService interface
+type retentionService struct {
+	repo     database.RetentionRepository
+	defaults models.RetentionPolicy
+}
+
+// NewRetentionService creates a new retention service applying defaults to
+// users without an override
+func NewRetentionService(repo database.RetentionRepository, defaults models.RetentionPolicy) RetentionService {
+	return &retentionService{
+		repo:     repo,
+		defaults: defaults,
+	}
+}
+
+// GetRetention returns the retention policy applied to a user
+func (s *retentionService) GetRetention(userID int) (*models.Retention, error) {
+	override, err := s.repo.GetRetentionOverride(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention override: %w", err)
+	}
+
+	return &models.Retention{
+		Default:   s.defaults,
+		Override:  *override,
+		Effective: override.Apply(s.defaults),
+	}, nil
+}
+
+// SetRetention replaces the retention override of a user. A zero limit keeps
+// runs forever, a nil one falls back to the default.
+func (s *retentionService) SetRetention(userID int, override *models.RetentionOverride) (*models.Retention, error) {
+	if override.KeepRuns != nil && *override.KeepRuns < 0 {
+		return nil, fmt.Errorf("%w: keep_runs must not be negative", ErrInvalidRetention)
+	}
+	if override.MaxAgeDays != nil && *override.MaxAgeDays < 0 {
+		return nil, fmt.Errorf("%w: max_age_days must not be negative", ErrInvalidRetention)
+	}
+
+	if err := s.repo.SetRetentionOverride(userID, override); err != nil {
+		return nil, err
+	}
+	return s.GetRetention(userID)
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// ErrInvalidSchedule is returned when a schedule request fails validation
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// ErrScheduleNotFound is returned when a schedule does not exist or belongs to another user
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// ScheduleService defines the interface for managing recurring crawls
+type ScheduleService interface {
+	CreateSchedule(userID int, req *models.ScheduleRequest) (*models.Schedule, error)
+	GetSchedules(userID int) ([]models.Schedule, error)
+	GetSchedule(userID int, id string) (*models.Schedule, error)
+	UpdateSchedule(userID int, id string, req *models.ScheduleRequest) (*models.Schedule, error)
+	DeleteSchedule(userID int, id string) error
+}
+
+// scheduleService implements the ScheduleService interface
+type scheduleService struct {
+	schedules database.ScheduleRepository
+	repo      database.Repository
+}
+
+// NewScheduleService creates a new schedule service
+func NewScheduleService(schedules database.ScheduleRepository, repo database.Repository) ScheduleService {
+	return &scheduleService{
+		schedules: schedules,
+		repo:      repo,
+	}
+}
+
+// CreateSchedule validates a request and stores it as a new schedule
+func (s *scheduleService) CreateSchedule(userID int, req *models.ScheduleRequest) (*models.Schedule, error) {
+	schedule := &models.Schedule{UserID: userID, Enabled: true}
+	if err := s.apply(schedule, req); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.schedules.CreateSchedule(schedule); err != nil {
+		return nil, fmt.Errorf("failed to create schedule: %w", err)
+	}
+
+	return s.schedules.GetScheduleByID(userID, schedule.ID)
+}
+
+// GetSchedules returns all schedules of a user
+func (s *scheduleService) GetSchedules(userID int) ([]models.Schedule, error) {
+	schedules, err := s.schedules.GetSchedules(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// GetSchedule returns a single schedule
+func (s *scheduleService) GetSchedule(userID int, id string) (*models.Schedule, error) {
+	scheduleID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, ErrScheduleNotFound
+	}
+
+	schedule, err := s.schedules.GetScheduleByID(userID, scheduleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// UpdateSchedule replaces the settings of a schedule and recomputes its next run
+func (s *scheduleService) UpdateSchedule(userID int, id string, req *models.ScheduleRequest) (*models.Schedule, error) {
+	schedule, err := s.GetSchedule(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apply(schedule, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.schedules.UpdateSchedule(schedule); err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+
+	return s.schedules.GetScheduleByID(userID, schedule.ID)
+}
+
+// DeleteSchedule removes a schedule
+func (s *scheduleService) DeleteSchedule(userID int, id string) error {
+	scheduleID, err := strconv.Atoi(id)
+	if err != nil {
+		return ErrScheduleNotFound
+	}
+
+	err = s.schedules.DeleteSchedule(userID, scheduleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrScheduleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	return nil
+}
+
+// apply validates a request and copies it onto a schedule, resolving crawl
+// result IDs to their URLs and computing the next run time
+func (s *scheduleService) apply(schedule *models.Schedule, req *models.ScheduleRequest) error {
+	req.CronExpr = strings.TrimSpace(req.CronExpr)
+	if (req.CronExpr == "") == (req.IntervalMinutes <= 0) {
+		return fmt.Errorf("%w: exactly one of cron or interval_minutes is required", ErrInvalidSchedule)
+	}
+
+	urls := []string{}
+	seen := make(map[string]bool)
+	addURL := func(u string) {
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+
+	for _, u := range req.URLs {
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return fmt.Errorf("%w: invalid URL %q", ErrInvalidSchedule, u)
+		}
+		addURL(u)
+	}
+	for _, crawlID := range req.CrawlResultIDs {
+		urlData, err := s.repo.GetCrawlResultByID(schedule.UserID, crawlID)
+		if err != nil {
+			return fmt.Errorf("%w: crawl result %d not found", ErrInvalidSchedule, crawlID)
+		}
+		addURL(urlData.URL)
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("%w: at least one URL or crawl result is required", ErrInvalidSchedule)
+	}
+
+	schedule.Name = req.Name
+	schedule.CronExpr = req.CronExpr
+	schedule.IntervalMinutes = req.IntervalMinutes
+	if req.CronExpr != "" {
+		schedule.IntervalMinutes = 0
+	}
+	schedule.URLs = urls
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+
+	next, err := NextScheduleRun(schedule, time.Now())
+	if err != nil {
+		return err
+	}
+	schedule.NextRunAt = &next
+
+	return nil
+}
+
+// NextScheduleRun returns the first run time of a schedule after from
+func NextScheduleRun(schedule *models.Schedule, from time.Time) (time.Time, error) {
+	if schedule.CronExpr == "" {
+		if schedule.IntervalMinutes <= 0 {
+			return time.Time{}, fmt.Errorf("%w: interval_minutes must be positive", ErrInvalidSchedule)
+		}
+		return from.Add(time.Duration(schedule.IntervalMinutes) * time.Minute), nil
+	}
+
+	spec, err := cron.ParseStandard(schedule.CronExpr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	next := spec.Next(from)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: cron expression never fires", ErrInvalidSchedule)
+	}
+	return next, nil
+}
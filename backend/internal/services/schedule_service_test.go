@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+func TestNextScheduleRun(t *testing.T) {
+	from := time.Date(2025, 3, 14, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule models.Schedule
+		want     time.Time
+	}{
+		{
+			name:     "interval",
+			schedule: models.Schedule{IntervalMinutes: 90},
+			want:     time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily cron later today",
+			schedule: models.Schedule{CronExpr: "0 18 * * *"},
+			want:     time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily cron already past today",
+			schedule: models.Schedule{CronExpr: "0 6 * * *"},
+			want:     time.Date(2025, 3, 15, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "cron due exactly at from runs next time",
+			schedule: models.Schedule{CronExpr: "30 10 * * *"},
+			want:     time.Date(2025, 3, 15, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly cron",
+			schedule: models.Schedule{CronExpr: "0 9 * * MON"},
+			want:     time.Date(2025, 3, 17, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "cron wins over interval",
+			schedule: models.Schedule{CronExpr: "@hourly", IntervalMinutes: 5},
+			want:     time.Date(2025, 3, 14, 11, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextScheduleRun(&tt.schedule, from)
+			if err != nil {
+				t.Fatalf("NextScheduleRun() error = %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextScheduleRun() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextScheduleRunInvalid(t *testing.T) {
+	from := time.Date(2025, 3, 14, 10, 30, 0, 0, time.UTC)
+
+	for _, schedule := range []models.Schedule{
+		{},
+		{IntervalMinutes: -5},
+		{CronExpr: "not a cron expression"},
+		{CronExpr: "0 0 31 2 *"},
+	} {
+		if _, err := NextScheduleRun(&schedule, from); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("NextScheduleRun(%+v) error = %v, want ErrInvalidSchedule", schedule, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// Scheduler defines the interface for the recurring crawl scheduler
+type Scheduler interface {
+	Start()
+	Stop()
+}
+
+// scheduler enqueues the crawls of due schedules, checking at a fixed interval
+type scheduler struct {
+	schedules database.ScheduleRepository
+	repo      database.Repository
+	queue     JobQueue
+	quotas    QuotaService
+	interval  time.Duration
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewScheduler creates a new scheduler
+func NewScheduler(schedules database.ScheduleRepository, repo database.Repository, queue JobQueue, quotas QuotaService, interval time.Duration) Scheduler {
+	return &scheduler{
+		schedules: schedules,
+		repo:      repo,
+		queue:     queue,
+		quotas:    quotas,
+		interval:  interval,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start runs the scheduler in the background until Stop is called
+func (s *scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.runDue(time.Now())
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	log.Printf("Started crawl scheduler, checking every %s", s.interval)
+}
+
+// Stop stops checking for due schedules. A run in progress completes.
+func (s *scheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// runDue runs every schedule that is due at now. Runs missed while the server
+// was down are collapsed into a single run. Every instance runs a scheduler,
+// each run is claimed before it starts so that only one of them enqueues it.
+func (s *scheduler) runDue(now time.Time) {
+	due, err := s.schedules.GetDueSchedules(now)
+	if err != nil {
+		log.Printf("Failed to load due schedules: %v", err)
+		return
+	}
+
+	for i := range due {
+		schedule := &due[i]
+
+		next, err := NextScheduleRun(schedule, now)
+		if err != nil {
+			log.Printf("Failed to compute next run of schedule %d: %v", schedule.ID, err)
+			continue
+		}
+		claimed, err := s.schedules.ClaimScheduleRun(schedule.ID, now, next)
+		if err != nil {
+			log.Printf("Failed to record run of schedule %d: %v", schedule.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		s.run(schedule)
+	}
+}
+
+// run enqueues a crawl for every URL of a schedule, skipping URLs whose
+// previous crawl is still queued or running. The run is skipped entirely when
+// it does not fit in the owner's quotas.
+func (s *scheduler) run(schedule *models.Schedule) {
+	log.Printf("Running schedule %d (%s) for %d URLs", schedule.ID, schedule.Name, len(schedule.URLs))
+
+	if err := s.quotas.ReserveCrawls(schedule.UserID, len(schedule.URLs)); err != nil {
+		log.Printf("Skipping run of schedule %d: %v", schedule.ID, err)
+		return
+	}
+
+	queued := 0
+	defer func() {
+		if err := s.quotas.ReleaseCrawls(schedule.UserID, len(schedule.URLs)-queued); err != nil {
+			log.Printf("Failed to release crawl quota of user %d: %v", schedule.UserID, err)
+		}
+	}()
+
+	for _, u := range schedule.URLs {
+		crawlID, err := s.repo.GetCrawlResultIDByURL(schedule.UserID, u)
+		if errors.Is(err, sql.ErrNoRows) {
+			crawlID, err = s.repo.CreateCrawlResult(schedule.UserID, u)
+			if err != nil {
+				log.Printf("Schedule %d failed to create crawl result for %s: %v", schedule.ID, u, err)
+				continue
+			}
+		} else if err != nil {
+			log.Printf("Schedule %d failed to look up %s: %v", schedule.ID, u, err)
+			continue
+		}
+
+		err = s.queue.Enqueue(schedule.UserID, crawlID, u, models.JobTypeCrawl)
+		if errors.Is(err, ErrJobActive) {
+			log.Printf("Schedule %d skipped %s: previous crawl is still running", schedule.ID, u)
+			continue
+		}
+		if err != nil {
+			log.Printf("Schedule %d failed to queue %s: %v", schedule.ID, u, err)
+			continue
+		}
+		queued++
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// ErrEmptySearch is returned when a search query has no word to look for
+var ErrEmptySearch = errors.New("search query has no words")
+
+const (
+	// maxSearchTerms caps the words of a search query
+	maxSearchTerms = 10
+	// snippetWords is the length of a result snippet in words
+	snippetWords = 30
+	// snippetLead is the number of words a snippet shows before the first match
+	snippetLead = 8
+)
+
+// Search returns the crawled pages of a user whose title, meta description,
+// headings, link texts or body contain every word of query, best match first
+func (s *crawlService) Search(userID int, query string, page, pageSize int) (*models.SearchResponse, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+
+	// Validate pagination parameters
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	results, total, err := s.repo.SearchPages(userID, terms, page, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search pages: %w", err)
+	}
+	for i := range results {
+		results[i].Snippet = searchSnippet(&results[i].Document, terms)
+	}
+
+	return &models.SearchResponse{
+		Query:      query,
+		Data:       results,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	}, nil
+}
+
+// searchTerms splits a query into its distinct lowercase words, dropping punctuation
+func searchTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), notWordRune) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// searchSnippet returns an excerpt of a matching page around the first word
+// starting with one of terms, looking in the body first
+func searchSnippet(doc *models.SearchDocument, terms []string) string {
+	fields := []string{doc.Body, doc.MetaDescription, doc.Headings, doc.Anchors, doc.Title}
+	for _, field := range fields {
+		words := strings.Fields(field)
+		for i, word := range words {
+			if matchesTerm(word, terms) {
+				return excerpt(words, max(i-snippetLead, 0), terms)
+			}
+		}
+	}
+
+	// The index also matches on stems, which are not recognized here
+	for _, field := range fields {
+		if words := strings.Fields(field); len(words) > 0 {
+			return excerpt(words, 0, terms)
+		}
+	}
+	return ""
+}
+
+// excerpt joins snippetWords words from start, HTML-escaped, wrapping the
+// words matching terms in <mark> tags
+func excerpt(words []string, start int, terms []string) string {
+	end := min(start+snippetWords, len(words))
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("… ")
+	}
+	for i, word := range words[start:end] {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if matchesTerm(word, terms) {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+	}
+	if end < len(words) {
+		b.WriteString(" …")
+	}
+	return b.String()
+}
+
+// matchesTerm reports whether a word, ignoring case and leading punctuation,
+// starts with one of terms
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(strings.TrimLeftFunc(word, notWordRune))
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// notWordRune reports whether r cannot be part of a search term
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "Broken Links", want: []string{"broken", "links"}},
+		{query: "  seo, SEO; audit!  ", want: []string{"seo", "audit"}},
+		{query: "café-crème 2025", want: []string{"café", "crème", "2025"}},
+		{query: "?!", want: nil},
+		{query: "a b c d e f g h i j k l", want: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}},
+	}
+
+	for _, tt := range tests {
+		if got := searchTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("searchTerms(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   models.SearchDocument
+		terms []string
+		want  string
+	}{
+		{
+			name:  "match in body",
+			doc:   models.SearchDocument{Title: "Pricing", Body: "Our plans start at ten dollars."},
+			terms: []string{"plan"},
+			want:  "Our <mark>plans</mark> start at ten dollars.",
+		},
+		{
+			name:  "body before title",
+			doc:   models.SearchDocument{Title: "Pricing plans", Body: "See the plans below."},
+			terms: []string{"plans"},
+			want:  "See the <mark>plans</mark> below.",
+		},
+		{
+			name:  "match in title only",
+			doc:   models.SearchDocument{Title: "Pricing plans", Body: "Nothing relevant here."},
+			terms: []string{"pricing"},
+			want:  "<mark>Pricing</mark> plans",
+		},
+		{
+			name:  "case and leading punctuation ignored",
+			doc:   models.SearchDocument{Body: `He said "Crawl" twice.`},
+			terms: []string{"crawl"},
+			want:  `He said <mark>&#34;Crawl&#34;</mark> twice.`,
+		},
+		{
+			name:  "stemmed match falls back to the start of the body",
+			doc:   models.SearchDocument{Title: "Crawls", Body: "The page was crawled"},
+			terms: []string{"crawling"},
+			want:  "The page was crawled",
+		},
+		{
+			name:  "no match shows the first field with text",
+			doc:   models.SearchDocument{Headings: "Welcome home", Title: "Home"},
+			terms: []string{"ran"},
+			want:  "Welcome home",
+		},
+		{
+			name:  "empty document",
+			doc:   models.SearchDocument{},
+			terms: []string{"anything"},
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchSnippet(&tt.doc, tt.terms); got != tt.want {
+				t.Errorf("searchSnippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	words := make([]string, 100)
+	for i := range words {
+		words[i] = "word"
+	}
+	words[50] = "<target>"
+
+	got := excerpt(words, 50-snippetLead, []string{"target"})
+	if !strings.HasPrefix(got, "… ") || !strings.HasSuffix(got, " …") {
+		t.Errorf("excerpt from the middle = %q, want ellipses on both ends", got)
+	}
+	if !strings.Contains(got, "<mark>&lt;target&gt;</mark>") {
+		t.Errorf("excerpt = %q, want the escaped match marked", got)
+	}
+	if n := len(strings.Fields(strings.Trim(got, "… "))); n != snippetWords {
+		t.Errorf("excerpt has %d words, want %d", n, snippetWords)
+	}
+
+	// A snippet reaching the end of the text has no trailing ellipsis
+	if got := excerpt(words[:10], 0, nil); strings.Contains(got, "…") {
+		t.Errorf("excerpt of a short text = %q, want no ellipsis", got)
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// newTestConnection opens a migrated SQLite database in a temporary directory
+func newTestConnection(t *testing.T) *database.Connection {
+	t.Helper()
+	conn, err := database.NewConnection("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewConnection: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := database.NewMigrationManager(conn).Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return conn
+}
+
+// createTestUser stores a user and returns its ID
+func createTestUser(t *testing.T, conn *database.Connection, email string) int {
+	t.Helper()
+	now := time.Now()
+	user := &models.User{Email: email, Password: "x", FirstName: "Test", LastName: "User", CreatedAt: now, UpdatedAt: now}
+	if err := database.NewUserRepository(conn).CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user.ID
+}
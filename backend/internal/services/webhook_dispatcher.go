@@ -0,0 +1,363 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// webhookTimeout bounds a single webhook delivery attempt
+const webhookTimeout = 10 * time.Second
+
+// webhookBatchSize is the number of due deliveries claimed at once
+const webhookBatchSize = 50
+
+// webhookConcurrency is the number of deliveries sent at once
+const webhookConcurrency = 8
+
+// webhookLease is how long a claimed delivery is held by one dispatcher. It
+// outlasts an attempt, so the delivery is only sent again if the dispatcher
+// died before recording the outcome.
+const webhookLease = 6 * webhookTimeout
+
+// WebhookDispatcher defines the interface for sending crawl lifecycle events to webhooks
+type WebhookDispatcher interface {
+	HandleEvent(event models.CrawlEvent)
+	Wake()
+	Start()
+}
+
+// webhookDispatcher logs a delivery per subscribed webhook for every lifecycle
+// event and sends due deliveries in the background, retrying failures
+type webhookDispatcher struct {
+	webhooks     database.WebhookRepository
+	repo         database.Repository
+	client       *http.Client
+	retry        RetryPolicy
+	pollInterval time.Duration
+	wake         chan struct{}
+}
+
+// NewWebhookDispatcher creates a new webhook dispatcher
+func NewWebhookDispatcher(webhooks database.WebhookRepository, repo database.Repository, retry RetryPolicy, pollInterval time.Duration) WebhookDispatcher {
+	return &webhookDispatcher{
+		webhooks:     webhooks,
+		repo:         repo,
+		client:       newWebhookClient(),
+		retry:        retry,
+		pollInterval: pollInterval,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// HandleEvent turns crawl status transitions into webhook deliveries. It is
+// registered as an event bus listener, so the work happens on its own goroutine.
+func (d *webhookDispatcher) HandleEvent(event models.CrawlEvent) {
+	if eventTypes := webhookEventTypes(event); len(eventTypes) > 0 {
+		go d.enqueue(event, eventTypes)
+	}
+}
+
+// webhookEventTypes returns the webhook events a crawl event triggers.
+// Failures are only sent once the job gives up, not for attempts that are retried.
+func webhookEventTypes(event models.CrawlEvent) []string {
+	switch {
+	case event.Type == models.EventFailed:
+		return []string{models.WebhookEventCrawlFailed}
+	case event.Type != models.EventStatus:
+		return nil
+	case event.Status == "running":
+		return []string{models.WebhookEventCrawlStarted}
+	case event.Status == "done" && event.LinksFailed > 0:
+		return []string{models.WebhookEventCrawlCompleted, models.WebhookEventBrokenLinksFound}
+	case event.Status == "done":
+		return []string{models.WebhookEventCrawlCompleted}
+	}
+	return nil
+}
+
+// Wake makes the dispatcher send due deliveries without waiting for the next poll
+func (d *webhookDispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start sends due deliveries in the background until the process exits
+func (d *webhookDispatcher) Start() {
+	go func() {
+		for {
+			d.deliverDue()
+			select {
+			case <-d.wake:
+			case <-time.After(d.pollInterval):
+			}
+		}
+	}()
+	log.Printf("Started webhook dispatcher")
+}
+
+// enqueue logs a delivery of each event type to every webhook subscribed to it
+func (d *webhookDispatcher) enqueue(event models.CrawlEvent, eventTypes []string) {
+	webhooks, err := d.webhooks.GetEnabledWebhooks(event.UserID)
+	if err != nil {
+		log.Printf("Failed to load webhooks of user %d: %v", event.UserID, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	queued := false
+	for _, eventType := range eventTypes {
+		var payload []byte
+		for _, webhook := range webhooks {
+			if !subscribed(webhook, eventType) {
+				continue
+			}
+
+			// Build the payload lazily, only when someone listens for the event
+			if payload == nil {
+				payload, err = d.payload(event, eventType)
+				if err != nil {
+					log.Printf("Failed to build %s payload for crawl %d: %v", eventType, event.CrawlResultID, err)
+					break
+				}
+			}
+
+			delivery := &models.WebhookDelivery{WebhookID: webhook.ID, EventType: eventType, Payload: payload}
+			if _, err := d.webhooks.CreateDelivery(delivery); err != nil {
+				log.Printf("Failed to log %s delivery for webhook %d: %v", eventType, webhook.ID, err)
+				continue
+			}
+			queued = true
+		}
+	}
+
+	if queued {
+		d.Wake()
+	}
+}
+
+// payload builds the JSON body of an event, adding the error detail of failed
+// crawls and the broken links of completed ones
+func (d *webhookDispatcher) payload(event models.CrawlEvent, eventType string) ([]byte, error) {
+	data := models.WebhookCrawlData{
+		CrawlResultID: event.CrawlResultID,
+		URL:           event.URL,
+		Status:        event.Status,
+		PagesFetched:  event.PagesFetched,
+		LinksFound:    event.LinksFound,
+		LinksChecked:  event.LinksChecked,
+		LinksFailed:   event.LinksFailed,
+	}
+
+	switch eventType {
+	case models.WebhookEventCrawlFailed:
+		result, err := d.repo.GetCrawlResultByID(event.UserID, event.CrawlResultID)
+		if err != nil {
+			return nil, err
+		}
+		data.ErrorClass = result.CrawlData.ErrorClass.String
+		data.ErrorMessage = result.CrawlData.ErrorMessage.String
+	case models.WebhookEventBrokenLinksFound:
+		links, err := d.repo.GetLinksByCrawlID(event.CrawlResultID)
+		if err != nil {
+			return nil, err
+		}
+		data.BrokenLinks = []models.LinkData{}
+		for _, link := range links {
+			if !link.IsAccessible {
+				data.BrokenLinks = append(data.BrokenLinks, link)
+			}
+		}
+	}
+
+	return json.Marshal(models.WebhookPayload{Event: eventType, CreatedAt: event.Time, Data: data})
+}
+
+// deliverDue claims the deliveries whose next attempt is due and sends them
+// through a bounded pool, until none is left
+func (d *webhookDispatcher) deliverDue() {
+	for {
+		deliveries, err := d.webhooks.ClaimDueDeliveries(webhookBatchSize, webhookLease)
+		if err != nil {
+			log.Printf("Failed to claim due webhook deliveries: %v", err)
+			return
+		}
+
+		queue := make(chan *models.WebhookDelivery)
+		var wg sync.WaitGroup
+		for i := 0; i < min(webhookConcurrency, len(deliveries)); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for delivery := range queue {
+					d.deliver(delivery)
+				}
+			}()
+		}
+		for i := range deliveries {
+			queue <- &deliveries[i]
+		}
+		close(queue)
+		wg.Wait()
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt at a delivery and records the outcome
+func (d *webhookDispatcher) deliver(delivery *models.WebhookDelivery) {
+	webhook, err := d.webhooks.GetWebhook(delivery.WebhookID)
+	if err != nil {
+		log.Printf("Failed to load webhook %d for delivery %d: %v", delivery.WebhookID, delivery.ID, err)
+		return
+	}
+
+	var retryIn time.Duration
+	delivery.Attempts++
+	delivery.ResponseStatus, err = d.send(webhook, delivery)
+	if err == nil {
+		delivery.Status = models.DeliveryStatusSucceeded
+		delivery.LastError = ""
+	} else if delivery.Attempts >= d.retry.MaxAttempts {
+		log.Printf("Giving up on webhook delivery %d after %d attempts: %v", delivery.ID, delivery.Attempts, err)
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.LastError = err.Error()
+	} else {
+		retryIn = d.retry.Delay(delivery.Attempts)
+		log.Printf("Webhook delivery %d failed: %v, retrying in %s", delivery.ID, err, retryIn)
+		delivery.LastError = err.Error()
+	}
+
+	if err := d.webhooks.RecordDeliveryAttempt(delivery, retryIn); err != nil {
+		log.Printf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send posts a delivery signed with the webhook secret and returns the
+// response status. Any non-2xx status is an error.
+func (d *webhookDispatcher) send(webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(delivery.ID))
+	timestamp := time.Now().Unix()
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload returns the hex-encoded HMAC-SHA256 of a payload sent at
+// timestamp, in Unix seconds. The signed message is the timestamp, a dot and
+// the payload, so receivers rejecting old timestamps cannot be sent a
+// captured delivery again.
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscribed reports whether a webhook receives an event type. A webhook
+// without events receives all of them.
+func subscribed(webhook models.Webhook, eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, e := range webhook.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// errBlockedAddress is returned for webhook hosts resolving to an address the
+// server must not call, such as its own network or cloud metadata services
+var errBlockedAddress = errors.New("address not allowed")
+
+// newWebhookClient creates the HTTP client sending deliveries. It never uses
+// a proxy and only connects to public addresses, checked after resolution so
+// a host re-pointed at an internal address after registration, or a redirect
+// to one, is refused too.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				host, port, err := net.SplitHostPort(address)
+				if err != nil {
+					return nil, err
+				}
+				ips, err := resolvePublicHost(ctx, host)
+				if err != nil {
+					return nil, err
+				}
+				// Dial the checked address rather than the name, which could resolve differently
+				return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].String(), port))
+			},
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConnsPerHost: webhookConcurrency,
+		},
+	}
+}
+
+// resolvePublicHost resolves host and fails when any of its addresses is blocked
+func resolvePublicHost(ctx context.Context, host string) ([]net.IP, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no address found for %s", host)
+	}
+	for _, ip := range ips {
+		if blockedIP(ip) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", errBlockedAddress, host, ip)
+		}
+	}
+	return ips, nil
+}
+
+// blockedIP reports whether ip is a loopback, private, link-local, unspecified
+// or multicast address. Link-local covers the 169.254.169.254 metadata service.
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
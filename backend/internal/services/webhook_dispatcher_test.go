@@ -0,0 +1,391 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	payload := []byte(`{"event":"crawl.completed"}`)
+
+	// Computed independently with HMAC-SHA256("secret", "1700000000." + payload)
+	want := "ff13e73d7b0b4a7d0c3e2447a9cc982aabb7c2468b87bf40c7382b6b56002160"
+	if got := SignWebhookPayload("secret", 1700000000, payload); got != want {
+		t.Errorf("SignWebhookPayload() = %s, want %s", got, want)
+	}
+
+	// A captured delivery cannot be sent again under another timestamp
+	if SignWebhookPayload("secret", 1700000001, payload) == want {
+		t.Error("signature does not depend on the timestamp")
+	}
+	if SignWebhookPayload("other", 1700000000, payload) == want {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, Backoff: time.Minute}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 3, want: 4 * time.Minute},
+		{attempts: 7, want: maxRetryDelay},
+		{attempts: 100, want: maxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempts); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookEventTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		event models.CrawlEvent
+		want  []string
+	}{
+		{
+			name:  "started",
+			event: models.CrawlEvent{Type: models.EventStatus, Status: "running"},
+			want:  []string{models.WebhookEventCrawlStarted},
+		},
+		{
+			name:  "completed",
+			event: models.CrawlEvent{Type: models.EventStatus, Status: "done"},
+			want:  []string{models.WebhookEventCrawlCompleted},
+		},
+		{
+			name:  "completed with broken links",
+			event: models.CrawlEvent{Type: models.EventStatus, Status: "done", LinksFailed: 2},
+			want:  []string{models.WebhookEventCrawlCompleted, models.WebhookEventBrokenLinksFound},
+		},
+		{
+			name:  "failed attempt about to be retried",
+			event: models.CrawlEvent{Type: models.EventStatus, Status: "error"},
+			want:  nil,
+		},
+		{
+			name:  "job failed for good",
+			event: models.CrawlEvent{Type: models.EventFailed, Status: "error"},
+			want:  []string{models.WebhookEventCrawlFailed},
+		},
+		{
+			name:  "progress",
+			event: models.CrawlEvent{Type: models.EventPageFetched},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := webhookEventTypes(tt.event); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("webhookEventTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockedIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "127.0.0.1", want: true},
+		{ip: "::1", want: true},
+		{ip: "10.1.2.3", want: true},
+		{ip: "172.16.0.1", want: true},
+		{ip: "192.168.1.1", want: true},
+		{ip: "169.254.169.254", want: true},
+		{ip: "fe80::1", want: true},
+		{ip: "fd00::1", want: true},
+		{ip: "0.0.0.0", want: true},
+		{ip: "::ffff:127.0.0.1", want: true},
+		{ip: "224.0.0.1", want: true},
+		{ip: "93.184.216.34", want: false},
+		{ip: "2606:4700::1111", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := blockedIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("blockedIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookURLValidation(t *testing.T) {
+	service := &webhookService{}
+
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "http://127.0.0.1:8080/hook", wantErr: true},
+		{url: "http://localhost/hook", wantErr: true},
+		{url: "http://10.0.0.5/hook", wantErr: true},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{url: "http://[::1]/hook", wantErr: true},
+		{url: "ftp://93.184.216.34/hook", wantErr: true},
+		{url: "/hook", wantErr: true},
+		{url: "https://93.184.216.34/hook", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := service.apply(&models.Webhook{}, &models.WebhookRequest{URL: tt.url})
+			if tt.wantErr && !errors.Is(err, ErrInvalidWebhook) {
+				t.Errorf("apply(%q) = %v, want ErrInvalidWebhook", tt.url, err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("apply(%q) = %v, want no error", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// The test server listens on loopback, as a service on the host would
+	resp, err := newWebhookClient().Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request to a loopback address succeeded")
+	}
+	if !errors.Is(err, errBlockedAddress) {
+		t.Errorf("request to a loopback address = %v, want errBlockedAddress", err)
+	}
+}
+
+// webhookEndpoint records the requests of a test webhook receiver, answering
+// with the status codes of responses in turn and 200 once they run out
+type webhookEndpoint struct {
+	mu        sync.Mutex
+	responses []int
+	requests  []*http.Request
+}
+
+func (e *webhookEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = append(e.requests, r)
+	status := http.StatusOK
+	if len(e.responses) > 0 {
+		status, e.responses = e.responses[0], e.responses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (e *webhookEndpoint) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.requests)
+}
+
+// newTestDispatcher creates a dispatcher for a webhook posting to endpoint.
+// The dispatcher uses the client of the test server, which may reach loopback.
+func newTestDispatcher(t *testing.T, conn *database.Connection, endpoint http.Handler, retry RetryPolicy) (*webhookDispatcher, *models.Webhook) {
+	t.Helper()
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+
+	webhooks := database.NewWebhookRepository(conn)
+	webhook := &models.Webhook{
+		UserID:  createTestUser(t, conn, "webhooks@example.com"),
+		URL:     server.URL + "/hook",
+		Secret:  "secret",
+		Events:  []string{},
+		Enabled: true,
+	}
+	if _, err := webhooks.CreateWebhook(webhook); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	dispatcher := &webhookDispatcher{
+		webhooks: webhooks,
+		client:   server.Client(),
+		retry:    retry,
+		wake:     make(chan struct{}, 1),
+	}
+	return dispatcher, webhook
+}
+
+// createTestDelivery logs a delivery due now
+func createTestDelivery(t *testing.T, webhooks database.WebhookRepository, webhookID int) int {
+	t.Helper()
+	delivery := &models.WebhookDelivery{WebhookID: webhookID, EventType: models.WebhookEventCrawlCompleted, Payload: []byte(`{"event":"crawl.completed"}`)}
+	id, err := webhooks.CreateDelivery(delivery)
+	if err != nil {
+		t.Fatalf("CreateDelivery: %v", err)
+	}
+	return id
+}
+
+func TestWebhookDispatcherSignsDeliveries(t *testing.T) {
+	conn := newTestConnection(t)
+	endpoint := &webhookEndpoint{}
+	dispatcher, webhook := newTestDispatcher(t, conn, endpoint, RetryPolicy{MaxAttempts: 3, Backoff: time.Minute})
+	id := createTestDelivery(t, dispatcher.webhooks, webhook.ID)
+
+	dispatcher.deliverDue()
+
+	if endpoint.count() != 1 {
+		t.Fatalf("endpoint received %d requests, want 1", endpoint.count())
+	}
+	req := endpoint.requests[0]
+	timestamp, err := strconv.ParseInt(req.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-Webhook-Timestamp = %q: %v", req.Header.Get("X-Webhook-Timestamp"), err)
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age < -time.Minute || age > time.Minute {
+		t.Errorf("X-Webhook-Timestamp is %s away from now", age)
+	}
+	want := "sha256=" + SignWebhookPayload("secret", timestamp, []byte(`{"event":"crawl.completed"}`))
+	if got := req.Header.Get("X-Webhook-Signature"); got != want {
+		t.Errorf("X-Webhook-Signature = %q, want %q", got, want)
+	}
+	if got := req.Header.Get("X-Webhook-Delivery"); got != strconv.Itoa(id) {
+		t.Errorf("X-Webhook-Delivery = %q, want %d", got, id)
+	}
+	if got := req.Header.Get("X-Webhook-Event"); got != models.WebhookEventCrawlCompleted {
+		t.Errorf("X-Webhook-Event = %q", got)
+	}
+
+	delivery, err := dispatcher.webhooks.GetDeliveryByID(webhook.ID, id)
+	if err != nil {
+		t.Fatalf("GetDeliveryByID: %v", err)
+	}
+	if delivery.Status != models.DeliveryStatusSucceeded || delivery.Attempts != 1 || delivery.ResponseStatus != 200 {
+		t.Errorf("delivery after success = %+v", delivery)
+	}
+}
+
+func TestWebhookDispatcherRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    []int
+		maxAttempts  int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{
+			name:         "succeeds on retry",
+			responses:    []int{http.StatusInternalServerError},
+			maxAttempts:  3,
+			wantStatus:   models.DeliveryStatusSucceeded,
+			wantAttempts: 2,
+		},
+		{
+			name:         "gives up after the last attempt",
+			responses:    []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable},
+			maxAttempts:  2,
+			wantStatus:   models.DeliveryStatusFailed,
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newTestConnection(t)
+			endpoint := &webhookEndpoint{responses: tt.responses}
+			// Without backoff a failed delivery is due again at once
+			dispatcher, webhook := newTestDispatcher(t, conn, endpoint, RetryPolicy{MaxAttempts: tt.maxAttempts})
+			id := createTestDelivery(t, dispatcher.webhooks, webhook.ID)
+
+			for i := 0; i < tt.maxAttempts+1; i++ {
+				dispatcher.deliverDue()
+			}
+
+			if endpoint.count() != tt.wantAttempts {
+				t.Errorf("endpoint received %d requests, want %d", endpoint.count(), tt.wantAttempts)
+			}
+			delivery, err := dispatcher.webhooks.GetDeliveryByID(webhook.ID, id)
+			if err != nil {
+				t.Fatalf("GetDeliveryByID: %v", err)
+			}
+			if delivery.Status != tt.wantStatus || delivery.Attempts != tt.wantAttempts {
+				t.Errorf("delivery = %s after %d attempts, want %s after %d",
+					delivery.Status, delivery.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if tt.wantStatus == models.DeliveryStatusFailed && delivery.LastError == "" {
+				t.Error("failed delivery has no last error")
+			}
+		})
+	}
+}
+
+func TestWebhookDispatcherBacksOff(t *testing.T) {
+	conn := newTestConnection(t)
+	endpoint := &webhookEndpoint{responses: []int{http.StatusInternalServerError}}
+	dispatcher, webhook := newTestDispatcher(t, conn, endpoint, RetryPolicy{MaxAttempts: 3, Backoff: time.Hour})
+	id := createTestDelivery(t, dispatcher.webhooks, webhook.ID)
+
+	dispatcher.deliverDue()
+	dispatcher.deliverDue()
+
+	if endpoint.count() != 1 {
+		t.Errorf("endpoint received %d requests before the backoff ended, want 1", endpoint.count())
+	}
+	delivery, err := dispatcher.webhooks.GetDeliveryByID(webhook.ID, id)
+	if err != nil {
+		t.Fatalf("GetDeliveryByID: %v", err)
+	}
+	if delivery.Status != models.DeliveryStatusPending || delivery.ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("delivery after a failed attempt = %+v", delivery)
+	}
+	if !delivery.NextAttemptAt.Valid || time.Until(delivery.NextAttemptAt.Time) < 50*time.Minute {
+		t.Errorf("next attempt at %v, want about an hour from now", delivery.NextAttemptAt)
+	}
+}
+
+func TestWebhookDispatchersShareDeliveries(t *testing.T) {
+	conn := newTestConnection(t)
+	endpoint := &webhookEndpoint{}
+	first, webhook := newTestDispatcher(t, conn, endpoint, RetryPolicy{MaxAttempts: 3, Backoff: time.Minute})
+	second := *first
+
+	const deliveries = 3*webhookBatchSize + 7
+	for i := 0; i < deliveries; i++ {
+		createTestDelivery(t, first.webhooks, webhook.ID)
+	}
+
+	// Two API instances polling at once send every delivery exactly once
+	var wg sync.WaitGroup
+	for _, dispatcher := range []*webhookDispatcher{first, &second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dispatcher.deliverDue()
+		}()
+	}
+	wg.Wait()
+
+	sent := map[string]int{}
+	for _, req := range endpoint.requests {
+		sent[req.Header.Get("X-Webhook-Delivery")]++
+	}
+	if len(sent) != deliveries {
+		t.Errorf("%d deliveries sent, want %d", len(sent), deliveries)
+	}
+	for id, n := range sent {
+		if n != 1 {
+			t.Errorf("delivery %s sent %d times", id, n)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// deliveryLogLimit is the number of recent deliveries listed per webhook
+const deliveryLogLimit = 100
+
+// webhookResolveTimeout bounds the resolution of a webhook host on registration
+const webhookResolveTimeout = 5 * time.Second
+
+// ErrInvalidWebhook is returned when a webhook request fails validation
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// ErrWebhookNotFound is returned when a webhook or delivery does not exist or belongs to another user
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// WebhookService defines the interface for managing webhooks and their deliveries
+type WebhookService interface {
+	CreateWebhook(userID int, req *models.WebhookRequest) (*models.Webhook, error)
+	GetWebhooks(userID int) ([]models.Webhook, error)
+	GetWebhook(userID int, id string) (*models.Webhook, error)
+	UpdateWebhook(userID int, id string, req *models.WebhookRequest) (*models.Webhook, error)
+	DeleteWebhook(userID int, id string) error
+	GetDeliveries(userID int, id string) ([]models.WebhookDelivery, error)
+	Redeliver(userID int, id, deliveryID string) (*models.WebhookDelivery, error)
+}
+
+// webhookService implements the WebhookService interface
+type webhookService struct {
+	webhooks   database.WebhookRepository
+	dispatcher WebhookDispatcher
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(webhooks database.WebhookRepository, dispatcher WebhookDispatcher) WebhookService {
+	return &webhookService{
+		webhooks:   webhooks,
+		dispatcher: dispatcher,
+	}
+}
+
+// CreateWebhook validates a request and registers a new webhook, generating
+// its secret when none is given
+func (s *webhookService) CreateWebhook(userID int, req *models.WebhookRequest) (*models.Webhook, error) {
+	webhook := &models.Webhook{UserID: userID, Enabled: true}
+	if err := s.apply(webhook, req); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.webhooks.CreateWebhook(webhook); err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return s.webhooks.GetWebhookByID(userID, webhook.ID)
+}
+
+// GetWebhooks returns all webhooks of a user
+func (s *webhookService) GetWebhooks(userID int) ([]models.Webhook, error) {
+	webhooks, err := s.webhooks.GetWebhooks(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// GetWebhook returns a single webhook
+func (s *webhookService) GetWebhook(userID int, id string) (*models.Webhook, error) {
+	webhookID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	webhook, err := s.webhooks.GetWebhookByID(userID, webhookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// UpdateWebhook replaces the settings of a webhook. The secret is kept when
+// the request does not give a new one.
+func (s *webhookService) UpdateWebhook(userID int, id string, req *models.WebhookRequest) (*models.Webhook, error) {
+	webhook, err := s.GetWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apply(webhook, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.webhooks.UpdateWebhook(webhook); err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	return s.webhooks.GetWebhookByID(userID, webhook.ID)
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (s *webhookService) DeleteWebhook(userID int, id string) error {
+	webhookID, err := strconv.Atoi(id)
+	if err != nil {
+		return ErrWebhookNotFound
+	}
+
+	err = s.webhooks.DeleteWebhook(userID, webhookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// GetDeliveries returns the most recent deliveries of a webhook
+func (s *webhookService) GetDeliveries(userID int, id string) ([]models.WebhookDelivery, error) {
+	webhook, err := s.GetWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.webhooks.GetDeliveries(webhook.ID, deliveryLogLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Redeliver sends the payload of a past delivery again as a new delivery
+func (s *webhookService) Redeliver(userID int, id, deliveryID string) (*models.WebhookDelivery, error) {
+	webhook, err := s.GetWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	originalID, err := strconv.Atoi(deliveryID)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	original, err := s.webhooks.GetDeliveryByID(webhook.ID, originalID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery: %w", err)
+	}
+
+	delivery := &models.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventType: original.EventType,
+		Payload:   original.Payload,
+	}
+	if _, err := s.webhooks.CreateDelivery(delivery); err != nil {
+		return nil, fmt.Errorf("failed to create delivery: %w", err)
+	}
+	s.dispatcher.Wake()
+
+	return s.webhooks.GetDeliveryByID(webhook.ID, delivery.ID)
+}
+
+// apply validates a request and copies it onto a webhook
+func (s *webhookService) apply(webhook *models.Webhook, req *models.WebhookRequest) error {
+	u, err := url.ParseRequestURI(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	// Deliveries check the address again when they connect
+	ctx, cancel := context.WithTimeout(context.Background(), webhookResolveTimeout)
+	defer cancel()
+	_, err = resolvePublicHost(ctx, u.Hostname())
+	switch {
+	case errors.Is(err, errBlockedAddress):
+		return fmt.Errorf("%w: url must not point to a private, loopback or link-local address", ErrInvalidWebhook)
+	case err != nil:
+		return fmt.Errorf("%w: url host %q cannot be resolved", ErrInvalidWebhook, u.Hostname())
+	}
+
+	events := []string{}
+	for _, event := range req.Events {
+		if !validWebhookEvent(event) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+		events = append(events, event)
+	}
+
+	webhook.URL = req.URL
+	webhook.Events = events
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+
+	switch {
+	case req.Secret != "":
+		webhook.Secret = req.Secret
+	case webhook.Secret == "":
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		webhook.Secret = secret
+	}
+
+	return nil
+}
+
+// validWebhookEvent reports whether event is a known webhook event type
+func validWebhookEvent(event string) bool {
+	for _, e := range models.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// generateWebhookSecret returns a random 256-bit hex secret
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
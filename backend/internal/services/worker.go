@@ -0,0 +1,411 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// interruptGrace bounds how long Shutdown waits for interrupted crawls to
+// record their state once the drain period is over
+const interruptGrace = 10 * time.Second
+
+// errLeaseLost is the cancellation cause of crawls whose lease was taken over,
+// typically after the worker could not reach the database for too long
+var errLeaseLost = fmt.Errorf("%w: job lease lost", crawler.ErrInterrupted)
+
+// WorkerOptions configures a crawl worker
+type WorkerOptions struct {
+	// ID identifies the worker in job leases and must be unique across
+	// processes, empty generates one from the host name and process ID
+	ID string
+	// Concurrency is the number of crawls run at once
+	Concurrency int
+	// PollInterval is how often the queue is checked when idle, and how often
+	// running crawls are checked for stop requests
+	PollInterval time.Duration
+	// LeaseDuration is how long a claimed job stays leased without a heartbeat
+	LeaseDuration time.Duration
+	// HeartbeatInterval is how often leases are renewed
+	HeartbeatInterval time.Duration
+	// ReclaimInterval is how often interrupted jobs and jobs whose lease
+	// expired are put back in the queue, LeaseDuration when zero
+	ReclaimInterval time.Duration
+	// Retry controls how transient failures are retried
+	Retry RetryPolicy
+}
+
+// Worker defines the interface for a pool of crawl workers
+type Worker interface {
+	Start()
+	Wake()
+	Shutdown(ctx context.Context) error
+}
+
+// worker implements the Worker interface. Jobs are leased from the crawl_jobs
+// table, so any number of workers can run against the same database. Users
+// with the fewest running crawls are served first, so a large batch from one
+// user cannot starve others.
+type worker struct {
+	jobs    database.JobRepository
+	repo    database.Repository
+	crawler crawler.CrawlerService
+	quotas  QuotaService
+	events  crawler.EventSink
+	options WorkerOptions
+	wake    chan struct{}
+
+	// stopping is closed when shutdown begins, workers then stop claiming jobs.
+	// finished is closed once every crawl has ended, stopping heartbeats.
+	stopping   chan struct{}
+	stopOnce   sync.Once
+	finished   chan struct{}
+	finishOnce sync.Once
+	workerWG   sync.WaitGroup
+
+	// running holds the cancel function of every crawl in progress, keyed by job ID
+	mu      sync.Mutex
+	running map[int]context.CancelCauseFunc
+}
+
+// NewWorker creates a new worker pool
+func NewWorker(jobs database.JobRepository, repo database.Repository, crawler crawler.CrawlerService, quotas QuotaService, events crawler.EventSink, options WorkerOptions) Worker {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	if options.ID == "" {
+		options.ID = generateWorkerID()
+	}
+	if options.ReclaimInterval <= 0 {
+		options.ReclaimInterval = options.LeaseDuration
+	}
+	return &worker{
+		jobs:     jobs,
+		repo:     repo,
+		crawler:  crawler,
+		quotas:   quotas,
+		events:   events,
+		options:  options,
+		wake:     make(chan struct{}, options.Concurrency),
+		stopping: make(chan struct{}),
+		finished: make(chan struct{}),
+		running:  make(map[int]context.CancelCauseFunc),
+	}
+}
+
+// Start re-enqueues interrupted and abandoned jobs, then starts the workers
+// and their heartbeat
+func (w *worker) Start() {
+	if err := w.reclaim(); err != nil {
+		log.Printf("Failed to reclaim jobs: %v", err)
+	}
+
+	for i := 0; i < w.options.Concurrency; i++ {
+		w.workerWG.Add(1)
+		go w.work(i + 1)
+	}
+	go w.maintain()
+	log.Printf("Started %d crawl workers as %s", w.options.Concurrency, w.options.ID)
+}
+
+// Wake makes an idle worker check the queue without waiting for the next poll
+func (w *worker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown stops claiming jobs and waits for running crawls to finish. Crawls
+// still running when ctx is done are interrupted, recorded as such and
+// re-enqueued by the next worker to reclaim jobs. Shutting down again is
+// harmless.
+func (w *worker) Shutdown(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stopping) })
+
+	done := make(chan struct{})
+	go func() {
+		w.workerWG.Wait()
+		close(done)
+	}()
+	defer w.finishOnce.Do(func() { close(w.finished) })
+
+	select {
+	case <-done:
+		log.Printf("All crawl workers finished")
+		return nil
+	case <-ctx.Done():
+	}
+
+	w.mu.Lock()
+	log.Printf("Drain period over, interrupting %d running crawls", len(w.running))
+	for _, cancel := range w.running {
+		cancel(crawler.ErrInterrupted)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(interruptGrace):
+		log.Printf("Timed out waiting for interrupted crawls to record their state")
+	}
+	return ctx.Err()
+}
+
+// work claims and runs jobs until shutdown begins
+func (w *worker) work(workerID int) {
+	defer w.workerWG.Done()
+
+	for {
+		select {
+		case <-w.stopping:
+			return
+		default:
+		}
+
+		job, err := w.jobs.ClaimNextJob(w.options.ID, w.options.LeaseDuration, w.quotas.Limits().ConcurrentCrawls)
+		if err != nil {
+			log.Printf("Worker %d failed to claim job: %v", workerID, err)
+		}
+		if job == nil {
+			select {
+			case <-w.wake:
+			case <-time.After(w.options.PollInterval):
+			case <-w.stopping:
+				return
+			}
+			continue
+		}
+
+		w.run(workerID, job)
+	}
+}
+
+// maintain stops crawls whose users asked for it, renews the leases of
+// running jobs and reclaims jobs abandoned by other workers, until every
+// crawl of this worker has ended
+func (w *worker) maintain() {
+	poll := time.NewTicker(w.options.PollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(w.options.HeartbeatInterval)
+	defer heartbeat.Stop()
+	reclaim := time.NewTicker(w.options.ReclaimInterval)
+	defer reclaim.Stop()
+
+	for {
+		select {
+		case <-poll.C:
+			w.stopRequested()
+		case <-heartbeat.C:
+			w.renewLeases()
+		case <-reclaim.C:
+			if err := w.reclaim(); err != nil {
+				log.Printf("Failed to reclaim jobs: %v", err)
+			}
+		case <-w.finished:
+			return
+		}
+	}
+}
+
+// stopRequested cancels the running crawls a user asked to stop
+func (w *worker) stopRequested() {
+	ids, err := w.jobs.GetCancelRequested(w.options.ID)
+	if err != nil {
+		log.Printf("Failed to check for stopped crawls: %v", err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range ids {
+		if cancel, ok := w.running[id]; ok {
+			cancel(nil)
+		}
+	}
+}
+
+// renewLeases extends the lease of every running job and interrupts the
+// crawls whose lease was lost
+func (w *worker) renewLeases() {
+	w.mu.Lock()
+	ids := make([]int, 0, len(w.running))
+	for id := range w.running {
+		ids = append(ids, id)
+	}
+	w.mu.Unlock()
+
+	for _, id := range ids {
+		held, err := w.jobs.RenewLease(id, w.options.ID, w.options.LeaseDuration)
+		if err != nil {
+			log.Printf("Failed to renew lease of job %d: %v", id, err)
+			continue
+		}
+		if held {
+			continue
+		}
+
+		log.Printf("Lost lease of job %d, stopping its crawl", id)
+		w.mu.Lock()
+		if cancel, ok := w.running[id]; ok {
+			cancel(errLeaseLost)
+		}
+		w.mu.Unlock()
+	}
+}
+
+// reclaim re-enqueues interrupted jobs and jobs whose lease expired
+func (w *worker) reclaim() error {
+	requeued, failed, err := w.jobs.ReclaimJobs(w.options.Retry.MaxAttempts)
+	if err != nil {
+		return fmt.Errorf("failed to reclaim jobs: %w", err)
+	}
+	if requeued > 0 {
+		log.Printf("Re-enqueued %d interrupted or abandoned crawl jobs", requeued)
+	}
+	if failed > 0 {
+		log.Printf("Failed %d abandoned crawl jobs out of attempts", failed)
+	}
+	return nil
+}
+
+// run executes a claimed job and records its outcome
+func (w *worker) run(workerID int, job *models.CrawlJob) {
+	log.Printf("Worker %d running %s job %d for %s", workerID, job.Type, job.ID, job.URL)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	w.mu.Lock()
+	w.running[job.ID] = cancel
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, job.ID)
+		w.mu.Unlock()
+		cancel(nil)
+	}()
+
+	var err error
+	switch job.Type {
+	case models.JobTypeReplay:
+		err = w.crawler.ReplayURL(ctx, job.UserID, job.URL, int(job.SourceRunID.Int64), w.repo)
+	case models.JobTypeReanalyze:
+		var source *crawler.Source
+		source, err = loadSource(w.repo, int(job.SourceRunID.Int64))
+		if err != nil {
+			log.Printf("Failed to load run %d for re-analysis of %s: %v", job.SourceRunID.Int64, job.URL, err)
+			if dbErr := w.repo.UpdateCrawlError(job.UserID, job.URL, crawler.ErrorClassUnknown, err.Error()); dbErr != nil {
+				log.Printf("Failed to update error status for %s: %v", job.URL, dbErr)
+			}
+			publishStatus(w.events, job.UserID, job.CrawlResultID, job.URL, "error")
+			break
+		}
+		err = w.crawler.ReanalyzeURL(ctx, job.UserID, job.URL, source, w.repo)
+	default:
+		// The first attempt fetches the page reserved when the crawl was submitted
+		if job.Attempts > 1 {
+			if err := w.quotas.RecordPage(job.UserID); err != nil {
+				log.Printf("Failed to record page fetch of job %d: %v", job.ID, err)
+			}
+		}
+		err = w.crawler.CrawlURL(ctx, job.UserID, job.URL, w.quotas.Limits().LinkChecksPerCrawl, w.repo)
+	}
+
+	var crawlErr *crawler.CrawlError
+	status, lastError := models.JobStatusDone, ""
+	switch {
+	case errors.Is(context.Cause(ctx), errLeaseLost):
+		// Another worker owns the job now
+		return
+	case errors.Is(err, crawler.ErrInterrupted):
+		log.Printf("Job %d was interrupted for %s", job.ID, job.URL)
+		status = models.JobStatusInterrupted
+	case errors.Is(err, context.Canceled):
+		log.Printf("Job %d was stopped for %s", job.ID, job.URL)
+		status = models.JobStatusCancelled
+	case errors.As(err, &crawlErr) && crawlErr.Transient() && job.Attempts < w.options.Retry.MaxAttempts:
+		w.retryLater(job, err)
+		return
+	case err != nil:
+		log.Printf("Job %d failed for %s: %v", job.ID, job.URL, err)
+		status, lastError = models.JobStatusFailed, err.Error()
+	}
+
+	if err := w.jobs.UpdateJobStatus(job.ID, w.options.ID, status, lastError); err != nil {
+		log.Printf("Failed to record status of job %d: %v", job.ID, err)
+	}
+	if status == models.JobStatusFailed {
+		publishFailure(w.events, job)
+	}
+}
+
+// retryLater puts a job that failed with a transient error back in the queue
+// after an exponential backoff
+func (w *worker) retryLater(job *models.CrawlJob, err error) {
+	delay := w.options.Retry.Delay(job.Attempts)
+	log.Printf("Job %d failed for %s: %v, retrying in %s (attempt %d of %d)",
+		job.ID, job.URL, err, delay, job.Attempts, w.options.Retry.MaxAttempts)
+
+	if err := w.repo.UpdateCrawlResultStatus(job.UserID, job.URL, "pending"); err != nil {
+		log.Printf("Failed to reset status of %s: %v", job.URL, err)
+	}
+	publishStatus(w.events, job.UserID, job.CrawlResultID, job.URL, "pending")
+	if err := w.jobs.RetryJob(job.ID, w.options.ID, err.Error(), delay); err != nil {
+		log.Printf("Failed to requeue job %d: %v", job.ID, err)
+	}
+}
+
+// generateWorkerID builds a worker ID from the host name, the process ID and
+// a random suffix, so that restarted processes never reuse an ID
+func generateWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// loadSource loads the snapshot of a run and the observations a re-analysis
+// of it reuses
+func loadSource(repo database.Repository, runID int) (*crawler.Source, error) {
+	snapshot, err := repo.GetSnapshotByRunID(runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+
+	links, err := repo.GetLinksByRunID(runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get links: %w", err)
+	}
+
+	resources, err := repo.GetResourcesByRunID(runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resources: %w", err)
+	}
+
+	// Runs of pages rejected before any check have no security check
+	security, err := repo.GetSecurityCheckByRunID(runID)
+	if err != nil {
+		security = nil
+	}
+
+	return &crawler.Source{
+		RunID:     runID,
+		Snapshot:  snapshot,
+		Links:     links,
+		Resources: resources,
+		Security:  security,
+	}, nil
+}
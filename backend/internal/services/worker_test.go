@@ -0,0 +1,372 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/seo-crawler-app/internal/database"
+	"github.com/seo-crawler-app/internal/models"
+	"github.com/seo-crawler-app/pkg/blob"
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// newTestWorker creates a single worker polling the queue often
+func newTestWorker(conn *database.Connection, repo database.Repository, c crawler.CrawlerService) Worker {
+	return NewWorker(database.NewJobRepository(conn), repo, c,
+		NewQuotaService(database.NewUsageRepository(conn), models.QuotaLimits{}), nil,
+		WorkerOptions{
+			ID:                "test-worker",
+			Concurrency:       1,
+			PollInterval:      10 * time.Millisecond,
+			LeaseDuration:     time.Minute,
+			HeartbeatInterval: 10 * time.Millisecond,
+			Retry:             RetryPolicy{MaxAttempts: 3, Backoff: time.Minute},
+		})
+}
+
+// fakeCrawler runs crawl in place of a crawl, and supports nothing else
+type fakeCrawler struct {
+	crawl func(ctx context.Context, url string) error
+}
+
+func (f *fakeCrawler) CrawlURL(ctx context.Context, userID int, url string, maxLinkChecks int, repo crawler.Repository) error {
+	return f.crawl(ctx, url)
+}
+
+func (f *fakeCrawler) ReplayURL(ctx context.Context, userID int, url string, sourceRunID int, repo crawler.Repository) error {
+	return errors.New("replay not supported")
+}
+
+func (f *fakeCrawler) ReanalyzeURL(ctx context.Context, userID int, url string, source *crawler.Source, repo crawler.Repository) error {
+	return errors.New("re-analysis not supported")
+}
+
+func (f *fakeCrawler) ArchivePath(runID int) string {
+	return ""
+}
+
+// blockingCrawler returns a crawler whose crawls report on started and run
+// until release is closed, or until they are cancelled
+func blockingCrawler(started chan<- string, release <-chan struct{}) *fakeCrawler {
+	return &fakeCrawler{crawl: func(ctx context.Context, url string) error {
+		started <- url
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}}
+}
+
+// enqueueTestCrawl queues a crawl of a new crawl result of a user and returns
+// the job ID
+func enqueueTestCrawl(t *testing.T, conn *database.Connection, userID int, url string) int {
+	t.Helper()
+	resultID, err := database.NewCrawlRepository(conn, nil).CreateCrawlResult(userID, url)
+	if err != nil {
+		t.Fatalf("CreateCrawlResult: %v", err)
+	}
+	jobID, err := database.NewJobRepository(conn).EnqueueJob(&models.CrawlJob{
+		CrawlResultID: resultID, UserID: userID, URL: url, Type: models.JobTypeCrawl,
+	})
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+	return jobID
+}
+
+// waitForJob waits until a job has status and returns it
+func waitForJob(t *testing.T, conn *database.Connection, jobID int, status string) *models.CrawlJob {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, err := database.NewJobRepository(conn).GetJobByID(jobID)
+		if err != nil {
+			t.Fatalf("GetJobByID: %v", err)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d status = %q, want %q", jobID, job.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForRuns waits until a crawl result has count finished runs and returns
+// them, latest first
+func waitForRuns(t *testing.T, repo database.Repository, crawlResultID, count int) []models.CrawlRun {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		runs, err := repo.GetCrawlRuns(crawlResultID, 10)
+		if err != nil {
+			t.Fatalf("GetCrawlRuns: %v", err)
+		}
+		if len(runs) == count && runs[0].FinishedAt != nil {
+			return runs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("runs = %+v, want %d finished runs", runs, count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWorkerReanalyzesWithoutFetching(t *testing.T) {
+	var requests atomic.Int32
+	var title atomic.Value
+	title.Store("Before")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<!DOCTYPE html><html><head><title>%s</title></head><body><h1>Hello</h1><a href="/missing">Missing</a></body></html>`, title.Load())
+	}))
+	defer server.Close()
+	pageURL := server.URL + "/"
+
+	conn := newTestConnection(t)
+	repo := database.NewCrawlRepository(conn, blob.NewFSStore(t.TempDir()))
+	c := crawler.NewCrawler(crawler.Options{})
+	queue := NewJobQueue(database.NewJobRepository(conn), repo, nil, nil)
+	crawls := NewCrawlService(repo, database.NewAgentRepository(conn), c, queue,
+		NewQuotaService(database.NewUsageRepository(conn), models.QuotaLimits{}), nil)
+	userID := createTestUser(t, conn, "reanalyze@example.com")
+
+	resultID, err := repo.CreateCrawlResult(userID, pageURL)
+	if err != nil {
+		t.Fatalf("CreateCrawlResult: %v", err)
+	}
+	if err := c.CrawlURL(context.Background(), userID, pageURL, 0, repo); err != nil {
+		t.Fatalf("CrawlURL: %v", err)
+	}
+	source := waitForRuns(t, repo, resultID, 1)[0]
+
+	// The live page changes, the re-analysis must only see the snapshot
+	title.Store("After")
+	fetched := requests.Load()
+
+	if err := crawls.ReanalyzeCrawl(userID, fmt.Sprint(resultID), ""); err != nil {
+		t.Fatalf("ReanalyzeCrawl: %v", err)
+	}
+	w := newTestWorker(conn, repo, c)
+	w.Start()
+	runs := waitForRuns(t, repo, resultID, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if n := requests.Load() - fetched; n != 0 {
+		t.Errorf("re-analysis made %d requests, want none", n)
+	}
+
+	run := runs[0]
+	if run.ID == source.ID || run.Type != models.JobTypeReanalyze || run.SourceRunID == nil || *run.SourceRunID != source.ID {
+		t.Fatalf("latest run = %+v, want a new re-analysis of run %d", run, source.ID)
+	}
+	result, err := repo.GetCrawlResultByID(userID, resultID)
+	if err != nil {
+		t.Fatalf("GetCrawlResultByID: %v", err)
+	}
+	if result.CrawlData.Status != "done" || result.CrawlData.Title.String != "Before" {
+		t.Errorf("crawl result = status %q, title %q, want done, Before", result.CrawlData.Status, result.CrawlData.Title.String)
+	}
+	if result.CrawlData.Headings["h1"] != 1 {
+		t.Errorf("headings = %v, want one h1", result.CrawlData.Headings)
+	}
+
+	// The status of a link comes from the source run
+	links, err := repo.GetLinksByRunID(run.ID)
+	if err != nil {
+		t.Fatalf("GetLinksByRunID: %v", err)
+	}
+	if len(links) != 1 || links[0].URL != server.URL+"/missing" || links[0].StatusCode != http.StatusNotFound {
+		t.Errorf("links = %+v, want /missing with status 404", links)
+	}
+
+	// The re-analysis keeps the snapshot it read
+	snapshot, err := repo.GetSnapshotByRunID(run.ID)
+	if err != nil {
+		t.Fatalf("GetSnapshotByRunID: %v", err)
+	}
+	original, err := repo.GetSnapshotByRunID(source.ID)
+	if err != nil {
+		t.Fatalf("GetSnapshotByRunID: %v", err)
+	}
+	if string(snapshot.Body) != string(original.Body) || !snapshot.FetchedAt.Equal(original.FetchedAt) {
+		t.Errorf("snapshot of the re-analysis differs from the one it read")
+	}
+}
+
+func TestWorkerShutdown(t *testing.T) {
+	tests := []struct {
+		name string
+		// finish lets the running crawl end during the drain period
+		finish     bool
+		wantErr    error
+		wantStatus string
+	}{
+		{name: "drained", finish: true, wantStatus: models.JobStatusDone},
+		{name: "interrupted", wantErr: context.DeadlineExceeded, wantStatus: models.JobStatusInterrupted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newTestConnection(t)
+			userID := createTestUser(t, conn, "shutdown@example.com")
+			running := enqueueTestCrawl(t, conn, userID, "https://example.com/running")
+			waiting := enqueueTestCrawl(t, conn, userID, "https://example.com/waiting")
+
+			started := make(chan string, 2)
+			release := make(chan struct{})
+			w := newTestWorker(conn, database.NewCrawlRepository(conn, nil), blockingCrawler(started, release))
+			w.Start()
+			select {
+			case <-started:
+			case <-time.After(10 * time.Second):
+				t.Fatal("no crawl started")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if tt.finish {
+				// The crawl ends once shutdown has begun
+				time.AfterFunc(20*time.Millisecond, func() { close(release) })
+			}
+			if err := w.Shutdown(ctx); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Shutdown error = %v, want %v", err, tt.wantErr)
+			}
+
+			job := waitForJob(t, conn, running, tt.wantStatus)
+			if job.LeaseOwner.Valid {
+				t.Errorf("job lease owner = %q after shutdown, want none", job.LeaseOwner.String)
+			}
+			// Nothing more was claimed once shutdown began
+			waitForJob(t, conn, waiting, models.JobStatusQueued)
+			select {
+			case url := <-started:
+				t.Errorf("crawl of %s started during shutdown", url)
+			default:
+			}
+
+			if err := w.Shutdown(context.Background()); err != nil {
+				t.Errorf("second Shutdown: %v", err)
+			}
+		})
+	}
+}
+
+func TestWorkerResumesInterruptedCrawls(t *testing.T) {
+	conn := newTestConnection(t)
+	userID := createTestUser(t, conn, "resume@example.com")
+	jobID := enqueueTestCrawl(t, conn, userID, "https://example.com/")
+	repo := database.NewCrawlRepository(conn, nil)
+
+	started := make(chan string, 1)
+	w := newTestWorker(conn, repo, blockingCrawler(started, nil))
+	w.Start()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	w.Shutdown(ctx)
+	waitForJob(t, conn, jobID, models.JobStatusInterrupted)
+
+	// The next worker to start runs the interrupted crawl again
+	release := make(chan struct{})
+	close(release)
+	next := newTestWorker(conn, repo, blockingCrawler(started, release))
+	next.Start()
+	defer next.Shutdown(context.Background())
+
+	job := waitForJob(t, conn, jobID, models.JobStatusDone)
+	if job.Attempts != 2 {
+		t.Errorf("job attempts = %d, want 2", job.Attempts)
+	}
+}
+
+func TestWorkerStopsCrawlWhenLeaseLost(t *testing.T) {
+	conn := newTestConnection(t)
+	userID := createTestUser(t, conn, "lost@example.com")
+	jobID := enqueueTestCrawl(t, conn, userID, "https://example.com/")
+
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	w := newTestWorker(conn, database.NewCrawlRepository(conn, nil), &fakeCrawler{crawl: func(ctx context.Context, url string) error {
+		close(started)
+		<-ctx.Done()
+		stopped <- context.Cause(ctx)
+		return context.Cause(ctx)
+	}})
+	w.Start()
+	defer w.Shutdown(context.Background())
+	<-started
+
+	// Another worker reclaimed the job while this one could not renew its lease
+	if _, err := conn.Exec(`UPDATE crawl_jobs SET lease_owner = 'other-worker' WHERE id = ?`, jobID); err != nil {
+		t.Fatalf("taking over the lease: %v", err)
+	}
+
+	select {
+	case cause := <-stopped:
+		if !errors.Is(cause, crawler.ErrInterrupted) {
+			t.Errorf("crawl cancelled with %v, want an interruption", cause)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawl kept running after its lease was lost")
+	}
+
+	// The job is left to its new owner
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	job := waitForJob(t, conn, jobID, models.JobStatusRunning)
+	if job.LeaseOwner.String != "other-worker" {
+		t.Errorf("job lease owner = %q, want other-worker", job.LeaseOwner.String)
+	}
+}
+
+func TestWorkerReclaimsExpiredLeases(t *testing.T) {
+	conn := newTestConnection(t)
+	userID := createTestUser(t, conn, "abandoned@example.com")
+	jobID := enqueueTestCrawl(t, conn, userID, "https://example.com/")
+	jobs := database.NewJobRepository(conn)
+
+	// A worker claimed the job and died without renewing its lease
+	if job, err := jobs.ClaimNextJob("dead-worker", time.Minute, 0); err != nil || job == nil {
+		t.Fatalf("ClaimNextJob = %+v, %v", job, err)
+	}
+	if _, err := conn.Exec(`UPDATE crawl_jobs SET lease_expires_at = '2000-01-01 00:00:00' WHERE id = ?`, jobID); err != nil {
+		t.Fatalf("expiring lease: %v", err)
+	}
+
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	close(release)
+	w := newTestWorker(conn, database.NewCrawlRepository(conn, nil), blockingCrawler(started, release))
+	w.Start()
+	defer w.Shutdown(context.Background())
+
+	job := waitForJob(t, conn, jobID, models.JobStatusDone)
+	if job.Attempts != 2 {
+		t.Errorf("job attempts = %d, want 2", job.Attempts)
+	}
+	if url := <-started; url != "https://example.com/" {
+		t.Errorf("crawled %s, want https://example.com/", url)
+	}
+}
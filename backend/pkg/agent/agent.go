@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/seo-crawler-app/pkg/crawler"
+)
+
+// uploadAttempts is the number of times the result of a job is uploaded
+// before it is given up, the server then re-runs the job once its lease expires
+const uploadAttempts = 5
+
+// uploadBackoff is the delay before the first upload retry, doubled on each attempt
+const uploadBackoff = 2 * time.Second
+
+// interruptGrace bounds how long Shutdown waits for interrupted crawls to
+// upload their partial results once the drain period is over
+const interruptGrace = 30 * time.Second
+
+// errJobLost is the cancellation cause of crawls whose job was handed to
+// someone else, their results are discarded
+var errJobLost = errors.New("job lease lost")
+
+// Options configures an agent
+type Options struct {
+	// Concurrency is the number of crawls run at once
+	Concurrency int
+	// PollInterval is how often the server is asked for jobs when idle
+	PollInterval time.Duration
+	// HeartbeatInterval is how often the leases of running jobs are renewed,
+	// and how often they are checked for stop requests
+	HeartbeatInterval time.Duration
+	// Crawler configures the crawls. The link check limit is set per job by the server.
+	Crawler crawler.Options
+}
+
+// Agent defines the interface for a remote crawl agent
+type Agent interface {
+	Start()
+	Shutdown(ctx context.Context) error
+}
+
+// agent implements the Agent interface. It pulls jobs from the server, crawls
+// them into an in-memory Recorder and uploads the recorded result, so the
+// server stores exactly what a crawl of its own would have stored.
+type agent struct {
+	client  Client
+	options Options
+	crawler crawler.CrawlerService
+
+	stopping chan struct{}
+	stopOnce sync.Once
+	finished chan struct{}
+	workerWG sync.WaitGroup
+
+	// running holds the cancel function of every crawl in progress, keyed by job ID
+	mu      sync.Mutex
+	running map[int]context.CancelCauseFunc
+}
+
+// New creates a new agent
+func New(client Client, options Options) Agent {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	return &agent{
+		client:   client,
+		options:  options,
+		crawler:  crawler.NewCrawler(options.Crawler),
+		stopping: make(chan struct{}),
+		finished: make(chan struct{}),
+		running:  make(map[int]context.CancelCauseFunc),
+	}
+}
+
+// Start starts the workers and their heartbeat
+func (a *agent) Start() {
+	for i := 0; i < a.options.Concurrency; i++ {
+		a.workerWG.Add(1)
+		go a.work(i + 1)
+	}
+	go a.heartbeat()
+	log.Printf("Started agent with %d crawl workers", a.options.Concurrency)
+}
+
+// Shutdown stops claiming jobs and waits for running crawls to finish. Crawls
+// still running when ctx is done are interrupted and uploaded as such, and the
+// server queues them again.
+func (a *agent) Shutdown(ctx context.Context) error {
+	a.stopOnce.Do(func() { close(a.stopping) })
+
+	done := make(chan struct{})
+	go func() {
+		a.workerWG.Wait()
+		close(done)
+	}()
+	defer close(a.finished)
+
+	select {
+	case <-done:
+		log.Printf("All crawl workers finished")
+		return nil
+	case <-ctx.Done():
+	}
+
+	a.mu.Lock()
+	log.Printf("Drain period over, interrupting %d running crawls", len(a.running))
+	for _, cancel := range a.running {
+		cancel(crawler.ErrInterrupted)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(interruptGrace):
+		log.Printf("Timed out waiting for interrupted crawls to upload their results")
+	}
+	return ctx.Err()
+}
+
+// work claims and runs jobs until shutdown begins
+func (a *agent) work(workerID int) {
+	defer a.workerWG.Done()
+
+	for {
+		select {
+		case <-a.stopping:
+			return
+		default:
+		}
+
+		job, err := a.client.Claim(context.Background())
+		if err != nil {
+			log.Printf("Worker %d: %v", workerID, err)
+		}
+		if job == nil {
+			select {
+			case <-time.After(a.options.PollInterval):
+			case <-a.stopping:
+				return
+			}
+			continue
+		}
+
+		a.run(workerID, job)
+	}
+}
+
+// heartbeat renews the leases of running jobs and stops the crawls that were
+// stopped by a user or handed to someone else, until every crawl has ended
+func (a *agent) heartbeat() {
+	ticker := time.NewTicker(a.options.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.renewLeases()
+		case <-a.finished:
+			return
+		}
+	}
+}
+
+// renewLeases sends a heartbeat for every running job
+func (a *agent) renewLeases() {
+	a.mu.Lock()
+	ids := make([]int, 0, len(a.running))
+	for id := range a.running {
+		ids = append(ids, id)
+	}
+	a.mu.Unlock()
+
+	for _, id := range ids {
+		heartbeat, err := a.client.Heartbeat(context.Background(), id)
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+
+		var cause error
+		switch {
+		case !heartbeat.Held:
+			log.Printf("Lost lease of job %d, stopping its crawl", id)
+			cause = errJobLost
+		case heartbeat.CancelRequested:
+			log.Printf("Job %d was stopped by its user", id)
+		default:
+			continue
+		}
+
+		a.mu.Lock()
+		if cancel, ok := a.running[id]; ok {
+			cancel(cause)
+		}
+		a.mu.Unlock()
+	}
+}
+
+// run crawls a claimed job and uploads its outcome
+func (a *agent) run(workerID int, job *Job) {
+	log.Printf("Worker %d running job %d for %s", workerID, job.ID, job.URL)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	a.mu.Lock()
+	a.running[job.ID] = cancel
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.running, job.ID)
+		a.mu.Unlock()
+		cancel(nil)
+	}()
+
+	recorder := crawler.NewRecorder(job.CrawlResultID)
+	err := a.crawler.CrawlURL(ctx, 0, job.URL, job.MaxLinkChecks, recorder)
+
+	completion := &Completion{Outcome: OutcomeDone, Result: recorder.Result()}
+	var crawlErr *crawler.CrawlError
+	switch {
+	case errors.Is(context.Cause(ctx), errJobLost):
+		// Someone else runs the job now
+		return
+	case errors.Is(err, crawler.ErrInterrupted):
+		log.Printf("Job %d was interrupted for %s", job.ID, job.URL)
+		completion.Outcome = OutcomeInterrupted
+	case errors.Is(err, context.Canceled):
+		log.Printf("Job %d was stopped for %s", job.ID, job.URL)
+		completion.Outcome = OutcomeCancelled
+	case err != nil:
+		log.Printf("Job %d failed for %s: %v", job.ID, job.URL, err)
+		completion.Outcome = OutcomeFailed
+		completion.Error = err.Error()
+		completion.Transient = errors.As(err, &crawlErr) && crawlErr.Transient()
+	}
+
+	a.upload(job, completion)
+}
+
+// upload sends the outcome of a job to the server, retrying failed uploads
+// with an exponential backoff
+func (a *agent) upload(job *Job, completion *Completion) {
+	delay := uploadBackoff
+	for attempt := 1; ; attempt++ {
+		err := a.client.Complete(context.Background(), job.ID, completion)
+		if err == nil {
+			log.Printf("Uploaded result of job %d for %s", job.ID, job.URL)
+			return
+		}
+
+		var statusErr *StatusError
+		switch {
+		case errors.Is(err, ErrJobLost):
+			log.Printf("Discarding result of job %d, it is no longer leased to this agent", job.ID)
+			return
+		case errors.As(err, &statusErr) && statusErr.StatusCode < 500:
+			log.Printf("Server rejected result of job %d: %v", job.ID, err)
+			return
+		case attempt == uploadAttempts:
+			log.Printf("Giving up on result of job %d: %v", job.ID, err)
+			return
+		}
+
+		log.Printf("%v, retrying in %s", err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
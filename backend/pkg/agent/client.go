@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrJobLost is returned when the server no longer leases a job to the agent,
+// typically because the lease expired and the job was handed out again
+var ErrJobLost = errors.New("job is no longer leased to this agent")
+
+// requestTimeout bounds a single request to the server
+const requestTimeout = time.Minute
+
+// Client defines the interface for talking to the server's agent API
+type Client interface {
+	Claim(ctx context.Context) (*Job, error)
+	Heartbeat(ctx context.Context, jobID int) (*Heartbeat, error)
+	Complete(ctx context.Context, jobID int, completion *Completion) error
+}
+
+// StatusError is a request rejected by the server
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error returns the status and the server's message
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server responded %d: %s", e.StatusCode, e.Message)
+}
+
+// httpClient implements the Client interface over HTTP
+type httpClient struct {
+	serverURL string
+	token     string
+	http      *http.Client
+}
+
+// NewClient creates a client for the server at serverURL, authenticating
+// with an agent token
+func NewClient(serverURL, token string) Client {
+	return &httpClient{
+		serverURL: strings.TrimRight(serverURL, "/"),
+		token:     token,
+		http:      &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Claim leases the next job assigned to the agent, or returns nil when there is none
+func (c *httpClient) Claim(ctx context.Context) (*Job, error) {
+	var job Job
+	status, err := c.post(ctx, "/api/agent/jobs/claim", nil, &job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	if status == http.StatusNoContent {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+// Heartbeat renews the lease of a running job
+func (c *httpClient) Heartbeat(ctx context.Context, jobID int) (*Heartbeat, error) {
+	var heartbeat Heartbeat
+	if _, err := c.post(ctx, fmt.Sprintf("/api/agent/jobs/%d/heartbeat", jobID), nil, &heartbeat); err != nil {
+		return nil, fmt.Errorf("failed to send heartbeat of job %d: %w", jobID, err)
+	}
+	return &heartbeat, nil
+}
+
+// Complete uploads the outcome of a job
+func (c *httpClient) Complete(ctx context.Context, jobID int, completion *Completion) error {
+	_, err := c.post(ctx, fmt.Sprintf("/api/agent/jobs/%d/complete", jobID), completion, nil)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict {
+		return ErrJobLost
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload result of job %d: %w", jobID, err)
+	}
+	return nil
+}
+
+// post sends body as JSON to path and decodes a successful response into out
+func (c *httpClient) post(ctx context.Context, path string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.serverURL+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&apiErr)
+		return resp.StatusCode, &StatusError{StatusCode: resp.StatusCode, Message: apiErr.Error}
+	}
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
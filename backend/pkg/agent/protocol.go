@@ -0,0 +1,40 @@
+package agent
+
+import "github.com/seo-crawler-app/pkg/crawler"
+
+// Completion outcomes reported by an agent
+const (
+	OutcomeDone        = "done"
+	OutcomeFailed      = "failed"
+	OutcomeCancelled   = "cancelled"
+	OutcomeInterrupted = "interrupted"
+)
+
+// Job is a crawl handed to an agent by the server
+type Job struct {
+	ID            int    `json:"id"`
+	CrawlResultID int    `json:"crawl_result_id"`
+	URL           string `json:"url"`
+	Attempts      int    `json:"attempts"`
+	// MaxLinkChecks is the number of links the agent may check, zero for all
+	MaxLinkChecks int `json:"max_link_checks"`
+}
+
+// Heartbeat is the server's answer to a job heartbeat
+type Heartbeat struct {
+	// Held reports whether the agent still holds the job. A job that is no
+	// longer held must be abandoned without uploading its result.
+	Held bool `json:"held"`
+	// CancelRequested reports whether a user asked to stop the crawl
+	CancelRequested bool `json:"cancel_requested"`
+}
+
+// Completion is the outcome of a job uploaded by an agent
+type Completion struct {
+	Outcome string `json:"outcome"`
+	// Error describes a failed crawl
+	Error string `json:"error,omitempty"`
+	// Transient reports whether retrying a failed crawl later may succeed
+	Transient bool            `json:"transient,omitempty"`
+	Result    *crawler.Result `json:"result"`
+}
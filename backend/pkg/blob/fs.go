@@ -0,0 +1,137 @@
+package blob
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fsStore implements the Store interface on the local filesystem. Blobs are
+// gzip-compressed and spread over two levels of directories named after the
+// start of their key.
+type fsStore struct {
+	dir string
+}
+
+// NewFSStore creates a blob store writing under dir
+func NewFSStore(dir string) Store {
+	return &fsStore{dir: dir}
+}
+
+// Put stores data unless a blob with the same content already exists
+func (s *fsStore) Put(data []byte) (string, error) {
+	key := Key(data)
+	path := s.path(key)
+
+	// Refresh the time of a blob stored already, telling Prune it is in use
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		return key, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	// Write to a temporary file first so a blob is never seen half written
+	f, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write(data); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to close blob file: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to move blob into place: %w", err)
+	}
+
+	return key, nil
+}
+
+// Get returns the content of a blob
+func (s *fsStore) Get(key string) ([]byte, error) {
+	if !validKey(key) {
+		return nil, ErrNotFound
+	}
+
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", key, err)
+	}
+	defer zr.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, zr); err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", key, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Delete removes a blob, deleting a missing blob is not an error
+func (s *fsStore) Delete(key string) error {
+	if !validKey(key) {
+		return nil
+	}
+
+	err := os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// Prune removes a blob unless it was put at or after before, and reports
+// whether it was removed
+func (s *fsStore) Prune(key string, before time.Time) (bool, error) {
+	if !validKey(key) {
+		return false, nil
+	}
+
+	path := s.path(key)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat blob: %w", err)
+	}
+	if !info.ModTime().Before(before) {
+		return false, nil
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return true, nil
+}
+
+// path returns the file a blob is stored in
+func (s *fsStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key[2:4], key+".gz")
+}
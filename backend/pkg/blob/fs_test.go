@@ -0,0 +1,182 @@
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countBlobs returns the number of blob files stored under dir
+func countBlobs(t *testing.T, dir string) int {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*", "*.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestFSStorePutDeduplicates(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFSStore(dir)
+	data := []byte("<html><body>Hello</body></html>")
+
+	first, err := store.Put(data)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	second, err := store.Put(append([]byte(nil), data...))
+	if err != nil {
+		t.Fatalf("second Put: %v", err)
+	}
+	if first != second || first != Key(data) {
+		t.Errorf("Put keys = %s, %s, want %s twice", first, second, Key(data))
+	}
+	if n := countBlobs(t, dir); n != 1 {
+		t.Errorf("%d blobs stored for the same content, want 1", n)
+	}
+
+	if _, err := store.Put([]byte("other")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if n := countBlobs(t, dir); n != 2 {
+		t.Errorf("%d blobs stored for two contents, want 2", n)
+	}
+
+	got, err := store.Get(first)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get = %q, want %q", got, data)
+	}
+}
+
+func TestFSStoreGetMissing(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	if _, err := store.Get(Key([]byte("never stored"))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing blob error = %v, want %v", err, ErrNotFound)
+	}
+
+	key, err := store.Put([]byte("deleted"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted blob error = %v, want %v", err, ErrNotFound)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+}
+
+func TestFSStorePrune(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFSStore(dir).(*fsStore)
+	now := time.Now()
+
+	// put stores data as put at the given time
+	put := func(data string, at time.Time) string {
+		t.Helper()
+		key, err := store.Put([]byte(data))
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if err := os.Chtimes(store.path(key), at, at); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	old := put("old", now.Add(-2*time.Hour))
+	recent := put("recent", now)
+	reused := put("reused", now.Add(-2*time.Hour))
+
+	// Putting a blob again marks it as in use
+	if _, err := store.Put([]byte("reused")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	before := now.Add(-time.Hour)
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{name: "older than the grace period", key: old, want: true},
+		{name: "put within the grace period", key: recent, want: false},
+		{name: "put again within the grace period", key: reused, want: false},
+		{name: "missing", key: Key([]byte("missing")), want: false},
+		{name: "already pruned", key: old, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, err := store.Prune(tt.key, before)
+			if err != nil {
+				t.Fatalf("Prune: %v", err)
+			}
+			if removed != tt.want {
+				t.Errorf("Prune removed = %v, want %v", removed, tt.want)
+			}
+		})
+	}
+
+	if _, err := store.Get(old); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of the pruned blob error = %v, want %v", err, ErrNotFound)
+	}
+	for _, key := range []string{recent, reused} {
+		if _, err := store.Get(key); err != nil {
+			t.Errorf("Get of the kept blob %s: %v", key, err)
+		}
+	}
+}
+
+func TestFSStoreRejectsInvalidKeys(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFSStore(filepath.Join(dir, "blobs"))
+	// A file outside the store that crafted keys could reach
+	outside := filepath.Join(dir, "secret.gz")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	valid := Key([]byte("x"))
+	keys := []string{
+		"",
+		"abc",
+		"../../secret",
+		"../" + valid[3:],
+		valid[:len(valid)-1],
+		valid + "0",
+		"zz" + valid[2:],
+		valid[:10] + "/" + valid[11:],
+	}
+	for _, key := range keys {
+		t.Run(key, func(t *testing.T) {
+			if validKey(key) {
+				t.Errorf("validKey(%q) = true, want false", key)
+			}
+			if _, err := store.Get(key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(%q) error = %v, want %v", key, err, ErrNotFound)
+			}
+			if err := store.Delete(key); err != nil {
+				t.Errorf("Delete(%q): %v", key, err)
+			}
+			if removed, err := store.Prune(key, time.Now().Add(time.Hour)); err != nil || removed {
+				t.Errorf("Prune(%q) = %v, %v, want nothing removed", key, removed, err)
+			}
+		})
+	}
+
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the store: %v", err)
+	}
+	if !validKey(valid) {
+		t.Errorf("validKey(%q) = false, want true", valid)
+	}
+}
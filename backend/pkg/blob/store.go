@@ -0,0 +1,38 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a blob is not in the store
+var ErrNotFound = errors.New("blob not found")
+
+// Store defines the interface for content-addressed blob storage. Blobs are
+// keyed by the SHA-256 of their content, so storing the same content twice
+// keeps a single copy. Prune deletes a blob only when it was not put since a
+// given time, so a blob being reused while it is collected survives.
+type Store interface {
+	Put(data []byte) (string, error)
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	Prune(key string, before time.Time) (bool, error)
+}
+
+// Key returns the key content is stored under
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// validKey reports whether key is a well-formed blob key, keeping keys from
+// naming anything outside the store
+func validKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
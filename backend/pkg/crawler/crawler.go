@@ -1,10 +1,18 @@
 package crawler
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gocolly/colly/v2"
@@ -13,49 +21,154 @@ import (
 
 // CrawlerService defines the interface for crawling operations
 type CrawlerService interface {
-	CrawlURL(userID int, url string, repo Repository) error
+	CrawlURL(ctx context.Context, userID int, url string, maxLinkChecks int, repo Repository) error
+	ReplayURL(ctx context.Context, userID int, url string, sourceRunID int, repo Repository) error
+	ReanalyzeURL(ctx context.Context, userID int, url string, source *Source, repo Repository) error
+	ArchivePath(runID int) string
 }
 
 // Repository defines the interface for database operations needed by crawler
 type Repository interface {
 	GetCrawlResultIDByURL(userID int, url string) (int, error)
+	StartCrawlRun(crawlResultID int, runType string, sourceRunID int) (int, error)
 	UpdateCrawlResultStatus(userID int, url, status string) error
-	UpdateCrawlData(userID int, url string, data *models.CrawlData) error
-	CreateLink(crawlID int, link *models.LinkData) (int64, error)
-	UpdateLinkStatus(linkID int64, statusCode int, isAccessible bool) error
-	CreateHeading(crawlID int, heading *models.HeadingData) error
+	UpdateCrawlError(userID int, url, errorClass, errorMessage string) error
+	SavePageResult(runID int, page *models.PageResult) error
+}
+
+// Options configures a crawler
+type Options struct {
+	// WARCDir is where the WARC archive of each crawl run is written, empty disables archiving
+	WARCDir string
+	// HostRequestsPerSecond is the request rate allowed per host across all crawls
+	HostRequestsPerSecond float64
+	// HostConcurrency is the number of requests allowed in flight per host across all crawls
+	HostConcurrency int
+	// Events receives the progress of every crawl, nil disables events
+	Events EventSink
 }
 
 // Crawler implements the CrawlerService interface
-type Crawler struct{}
+type Crawler struct {
+	options Options
+	limiter *hostLimiter
+}
 
 // NewCrawler creates a new crawler instance
-func NewCrawler() CrawlerService {
-	return &Crawler{}
+func NewCrawler(options Options) CrawlerService {
+	return &Crawler{
+		options: options,
+		limiter: newHostLimiter(options.HostRequestsPerSecond, options.HostConcurrency),
+	}
 }
 
-// CrawlURL crawls a given URL and stores the results
-func (c *Crawler) CrawlURL(userID int, baseURL string, repo Repository) error {
-	collector := colly.NewCollector(
-		colly.MaxDepth(1),
-		colly.Async(true),
-	)
+// CrawlURL crawls a given URL and stores the results in a new run of its
+// crawl result, checking at most maxLinkChecks of its links, or every link
+// when zero. Links past the limit are stored without a status. Cancelling ctx aborts
+// in-flight fetches and link checks and stores the partial results as stopped,
+// or as interrupted when the cancellation cause is ErrInterrupted.
+func (c *Crawler) CrawlURL(ctx context.Context, userID int, baseURL string, maxLinkChecks int, repo Repository) error {
+	crawlResultID, err := lookupCrawlResultID(repo, userID, baseURL)
+	if err != nil {
+		return err
+	}
+	runID, err := repo.StartCrawlRun(crawlResultID, models.JobTypeCrawl, 0)
+	if err != nil {
+		log.Printf("Failed to start crawl run for %s: %v", baseURL, err)
+		return err
+	}
 
-	// Limit the number of threads
-	collector.Limit(&colly.LimitRule{
-		DomainGlob:  "*",
-		Parallelism: 2,
-		RandomDelay: 5 * time.Second,
-	})
+	// Archive every request/response pair of this crawl
+	transport := http.DefaultTransport
+	if c.options.WARCDir != "" {
+		archive, closeArchive, err := c.createArchive(runID)
+		if err != nil {
+			log.Printf("Failed to create WARC archive for %s: %v", baseURL, err)
+		} else {
+			defer closeArchive()
+			transport = &recordingTransport{next: transport, archive: archive}
+		}
+	}
 
-	data := &models.CrawlData{
-		Headings:       make(map[string]int),
-		Status:         "running",
-		Links:          []models.LinkData{},
-		HeadingDetails: []models.HeadingData{},
+	// Every live request waits for its host's budget, shared with other crawls
+	transport = c.limiter.Transport(transport)
+
+	return c.crawl(ctx, userID, crawlResultID, runID, baseURL, repo, transport, false, nil, maxLinkChecks)
+}
+
+// ReplayURL re-runs the analyzers against the WARC archive of run sourceRunID
+// of the URL, without any network access, storing the results in a new run
+func (c *Crawler) ReplayURL(ctx context.Context, userID int, baseURL string, sourceRunID int, repo Repository) error {
+	crawlResultID, err := lookupCrawlResultID(repo, userID, baseURL)
+	if err != nil {
+		return err
+	}
+	runID, err := repo.StartCrawlRun(crawlResultID, models.JobTypeReplay, sourceRunID)
+	if err != nil {
+		log.Printf("Failed to start replay run for %s: %v", baseURL, err)
+		return err
 	}
 
-	// Get the crawl result ID for storing detailed data
+	archive, err := OpenWARC(c.ArchivePath(sourceRunID))
+	if err != nil {
+		log.Printf("Failed to open WARC archive for %s: %v", baseURL, err)
+		if dbErr := repo.UpdateCrawlError(userID, baseURL, ErrorClassUnknown, err.Error()); dbErr != nil {
+			log.Printf("Failed to update error status for %s: %v", baseURL, dbErr)
+		}
+		newProgress(c.options.Events, userID, crawlResultID, baseURL).status("error")
+		return err
+	}
+
+	return c.crawl(ctx, userID, crawlResultID, runID, baseURL, repo, archive, true, nil, 0)
+}
+
+// ArchivePath returns the path of the WARC archive of a crawl run
+func (c *Crawler) ArchivePath(runID int) string {
+	return ArchivePath(c.options.WARCDir, runID)
+}
+
+// ArchivePath returns the path of the WARC archive of a crawl run in dir
+func ArchivePath(dir string, runID int) string {
+	return filepath.Join(dir, fmt.Sprintf("run-%d.warc.gz", runID))
+}
+
+// createArchive opens a new WARC archive for a crawl run. The archive is
+// written to a temporary file and moved into place when closed, so that it
+// is never replayed before the crawl is complete.
+func (c *Crawler) createArchive(runID int) (*WARCWriter, func(), error) {
+	if err := os.MkdirAll(c.options.WARCDir, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create WARC directory: %w", err)
+	}
+
+	path := c.ArchivePath(runID)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create WARC file: %w", err)
+	}
+
+	archive, err := NewWARCWriter(f, filepath.Base(path))
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, nil, err
+	}
+
+	closeArchive := func() {
+		if err := f.Close(); err != nil {
+			log.Printf("Failed to close WARC file %s: %v", f.Name(), err)
+			return
+		}
+		if err := os.Rename(f.Name(), path); err != nil {
+			log.Printf("Failed to move WARC file into place %s: %v", path, err)
+		}
+	}
+
+	return archive, closeArchive, nil
+}
+
+// lookupCrawlResultID gets the crawl result ID for storing detailed data,
+// retrying briefly in case the row was only just created
+func lookupCrawlResultID(repo Repository, userID int, baseURL string) (int, error) {
 	var crawlResultID int
 	maxTries := 5
 	for i := 0; i < maxTries; i++ {
@@ -66,20 +179,107 @@ func (c *Crawler) CrawlURL(userID int, baseURL string, repo Repository) error {
 		}
 		if i == maxTries-1 {
 			log.Printf("Failed to get crawl result ID for %s after %d tries: %v", baseURL, maxTries, err)
-			return err
+			return 0, err
 		}
 		time.Sleep(200 * time.Millisecond)
 	}
+	return crawlResultID, nil
+}
+
+// crawl fetches a page through transport and runs every analyzer on it,
+// collecting page details in memory and storing them in run runID at once
+// when the crawl ends. In offline mode, checks that need a live connection
+// are skipped. A re-analysis passes the source run it reads, whose
+// certificate stands in for the one that cannot be inspected offline. At most
+// maxLinkChecks links are checked, every link when zero.
+func (c *Crawler) crawl(ctx context.Context, userID, crawlResultID, runID int, baseURL string, repo Repository, transport http.RoundTripper, offline bool, source *Source, maxLinkChecks int) error {
+	collector := colly.NewCollector(
+		colly.MaxDepth(1),
+		colly.Async(true),
+		colly.StdlibContext(ctx),
+		// One byte over the limit tells a truncated page apart from one of exactly maxPageSize
+		colly.MaxBodySize(maxPageSize+1),
+	)
+	collector.WithTransport(transport)
+
+	// The host limiter applies the request timeout once a request may start,
+	// so time spent waiting for the host does not count against it
+	collector.SetRequestTimeout(0)
+
+	// Link checks, resource measurements and security checks share the transport
+	client := &http.Client{Transport: transport}
+
+	data := &models.CrawlData{
+		Headings:       make(map[string]int),
+		Status:         "running",
+		Links:          []models.LinkData{},
+		HeadingDetails: []models.HeadingData{},
+		Forms:          []models.FormData{},
+		Issues:         []models.IssueData{},
+		Resources:      []models.ResourceData{},
+	}
 
 	// Update status to running
 	if err := repo.UpdateCrawlResultStatus(userID, baseURL, "running"); err != nil {
 		log.Printf("Failed to update status to running for %s: %v", baseURL, err)
 		return err
 	}
+	progress := newProgress(c.options.Events, userID, crawlResultID, baseURL)
+	progress.status("running")
+
+	addIssue := func(issue *models.IssueData) {
+		data.Issues = append(data.Issues, *issue)
+	}
+
+	// snapshot is the response that was audited
+	var snapshot *models.Snapshot
+
+	// pageErr holds the classified failure of the page fetch, if any
+	var pageErr *CrawlError
+
+	// Refuse pages announcing a body over the size limit before downloading them
+	collector.OnResponseHeaders(func(r *colly.Response) {
+		size, err := strconv.ParseInt(r.Headers.Get("Content-Length"), 10, 64)
+		if err == nil && size > maxPageSize {
+			pageErr = &CrawlError{
+				Class:      ErrorClassBodyTooLarge,
+				StatusCode: r.StatusCode,
+				Err:        fmt.Errorf("page of %d bytes exceeds the %d byte limit", size, maxPageSize),
+			}
+			r.Request.Abort()
+		}
+	})
 
 	// Set up response handler
 	collector.OnResponse(func(r *colly.Response) {
+		if len(r.Body) > maxPageSize {
+			pageErr = &CrawlError{
+				Class:      ErrorClassBodyTooLarge,
+				StatusCode: r.StatusCode,
+				Err:        fmt.Errorf("page exceeds the %d byte limit", maxPageSize),
+			}
+		}
+		progress.pageFetched()
+
+		// Keep the exact response that was audited
+		if pageErr == nil {
+			snapshot = &models.Snapshot{
+				URL:         r.Request.URL.String(),
+				StatusCode:  r.StatusCode,
+				ContentType: r.Headers.Get("Content-Type"),
+				FetchedAt:   time.Now(),
+				Headers:     *r.Headers,
+				Body:        r.Body,
+			}
+			// A re-analysis keeps the response it read as it was fetched
+			if source != nil {
+				snapshot.FetchedAt = source.Snapshot.FetchedAt
+				snapshot.Headers = source.Snapshot.Headers
+			}
+		}
+
 		body := string(r.Body)
+		data.HTMLSize = int64(len(r.Body))
 		if strings.Contains(body, "<!DOCTYPE html>") {
 			data.HTMLVersion.String = "HTML5"
 			data.HTMLVersion.Valid = true
@@ -98,6 +298,17 @@ func (c *Crawler) CrawlURL(userID int, baseURL string, repo Repository) error {
 		data.Title.Valid = true
 	})
 
+	// Set up meta description handler
+	collector.OnHTML(`meta[name="description" i]`, func(e *colly.HTMLElement) {
+		data.MetaDescription.String = strings.TrimSpace(e.Attr("content"))
+		data.MetaDescription.Valid = true
+	})
+
+	// Keep the page text for full-text search
+	collector.OnHTML("body", func(e *colly.HTMLElement) {
+		data.BodyText = bodyText(e)
+	})
+
 	// Set up heading handler
 	headingOrder := 0
 	collector.OnHTML("h1, h2, h3, h4, h5, h6", func(e *colly.HTMLElement) {
@@ -106,38 +317,44 @@ func (c *Crawler) CrawlURL(userID int, baseURL string, repo Repository) error {
 		
 		headingText := strings.TrimSpace(e.Text)
 		if headingText != "" {
-			heading := &models.HeadingData{
+			data.HeadingDetails = append(data.HeadingDetails, models.HeadingData{
 				Level: e.Name,
 				Text:  headingText,
 				Order: headingOrder,
-			}
-			
-			// Store heading details in database
-			if err := repo.CreateHeading(crawlResultID, heading); err != nil {
-				log.Printf("Failed to store heading for %s: %v", baseURL, err)
-			}
-			
-			// Add to local data
-			data.HeadingDetails = append(data.HeadingDetails, *heading)
+			})
 		}
 	})
 
-	// Check for login forms
+	// Classify forms
 	collector.OnHTML("form", func(e *colly.HTMLElement) {
-		formHTML, err := e.DOM.Html()
-		if err != nil {
-			return
-		}
-		formHTML = strings.ToLower(formHTML)
-		if strings.Contains(formHTML, "login") || 
-		   strings.Contains(formHTML, "password") || 
-		   strings.Contains(formHTML, "username") ||
-		   strings.Contains(formHTML, "email") {
+		form := classifyForm(e, e.Request.URL)
+		if form.Type == FormTypeLogin {
 			data.HasLoginForm = true
 		}
+		data.Forms = append(data.Forms, form)
+
+		if issue := insecureFormIssue(&form); issue != nil {
+			addIssue(issue)
+		}
 	})
 
+	// Detect subresources loaded over HTTP on HTTPS pages
+	mixedContent := 0
+	collector.OnHTML(mixedContentSelector, func(e *colly.HTMLElement) {
+		if issue := mixedContentIssue(e); issue != nil {
+			mixedContent++
+			addIssue(issue)
+		}
+	})
+
+	// Collect scripts, stylesheets, preloads, fonts and iframes
+	resources := newResourceCollector()
+	collector.OnHTML(resourceSelector, resources.collect)
+
 	// Set up link handler
+	var linkChecks sync.WaitGroup
+	var dataMu sync.Mutex
+	checksStarted := 0
 	collector.OnHTML("a[href]", func(e *colly.HTMLElement) {
 		link := e.Request.AbsoluteURL(e.Attr("href"))
 		if link == "" {
@@ -163,32 +380,50 @@ func (c *Crawler) CrawlURL(userID int, baseURL string, repo Repository) error {
 			data.ExternalLinks++
 		}
 
-		linkData := &models.LinkData{
+		dataMu.Lock()
+		linkIndex := len(data.Links)
+		data.Links = append(data.Links, models.LinkData{
 			URL:          link,
 			Text:         linkText,
 			Type:         linkType,
 			StatusCode:   0,
 			IsAccessible: true,
-		}
+		})
+		dataMu.Unlock()
+		progress.linkFound()
 
-		// Store link in database
-		linkID, err := repo.CreateLink(crawlResultID, linkData)
-		if err != nil {
-			log.Printf("Failed to store link for %s (link: %s): %v", baseURL, link, err)
+		// Leave links past the per-crawl limit unchecked
+		if maxLinkChecks > 0 && checksStarted >= maxLinkChecks {
+			if checksStarted == maxLinkChecks {
+				log.Printf("Link check limit of %d reached for %s", maxLinkChecks, baseURL)
+			}
+			checksStarted++
 			return
 		}
-		
-		// Add to local data
-		linkData.ID = int(linkID)
-		data.Links = append(data.Links, *linkData)
-
-		// Check link status asynchronously and update database
-		go func(link string, linkID int64) {
-			client := &http.Client{Timeout: 10 * time.Second}
-			resp, err := client.Head(link)
+		checksStarted++
+
+		// Check link status asynchronously
+		linkChecks.Add(1)
+		go func(link string, linkIndex int) {
+			defer linkChecks.Done()
 			statusCode := 0
 			isAccessible := true
-			
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, link, nil)
+			if err != nil {
+				return
+			}
+			resp, err := client.Do(req)
+
+			// A check aborted by cancellation says nothing about the link, and
+			// neither does one that was never recorded when working offline
+			if ctx.Err() != nil || errors.Is(err, ErrNotArchived) {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return
+			}
+
 			if err != nil {
 				statusCode = 0
 				isAccessible = false
@@ -197,52 +432,121 @@ func (c *Crawler) CrawlURL(userID int, baseURL string, repo Repository) error {
 				statusCode = resp.StatusCode
 				if resp.StatusCode >= 400 {
 					isAccessible = false
-					data.InaccessibleLinks++
 				}
 			}
-			
-			// Update link status in database
-			if err := repo.UpdateLinkStatus(linkID, statusCode, isAccessible); err != nil {
-				log.Printf("Failed to update link status for %s: %v", link, err)
-			}
-			
-			// Update local data
-			for i := range data.Links {
-				if data.Links[i].ID == int(linkID) {
-					data.Links[i].StatusCode = statusCode
-					data.Links[i].IsAccessible = isAccessible
-					break
-				}
+
+			progress.linkChecked(!isAccessible)
+
+			dataMu.Lock()
+			defer dataMu.Unlock()
+			if !isAccessible {
+				data.InaccessibleLinks++
 			}
-		}(link, linkID)
+			data.Links[linkIndex].StatusCode = statusCode
+			data.Links[linkIndex].IsAccessible = isAccessible
+		}(link, linkIndex)
 	})
 
 	// Set up completion handler
+	scraped := false
 	collector.OnScraped(func(r *colly.Response) {
-		if err := repo.UpdateCrawlData(userID, baseURL, data); err != nil {
-			log.Printf("Failed to update crawl data for %s: %v", baseURL, err)
-		} else {
-			log.Printf("Finished crawling: %s", baseURL)
+		scraped = true
+
+		// Skip the remaining checks when the crawl was stopped or the page rejected
+		if ctx.Err() != nil || pageErr != nil {
+			return
+		}
+
+		// Run HTTPS and TLS checks against the final URL of the page
+		security, issues := checkSecurity(ctx, client, c.limiter, r.Request.URL, mixedContent, offline)
+		if source != nil {
+			issues = append(issues, source.certificateIssues(security)...)
+		}
+		data.Security = security
+		for i := range issues {
+			addIssue(&issues[i])
+		}
+
+		// Measure page resources for the page-weight report
+		data.Resources = append(data.Resources, resources.measure(ctx, client)...)
+		resourceIssueList := resourceIssues(data.Resources)
+		for i := range resourceIssueList {
+			addIssue(&resourceIssueList[i])
 		}
 	})
 
 	// Set up error handler
 	collector.OnError(func(r *colly.Response, err error) {
-		if dbErr := repo.UpdateCrawlResultStatus(userID, baseURL, "error"); dbErr != nil {
-			log.Printf("Failed to update error status for %s: %v", baseURL, dbErr)
+		// Cancellation is handled once the collector has stopped
+		if ctx.Err() != nil {
+			return
+		}
+		// Keep the reason a page was aborted after its headers
+		if pageErr == nil {
+			pageErr = classifyError(err, r.StatusCode)
 		}
-		log.Printf("Error crawling %s: %v", baseURL, err)
+		log.Printf("Error crawling %s: %v", baseURL, pageErr)
 	})
 
+	// Store everything collected in a single write
+	save := func() error {
+		return repo.SavePageResult(runID, &models.PageResult{Data: data, Snapshot: snapshot})
+	}
+
 	// Start crawling
-	if err := collector.Visit(baseURL); err != nil {
+	if err := collector.Visit(baseURL); err != nil && ctx.Err() == nil {
 		log.Printf("Failed to start crawling %s: %v", baseURL, err)
-		if dbErr := repo.UpdateCrawlResultStatus(userID, baseURL, "error"); dbErr != nil {
+		crawlErr := classifyError(err, 0)
+		data.Status = "error"
+		data.ErrorClass = sql.NullString{String: crawlErr.Class, Valid: true}
+		data.ErrorMessage = sql.NullString{String: crawlErr.Err.Error(), Valid: true}
+		if dbErr := save(); dbErr != nil {
 			log.Printf("Failed to update error status for %s: %v", baseURL, dbErr)
 		}
-		return err
+		progress.status("error")
+		return crawlErr
 	}
 
 	collector.Wait()
+
+	// Store the result once every link has been checked
+	linkChecks.Wait()
+
+	// Keep whatever was collected before the crawl was stopped or interrupted
+	if ctx.Err() != nil {
+		data.Status = "stopped"
+		if errors.Is(context.Cause(ctx), ErrInterrupted) {
+			data.Status = "interrupted"
+		}
+		if err := save(); err != nil {
+			log.Printf("Failed to store partial crawl data for %s: %v", baseURL, err)
+		} else {
+			log.Printf("Crawling %s: %s", data.Status, baseURL)
+		}
+		progress.status(data.Status)
+		return context.Cause(ctx)
+	}
+
+	if pageErr != nil {
+		data.Status = "error"
+		data.ErrorClass = sql.NullString{String: pageErr.Class, Valid: true}
+		data.ErrorMessage = sql.NullString{String: pageErr.Err.Error(), Valid: true}
+		if err := save(); err != nil {
+			log.Printf("Failed to update error status for %s: %v", baseURL, err)
+		}
+		progress.status("error")
+		return pageErr
+	}
+
+	if scraped {
+		data.Status = "done"
+		if err := save(); err != nil {
+			log.Printf("Failed to update crawl data for %s: %v", baseURL, err)
+		} else {
+			log.Printf("Finished crawling: %s", baseURL)
+		}
+		progress.status(data.Status)
+	}
+
 	return nil
-} 
\ No newline at end of file
+}
@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"fmt"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// DiffRuns compares two runs of the same page. Both runs must carry their
+// links and headings. Links are matched by URL and headings by level and
+// text, so reordering a page is not reported as a change.
+func DiffRuns(from, to *models.CrawlRun) *models.RunDiff {
+	diff := &models.RunDiff{
+		From:              runRef(from),
+		To:                runRef(to),
+		Status:            valueChange(from.CrawlData.Status, to.CrawlData.Status),
+		Title:             valueChange(from.CrawlData.Title.String, to.CrawlData.Title.String),
+		MetaDescription:   valueChange(from.CrawlData.MetaDescription.String, to.CrawlData.MetaDescription.String),
+		HTMLVersion:       valueChange(from.CrawlData.HTMLVersion.String, to.CrawlData.HTMLVersion.String),
+		HeadingsAdded:     headingsMissing(to.CrawlData.HeadingDetails, from.CrawlData.HeadingDetails),
+		HeadingsRemoved:   headingsMissing(from.CrawlData.HeadingDetails, to.CrawlData.HeadingDetails),
+		LinksAdded:        []models.LinkData{},
+		LinksRemoved:      []models.LinkData{},
+		LinkStatusChanges: []models.LinkStatusChange{},
+		NewBrokenLinks:    []models.LinkData{},
+	}
+
+	fromLinks := linksByURL(from.CrawlData.Links)
+	toLinks := linksByURL(to.CrawlData.Links)
+
+	for _, link := range uniqueLinks(to.CrawlData.Links) {
+		old, found := fromLinks[link.URL]
+		if !found {
+			diff.LinksAdded = append(diff.LinksAdded, link)
+		}
+		if isBroken(link) && (!found || !isBroken(old)) {
+			diff.NewBrokenLinks = append(diff.NewBrokenLinks, link)
+		}
+		// Links left unchecked by either run have no status to compare
+		if found && isChecked(old) && isChecked(link) &&
+			(old.StatusCode != link.StatusCode || old.IsAccessible != link.IsAccessible) {
+			diff.LinkStatusChanges = append(diff.LinkStatusChanges, models.LinkStatusChange{
+				URL:            link.URL,
+				Text:           link.Text,
+				Type:           link.Type,
+				FromStatusCode: old.StatusCode,
+				ToStatusCode:   link.StatusCode,
+				FromAccessible: old.IsAccessible,
+				ToAccessible:   link.IsAccessible,
+			})
+		}
+	}
+	for _, link := range uniqueLinks(from.CrawlData.Links) {
+		if _, found := toLinks[link.URL]; !found {
+			diff.LinksRemoved = append(diff.LinksRemoved, link)
+		}
+	}
+
+	diff.Summary = summarizeDiff(diff)
+	return diff
+}
+
+// runRef returns the reference to a run used in a diff
+func runRef(run *models.CrawlRun) models.RunRef {
+	return models.RunRef{
+		ID:         run.ID,
+		Type:       run.Type,
+		Status:     run.CrawlData.Status,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+	}
+}
+
+// valueChange returns the change between two field values, or nil when they are equal
+func valueChange(from, to string) *models.ValueChange {
+	if from == to {
+		return nil
+	}
+	return &models.ValueChange{From: from, To: to}
+}
+
+// headingsMissing returns the headings of a that are not in b. Repeated
+// headings are counted, so a heading appearing twice where it appeared once
+// is reported once.
+func headingsMissing(a, b []models.HeadingData) []models.HeadingData {
+	counts := make(map[string]int)
+	for _, heading := range b {
+		counts[heading.Level+"\x00"+heading.Text]++
+	}
+
+	missing := []models.HeadingData{}
+	for _, heading := range a {
+		key := heading.Level + "\x00" + heading.Text
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		missing = append(missing, heading)
+	}
+	return missing
+}
+
+// uniqueLinks returns the first occurrence of every link URL, in page order
+func uniqueLinks(links []models.LinkData) []models.LinkData {
+	seen := make(map[string]bool)
+	unique := make([]models.LinkData, 0, len(links))
+	for _, link := range links {
+		if !seen[link.URL] {
+			seen[link.URL] = true
+			unique = append(unique, link)
+		}
+	}
+	return unique
+}
+
+// linksByURL indexes links by URL, keeping the first occurrence of each
+func linksByURL(links []models.LinkData) map[string]models.LinkData {
+	index := make(map[string]models.LinkData)
+	for _, link := range uniqueLinks(links) {
+		index[link.URL] = link
+	}
+	return index
+}
+
+// isChecked reports whether a link was checked, unchecked links have neither
+// a status code nor a failure
+func isChecked(link models.LinkData) bool {
+	return link.StatusCode != 0 || !link.IsAccessible
+}
+
+// isBroken reports whether a link was found inaccessible
+func isBroken(link models.LinkData) bool {
+	return !link.IsAccessible
+}
+
+// summarizeDiff describes a diff in plain sentences
+func summarizeDiff(diff *models.RunDiff) []string {
+	summary := []string{}
+	if diff.Status != nil {
+		summary = append(summary, fmt.Sprintf("Crawl status changed from %q to %q.", diff.Status.From, diff.Status.To))
+	}
+	if n := len(diff.NewBrokenLinks); n > 0 {
+		summary = append(summary, fmt.Sprintf("%s became broken.", countNoun(n, "link")))
+	}
+	if diff.Title != nil {
+		summary = append(summary, fmt.Sprintf("Title changed from %q to %q.", diff.Title.From, diff.Title.To))
+	}
+	if diff.MetaDescription != nil {
+		summary = append(summary, describeChange("Meta description", diff.MetaDescription))
+	}
+	if diff.HTMLVersion != nil {
+		summary = append(summary, fmt.Sprintf("HTML version changed from %q to %q.", diff.HTMLVersion.From, diff.HTMLVersion.To))
+	}
+	if added, removed := len(diff.HeadingsAdded), len(diff.HeadingsRemoved); added > 0 || removed > 0 {
+		summary = append(summary, fmt.Sprintf("%s added, %d removed.", countNoun(added, "heading"), removed))
+	}
+	if added, removed := len(diff.LinksAdded), len(diff.LinksRemoved); added > 0 || removed > 0 {
+		summary = append(summary, fmt.Sprintf("%s added, %d removed.", countNoun(added, "link"), removed))
+	}
+	if n := len(diff.LinkStatusChanges); n > 0 {
+		summary = append(summary, fmt.Sprintf("%s changed status.", countNoun(n, "link")))
+	}
+	if len(summary) == 0 {
+		summary = append(summary, "No changes.")
+	}
+	return summary
+}
+
+// describeChange describes a change of a field too long to quote in full
+func describeChange(field string, change *models.ValueChange) string {
+	switch {
+	case change.From == "":
+		return field + " was added."
+	case change.To == "":
+		return field + " was removed."
+	default:
+		return field + " changed."
+	}
+}
+
+// countNoun formats a count with a noun, pluralized when needed
+func countNoun(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
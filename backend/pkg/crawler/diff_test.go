@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// testRun builds a completed run with the given title, headings and links
+func testRun(id int, title string, headings []models.HeadingData, links []models.LinkData) *models.CrawlRun {
+	return &models.CrawlRun{
+		ID:   id,
+		Type: models.JobTypeCrawl,
+		CrawlData: models.CrawlData{
+			Status:         "completed",
+			Title:          sql.NullString{String: title, Valid: title != ""},
+			HeadingDetails: headings,
+			Links:          links,
+		},
+	}
+}
+
+func TestDiffRuns(t *testing.T) {
+	from := testRun(1, "Old title",
+		[]models.HeadingData{{Level: "h1", Text: "Welcome"}, {Level: "h2", Text: "News"}},
+		[]models.LinkData{
+			{URL: "https://example.com/a", Type: "internal", StatusCode: 200, IsAccessible: true},
+			{URL: "https://example.com/b", Type: "internal", StatusCode: 200, IsAccessible: true},
+			{URL: "https://example.com/gone", Type: "internal", StatusCode: 200, IsAccessible: true},
+			{URL: "https://example.org/", Type: "external", IsAccessible: true},
+		})
+	to := testRun(2, "New title",
+		// Reordered headings are not a change, a repeated one is
+		[]models.HeadingData{{Level: "h2", Text: "News"}, {Level: "h1", Text: "Welcome"}, {Level: "h2", Text: "News"}},
+		[]models.LinkData{
+			{URL: "https://example.com/b", Type: "internal", StatusCode: 404, IsAccessible: false},
+			{URL: "https://example.com/a", Type: "internal", StatusCode: 301, IsAccessible: true},
+			{URL: "https://example.com/a", Type: "internal", StatusCode: 301, IsAccessible: true},
+			{URL: "https://example.com/new", Type: "internal", StatusCode: 500, IsAccessible: false},
+			{URL: "https://example.org/", Type: "external", StatusCode: 200, IsAccessible: true},
+		})
+
+	diff := DiffRuns(from, to)
+
+	if diff.From.ID != 1 || diff.To.ID != 2 {
+		t.Errorf("diff of runs %d and %d", diff.From.ID, diff.To.ID)
+	}
+	if diff.Status != nil {
+		t.Errorf("Status = %+v, want no change", diff.Status)
+	}
+	if want := (&models.ValueChange{From: "Old title", To: "New title"}); !reflect.DeepEqual(diff.Title, want) {
+		t.Errorf("Title = %+v, want %+v", diff.Title, want)
+	}
+	if diff.MetaDescription != nil {
+		t.Errorf("MetaDescription = %+v, want no change", diff.MetaDescription)
+	}
+
+	if want := []models.HeadingData{{Level: "h2", Text: "News"}}; !reflect.DeepEqual(diff.HeadingsAdded, want) {
+		t.Errorf("HeadingsAdded = %+v, want %+v", diff.HeadingsAdded, want)
+	}
+	if len(diff.HeadingsRemoved) != 0 {
+		t.Errorf("HeadingsRemoved = %+v, want none", diff.HeadingsRemoved)
+	}
+
+	if got := linkURLs(diff.LinksAdded); !reflect.DeepEqual(got, []string{"https://example.com/new"}) {
+		t.Errorf("LinksAdded = %v", got)
+	}
+	if got := linkURLs(diff.LinksRemoved); !reflect.DeepEqual(got, []string{"https://example.com/gone"}) {
+		t.Errorf("LinksRemoved = %v", got)
+	}
+	if got := linkURLs(diff.NewBrokenLinks); !reflect.DeepEqual(got, []string{"https://example.com/b", "https://example.com/new"}) {
+		t.Errorf("NewBrokenLinks = %v", got)
+	}
+
+	// The external link was not checked by the first run, so it has no status change
+	wantChanges := []models.LinkStatusChange{
+		{URL: "https://example.com/b", Type: "internal", FromStatusCode: 200, ToStatusCode: 404, FromAccessible: true, ToAccessible: false},
+		{URL: "https://example.com/a", Type: "internal", FromStatusCode: 200, ToStatusCode: 301, FromAccessible: true, ToAccessible: true},
+	}
+	if !reflect.DeepEqual(diff.LinkStatusChanges, wantChanges) {
+		t.Errorf("LinkStatusChanges = %+v, want %+v", diff.LinkStatusChanges, wantChanges)
+	}
+
+	wantSummary := []string{
+		"2 links became broken.",
+		`Title changed from "Old title" to "New title".`,
+		"1 heading added, 0 removed.",
+		"1 link added, 1 removed.",
+		"2 links changed status.",
+	}
+	if !reflect.DeepEqual(diff.Summary, wantSummary) {
+		t.Errorf("Summary = %q, want %q", diff.Summary, wantSummary)
+	}
+}
+
+func TestDiffRunsUnchanged(t *testing.T) {
+	links := []models.LinkData{{URL: "https://example.com/a", StatusCode: 200, IsAccessible: true}}
+	headings := []models.HeadingData{{Level: "h1", Text: "Welcome"}}
+
+	diff := DiffRuns(testRun(1, "Same", headings, links), testRun(2, "Same", headings, links))
+	if !reflect.DeepEqual(diff.Summary, []string{"No changes."}) {
+		t.Errorf("Summary = %q, want no changes", diff.Summary)
+	}
+	// Empty lists are encoded as [] rather than null
+	if diff.LinksAdded == nil || diff.LinksRemoved == nil || diff.NewBrokenLinks == nil ||
+		diff.LinkStatusChanges == nil || diff.HeadingsAdded == nil || diff.HeadingsRemoved == nil {
+		t.Errorf("diff of identical runs has nil lists: %+v", diff)
+	}
+}
+
+func TestDescribeChange(t *testing.T) {
+	tests := []struct {
+		change models.ValueChange
+		want   string
+	}{
+		{change: models.ValueChange{From: "", To: "A page"}, want: "Meta description was added."},
+		{change: models.ValueChange{From: "A page", To: ""}, want: "Meta description was removed."},
+		{change: models.ValueChange{From: "A page", To: "Another page"}, want: "Meta description changed."},
+	}
+
+	for _, tt := range tests {
+		if got := describeChange("Meta description", &tt.change); got != tt.want {
+			t.Errorf("describeChange(%+v) = %q, want %q", tt.change, got, tt.want)
+		}
+	}
+}
+
+func linkURLs(links []models.LinkData) []string {
+	urls := []string{}
+	for _, link := range links {
+		urls = append(urls, link.URL)
+	}
+	return urls
+}
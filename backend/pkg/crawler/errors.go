@@ -0,0 +1,107 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Error classes recorded when a crawl fails
+const (
+	ErrorClassDNS               = "dns"
+	ErrorClassConnectionRefused = "connection_refused"
+	ErrorClassTimeout           = "timeout"
+	ErrorClassTLS               = "tls"
+	ErrorClassHTTP4xx           = "http_4xx"
+	ErrorClassHTTP5xx           = "http_5xx"
+	ErrorClassBodyTooLarge      = "body_too_large"
+	ErrorClassUnknown           = "unknown"
+)
+
+// ErrInterrupted is the cancellation cause of crawls cut short by a shutdown.
+// Such crawls are recorded as interrupted rather than stopped.
+var ErrInterrupted = errors.New("crawl interrupted by shutdown")
+
+// maxPageSize caps the size of a crawled page
+const maxPageSize = 10 << 20
+
+// CrawlError is a classified crawl failure
+type CrawlError struct {
+	Class      string
+	StatusCode int
+	Err        error
+}
+
+// Error returns the class and the underlying message
+func (e *CrawlError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Class, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *CrawlError) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether retrying the crawl later may succeed
+func (e *CrawlError) Transient() bool {
+	switch e.Class {
+	case ErrorClassTimeout, ErrorClassConnectionRefused, ErrorClassHTTP5xx:
+		return true
+	case ErrorClassHTTP4xx:
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+	case ErrorClassDNS:
+		var dnsErr *net.DNSError
+		return errors.As(e.Err, &dnsErr) && !dnsErr.IsNotFound
+	}
+	return false
+}
+
+// classifyError turns a failed page fetch into a CrawlError. statusCode is the
+// HTTP status of the response, or 0 when none was received.
+func classifyError(err error, statusCode int) *CrawlError {
+	var crawlErr *CrawlError
+	if errors.As(err, &crawlErr) {
+		return crawlErr
+	}
+
+	classified := &CrawlError{Class: ErrorClassUnknown, StatusCode: statusCode, Err: err}
+
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCertErr x509.CertificateInvalidError
+
+	switch {
+	case statusCode >= 500:
+		classified.Class = ErrorClassHTTP5xx
+	case statusCode >= 400:
+		classified.Class = ErrorClassHTTP4xx
+	case errors.As(err, &dnsErr):
+		classified.Class = ErrorClassDNS
+		if dnsErr.IsTimeout {
+			classified.Class = ErrorClassTimeout
+		}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		classified.Class = ErrorClassConnectionRefused
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr), errors.As(err, &invalidCertErr),
+		strings.Contains(err.Error(), "tls: "):
+		classified.Class = ErrorClassTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		classified.Class = ErrorClassTimeout
+	}
+
+	return classified
+}
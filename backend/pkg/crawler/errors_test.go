@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	dialErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: err}}
+	}
+	classified := &CrawlError{Class: ErrorClassBodyTooLarge, Err: errors.New("page larger than 10 MiB")}
+
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		want       string
+	}{
+		{name: "server error", err: errors.New("Internal Server Error"), statusCode: 503, want: ErrorClassHTTP5xx},
+		{name: "client error", err: errors.New("Not Found"), statusCode: 404, want: ErrorClassHTTP4xx},
+		{name: "unknown host", err: dialErr(&net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}), want: ErrorClassDNS},
+		{name: "dns timeout", err: dialErr(&net.DNSError{Err: "i/o timeout", Name: "slow.example", IsTimeout: true}), want: ErrorClassTimeout},
+		{name: "connection refused", err: dialErr(os.NewSyscallError("connect", syscall.ECONNREFUSED)), want: ErrorClassConnectionRefused},
+		{name: "unknown authority", err: dialErr(x509.UnknownAuthorityError{}), want: ErrorClassTLS},
+		{name: "tls record header", err: dialErr(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), want: ErrorClassTLS},
+		{name: "context deadline", err: fmt.Errorf("fetch: %w", context.DeadlineExceeded), want: ErrorClassTimeout},
+		{name: "read deadline", err: dialErr(os.ErrDeadlineExceeded), want: ErrorClassTimeout},
+		{name: "already classified", err: fmt.Errorf("crawl: %w", classified), want: ErrorClassBodyTooLarge},
+		{name: "unknown", err: errors.New("something else"), want: ErrorClassUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyError(tt.err, tt.statusCode)
+			if got.Class != tt.want {
+				t.Errorf("classifyError(%v, %d) class = %q, want %q", tt.err, tt.statusCode, got.Class, tt.want)
+			}
+			if !errors.Is(got, tt.err) && !errors.Is(tt.err, got) {
+				t.Errorf("classifyError(%v, %d) lost the original error", tt.err, tt.statusCode)
+			}
+		})
+	}
+}
+
+func TestCrawlErrorTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *CrawlError
+		want bool
+	}{
+		{name: "timeout", err: &CrawlError{Class: ErrorClassTimeout}, want: true},
+		{name: "connection refused", err: &CrawlError{Class: ErrorClassConnectionRefused}, want: true},
+		{name: "server error", err: &CrawlError{Class: ErrorClassHTTP5xx, StatusCode: 502}, want: true},
+		{name: "too many requests", err: &CrawlError{Class: ErrorClassHTTP4xx, StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "request timeout", err: &CrawlError{Class: ErrorClassHTTP4xx, StatusCode: http.StatusRequestTimeout}, want: true},
+		{name: "not found", err: &CrawlError{Class: ErrorClassHTTP4xx, StatusCode: http.StatusNotFound}, want: false},
+		{name: "temporary dns failure", err: &CrawlError{Class: ErrorClassDNS, Err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}, want: true},
+		{name: "unknown host", err: &CrawlError{Class: ErrorClassDNS, Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, want: false},
+		{name: "tls", err: &CrawlError{Class: ErrorClassTLS}, want: false},
+		{name: "body too large", err: &CrawlError{Class: ErrorClassBodyTooLarge}, want: false},
+		{name: "unknown", err: &CrawlError{Class: ErrorClassUnknown}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Transient(); got != tt.want {
+				t.Errorf("Transient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
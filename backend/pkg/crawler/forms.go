@@ -0,0 +1,216 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// Form types assigned by classifyForm
+const (
+	FormTypeLogin      = "login"
+	FormTypeSignup     = "signup"
+	FormTypeSearch     = "search"
+	FormTypeContact    = "contact"
+	FormTypeNewsletter = "newsletter"
+	FormTypePayment    = "payment"
+	FormTypeOther      = "other"
+)
+
+// Keywords looked up in the words of the form action URL, per form type. A
+// hyphenated keyword matches its words in sequence.
+var (
+	loginActionKeywords      = []string{"login", "log-in", "signin", "sign-in", "session"}
+	signupActionKeywords     = []string{"signup", "sign-up", "register", "registration", "join", "create-account"}
+	searchActionKeywords     = []string{"search", "find"}
+	contactActionKeywords    = []string{"contact", "feedback", "enquiry", "inquiry", "support"}
+	newsletterActionKeywords = []string{"subscribe", "newsletter", "mailing-list", "list-manage"}
+	paymentActionKeywords    = []string{"checkout", "payment", "pay", "billing", "order"}
+	// cardSelectKeywords are looked up in the names of select fields
+	cardSelectKeywords = []string{"exp", "expiry", "expiration", "card"}
+)
+
+// formSignals counts the form fields that hint at the purpose of a form
+type formSignals struct {
+	inputs           int
+	textInputs       int
+	passwords        int
+	newPasswords     int
+	currentPasswords int
+	emails           int
+	searchInputs     int
+	textareas        int
+	paymentInputs    int
+	selects          int
+	passwordNoHint   bool
+}
+
+// classifyForm inspects a form element and determines what kind of form it is.
+// The classification is based on input types, autocomplete attributes and the
+// action URL, in that order of precedence.
+func classifyForm(e *colly.HTMLElement, pageURL *url.URL) models.FormData {
+	signals := collectFormSignals(e)
+
+	action := e.Request.AbsoluteURL(e.Attr("action"))
+	if strings.TrimSpace(e.Attr("action")) == "" {
+		action = pageURL.String()
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(e.Attr("method")))
+	if method == "" {
+		method = "GET"
+	}
+
+	form := models.FormData{
+		Action:                      action,
+		Method:                      method,
+		InputCount:                  signals.inputs,
+		HasPassword:                 signals.passwords > 0,
+		PasswordMissingAutocomplete: signals.passwordNoHint,
+	}
+
+	actionURL, err := url.Parse(action)
+	if err == nil && pageURL.Scheme == "https" && actionURL.Scheme == "http" {
+		form.InsecureAction = true
+	}
+
+	var actionPath []string
+	if err == nil {
+		actionPath = actionWords(actionURL.Path + "?" + actionURL.RawQuery)
+	}
+
+	switch {
+	case signals.paymentInputs > 0 || (signals.passwords == 0 && hasKeyword(actionPath, paymentActionKeywords)):
+		form.Type = FormTypePayment
+	case signals.newPasswords > 0 || signals.passwords > 1 || (signals.passwords > 0 && hasKeyword(actionPath, signupActionKeywords)):
+		form.Type = FormTypeSignup
+	case signals.passwords > 0 || signals.currentPasswords > 0 || hasKeyword(actionPath, loginActionKeywords):
+		form.Type = FormTypeLogin
+	case signals.searchInputs > 0 || strings.EqualFold(e.Attr("role"), "search") || hasKeyword(actionPath, searchActionKeywords) ||
+		(signals.selects > 0 && signals.textInputs == 1 && signals.emails == 0 && method == "GET"):
+		form.Type = FormTypeSearch
+	case signals.textareas > 0 || hasKeyword(actionPath, contactActionKeywords):
+		form.Type = FormTypeContact
+	case (signals.emails > 0 && signals.textInputs <= 1) || hasKeyword(actionPath, newsletterActionKeywords):
+		form.Type = FormTypeNewsletter
+	case hasKeyword(actionPath, signupActionKeywords):
+		form.Type = FormTypeSignup
+	default:
+		form.Type = FormTypeOther
+	}
+
+	return form
+}
+
+// collectFormSignals walks the fields of a form and counts the hints they carry
+func collectFormSignals(e *colly.HTMLElement) formSignals {
+	var s formSignals
+
+	e.ForEach("input", func(_ int, input *colly.HTMLElement) {
+		inputType := strings.ToLower(strings.TrimSpace(input.Attr("type")))
+		if inputType == "" {
+			inputType = "text"
+		}
+		if inputType == "hidden" || inputType == "submit" || inputType == "button" ||
+			inputType == "reset" || inputType == "image" {
+			return
+		}
+		s.inputs++
+
+		autocomplete := autocompleteField(input.Attr("autocomplete"))
+		switch {
+		case strings.HasPrefix(autocomplete, "cc-"):
+			s.paymentInputs++
+		case autocomplete == "new-password":
+			s.newPasswords++
+		case autocomplete == "current-password":
+			s.currentPasswords++
+		}
+
+		switch inputType {
+		case "password":
+			s.passwords++
+			if autocomplete == "" {
+				s.passwordNoHint = true
+			}
+		case "email":
+			s.emails++
+		case "search":
+			s.searchInputs++
+		case "text", "tel", "url", "number":
+			if autocomplete == "email" {
+				s.emails++
+			} else {
+				s.textInputs++
+			}
+		}
+	})
+
+	e.ForEach("textarea", func(_ int, _ *colly.HTMLElement) {
+		s.inputs++
+		s.textareas++
+	})
+
+	// Card expiry dates are usually picked from lists, filters of search forms too
+	e.ForEach("select", func(_ int, sel *colly.HTMLElement) {
+		s.inputs++
+		s.selects++
+		if strings.HasPrefix(autocompleteField(sel.Attr("autocomplete")), "cc-") ||
+			hasKeyword(actionWords(sel.Attr("name")), cardSelectKeywords) {
+			s.paymentInputs++
+		}
+	})
+
+	return s
+}
+
+// autocompleteField returns the field name of an autocomplete attribute,
+// dropping section, shipping/billing and contact-type tokens
+func autocompleteField(value string) string {
+	tokens := strings.Fields(strings.ToLower(value))
+	if len(tokens) == 0 {
+		return ""
+	}
+	return tokens[len(tokens)-1]
+}
+
+// actionWords splits a URL path or field name into its lowercase words
+func actionWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// hasKeyword reports whether words contain any of the given keywords, the
+// words of a hyphenated keyword in sequence, each word possibly plural
+func hasKeyword(words []string, keywords []string) bool {
+	for _, keyword := range keywords {
+		parts := strings.Split(keyword, "-")
+		for i := 0; i+len(parts) <= len(words); i++ {
+			match := true
+			for j, part := range parts {
+				if word := words[i+j]; word != part && word != part+"s" {
+					match = false
+					break
+				}
+			}
+			if match {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsAny reports whether s contains any of the given keywords
+func containsAny(s string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(s, keyword) {
+			return true
+		}
+	}
+	return false
+}
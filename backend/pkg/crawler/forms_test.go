@@ -0,0 +1,159 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// formElement parses markup holding a form served from pageURL
+func formElement(t *testing.T, pageURL *url.URL, markup string) *colly.HTMLElement {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(markup))
+	if err != nil {
+		t.Fatalf("failed to parse markup: %v", err)
+	}
+	form := doc.Find("form").First()
+	if form.Length() == 0 {
+		t.Fatal("markup has no form")
+	}
+	resp := &colly.Response{Request: &colly.Request{URL: pageURL}}
+	return colly.NewHTMLElementFromSelectionNode(resp, form, form.Nodes[0], 0)
+}
+
+func TestClassifyForm(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/page")
+
+	tests := []struct {
+		name   string
+		markup string
+		want   string
+	}{
+		{
+			name:   "login by password field",
+			markup: `<form action="/account" method="post"><input name="user"><input type="password" autocomplete="current-password"></form>`,
+			want:   FormTypeLogin,
+		},
+		{
+			name:   "signup by new password",
+			markup: `<form action="/account" method="post"><input type="email"><input type="password" autocomplete="new-password"></form>`,
+			want:   FormTypeSignup,
+		},
+		{
+			name:   "signup by two passwords",
+			markup: `<form method="post"><input type="password" autocomplete="off"><input type="password" autocomplete="off"></form>`,
+			want:   FormTypeSignup,
+		},
+		{
+			name:   "login by hyphenated action keyword",
+			markup: `<form action="/users/sign-in" method="post"><input name="user"></form>`,
+			want:   FormTypeLogin,
+		},
+		{
+			name:   "search input",
+			markup: `<form action="/" method="get"><input type="search" name="q"></form>`,
+			want:   FormTypeSearch,
+		},
+		{
+			name:   "search with a category select",
+			markup: `<form action="/products" method="get"><input name="q"><select name="category"><option>All</option></select></form>`,
+			want:   FormTypeSearch,
+		},
+		{
+			name:   "contact by textarea",
+			markup: `<form action="/send" method="post"><input name="name"><input type="email"><textarea></textarea></form>`,
+			want:   FormTypeContact,
+		},
+		{
+			name:   "newsletter by single email",
+			markup: `<form action="/send" method="post"><input type="email" name="email"></form>`,
+			want:   FormTypeNewsletter,
+		},
+		{
+			name:   "payment by card autocomplete",
+			markup: `<form action="/step" method="post"><input autocomplete="cc-number"><input autocomplete="cc-csc"></form>`,
+			want:   FormTypePayment,
+		},
+		{
+			name:   "payment by card expiry selects",
+			markup: `<form action="/step" method="post"><input name="holder"><input name="holder2"><select name="exp_month"></select><select name="exp_year"></select></form>`,
+			want:   FormTypePayment,
+		},
+		{
+			name:   "payment by plural action keyword",
+			markup: `<form action="/orders" method="post"><input name="address"><input name="city"></form>`,
+			want:   FormTypePayment,
+		},
+		{
+			name:   "pay is not matched inside display",
+			markup: `<form action="/display" method="post"><input name="a"><input name="b"></form>`,
+			want:   FormTypeOther,
+		},
+		{
+			name:   "order is not matched inside border-settings",
+			markup: `<form action="/border-settings" method="post"><input name="a"><input name="b"></form>`,
+			want:   FormTypeOther,
+		},
+		{
+			name:   "find is not matched inside findings",
+			markup: `<form action="/findings" method="post"><input name="a"><input name="b"></form>`,
+			want:   FormTypeOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := classifyForm(formElement(t, pageURL, tt.markup), pageURL)
+			if form.Type != tt.want {
+				t.Errorf("classifyForm() type = %q, want %q", form.Type, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyFormDetails(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/login")
+
+	form := classifyForm(formElement(t, pageURL,
+		`<form action="http://example.com/session"><input name="user"><input type="password"><select name="lang"></select><input type="hidden"></form>`,
+	), pageURL)
+
+	if form.Action != "http://example.com/session" {
+		t.Errorf("Action = %q", form.Action)
+	}
+	if form.Method != "GET" {
+		t.Errorf("Method = %q, want GET", form.Method)
+	}
+	if form.InputCount != 3 {
+		t.Errorf("InputCount = %d, want 3", form.InputCount)
+	}
+	if !form.HasPassword || !form.PasswordMissingAutocomplete || !form.InsecureAction {
+		t.Errorf("HasPassword, PasswordMissingAutocomplete and InsecureAction should be set: %+v", form)
+	}
+}
+
+func TestHasKeyword(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"/checkout", true},
+		{"/api/payments/new", true},
+		{"/create-account", true},
+		{"/create/account", true},
+		{"/account/create", false},
+		{"/display", false},
+		{"/border-settings", false},
+		{"/Checkout?step=2", true},
+	}
+
+	keywords := append(append([]string{}, paymentActionKeywords...), "create-account")
+	for _, tt := range tests {
+		if got := hasKeyword(actionWords(tt.s), keywords); got != tt.want {
+			t.Errorf("hasKeyword(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
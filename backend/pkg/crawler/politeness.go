@@ -0,0 +1,317 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// userAgent is colly's default user agent, used to pick the robots.txt group
+// that applies to the crawler
+const userAgent = "colly - https://github.com/gocolly/colly/v2"
+
+// requestTimeout bounds a single request once the host limiter lets it start
+const requestTimeout = 10 * time.Second
+
+// robotsTTL is how long the Crawl-delay of a host is cached
+const robotsTTL = time.Hour
+
+// maxRobotsSize caps how much of a robots.txt file is read
+const maxRobotsSize = 512 << 10
+
+// maxCrawlDelay caps the Crawl-delay honored for a host, so a huge value
+// cannot stall crawls indefinitely
+const maxCrawlDelay = 30 * time.Second
+
+// Backoff applied to a host answering 429 or 503, doubled on every
+// consecutive throttled response without a Retry-After header
+const (
+	minBackoff = time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// maxIdleHosts is the number of tracked hosts above which idle ones are pruned
+const maxIdleHosts = 10000
+
+// hostLimiter spaces out and caps concurrent requests per host across every
+// crawl of the process
+type hostLimiter struct {
+	interval    time.Duration
+	concurrency int
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+// hostState tracks the request budget of a single host
+type hostState struct {
+	slots chan struct{}
+
+	mu           sync.Mutex
+	nextSlot     time.Time
+	blockedUntil time.Time
+	crawlDelay   time.Duration
+	backoff      time.Duration
+
+	robotsMu    sync.Mutex
+	robotsUntil time.Time
+}
+
+// newHostLimiter creates a limiter allowing requestsPerSecond requests and at
+// most concurrency requests in flight per host
+func newHostLimiter(requestsPerSecond float64, concurrency int) *hostLimiter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var interval time.Duration
+	if requestsPerSecond > 0 {
+		interval = time.Duration(float64(time.Second) / requestsPerSecond)
+	}
+	return &hostLimiter{
+		interval:    interval,
+		concurrency: concurrency,
+		hosts:       make(map[string]*hostState),
+	}
+}
+
+// Transport wraps next so that every request goes through the limiter
+func (l *hostLimiter) Transport(next http.RoundTripper) http.RoundTripper {
+	return &limitedTransport{limiter: l, next: next}
+}
+
+// do runs fn within the budget of a host, for connections made outside an
+// HTTP request such as the TLS certificate inspection
+func (l *hostLimiter) do(ctx context.Context, host string, fn func() error) error {
+	h := l.host(strings.ToLower(host))
+	if err := h.acquire(ctx, l.interval); err != nil {
+		return err
+	}
+	defer h.release()
+	return fn()
+}
+
+// host returns the state of a host, creating it on first use
+func (l *hostLimiter) host(name string) *hostState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if h, ok := l.hosts[name]; ok {
+		return h
+	}
+
+	if len(l.hosts) >= maxIdleHosts {
+		l.prune()
+	}
+
+	h := &hostState{slots: make(chan struct{}, l.concurrency)}
+	l.hosts[name] = h
+	return h
+}
+
+// prune forgets hosts with no request in flight or pending and no active
+// backoff. Callers must hold l.mu.
+func (l *hostLimiter) prune() {
+	now := time.Now()
+	for name, h := range l.hosts {
+		h.mu.Lock()
+		idle := len(h.slots) == 0 && h.nextSlot.Before(now) && h.blockedUntil.Before(now)
+		h.mu.Unlock()
+		if idle {
+			delete(l.hosts, name)
+		}
+	}
+}
+
+// acquire waits until a request to the host may start
+func (h *hostState) acquire(ctx context.Context, interval time.Duration) error {
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	h.mu.Lock()
+	start := time.Now()
+	if h.nextSlot.After(start) {
+		start = h.nextSlot
+	}
+	if h.blockedUntil.After(start) {
+		start = h.blockedUntil
+	}
+	gap := interval
+	if h.crawlDelay > gap {
+		gap = h.crawlDelay
+	}
+	h.nextSlot = start.Add(gap)
+	h.mu.Unlock()
+
+	wait := time.Until(start)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		<-h.slots
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire
+func (h *hostState) release() {
+	<-h.slots
+}
+
+// observe backs off the host when it answers 429 or 503
+func (h *hostState) observe(resp *http.Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		h.backoff = 0
+		return
+	}
+
+	delay := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if delay <= 0 {
+		h.backoff *= 2
+		if h.backoff < minBackoff {
+			h.backoff = minBackoff
+		}
+		delay = h.backoff
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	if until := time.Now().Add(delay); until.After(h.blockedUntil) {
+		h.blockedUntil = until
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// limitedTransport routes the requests of one crawl through the shared host limiter
+type limitedTransport struct {
+	limiter *hostLimiter
+	next    http.RoundTripper
+}
+
+// RoundTrip loads the Crawl-delay of the host if needed, then waits for the
+// host limiter before sending the request
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := t.limiter.host(strings.ToLower(req.URL.Host))
+	if req.URL.Path != "/robots.txt" {
+		t.loadRobots(req, host)
+	}
+	return t.send(req, host)
+}
+
+// send performs a request within the budget of its host. The slot is held
+// until the response body is closed.
+func (t *limitedTransport) send(req *http.Request, host *hostState) (*http.Response, error) {
+	if err := host.acquire(req.Context(), t.limiter.interval); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), requestTimeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		host.release()
+		return nil, err
+	}
+
+	host.observe(resp)
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() {
+		cancel()
+		host.release()
+	}}
+	return resp, nil
+}
+
+// loadRobots fetches the robots.txt of a host once per robotsTTL and records
+// its Crawl-delay
+func (t *limitedTransport) loadRobots(req *http.Request, host *hostState) {
+	host.robotsMu.Lock()
+	defer host.robotsMu.Unlock()
+
+	if time.Now().Before(host.robotsUntil) {
+		return
+	}
+
+	robotsReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet,
+		req.URL.Scheme+"://"+req.URL.Host+"/robots.txt", nil)
+	if err != nil {
+		return
+	}
+	robotsReq.Header.Set("User-Agent", userAgent)
+
+	resp, err := t.send(robotsReq, host)
+	if err != nil {
+		// Retry on the next request if the crawl was stopped, otherwise treat
+		// the host as having no robots.txt
+		if req.Context().Err() == nil {
+			host.robotsUntil = time.Now().Add(robotsTTL)
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	host.robotsUntil = time.Now().Add(robotsTTL)
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		return
+	}
+	robots, err := robotstxt.FromStatusAndBytes(resp.StatusCode, body)
+	if err != nil {
+		return
+	}
+
+	delay := robots.FindGroup(userAgent).CrawlDelay
+	if delay > maxCrawlDelay {
+		delay = maxCrawlDelay
+	}
+
+	host.mu.Lock()
+	host.crawlDelay = delay
+	host.mu.Unlock()
+}
+
+// releasingBody releases the host slot of a response when its body is closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the body and releases the host slot
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
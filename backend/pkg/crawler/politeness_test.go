@@ -0,0 +1,156 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 14, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "empty", value: "", want: 0},
+		{name: "seconds", value: "120", want: 2 * time.Minute},
+		{name: "seconds with spaces", value: " 5 ", want: 5 * time.Second},
+		{name: "http date", value: "Fri, 14 Mar 2025 10:31:30 GMT", want: 90 * time.Second},
+		{name: "http date in the past", value: "Fri, 14 Mar 2025 10:29:00 GMT", want: -time.Minute},
+		{name: "garbage", value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.value, now); got != tt.want {
+				t.Errorf("retryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostLimiterSpacing(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	limiter := newHostLimiter(float64(time.Second/interval), 3)
+	host := limiter.host("example.com")
+
+	var starts []time.Time
+	for i := 0; i < 3; i++ {
+		if err := host.acquire(context.Background(), limiter.interval); err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		starts = append(starts, time.Now())
+	}
+	for i := 1; i < len(starts); i++ {
+		// Timers may fire a little early on some platforms
+		if gap := starts[i].Sub(starts[i-1]); gap < interval-5*time.Millisecond {
+			t.Errorf("request %d started %s after the previous one, want at least %s", i, gap, interval)
+		}
+	}
+
+	// Every slot is taken until a request is released
+	ctx, cancel := context.WithTimeout(context.Background(), 2*interval)
+	defer cancel()
+	if err := host.acquire(ctx, limiter.interval); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("acquire with every slot taken error = %v, want DeadlineExceeded", err)
+	}
+	host.release()
+	if err := host.acquire(context.Background(), limiter.interval); err != nil {
+		t.Errorf("acquire after a release: %v", err)
+	}
+
+	// Other hosts have a budget of their own
+	other := limiter.host("example.org")
+	ctx, cancel = context.WithTimeout(context.Background(), interval/2)
+	defer cancel()
+	if err := other.acquire(ctx, limiter.interval); err != nil {
+		t.Errorf("acquire on another host: %v", err)
+	}
+}
+
+func TestHostLimiterCrawlDelay(t *testing.T) {
+	limiter := newHostLimiter(100, 1)
+	host := limiter.host("example.com")
+	host.crawlDelay = 3 * time.Second
+
+	before := time.Now()
+	if err := host.acquire(context.Background(), limiter.interval); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if next := host.nextSlot.Sub(before); next < host.crawlDelay {
+		t.Errorf("next request allowed after %s, want the Crawl-delay of %s", next, host.crawlDelay)
+	}
+}
+
+func TestHostStateBackoff(t *testing.T) {
+	throttled := func(retry string) *http.Response {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		if retry != "" {
+			resp.Header.Set("Retry-After", retry)
+		}
+		return resp
+	}
+	blockedFor := func(h *hostState) time.Duration {
+		return time.Until(h.blockedUntil).Round(time.Second)
+	}
+
+	var h hostState
+	h.observe(throttled(""))
+	h.observe(throttled(""))
+	if got := blockedFor(&h); got != 2*minBackoff {
+		t.Errorf("blocked for %s after two throttled responses, want %s", got, 2*minBackoff)
+	}
+
+	// Retry-After wins over the doubled backoff but is capped
+	h.observe(throttled("10"))
+	if got := blockedFor(&h); got != 10*time.Second {
+		t.Errorf("blocked for %s after Retry-After: 10, want 10s", got)
+	}
+	h.observe(&http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"86400"}}})
+	if got := blockedFor(&h); got != maxBackoff {
+		t.Errorf("blocked for %s after Retry-After: 86400, want %s", got, maxBackoff)
+	}
+
+	// A successful response resets the backoff, not the block
+	h.observe(&http.Response{StatusCode: http.StatusOK})
+	if h.backoff != 0 {
+		t.Errorf("backoff after a successful response = %s, want 0", h.backoff)
+	}
+	if got := blockedFor(&h); got != maxBackoff {
+		t.Errorf("blocked for %s after a successful response, want %s", got, maxBackoff)
+	}
+}
+
+func TestHostLimiterDo(t *testing.T) {
+	limiter := newHostLimiter(0, 1)
+
+	// A connection holds the slot of its host until it is done
+	inside := make(chan struct{})
+	done := make(chan struct{})
+	go limiter.do(context.Background(), "Example.com", func() error {
+		close(inside)
+		<-done
+		return nil
+	})
+	<-inside
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := limiter.do(ctx, "example.com", func() error {
+		t.Error("connection ran while another held the only slot")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("do with the slot taken error = %v, want DeadlineExceeded", err)
+	}
+
+	close(done)
+	wantErr := errors.New("handshake failed")
+	if err := limiter.do(context.Background(), "example.com", func() error { return wantErr }); err != wantErr {
+		t.Errorf("do after the slot was released error = %v, want %v", err, wantErr)
+	}
+}
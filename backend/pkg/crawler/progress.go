@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// EventSink receives the progress events of crawls
+type EventSink interface {
+	Publish(event models.CrawlEvent)
+}
+
+// progress counts the work done by a single crawl and publishes every change
+type progress struct {
+	sink          EventSink
+	userID        int
+	crawlResultID int
+	url           string
+
+	mu           sync.Mutex
+	pagesFetched int
+	linksFound   int
+	linksChecked int
+	linksFailed  int
+}
+
+// newProgress creates the progress tracker of a crawl. A nil sink discards events.
+func newProgress(sink EventSink, userID, crawlResultID int, url string) *progress {
+	return &progress{sink: sink, userID: userID, crawlResultID: crawlResultID, url: url}
+}
+
+// status publishes a status transition of the crawl
+func (p *progress) status(status string) {
+	p.publish(models.EventStatus, status, func() {})
+}
+
+// pageFetched records a fetched page
+func (p *progress) pageFetched() {
+	p.publish(models.EventPageFetched, "", func() { p.pagesFetched++ })
+}
+
+// linkFound records a link found on the page
+func (p *progress) linkFound() {
+	p.publish(models.EventLinkFound, "", func() { p.linksFound++ })
+}
+
+// linkChecked records a finished link check
+func (p *progress) linkChecked(failed bool) {
+	p.publish(models.EventLinkChecked, "", func() {
+		p.linksChecked++
+		if failed {
+			p.linksFailed++
+		}
+	})
+}
+
+// publish applies update to the counters and sends the resulting snapshot
+func (p *progress) publish(eventType, status string, update func()) {
+	if p.sink == nil {
+		return
+	}
+
+	p.mu.Lock()
+	update()
+	event := models.CrawlEvent{
+		Type:          eventType,
+		CrawlResultID: p.crawlResultID,
+		UserID:        p.userID,
+		URL:           p.url,
+		Status:        status,
+		PagesFetched:  p.pagesFetched,
+		LinksFound:    p.linksFound,
+		LinksChecked:  p.linksChecked,
+		LinksFailed:   p.linksFailed,
+		Time:          time.Now(),
+	}
+	// Publishing under the lock keeps events of a crawl in counter order
+	p.sink.Publish(event)
+	p.mu.Unlock()
+}
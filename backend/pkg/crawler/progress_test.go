@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// eventLog is an event sink keeping every event it receives
+type eventLog struct {
+	mu     sync.Mutex
+	events []models.CrawlEvent
+}
+
+func (l *eventLog) Publish(event models.CrawlEvent) {
+	l.mu.Lock()
+	l.events = append(l.events, event)
+	l.mu.Unlock()
+}
+
+func TestProgress(t *testing.T) {
+	sink := &eventLog{}
+	p := newProgress(sink, 3, 7, "https://example.com/")
+
+	p.status("running")
+	p.pageFetched()
+	p.linkFound()
+	p.linkFound()
+	p.linkChecked(false)
+	p.linkChecked(true)
+	p.status("done")
+
+	// counters lists the pages fetched, links found, checked and failed of an event
+	counters := func(e models.CrawlEvent) [4]int {
+		return [4]int{e.PagesFetched, e.LinksFound, e.LinksChecked, e.LinksFailed}
+	}
+	want := []struct {
+		eventType string
+		status    string
+		counters  [4]int
+	}{
+		{models.EventStatus, "running", [4]int{0, 0, 0, 0}},
+		{models.EventPageFetched, "", [4]int{1, 0, 0, 0}},
+		{models.EventLinkFound, "", [4]int{1, 1, 0, 0}},
+		{models.EventLinkFound, "", [4]int{1, 2, 0, 0}},
+		{models.EventLinkChecked, "", [4]int{1, 2, 1, 0}},
+		{models.EventLinkChecked, "", [4]int{1, 2, 2, 1}},
+		{models.EventStatus, "done", [4]int{1, 2, 2, 1}},
+	}
+	if len(sink.events) != len(want) {
+		t.Fatalf("%d events published, want %d", len(sink.events), len(want))
+	}
+	for i, w := range want {
+		e := sink.events[i]
+		if e.Type != w.eventType || e.Status != w.status || !reflect.DeepEqual(counters(e), w.counters) {
+			t.Errorf("event %d = %s %q %v, want %s %q %v", i, e.Type, e.Status, counters(e), w.eventType, w.status, w.counters)
+		}
+		if e.UserID != 3 || e.CrawlResultID != 7 || e.URL != "https://example.com/" || e.Time.IsZero() {
+			t.Errorf("event %d = %+v, want it from crawl result 7 of user 3", i, e)
+		}
+	}
+}
+
+func TestProgressConcurrentChecks(t *testing.T) {
+	sink := &eventLog{}
+	p := newProgress(sink, 1, 1, "https://example.com/")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(failed bool) {
+			defer wg.Done()
+			p.linkChecked(failed)
+		}(i%2 == 0)
+	}
+	wg.Wait()
+
+	// Events reach the sink in the order their counters were updated
+	for i, e := range sink.events {
+		if e.LinksChecked != i+1 {
+			t.Fatalf("event %d reports %d links checked, want %d", i, e.LinksChecked, i+1)
+		}
+	}
+	if last := sink.events[len(sink.events)-1]; last.LinksFailed != 25 {
+		t.Errorf("links failed = %d, want 25", last.LinksFailed)
+	}
+}
+
+func TestProgressWithoutSink(t *testing.T) {
+	// Crawls without events publish nowhere
+	p := newProgress(nil, 1, 1, "https://example.com/")
+	p.status("running")
+	p.pageFetched()
+	p.linkFound()
+	p.linkChecked(true)
+}
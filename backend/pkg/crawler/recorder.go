@@ -0,0 +1,209 @@
+package crawler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// Result is everything a crawl stores about a page, in a form that can be
+// sent over the network and written to a Repository later. Remote agents use
+// it to crawl without database access.
+type Result struct {
+	RunType           string                `json:"run_type"`
+	Status            string                `json:"status"`
+	HTMLVersion       *string               `json:"html_version,omitempty"`
+	Title             *string               `json:"title,omitempty"`
+	MetaDescription   *string               `json:"meta_description,omitempty"`
+	Headings          map[string]int        `json:"headings"`
+	InternalLinks     int                   `json:"internal_links"`
+	ExternalLinks     int                   `json:"external_links"`
+	InaccessibleLinks int                   `json:"inaccessible_links"`
+	HasLoginForm      bool                  `json:"has_login_form"`
+	HTMLSize          int64                 `json:"html_size"`
+	ErrorClass        string                `json:"error_class,omitempty"`
+	ErrorMessage      string                `json:"error_message,omitempty"`
+	Links             []models.LinkData     `json:"links"`
+	HeadingDetails    []models.HeadingData  `json:"heading_details"`
+	Forms             []models.FormData     `json:"forms"`
+	Security          *models.SecurityData  `json:"security,omitempty"`
+	Issues            []models.IssueData    `json:"issues"`
+	Resources         []models.ResourceData `json:"resources"`
+	BodyText          string                `json:"body_text,omitempty"`
+	Snapshot          *models.Snapshot      `json:"snapshot,omitempty"`
+	// SnapshotBody is the body of Snapshot, which leaves it out of its JSON
+	SnapshotBody []byte `json:"snapshot_body,omitempty"`
+}
+
+// ErrUnfinishedResult is returned when applying a result whose crawl did not
+// finish
+var ErrUnfinishedResult = errors.New("crawl result is not finished")
+
+// Recorder is a Repository keeping the writes of a single crawl in memory
+type Recorder struct {
+	crawlResultID int
+
+	mu     sync.Mutex
+	result Result
+}
+
+// NewRecorder creates a recorder for the crawl of a crawl result
+func NewRecorder(crawlResultID int) *Recorder {
+	return &Recorder{
+		crawlResultID: crawlResultID,
+		result: Result{
+			Status:         "pending",
+			Headings:       map[string]int{},
+			Links:          []models.LinkData{},
+			HeadingDetails: []models.HeadingData{},
+			Forms:          []models.FormData{},
+			Issues:         []models.IssueData{},
+			Resources:      []models.ResourceData{},
+		},
+	}
+}
+
+// Result returns a copy of everything recorded so far
+func (r *Recorder) Result() *Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := r.result
+	result.Links = append([]models.LinkData(nil), r.result.Links...)
+	return &result
+}
+
+// GetCrawlResultIDByURL returns the crawl result the recorder was created for
+func (r *Recorder) GetCrawlResultIDByURL(userID int, url string) (int, error) {
+	return r.crawlResultID, nil
+}
+
+// StartCrawlRun records the type of the run, the recorder holding a single one
+func (r *Recorder) StartCrawlRun(crawlResultID int, runType string, sourceRunID int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result.RunType = runType
+	return 1, nil
+}
+
+// UpdateCrawlResultStatus records a status change
+func (r *Recorder) UpdateCrawlResultStatus(userID int, url, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result.Status = status
+	return nil
+}
+
+// UpdateCrawlError records a failed crawl
+func (r *Recorder) UpdateCrawlError(userID int, url, errorClass, errorMessage string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result.Status = "error"
+	r.result.ErrorClass = errorClass
+	r.result.ErrorMessage = errorMessage
+	return nil
+}
+
+// SavePageResult records everything the crawl found on the page
+func (r *Recorder) SavePageResult(runID int, page *models.PageResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := page.Data
+	r.result.Status = data.Status
+	r.result.HTMLVersion = nullStringPtr(data.HTMLVersion)
+	r.result.Title = nullStringPtr(data.Title)
+	r.result.MetaDescription = nullStringPtr(data.MetaDescription)
+	r.result.Headings = data.Headings
+	r.result.InternalLinks = data.InternalLinks
+	r.result.ExternalLinks = data.ExternalLinks
+	r.result.InaccessibleLinks = data.InaccessibleLinks
+	r.result.HasLoginForm = data.HasLoginForm
+	r.result.HTMLSize = data.HTMLSize
+	r.result.ErrorClass = data.ErrorClass.String
+	r.result.ErrorMessage = data.ErrorMessage.String
+	r.result.Links = data.Links
+	r.result.HeadingDetails = data.HeadingDetails
+	r.result.Forms = data.Forms
+	r.result.Security = data.Security
+	r.result.Issues = data.Issues
+	r.result.Resources = data.Resources
+	r.result.BodyText = data.BodyText
+	r.result.Snapshot = page.Snapshot
+	r.result.SnapshotBody = nil
+	if page.Snapshot != nil {
+		r.result.SnapshotBody = page.Snapshot.Body
+	}
+	return nil
+}
+
+// Apply writes a finished result to repo the way a crawl run against repo
+// would have, as a new run of the crawl result. The run type is the one of the
+// job the result is for, the RunType recorded alongside is not trusted.
+func (res *Result) Apply(repo Repository, userID, crawlResultID int, url, runType string) error {
+	switch res.Status {
+	case "error", "done", "stopped", "interrupted":
+	default:
+		return fmt.Errorf("%w: status %q", ErrUnfinishedResult, res.Status)
+	}
+
+	runID, err := repo.StartCrawlRun(crawlResultID, runType, 0)
+	if err != nil {
+		return fmt.Errorf("failed to start crawl run: %w", err)
+	}
+
+	page := &models.PageResult{
+		Data: &models.CrawlData{
+			HTMLVersion:       ptrNullString(res.HTMLVersion),
+			Title:             ptrNullString(res.Title),
+			MetaDescription:   ptrNullString(res.MetaDescription),
+			Headings:          res.Headings,
+			InternalLinks:     res.InternalLinks,
+			ExternalLinks:     res.ExternalLinks,
+			InaccessibleLinks: res.InaccessibleLinks,
+			HasLoginForm:      res.HasLoginForm,
+			HTMLSize:          res.HTMLSize,
+			Status:            res.Status,
+			Links:             res.Links,
+			HeadingDetails:    res.HeadingDetails,
+			Forms:             res.Forms,
+			Security:          res.Security,
+			Issues:            res.Issues,
+			Resources:         res.Resources,
+			BodyText:          res.BodyText,
+		},
+	}
+	if res.Status == "error" {
+		page.Data.ErrorClass = sql.NullString{String: res.ErrorClass, Valid: true}
+		page.Data.ErrorMessage = sql.NullString{String: res.ErrorMessage, Valid: true}
+	}
+	if res.Snapshot != nil {
+		snapshot := *res.Snapshot
+		snapshot.Body = res.SnapshotBody
+		page.Snapshot = &snapshot
+	}
+
+	if err := repo.SavePageResult(runID, page); err != nil {
+		return fmt.Errorf("failed to store page result: %w", err)
+	}
+	return nil
+}
+
+// nullStringPtr converts a nullable string for the wire
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// ptrNullString converts a wire string back to a nullable one
+func ptrNullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
@@ -0,0 +1,321 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/seo-crawler-app/internal/models"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Resource types reported in the page-weight report
+const (
+	ResourceTypeScript     = "script"
+	ResourceTypeStylesheet = "stylesheet"
+	ResourceTypePreload    = "preload"
+	ResourceTypeFont       = "font"
+	ResourceTypeIframe     = "iframe"
+)
+
+// IssueCategoryPerformance groups issues affecting page weight and rendering
+const IssueCategoryPerformance = "performance"
+
+// resourceSelector matches the elements that reference page resources
+const resourceSelector = "script[src], link[href], iframe[src], style"
+
+// maxResourceSize caps how much of a single resource is downloaded when measuring it
+const maxResourceSize = 20 << 20
+
+// resourceFetchConcurrency is the number of resources measured in parallel
+const resourceFetchConcurrency = 4
+
+// fontFaceURL matches font files referenced from inline @font-face rules
+var fontFaceURL = regexp.MustCompile(`url\(\s*['"]?([^'")]+\.(?:woff2?|ttf|otf|eot)(?:[?#][^'")]*)?)['"]?\s*\)`)
+
+// fontExtensions are the file extensions treated as fonts when referenced directly
+var fontExtensions = []string{".woff2", ".woff", ".ttf", ".otf", ".eot"}
+
+// compressibleTypes are the content types expected to be served compressed
+var compressibleTypes = []string{"javascript", "css", "html", "json", "svg", "xml", "text/"}
+
+// resourceCollector gathers the resources referenced by a page, deduplicated by URL
+type resourceCollector struct {
+	mu        sync.Mutex
+	resources []models.ResourceData
+	seen      map[string]int
+}
+
+// newResourceCollector creates an empty resource collector
+func newResourceCollector() *resourceCollector {
+	return &resourceCollector{seen: make(map[string]int)}
+}
+
+// collect records the resources referenced by a matched element
+func (rc *resourceCollector) collect(e *colly.HTMLElement) {
+	inHead := e.DOM.ParentsFiltered("head").Length() > 0
+
+	switch e.Name {
+	case "script":
+		blocking := inHead && !hasAttr(e, "async") && !hasAttr(e, "defer") &&
+			!strings.EqualFold(e.Attr("type"), "module")
+		rc.add(e, e.Attr("src"), ResourceTypeScript, blocking)
+
+	case "iframe":
+		rc.add(e, e.Attr("src"), ResourceTypeIframe, false)
+
+	case "link":
+		rels := strings.Fields(strings.ToLower(e.Attr("rel")))
+		href := e.Attr("href")
+		switch {
+		case hasToken(rels, "stylesheet"):
+			media := strings.ToLower(strings.TrimSpace(e.Attr("media")))
+			blocking := inHead && !hasAttr(e, "disabled") &&
+				(media == "" || media == "all" || media == "screen")
+			rc.add(e, href, ResourceTypeStylesheet, blocking)
+		case hasToken(rels, "preload") || hasToken(rels, "modulepreload"):
+			if strings.EqualFold(e.Attr("as"), "font") || isFontURL(href) {
+				rc.add(e, href, ResourceTypeFont, false)
+			} else {
+				rc.add(e, href, ResourceTypePreload, false)
+			}
+		case isFontURL(href):
+			rc.add(e, href, ResourceTypeFont, false)
+		}
+
+	case "style":
+		for _, match := range fontFaceURL.FindAllStringSubmatch(e.Text, -1) {
+			rc.add(e, match[1], ResourceTypeFont, false)
+		}
+	}
+}
+
+// add records a single resource, ignoring empty and non-HTTP references
+func (rc *resourceCollector) add(e *colly.HTMLElement, ref, resourceType string, blocking bool) {
+	link := e.Request.AbsoluteURL(strings.TrimSpace(ref))
+	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if i, ok := rc.seen[link]; ok {
+		rc.resources[i].IsRenderBlocking = rc.resources[i].IsRenderBlocking || blocking
+		return
+	}
+
+	rc.seen[link] = len(rc.resources)
+	rc.resources = append(rc.resources, models.ResourceData{
+		URL:              link,
+		Type:             resourceType,
+		IsRenderBlocking: blocking,
+		IsThirdParty:     isThirdParty(e.Request.URL, link),
+	})
+}
+
+// measure fetches every collected resource and records its size, compression
+// and cache headers
+func (rc *resourceCollector) measure(ctx context.Context, client *http.Client) []models.ResourceData {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, resourceFetchConcurrency)
+
+	for i := range rc.resources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(resource *models.ResourceData) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			measureResource(ctx, client, resource)
+		}(&rc.resources[i])
+	}
+
+	wg.Wait()
+	return rc.resources
+}
+
+// measureResource downloads a resource as a browser would and fills in its
+// transfer details
+func measureResource(ctx context.Context, client *http.Client, resource *models.ResourceData) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resource.URL, nil)
+	if err != nil {
+		return
+	}
+	// Setting Accept-Encoding explicitly stops the transport from decompressing
+	// transparently, so the body is counted as transferred
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	size, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, maxResourceSize))
+
+	resource.StatusCode = resp.StatusCode
+	resource.Size = size
+	resource.ContentType = resp.Header.Get("Content-Type")
+	resource.Compression = resp.Header.Get("Content-Encoding")
+	resource.CacheControl = resp.Header.Get("Cache-Control")
+	resource.Expires = resp.Header.Get("Expires")
+}
+
+// resourceIssues reports render-blocking, uncompressed and uncached resources
+func resourceIssues(resources []models.ResourceData) []models.IssueData {
+	var issues []models.IssueData
+
+	for _, resource := range resources {
+		if resource.IsRenderBlocking {
+			issues = append(issues, models.IssueData{
+				Category: IssueCategoryPerformance,
+				Severity: SeverityWarning,
+				Code:     "render_blocking_resource",
+				Message:  fmt.Sprintf("Render-blocking %s in <head>", resource.Type),
+				URL:      resource.URL,
+			})
+		}
+		if resource.StatusCode != http.StatusOK {
+			continue
+		}
+		if isUncompressed(resource) {
+			issues = append(issues, models.IssueData{
+				Category: IssueCategoryPerformance,
+				Severity: SeverityInfo,
+				Code:     "uncompressed_resource",
+				Message:  fmt.Sprintf("%s of %d bytes is served without compression", resource.Type, resource.Size),
+				URL:      resource.URL,
+			})
+		}
+		if isUncached(resource) {
+			issues = append(issues, models.IssueData{
+				Category: IssueCategoryPerformance,
+				Severity: SeverityInfo,
+				Code:     "uncached_resource",
+				Message:  fmt.Sprintf("%s has no cache lifetime", resource.Type),
+				URL:      resource.URL,
+			})
+		}
+	}
+
+	return issues
+}
+
+// SummarizeResources computes the total page weight and the third-party
+// domains of a page from its HTML size and resources
+func SummarizeResources(htmlSize int64, resources []models.ResourceData) models.ResourceSummary {
+	summary := models.ResourceSummary{
+		HTMLSize:          htmlSize,
+		ResourceCount:     len(resources),
+		TotalSize:         htmlSize,
+		SizeByType:        make(map[string]int64),
+		ThirdPartyDomains: []string{},
+	}
+
+	domains := make(map[string]bool)
+	for _, resource := range resources {
+		summary.TotalSize += resource.Size
+		summary.SizeByType[resource.Type] += resource.Size
+		if resource.IsRenderBlocking {
+			summary.RenderBlockingCount++
+		}
+		if resource.StatusCode == http.StatusOK && isUncompressed(resource) {
+			summary.UncompressedCount++
+		}
+		if resource.StatusCode == http.StatusOK && isUncached(resource) {
+			summary.UncachedCount++
+		}
+		if resource.IsThirdParty {
+			if u, err := url.Parse(resource.URL); err == nil {
+				domains[u.Hostname()] = true
+			}
+		}
+	}
+
+	for domain := range domains {
+		summary.ThirdPartyDomains = append(summary.ThirdPartyDomains, domain)
+	}
+	sort.Strings(summary.ThirdPartyDomains)
+
+	return summary
+}
+
+// isUncompressed reports whether a text resource was served without compression
+func isUncompressed(resource models.ResourceData) bool {
+	if resource.Compression != "" && resource.Compression != "identity" {
+		return false
+	}
+	// Tiny responses are not worth compressing
+	if resource.Size < 1024 {
+		return false
+	}
+	return containsAny(strings.ToLower(resource.ContentType), compressibleTypes)
+}
+
+// isUncached reports whether a resource was served without any cache lifetime
+func isUncached(resource models.ResourceData) bool {
+	cacheControl := strings.ToLower(resource.CacheControl)
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "no-cache") {
+		return true
+	}
+	return !strings.Contains(cacheControl, "max-age") && resource.Expires == ""
+}
+
+// isThirdParty reports whether link belongs to a different site than the page.
+// Subdomains of the same registrable domain count as first party.
+func isThirdParty(pageURL *url.URL, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	if u.Hostname() == pageURL.Hostname() {
+		return false
+	}
+
+	pageSite, err := publicsuffix.EffectiveTLDPlusOne(pageURL.Hostname())
+	if err != nil {
+		return true
+	}
+	linkSite, err := publicsuffix.EffectiveTLDPlusOne(u.Hostname())
+	if err != nil {
+		return true
+	}
+	return pageSite != linkSite
+}
+
+// isFontURL reports whether a URL points at a font file
+func isFontURL(link string) bool {
+	path := strings.ToLower(link)
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	for _, ext := range fontExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAttr reports whether an element carries an attribute, even an empty one
+func hasAttr(e *colly.HTMLElement, name string) bool {
+	_, ok := e.DOM.Attr(name)
+	return ok
+}
+
+// hasToken reports whether tokens contains token
+func hasToken(tokens []string, token string) bool {
+	for _, t := range tokens {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+func TestSummarizeResources(t *testing.T) {
+	resources := []models.ResourceData{
+		{
+			URL: "https://example.com/app.js", Type: ResourceTypeScript, StatusCode: 200, Size: 40000,
+			ContentType: "application/javascript", Compression: "gzip", CacheControl: "max-age=3600",
+			IsRenderBlocking: true,
+		},
+		{
+			URL: "https://cdn.example.net/site.css", Type: ResourceTypeStylesheet, StatusCode: 200, Size: 8000,
+			ContentType: "text/css", CacheControl: "no-cache", IsRenderBlocking: true, IsThirdParty: true,
+		},
+		{
+			URL: "https://fonts.example.org/a.woff2", Type: ResourceTypeFont, StatusCode: 200, Size: 20000,
+			ContentType: "font/woff2", Expires: "Thu, 01 Jan 2099 00:00:00 GMT", IsThirdParty: true,
+		},
+		{
+			URL: "https://cdn.example.net/other.js", Type: ResourceTypeScript, StatusCode: 200, Size: 500,
+			ContentType: "text/javascript", CacheControl: "public, max-age=60", IsThirdParty: true,
+		},
+		{
+			// Failed fetches count toward the weight but are not judged on their headers
+			URL: "https://example.com/missing.css", Type: ResourceTypeStylesheet, StatusCode: 404, Size: 300,
+			ContentType: "text/html",
+		},
+	}
+
+	got := SummarizeResources(12000, resources)
+	want := models.ResourceSummary{
+		HTMLSize:      12000,
+		ResourceCount: 5,
+		TotalSize:     12000 + 40000 + 8000 + 20000 + 500 + 300,
+		SizeByType: map[string]int64{
+			ResourceTypeScript:     40500,
+			ResourceTypeStylesheet: 8300,
+			ResourceTypeFont:       20000,
+		},
+		RenderBlockingCount: 2,
+		UncompressedCount:   1,
+		UncachedCount:       1,
+		ThirdPartyDomains:   []string{"cdn.example.net", "fonts.example.org"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SummarizeResources() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSummarizeResourcesEmpty(t *testing.T) {
+	got := SummarizeResources(512, nil)
+	if got.TotalSize != 512 || got.ResourceCount != 0 {
+		t.Errorf("SummarizeResources(512, nil) = %+v", got)
+	}
+	// Encoded as an empty list, not null
+	if got.ThirdPartyDomains == nil || got.SizeByType == nil {
+		t.Errorf("SummarizeResources(512, nil) left nil collections: %+v", got)
+	}
+}
+
+func TestIsThirdParty(t *testing.T) {
+	page, _ := url.Parse("https://www.example.co.uk/products/")
+
+	tests := []struct {
+		link string
+		want bool
+	}{
+		{link: "https://www.example.co.uk/app.js", want: false},
+		{link: "http://www.example.co.uk:8080/app.js", want: false},
+		{link: "https://static.example.co.uk/app.js", want: false},
+		{link: "https://example.co.uk/app.js", want: false},
+		{link: "https://other.co.uk/app.js", want: true},
+		{link: "https://cdn.jsdelivr.net/npm/lib.js", want: true},
+		{link: "https://example.com/app.js", want: true},
+		{link: "::not a url", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			if got := isThirdParty(page, tt.link); got != tt.want {
+				t.Errorf("isThirdParty(%s, %q) = %v, want %v", page, tt.link, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// Issue severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Issue categories
+const (
+	IssueCategorySecurity = "security"
+)
+
+// certExpiryWarningDays is how long before expiry a certificate is reported
+const certExpiryWarningDays = 30
+
+// mixedContentSelector matches the elements that load subresources
+const mixedContentSelector = "img[src], script[src], iframe[src], audio[src], video[src], source[src], embed[src], object[data], link[href]"
+
+// activeMixedContentTags are the elements browsers block outright when loaded over HTTP
+var activeMixedContentTags = map[string]bool{
+	"script": true,
+	"iframe": true,
+	"embed":  true,
+	"object": true,
+	"link":   true,
+}
+
+// subresourceLinkRels are the link relations that make the browser fetch the target
+var subresourceLinkRels = []string{"stylesheet", "icon", "preload", "modulepreload", "manifest"}
+
+// mixedContentIssue returns an issue when an element on an HTTPS page loads
+// its resource over plain HTTP
+func mixedContentIssue(e *colly.HTMLElement) *models.IssueData {
+	if e.Request.URL.Scheme != "https" {
+		return nil
+	}
+
+	attr := "src"
+	switch e.Name {
+	case "object":
+		attr = "data"
+	case "link":
+		rel := strings.ToLower(e.Attr("rel"))
+		if !containsAny(rel, subresourceLinkRels) {
+			return nil
+		}
+		attr = "href"
+	}
+
+	resource := e.Request.AbsoluteURL(e.Attr(attr))
+	if !strings.HasPrefix(strings.ToLower(resource), "http://") {
+		return nil
+	}
+
+	if activeMixedContentTags[e.Name] {
+		return &models.IssueData{
+			Category: IssueCategorySecurity,
+			Severity: SeverityError,
+			Code:     "mixed_content_active",
+			Message:  fmt.Sprintf("<%s> loads an active resource over HTTP on an HTTPS page", e.Name),
+			URL:      resource,
+		}
+	}
+
+	return &models.IssueData{
+		Category: IssueCategorySecurity,
+		Severity: SeverityWarning,
+		Code:     "mixed_content_passive",
+		Message:  fmt.Sprintf("<%s> loads a passive resource over HTTP on an HTTPS page", e.Name),
+		URL:      resource,
+	}
+}
+
+// insecureFormIssue returns an issue for a form posting to HTTP from an HTTPS page
+func insecureFormIssue(form *models.FormData) *models.IssueData {
+	if !form.InsecureAction {
+		return nil
+	}
+	return &models.IssueData{
+		Category: IssueCategorySecurity,
+		Severity: SeverityError,
+		Code:     "insecure_form_action",
+		Message:  fmt.Sprintf("%s form submits over HTTP from an HTTPS page", form.Type),
+		URL:      form.Action,
+	}
+}
+
+// checkSecurity runs the HTTP-to-HTTPS redirect and TLS certificate checks for
+// the final URL of a crawled page. mixedContent is the number of mixed content
+// issues already found while parsing the page. The certificate cannot be
+// inspected offline, so it is skipped when replaying an archive. The TLS
+// connection counts against the budget of the host in limiter, like requests.
+func checkSecurity(ctx context.Context, client *http.Client, limiter *hostLimiter, pageURL *url.URL, mixedContent int, offline bool) (*models.SecurityData, []models.IssueData) {
+	security := &models.SecurityData{
+		IsHTTPS:           pageURL.Scheme == "https",
+		MixedContentCount: mixedContent,
+	}
+	var issues []models.IssueData
+
+	if !security.IsHTTPS {
+		issues = append(issues, models.IssueData{
+			Category: IssueCategorySecurity,
+			Severity: SeverityError,
+			Code:     "not_https",
+			Message:  "Page is served over plain HTTP",
+			URL:      pageURL.String(),
+		})
+		return security, issues
+	}
+
+	security.RedirectsToHTTPS = redirectsToHTTPS(ctx, client, pageURL)
+	if !security.RedirectsToHTTPS {
+		issues = append(issues, models.IssueData{
+			Category: IssueCategorySecurity,
+			Severity: SeverityWarning,
+			Code:     "no_https_redirect",
+			Message:  "HTTP version of the page does not redirect to HTTPS",
+			URL:      httpVersion(pageURL).String(),
+		})
+	}
+
+	if offline {
+		return security, issues
+	}
+
+	err := limiter.do(ctx, pageURL.Host, func() error {
+		return inspectCertificate(ctx, pageURL, security)
+	})
+	if err != nil {
+		issues = append(issues, models.IssueData{
+			Category: IssueCategorySecurity,
+			Severity: SeverityError,
+			Code:     "tls_handshake_failed",
+			Message:  fmt.Sprintf("TLS handshake failed: %v", err),
+		})
+		return security, issues
+	}
+
+	issues = append(issues, certificateIssues(security, time.Now())...)
+	return security, issues
+}
+
+// httpVersion returns a copy of u using the http scheme and default port
+func httpVersion(u *url.URL) *url.URL {
+	plain := *u
+	plain.Scheme = "http"
+	if port := u.Port(); port == "443" {
+		plain.Host = u.Hostname()
+		if strings.Contains(plain.Host, ":") {
+			plain.Host = "[" + plain.Host + "]"
+		}
+	}
+	return &plain
+}
+
+// redirectsToHTTPS requests the HTTP version of a URL and reports whether the
+// redirect chain ends on HTTPS
+func redirectsToHTTPS(ctx context.Context, client *http.Client, pageURL *url.URL) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, httpVersion(pageURL).String(), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	return resp.Request.URL.Scheme == "https"
+}
+
+// inspectCertificate connects to the host of an HTTPS URL and fills the
+// certificate and protocol details of security
+func inspectCertificate(ctx context.Context, pageURL *url.URL, security *models.SecurityData) error {
+	host := pageURL.Hostname()
+	port := pageURL.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 10 * time.Second},
+		Config: &tls.Config{
+			ServerName: host,
+			MinVersion: tls.VersionTLS10,
+			// Verification is done below so that every failure can be reported
+			// individually instead of aborting the handshake
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	security.TLSVersion = tls.VersionName(state.Version)
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+
+	leaf := state.PeerCertificates[0]
+	expiresAt := leaf.NotAfter
+	security.CertSubject = leaf.Subject.CommonName
+	security.CertIssuer = leaf.Issuer.CommonName
+	security.CertExpiresAt = &expiresAt
+	security.CertDaysRemaining = int(time.Until(expiresAt).Hours() / 24)
+	security.HostnameMatch = leaf.VerifyHostname(host) == nil
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates}); err != nil {
+		security.ChainError = err.Error()
+	} else {
+		security.ChainValid = true
+	}
+
+	return nil
+}
+
+// certificateIssues turns the results of inspectCertificate into issues, as of
+// the time the certificate was seen
+func certificateIssues(security *models.SecurityData, seenAt time.Time) []models.IssueData {
+	var issues []models.IssueData
+
+	switch {
+	case security.CertExpiresAt.Before(seenAt):
+		issues = append(issues, models.IssueData{
+			Category: IssueCategorySecurity,
+			Severity: SeverityError,
+			Code:     "cert_expired",
+			Message:  fmt.Sprintf("TLS certificate expired on %s", security.CertExpiresAt.Format("2006-01-02")),
+		})
+	case security.CertDaysRemaining <= certExpiryWarningDays:
+		issues = append(issues, models.IssueData{
+			Category: IssueCategorySecurity,
+			Severity: SeverityWarning,
+			Code:     "cert_expiring",
+			Message: fmt.Sprintf("TLS certificate expires in %d days (%s)",
+				security.CertDaysRemaining, security.CertExpiresAt.Format("2006-01-02")),
+		})
+	}
+
+	if !security.HostnameMatch {
+		issues = append(issues, models.IssueData{
+			Category: IssueCategorySecurity,
+			Severity: SeverityError,
+			Code:     "cert_hostname_mismatch",
+			Message:  fmt.Sprintf("TLS certificate (%s) does not match the hostname", security.CertSubject),
+		})
+	}
+
+	if !security.ChainValid {
+		issues = append(issues, models.IssueData{
+			Category: IssueCategorySecurity,
+			Severity: SeverityError,
+			Code:     "cert_chain_invalid",
+			Message:  fmt.Sprintf("TLS certificate chain is not trusted: %s", security.ChainError),
+		})
+	}
+
+	if security.TLSVersion == "TLS 1.0" || security.TLSVersion == "TLS 1.1" {
+		issues = append(issues, models.IssueData{
+			Category: IssueCategorySecurity,
+			Severity: SeverityWarning,
+			Code:     "tls_outdated",
+			Message:  fmt.Sprintf("Server negotiated outdated protocol %s", security.TLSVersion),
+		})
+	}
+
+	return issues
+}
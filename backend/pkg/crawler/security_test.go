@@ -0,0 +1,189 @@
+package crawler
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// issueCodes returns the codes of issues, in order
+func issueCodes(issues []models.IssueData) []string {
+	var codes []string
+	for _, issue := range issues {
+		codes = append(codes, issue.Code)
+	}
+	return codes
+}
+
+func TestCertificateIssues(t *testing.T) {
+	seenAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// valid returns the inspection of a sound certificate expiring in days days
+	valid := func(days int) models.SecurityData {
+		expiresAt := seenAt.AddDate(0, 0, days)
+		return models.SecurityData{
+			TLSVersion:        "TLS 1.3",
+			CertSubject:       "example.com",
+			CertExpiresAt:     &expiresAt,
+			CertDaysRemaining: days,
+			HostnameMatch:     true,
+			ChainValid:        true,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(s *models.SecurityData)
+		days   int
+		want   []string
+	}{
+		{name: "valid", days: 90},
+		{name: "expiring", days: certExpiryWarningDays, want: []string{"cert_expiring"}},
+		{name: "expiring tomorrow", days: 1, want: []string{"cert_expiring"}},
+		{name: "expired", days: -1, want: []string{"cert_expired"}},
+		{
+			name: "hostname mismatch",
+			days: 90,
+			modify: func(s *models.SecurityData) {
+				s.HostnameMatch = false
+			},
+			want: []string{"cert_hostname_mismatch"},
+		},
+		{
+			name: "untrusted chain",
+			days: 90,
+			modify: func(s *models.SecurityData) {
+				s.ChainValid = false
+				s.ChainError = "x509: certificate signed by unknown authority"
+			},
+			want: []string{"cert_chain_invalid"},
+		},
+		{
+			name: "outdated protocol",
+			days: 90,
+			modify: func(s *models.SecurityData) {
+				s.TLSVersion = "TLS 1.1"
+			},
+			want: []string{"tls_outdated"},
+		},
+		{
+			name: "everything wrong",
+			days: -30,
+			modify: func(s *models.SecurityData) {
+				s.HostnameMatch = false
+				s.ChainValid = false
+				s.TLSVersion = "TLS 1.0"
+			},
+			want: []string{"cert_expired", "cert_hostname_mismatch", "cert_chain_invalid", "tls_outdated"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			security := valid(tt.days)
+			if tt.modify != nil {
+				tt.modify(&security)
+			}
+			issues := certificateIssues(&security, seenAt)
+			if got := issueCodes(issues); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("certificateIssues() = %v, want %v", got, tt.want)
+			}
+			for _, issue := range issues {
+				if issue.Category != IssueCategorySecurity || issue.Message == "" {
+					t.Errorf("issue %s = %+v, want a security issue with a message", issue.Code, issue)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPVersion(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://example.com/page?q=1", want: "http://example.com/page?q=1"},
+		{url: "https://example.com:443/", want: "http://example.com/"},
+		{url: "https://example.com:8443/", want: "http://example.com:8443/"},
+		{url: "https://[::1]:443/", want: "http://[::1]/"},
+		{url: "http://example.com/", want: "http://example.com/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := httpVersion(u).String(); got != tt.want {
+				t.Errorf("httpVersion(%s) = %s, want %s", tt.url, got, tt.want)
+			}
+			if u.String() != tt.url {
+				t.Errorf("httpVersion modified its argument to %s", u)
+			}
+		})
+	}
+}
+
+// element parses markup holding a single element served from pageURL
+func element(t *testing.T, pageURL string, markup string) *colly.HTMLElement {
+	t.Helper()
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(markup))
+	if err != nil {
+		t.Fatalf("failed to parse markup: %v", err)
+	}
+	selection := doc.Find(mixedContentSelector).First()
+	if selection.Length() == 0 {
+		t.Fatal("markup has no element loading a resource")
+	}
+	resp := &colly.Response{Request: &colly.Request{URL: u}}
+	return colly.NewHTMLElementFromSelectionNode(resp, selection, selection.Nodes[0], 0)
+}
+
+func TestMixedContentIssue(t *testing.T) {
+	tests := []struct {
+		name     string
+		pageURL  string
+		markup   string
+		wantCode string
+		wantURL  string
+	}{
+		{name: "active script", pageURL: "https://example.com/", markup: `<script src="http://cdn.example.com/app.js"></script>`, wantCode: "mixed_content_active", wantURL: "http://cdn.example.com/app.js"},
+		{name: "active iframe", pageURL: "https://example.com/", markup: `<iframe src="http://example.org/"></iframe>`, wantCode: "mixed_content_active", wantURL: "http://example.org/"},
+		{name: "passive image", pageURL: "https://example.com/", markup: `<img src="HTTP://example.com/logo.png">`, wantCode: "mixed_content_passive", wantURL: "http://example.com/logo.png"},
+		{name: "object data", pageURL: "https://example.com/", markup: `<object data="http://example.com/movie.swf"></object>`, wantCode: "mixed_content_active", wantURL: "http://example.com/movie.swf"},
+		{name: "stylesheet", pageURL: "https://example.com/", markup: `<link rel="Stylesheet" href="http://example.com/style.css">`, wantCode: "mixed_content_active", wantURL: "http://example.com/style.css"},
+		{name: "canonical link", pageURL: "https://example.com/", markup: `<link rel="canonical" href="http://example.com/">`},
+		{name: "https resource", pageURL: "https://example.com/", markup: `<script src="https://cdn.example.com/app.js"></script>`},
+		{name: "relative resource", pageURL: "https://example.com/", markup: `<img src="/logo.png">`},
+		{name: "protocol-relative resource", pageURL: "https://example.com/", markup: `<img src="//cdn.example.com/logo.png">`},
+		{name: "http page", pageURL: "http://example.com/", markup: `<script src="http://cdn.example.com/app.js"></script>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issue := mixedContentIssue(element(t, tt.pageURL, tt.markup))
+			if tt.wantCode == "" {
+				if issue != nil {
+					t.Errorf("mixedContentIssue() = %+v, want nil", issue)
+				}
+				return
+			}
+			if issue == nil {
+				t.Fatalf("mixedContentIssue() = nil, want %s", tt.wantCode)
+			}
+			if issue.Code != tt.wantCode || issue.URL != tt.wantURL {
+				t.Errorf("mixedContentIssue() = %s for %s, want %s for %s", issue.Code, issue.URL, tt.wantCode, tt.wantURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/seo-crawler-app/internal/models"
+)
+
+// Source is an earlier run re-analyzed from its snapshot. A re-analysis makes
+// no request, so the links, resources and certificate observed by the source
+// run stand in for the ones it would have checked.
+type Source struct {
+	RunID     int
+	Snapshot  *models.Snapshot
+	Links     []models.LinkData
+	Resources []models.ResourceData
+	Security  *models.SecurityData
+}
+
+// ReanalyzeURL re-runs the analyzers against the snapshot of an earlier run
+// of the URL, without any network access, storing the results in a new run
+func (c *Crawler) ReanalyzeURL(ctx context.Context, userID int, baseURL string, source *Source, repo Repository) error {
+	crawlResultID, err := lookupCrawlResultID(repo, userID, baseURL)
+	if err != nil {
+		return err
+	}
+	runID, err := repo.StartCrawlRun(crawlResultID, models.JobTypeReanalyze, source.RunID)
+	if err != nil {
+		log.Printf("Failed to start re-analysis run for %s: %v", baseURL, err)
+		return err
+	}
+
+	return c.crawl(ctx, userID, crawlResultID, runID, baseURL, repo, newSnapshotTransport(baseURL, source), true, source, 0)
+}
+
+// certificateIssues copies the certificate seen by the source run into
+// security and returns its issues as of the time the snapshot was taken
+func (s *Source) certificateIssues(security *models.SecurityData) []models.IssueData {
+	if !security.IsHTTPS || s.Security == nil || !s.Security.IsHTTPS {
+		return nil
+	}
+	if s.Security.TLSVersion == "" {
+		return []models.IssueData{{
+			Category: IssueCategorySecurity,
+			Severity: SeverityError,
+			Code:     "tls_handshake_failed",
+			Message:  "TLS handshake failed when the snapshot was taken",
+		}}
+	}
+
+	security.TLSVersion = s.Security.TLSVersion
+	security.CertSubject = s.Security.CertSubject
+	security.CertIssuer = s.Security.CertIssuer
+	security.CertExpiresAt = s.Security.CertExpiresAt
+	security.HostnameMatch = s.Security.HostnameMatch
+	security.ChainValid = s.Security.ChainValid
+	security.ChainError = s.Security.ChainError
+	if security.CertExpiresAt == nil {
+		return nil
+	}
+	security.CertDaysRemaining = int(security.CertExpiresAt.Sub(s.Snapshot.FetchedAt).Hours() / 24)
+	return certificateIssues(security, s.Snapshot.FetchedAt)
+}
+
+// snapshotTransport answers the requests of a re-analysis from a Source. The
+// page is served from the snapshot, and link checks and resource downloads
+// get responses rebuilt from what the source run observed. Anything the
+// source run did not observe fails with ErrNotArchived.
+type snapshotTransport struct {
+	baseURL   string
+	source    *Source
+	links     map[string]models.LinkData
+	resources map[string]models.ResourceData
+}
+
+// newSnapshotTransport creates the transport re-analyzing source
+func newSnapshotTransport(baseURL string, source *Source) *snapshotTransport {
+	t := &snapshotTransport{
+		baseURL:   baseURL,
+		source:    source,
+		links:     make(map[string]models.LinkData),
+		resources: make(map[string]models.ResourceData),
+	}
+	for _, link := range source.Links {
+		if isChecked(link) {
+			t.links[link.URL] = link
+		}
+	}
+	for _, resource := range source.Resources {
+		if resource.StatusCode != 0 {
+			t.resources[resource.URL] = resource
+		}
+	}
+	return t
+}
+
+// RoundTrip answers a request without any network access
+func (t *snapshotTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	snapshot := t.source.Snapshot
+	target := req.URL.String()
+
+	switch {
+	case target == snapshot.URL:
+		// The body was stored decoded, so its encoding and length no longer apply
+		header := snapshot.Headers.Clone()
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+		return t.response(req, snapshot.StatusCode, header, snapshot.Body), nil
+	case target == t.baseURL && req.Method == http.MethodGet:
+		// The page was reached through redirects, which are not kept
+		return t.response(req, http.StatusFound, http.Header{"Location": {snapshot.URL}}, nil), nil
+	case req.URL.Path == "/robots.txt":
+		// A missing robots.txt means everything may be crawled
+		return t.response(req, http.StatusNotFound, nil, nil), nil
+	case req.Method == http.MethodHead:
+		if link, ok := t.links[target]; ok {
+			if link.StatusCode == 0 {
+				return nil, fmt.Errorf("link %s was unreachable in run %d", target, t.source.RunID)
+			}
+			return t.response(req, link.StatusCode, nil, nil), nil
+		}
+	case req.Method == http.MethodGet:
+		if resource, ok := t.resources[target]; ok {
+			header := http.Header{}
+			setHeader(header, "Content-Type", resource.ContentType)
+			setHeader(header, "Content-Encoding", resource.Compression)
+			setHeader(header, "Cache-Control", resource.CacheControl)
+			setHeader(header, "Expires", resource.Expires)
+			// Only the size of a resource is measured, not its content
+			return t.response(req, resource.StatusCode, header, make([]byte, resource.Size)), nil
+		}
+		if t.redirectsToHTTPS(req) {
+			return t.response(req, http.StatusMovedPermanently, http.Header{"Location": {snapshot.URL}}, nil), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNotArchived, req.Method, target)
+}
+
+// redirectsToHTTPS reports whether req asks for the HTTP version of the page
+// and the source run found it redirecting to HTTPS
+func (t *snapshotTransport) redirectsToHTTPS(req *http.Request) bool {
+	security := t.source.Security
+	if security == nil || !security.RedirectsToHTTPS || req.URL.Scheme != "http" {
+		return false
+	}
+	page, err := req.URL.Parse(t.source.Snapshot.URL)
+	if err != nil {
+		return false
+	}
+	return httpVersion(page).String() == req.URL.String()
+}
+
+// response builds a response to req
+func (t *snapshotTransport) response(req *http.Request, statusCode int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+		Close:         true,
+	}
+}
+
+// setHeader sets a header unless value is empty
+func setHeader(header http.Header, key, value string) {
+	if value != "" {
+		header.Set(key, value)
+	}
+}
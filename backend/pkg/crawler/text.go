@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/html"
+)
+
+// maxBodyText caps the page text kept for full-text search
+const maxBodyText = 100 << 10
+
+// hiddenElements hold no text a visitor reads
+var hiddenElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+	"iframe":   true,
+}
+
+// bodyText returns the visible text of a body element with whitespace
+// collapsed, cut to maxBodyText bytes
+func bodyText(e *colly.HTMLElement) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if b.Len() >= maxBodyText {
+			return
+		}
+		switch n.Type {
+		case html.TextNode:
+			for _, word := range strings.Fields(n.Data) {
+				if b.Len() > 0 {
+					b.WriteByte(' ')
+				}
+				b.WriteString(word)
+			}
+		case html.ElementNode:
+			if hiddenElements[n.Data] {
+				return
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for _, node := range e.DOM.Nodes {
+		walk(node)
+	}
+
+	text := b.String()
+	if len(text) <= maxBodyText {
+		return text
+	}
+	// Cut on a character boundary
+	end := maxBodyText
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end]
+}
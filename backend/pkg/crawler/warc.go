@@ -0,0 +1,391 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotArchived is returned when a replayed request has no recorded response
+var ErrNotArchived = errors.New("url not found in WARC archive")
+
+// maxRecordedBody caps the response body kept in a record, one byte over what
+// any analyzer reads so that replayed oversized responses still fail the
+// size checks. Longer bodies are truncated and their record marked as such.
+const maxRecordedBody = max(maxPageSize, maxResourceSize) + 1
+
+// WARCWriter writes request/response pairs to a gzip-compressed WARC 1.0 file,
+// one gzip member per record as recommended by the WARC specification
+type WARCWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWARCWriter creates a WARC writer and writes the leading warcinfo record
+func NewWARCWriter(w io.Writer, filename string) (*WARCWriter, error) {
+	ww := &WARCWriter{w: w}
+
+	info := "software: seo-crawler-app\r\nformat: WARC File Format 1.0\r\n"
+	headers := [][2]string{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", warcDate(time.Now())},
+		{"WARC-Filename", filename},
+		{"Content-Type", "application/warc-fields"},
+	}
+	if err := ww.writeRecord(headers, []byte(info)); err != nil {
+		return nil, err
+	}
+
+	return ww, nil
+}
+
+// WriteExchange writes a request record and its concurrent response record.
+// truncated marks a response whose body was cut to maxRecordedBody.
+func (ww *WARCWriter) WriteExchange(targetURI string, request, response []byte, truncated bool) error {
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+
+	now := warcDate(time.Now())
+	requestID, err := ww.writeRequest(targetURI, now, request)
+	if err != nil {
+		return err
+	}
+
+	responseHeaders := [][2]string{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", now},
+		{"WARC-Target-URI", targetURI},
+		{"WARC-Concurrent-To", requestID},
+		{"Content-Type", "application/http; msgtype=response"},
+	}
+	if truncated {
+		responseHeaders = append(responseHeaders, [2]string{"WARC-Truncated", "length"})
+	}
+	return ww.writeRecord(responseHeaders, response)
+}
+
+// WriteFailure writes a request record and a concurrent metadata record with
+// the class and message of the error that kept it from getting a response
+func (ww *WARCWriter) WriteFailure(targetURI string, request []byte, failure *CrawlError) error {
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+
+	now := warcDate(time.Now())
+	requestID, err := ww.writeRequest(targetURI, now, request)
+	if err != nil {
+		return err
+	}
+
+	message := strings.Join(strings.Fields(failure.Err.Error()), " ")
+	block := fmt.Sprintf("fetch-error-class: %s\r\nfetch-error: %s\r\n", failure.Class, message)
+	metadataHeaders := [][2]string{
+		{"WARC-Type", "metadata"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", now},
+		{"WARC-Target-URI", targetURI},
+		{"WARC-Concurrent-To", requestID},
+		{"Content-Type", "application/warc-fields"},
+	}
+	return ww.writeRecord(metadataHeaders, []byte(block))
+}
+
+// writeRequest writes a request record and returns its record ID
+func (ww *WARCWriter) writeRequest(targetURI, date string, request []byte) (string, error) {
+	requestID := newRecordID()
+	headers := [][2]string{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", requestID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", targetURI},
+		{"Content-Type", "application/http; msgtype=request"},
+	}
+	return requestID, ww.writeRecord(headers, request)
+}
+
+// writeRecord writes a single record as its own gzip member
+func (ww *WARCWriter) writeRecord(headers [][2]string, block []byte) error {
+	var buf bytes.Buffer
+	buf.WriteString("WARC/1.0\r\n")
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+	fmt.Fprintf(&buf, "WARC-Block-Digest: %s\r\n", blockDigest(block))
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(block))
+	buf.Write(block)
+	buf.WriteString("\r\n\r\n")
+
+	gz := gzip.NewWriter(ww.w)
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write WARC record: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write WARC record: %w", err)
+	}
+	return nil
+}
+
+// recordingTransport archives every request/response pair passing through it
+type recordingTransport struct {
+	next    http.RoundTripper
+	archive *WARCWriter
+}
+
+// RoundTrip performs the request and writes the exchange to the archive. A
+// failed request is archived with its error, unless the crawl was cancelled.
+// Writes that fail are logged rather than failing the crawl itself.
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		if req.Context().Err() == nil {
+			if err := t.archive.WriteFailure(req.URL.String(), request, classifyError(err, 0)); err != nil {
+				log.Printf("Failed to archive %s: %v", req.URL, err)
+			}
+		}
+		return nil, err
+	}
+
+	// Buffer no more of the body than is recorded, the caller reads the
+	// buffered part and then the rest of the stream
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRecordedBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+
+	truncated := len(body) > maxRecordedBody
+	if truncated {
+		body = body[:maxRecordedBody]
+	}
+
+	// Write the response as received, with the length of the recorded body
+	recorded := *resp
+	recorded.Body = io.NopCloser(bytes.NewReader(body))
+	recorded.TransferEncoding = nil
+	if req.Method != http.MethodHead {
+		recorded.ContentLength = int64(len(body))
+	}
+	var response bytes.Buffer
+	if err := recorded.Write(&response); err != nil {
+		log.Printf("Failed to archive %s: %v", req.URL, err)
+		return resp, nil
+	}
+
+	if err := t.archive.WriteExchange(req.URL.String(), request, response.Bytes(), truncated); err != nil {
+		log.Printf("Failed to archive %s: %v", req.URL, err)
+	}
+
+	return resp, nil
+}
+
+// WARCArchive serves recorded responses from a WARC file in place of the
+// network, and fails the requests that failed when recorded the same way
+type WARCArchive struct {
+	responses map[string][]byte
+	failures  map[string]*CrawlError
+}
+
+// OpenWARC reads a WARC file written by WARCWriter into memory
+func OpenWARC(path string) (*WARCArchive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WARC file: %w", err)
+	}
+	defer f.Close()
+
+	return ReadWARC(f)
+}
+
+// ReadWARC parses the records of a gzip-compressed WARC stream and indexes
+// responses and fetch failures by request method and target URI
+func ReadWARC(r io.Reader) (*WARCArchive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WARC file: %w", err)
+	}
+	defer gz.Close()
+
+	archive := &WARCArchive{
+		responses: make(map[string][]byte),
+		failures:  make(map[string]*CrawlError),
+	}
+	methods := make(map[string]string)
+	reader := bufio.NewReader(gz)
+
+	for {
+		headers, block, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch headers.Get("WARC-Type") {
+		case "request":
+			method := "GET"
+			if line, _, ok := strings.Cut(string(block), " "); ok {
+				method = line
+			}
+			methods[headers.Get("WARC-Record-ID")] = method
+		case "response", "metadata":
+			method, ok := methods[headers.Get("WARC-Concurrent-To")]
+			if !ok {
+				method = "GET"
+			}
+			key := method + " " + headers.Get("WARC-Target-URI")
+			// Keep the first outcome, later ones come from retries
+			if archive.recorded(key) {
+				continue
+			}
+			if headers.Get("WARC-Type") == "response" {
+				archive.responses[key] = block
+			} else if failure := parseFailure(block); failure != nil {
+				archive.failures[key] = failure
+			}
+		}
+	}
+
+	return archive, nil
+}
+
+// recorded reports whether the archive holds a response or a failure for key
+func (a *WARCArchive) recorded(key string) bool {
+	_, hasResponse := a.responses[key]
+	_, hasFailure := a.failures[key]
+	return hasResponse || hasFailure
+}
+
+// parseFailure reads the fetch error of a metadata record, nil when the
+// record holds none
+func parseFailure(block []byte) *CrawlError {
+	fields, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(block, '\r', '\n')))).ReadMIMEHeader()
+	if err != nil && len(fields) == 0 {
+		return nil
+	}
+	class := fields.Get("Fetch-Error-Class")
+	if class == "" {
+		return nil
+	}
+	return &CrawlError{Class: class, Err: errors.New(fields.Get("Fetch-Error"))}
+}
+
+// readRecord reads the next WARC record from r
+func readRecord(r *bufio.Reader) (textproto.MIMEHeader, []byte, error) {
+	// Skip the blank lines separating records
+	var version string
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && strings.TrimSpace(line) == "" {
+			return nil, nil, io.EOF
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read WARC record: %w", err)
+		}
+		if version = strings.TrimSpace(line); version != "" {
+			break
+		}
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, nil, fmt.Errorf("invalid WARC record header %q", version)
+	}
+
+	headers, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read WARC record headers: %w", err)
+	}
+
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid WARC record length: %w", err)
+	}
+
+	block := make([]byte, length)
+	if _, err := io.ReadFull(r, block); err != nil {
+		return nil, nil, fmt.Errorf("failed to read WARC record block: %w", err)
+	}
+
+	return headers, block, nil
+}
+
+// RoundTrip answers a request from the archive without any network access
+func (a *WARCArchive) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := req.URL.String()
+
+	key := req.Method + " " + target
+	if !a.recorded(key) && req.Method == http.MethodHead {
+		key = http.MethodGet + " " + target
+	}
+	if failure, ok := a.failures[key]; ok {
+		return nil, failure
+	}
+
+	raw, ok := a.responses[key]
+	if !ok {
+		// A missing robots.txt means everything may be crawled
+		if req.URL.Path == "/robots.txt" {
+			return &http.Response{
+				Status:     "404 Not Found",
+				StatusCode: http.StatusNotFound,
+				Proto:      "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     make(http.Header),
+				Body:       http.NoBody,
+				Request:    req,
+			}, nil
+		}
+		return nil, fmt.Errorf("%w: %s %s", ErrNotArchived, req.Method, target)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse archived response for %s: %w", target, err)
+	}
+	return resp, nil
+}
+
+// newRecordID returns a random WARC record ID
+func newRecordID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// warcDate formats t as required by the WARC-Date header
+func warcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// blockDigest returns the base32 SHA-1 digest of a record block
+func blockDigest(block []byte) string {
+	sum := sha1.Sum(block)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
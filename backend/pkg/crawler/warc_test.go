@@ -0,0 +1,204 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// record sends every request through a recording transport and returns the archive
+func record(t *testing.T, requests ...*http.Request) *WARCArchive {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer, err := NewWARCWriter(&buf, "test.warc.gz")
+	if err != nil {
+		t.Fatalf("NewWARCWriter: %v", err)
+	}
+	transport := &recordingTransport{next: http.DefaultTransport, archive: writer}
+
+	for _, req := range requests {
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	archive, err := ReadWARC(&buf)
+	if err != nil {
+		t.Fatalf("ReadWARC: %v", err)
+	}
+	return archive
+}
+
+func newRequest(t *testing.T, method, url string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	return req
+}
+
+func TestWARCRoundTrip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<html><title>Recorded</title></html>")
+		case "/gone":
+			http.Error(w, "gone", http.StatusGone)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	archive := record(t,
+		newRequest(t, http.MethodGet, server.URL+"/page"),
+		newRequest(t, http.MethodGet, server.URL+"/gone"),
+	)
+
+	resp, err := archive.RoundTrip(newRequest(t, http.MethodGet, server.URL+"/page"))
+	if err != nil {
+		t.Fatalf("replay of /page: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "<html><title>Recorded</title></html>" {
+		t.Errorf("replay of /page = %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/html" {
+		t.Errorf("replayed Content-Type = %q, want text/html", got)
+	}
+
+	// HEAD falls back to the recorded GET
+	resp, err = archive.RoundTrip(newRequest(t, http.MethodHead, server.URL+"/gone"))
+	if err != nil {
+		t.Fatalf("replay of HEAD /gone: %v", err)
+	}
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("replay of HEAD /gone = %d, want %d", resp.StatusCode, http.StatusGone)
+	}
+
+	if _, err := archive.RoundTrip(newRequest(t, http.MethodGet, server.URL+"/missing")); !errors.Is(err, ErrNotArchived) {
+		t.Errorf("replay of unrecorded URL error = %v, want ErrNotArchived", err)
+	}
+
+	resp, err = archive.RoundTrip(newRequest(t, http.MethodGet, server.URL+"/robots.txt"))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("replay of unrecorded robots.txt = %v, %v, want 404", resp, err)
+	}
+}
+
+func TestWARCRecordsFailures(t *testing.T) {
+	// A listener closed right away gives an address that refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	url := "http://" + listener.Addr().String() + "/down"
+	listener.Close()
+
+	archive := record(t,
+		newRequest(t, http.MethodHead, url),
+		newRequest(t, http.MethodGet, url),
+	)
+
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		_, err := archive.RoundTrip(newRequest(t, method, url))
+		var crawlErr *CrawlError
+		if !errors.As(err, &crawlErr) {
+			t.Fatalf("replay of %s %s error = %v, want a CrawlError", method, url, err)
+		}
+		if crawlErr.Class != ErrorClassConnectionRefused {
+			t.Errorf("replay of %s %s class = %q, want %q", method, url, crawlErr.Class, ErrorClassConnectionRefused)
+		}
+		if errors.Is(err, ErrNotArchived) {
+			t.Errorf("replay of %s %s reported as not archived", method, url)
+		}
+	}
+}
+
+func TestWARCTruncatesLargeBodies(t *testing.T) {
+	size := maxRecordedBody + 1<<10
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, io.LimitReader(zeros{}, int64(size)))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	writer, err := NewWARCWriter(&buf, "test.warc.gz")
+	if err != nil {
+		t.Fatalf("NewWARCWriter: %v", err)
+	}
+	transport := &recordingTransport{next: http.DefaultTransport, archive: writer}
+
+	resp, err := transport.RoundTrip(newRequest(t, http.MethodGet, server.URL+"/large"))
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	// The caller still reads the whole body
+	n, _ := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if n != int64(size) {
+		t.Errorf("live body = %d bytes, want %d", n, size)
+	}
+
+	records, err := io.ReadAll(gzipReader(t, bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatalf("reading records: %v", err)
+	}
+	if !bytes.Contains(records, []byte("WARC-Truncated: length")) {
+		t.Error("truncated response record is not marked WARC-Truncated")
+	}
+
+	archive, err := ReadWARC(&buf)
+	if err != nil {
+		t.Fatalf("ReadWARC: %v", err)
+	}
+	resp, err = archive.RoundTrip(newRequest(t, http.MethodGet, server.URL+"/large"))
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	n, _ = io.Copy(io.Discard, resp.Body)
+	if n != maxRecordedBody {
+		t.Errorf("replayed body = %d bytes, want %d", n, maxRecordedBody)
+	}
+	if resp.ContentLength != maxRecordedBody {
+		t.Errorf("replayed Content-Length = %d, want %d", resp.ContentLength, maxRecordedBody)
+	}
+}
+
+func TestParseFailure(t *testing.T) {
+	failure := parseFailure([]byte("fetch-error-class: dns\r\nfetch-error: no such host\r\n"))
+	if failure == nil || failure.Class != ErrorClassDNS || failure.Err.Error() != "no such host" {
+		t.Errorf("parseFailure = %+v", failure)
+	}
+	if got := parseFailure([]byte("via: crawler\r\n")); got != nil {
+		t.Errorf("parseFailure of a record without an error = %+v, want nil", got)
+	}
+}
+
+func gzipReader(t *testing.T, r io.Reader) io.Reader {
+	t.Helper()
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	return zr
+}
+
+// zeros is an endless reader of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}